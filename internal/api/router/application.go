@@ -0,0 +1,98 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"recengine/internal/api/router/endpoints"
+	"recengine/internal/api/router/shards"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Router application instantiation parameters.
+type ApplicationDto struct {
+	Config *Config
+}
+
+// Router application. It serves the same REST API as a shard does, but
+// distributes the profiles among the shards.
+type Application struct {
+	router     *gin.Engine
+	httpSrv    *http.Server
+	config     *Config
+	nsEndpoint *endpoints.NamespaceEndpoint
+	pfEndpoint *endpoints.ProfileEndpoint
+}
+
+// Instantiates a new Application.
+func NewApplication(dto *ApplicationDto) (*Application, error) {
+	shardMap, err := shards.NewShardMap(dto.Config.Shards)
+	if err != nil {
+		return nil, err
+	}
+	engine := gin.Default()
+	httpSrv := &http.Server{
+		Addr:    dto.Config.GetHostPort(),
+		Handler: engine,
+	}
+	app := &Application{
+		router:     engine,
+		httpSrv:    httpSrv,
+		config:     dto.Config,
+		nsEndpoint: endpoints.NewNamespaceEndpoint(shardMap),
+		pfEndpoint: endpoints.NewProfileEndpoint(shardMap),
+	}
+	app.nsEndpoint.RegisterRoutes(engine)
+	app.pfEndpoint.RegisterRoutes(engine)
+	return app, nil
+}
+
+// Returns the HTTP handler serving the API.
+func (srv *Application) Handler() http.Handler {
+	return srv.router
+}
+
+// Starts the HTTP server in a dedicated Go routine and blocks current thread
+// execution until either an error occurs or the OS sends a signal to
+// terminate current process.
+func (srv *Application) Run() error {
+	listenError := make(chan error)
+
+	go func() {
+		if err := srv.httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			listenError <- fmt.Errorf("server listening failed: %v", err)
+		} else {
+			listenError <- nil
+		}
+		log.Println("Server stopped listening")
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-quit:
+	case err := <-listenError:
+		return err
+	}
+	log.Println("Shutdown server ...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.httpSrv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("server shutdown: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown timeout")
+	case err := <-listenError:
+		log.Println("Server exiting")
+		return err
+	}
+}
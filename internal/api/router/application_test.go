@@ -0,0 +1,263 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"recengine/internal/api/router/endpoints"
+	"recengine/internal/api/router/shards"
+	"recengine/internal/api/shard"
+	"recengine/internal/api/shard/dto"
+	"recengine/internal/domain"
+	"recengine/internal/infra/delta"
+	"recengine/internal/infra/index"
+	"recengine/internal/infra/itemindex"
+	"recengine/internal/infra/minhash"
+	"recengine/internal/infra/recdb"
+	"sort"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Starts a shard server storing its files in a temporary directory.
+func startTestShard(t *testing.T, ctx context.Context) *httptest.Server {
+	server := httptest.NewServer(newTestShardHandler(t, ctx))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Creates the handler of a shard storing its files in a temporary directory.
+func newTestShardHandler(t *testing.T, ctx context.Context) http.Handler {
+	t.Setenv("REC_PATH", t.TempDir())
+	nsService := domain.NewNamespaceService(
+		ctx,
+		delta.NewStorageFactory(),
+		recdb.NewStorageFactory(),
+		recdb.NewRatingStorageFactory(),
+		index.NewStorageFactory(),
+		itemindex.NewStorageFactory(),
+		minhash.NewStorageFactory(),
+	)
+	t.Cleanup(nsService.Stop)
+	app := shard.NewApplication(&shard.ApplicationDto{
+		Config:    &shard.Config{},
+		NsService: nsService,
+	})
+	return app.Handler()
+}
+
+// Sends a request to the server and returns the status code and the body.
+func sendTestRequest(t *testing.T, server *httptest.Server, method, path, body string) (int, []byte) {
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, data
+}
+
+func TestRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	shardServers := make([]*httptest.Server, 3)
+	urls := make([]string, len(shardServers))
+	for i := range shardServers {
+		shardServers[i] = startTestShard(t, ctx)
+		urls[i] = shardServers[i].URL
+	}
+	// A single shard having all the data to compare the results with
+	reference := startTestShard(t, ctx)
+	app, err := NewApplication(&ApplicationDto{Config: &Config{Shards: urls}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httptest.NewServer(app.Handler())
+	defer router.Close()
+
+	nsBody := `{"name":"movies","type":"like","dislikeFactor":0.5}`
+	for _, server := range []*httptest.Server{router, reference} {
+		if status, body := sendTestRequest(t, server, "POST", "/api/v1/namespaces", nsBody); status != 201 {
+			t.Fatalf("Failed to create namespace: %d %s", status, body)
+		}
+	}
+	const numUsers = 8
+	for user := uint64(1); user <= numUsers; user++ {
+		for _, item := range []uint64{user % 3, user % 5, 10 + user%2} {
+			path := fmt.Sprintf("/api/v1/namespaces/movies/profiles/%d/likes/%d", user, item)
+			for _, server := range []*httptest.Server{router, reference} {
+				if status, body := sendTestRequest(t, server, "PUT", path, ""); status != 204 {
+					t.Fatalf("Failed to like: %d %s", status, body)
+				}
+			}
+		}
+	}
+
+	t.Run("should create the namespace on every shard", func(t *testing.T) {
+		for _, server := range shardServers {
+			if status, _ := sendTestRequest(t, server, "GET", "/api/v1/namespaces/movies", ""); status != 200 {
+				t.Errorf("Shard %s has no namespace", server.URL)
+			}
+		}
+	})
+
+	t.Run("should store each profile on its owner shard only", func(t *testing.T) {
+		usedShards := make(map[int]bool)
+		for user := uint64(1); user <= numUsers; user++ {
+			owner := shards.GetShardIndex(user, len(shardServers))
+			usedShards[owner] = true
+			path := fmt.Sprintf("/api/v1/namespaces/movies/profiles/%d", user)
+			for i, server := range shardServers {
+				status, _ := sendTestRequest(t, server, "GET", path, "")
+				if i == owner && status != 200 {
+					t.Errorf("Owner shard %d doesn't have profile %d", i, user)
+				}
+				if i != owner && status != 404 {
+					t.Errorf("Shard %d has profile %d of shard %d", i, user, owner)
+				}
+			}
+		}
+		if len(usedShards) < 2 {
+			t.Errorf("The profiles are not distributed: %v", usedShards)
+		}
+	})
+
+	t.Run("should merge similar profiles of all shards", func(t *testing.T) {
+		for user := uint64(1); user <= numUsers; user++ {
+			path := fmt.Sprintf("/api/v1/namespaces/movies/profiles/%d/similar", user)
+			var expected, got []dto.SimilarProfileResponse
+			_, body := sendTestRequest(t, reference, "GET", path, "")
+			json.Unmarshal(body, &expected)
+			_, body = sendTestRequest(t, router, "GET", path, "")
+			json.Unmarshal(body, &got)
+			for _, list := range [][]dto.SimilarProfileResponse{expected, got} {
+				sort.Slice(list, func(i, j int) bool { return list[i].User < list[j].User })
+			}
+			if len(got) != len(expected) {
+				t.Fatalf("Expected %d similar profiles of %d, got %d", len(expected), user, len(got))
+			}
+			for i := range expected {
+				if got[i].User != expected[i].User || got[i].Similarity != expected[i].Similarity {
+					t.Errorf("Expected similar profile %v, got %v", expected[i], got[i])
+				}
+			}
+		}
+	})
+
+	t.Run("should recommend the same items as a single shard", func(t *testing.T) {
+		numRecommended := 0
+		for user := uint64(1); user <= numUsers; user++ {
+			path := fmt.Sprintf("/api/v1/namespaces/movies/profiles/%d/recommendations?limit=3", user)
+			var expected, got []dto.RecItemResponse
+			_, body := sendTestRequest(t, reference, "GET", path, "")
+			json.Unmarshal(body, &expected)
+			_, body = sendTestRequest(t, router, "GET", path, "")
+			json.Unmarshal(body, &got)
+			if len(got) != len(expected) {
+				t.Fatalf("Expected recommendations %v for %d, got %v", expected, user, got)
+			}
+			numRecommended += len(got)
+			for i := range expected {
+				if got[i].Item != expected[i].Item ||
+					math.Abs(float64(got[i].Relevance-expected[i].Relevance)) > 0.001 {
+					t.Errorf("Expected recommendations %v for %d, got %v", expected, user, got)
+					break
+				}
+			}
+		}
+		if numRecommended == 0 {
+			t.Error("Nothing has been recommended")
+		}
+	})
+}
+
+func TestRouterBroadcast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	urls := make([]string, 3)
+	for i := range urls[1:] {
+		urls[i+1] = startTestShard(t, ctx).URL
+	}
+	// The first shard fails internally while the failures are left
+	var failures int32
+	handler := newTestShardHandler(t, ctx)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+	urls[0] = flaky.URL
+	app, err := NewApplication(&ApplicationDto{Config: &Config{Shards: urls}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := httptest.NewServer(app.Handler())
+	defer router.Close()
+	nsBody := `{"name":"movies","type":"like","dislikeFactor":0.5}`
+
+	t.Run("should report the shards failed to apply a modification", func(t *testing.T) {
+		atomic.StoreInt32(&failures, 100)
+		status, body := sendTestRequest(t, router, "POST", "/api/v1/namespaces", nsBody)
+		atomic.StoreInt32(&failures, 0)
+		if status != http.StatusBadGateway {
+			t.Fatalf("Expected status 502, got %d %s", status, body)
+		}
+		var res endpoints.BroadcastError
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Shards) != 3 || res.Shards[0].Applied || !res.Shards[1].Applied || !res.Shards[2].Applied {
+			t.Errorf("Unexpected shard statuses: %s", body)
+		}
+		if res.Shards[0].URL != flaky.URL || res.Shards[0].StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Unexpected status of the failed shard: %v", res.Shards[0])
+		}
+	})
+
+	t.Run("should complete a repeated creation", func(t *testing.T) {
+		status, body := sendTestRequest(t, router, "POST", "/api/v1/namespaces", nsBody)
+		if status != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d %s", status, body)
+		}
+		if status, _ := sendTestRequest(t, flaky, "GET", "/api/v1/namespaces/movies", ""); status != 200 {
+			t.Errorf("The failed shard has no namespace")
+		}
+	})
+
+	t.Run("should reject creating an existing namespace", func(t *testing.T) {
+		status, body := sendTestRequest(t, router, "POST", "/api/v1/namespaces", nsBody)
+		if status != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d %s", status, body)
+		}
+	})
+
+	t.Run("should retry a shard failing temporarily", func(t *testing.T) {
+		atomic.StoreInt32(&failures, 1)
+		status, body := sendTestRequest(t, router, "DELETE", "/api/v1/namespaces/movies", "")
+		if status != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d %s", status, body)
+		}
+		if status, _ := sendTestRequest(t, flaky, "GET", "/api/v1/namespaces/movies", ""); status != 404 {
+			t.Errorf("The namespace hasn't been deleted from the failed shard")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package router
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultServerHost = "localhost"
+const defaultServerPort = 8080
+
+// Router configuration.
+type Config struct {
+	Host string
+	Port int
+	// Base URLs of the shards (e.g. "http://localhost:8081").
+	Shards []string
+}
+
+// Loads router configuration from environment variables and applies the
+// default values specified as an argument if a variable doesn't present.
+// The shards are listed in the REC_SHARDS variable separated by commas.
+// The argument may be nil.
+func NewConfigFromEnv(defaults *Config) *Config {
+	host := os.Getenv("REC_HOST")
+	if host == "" {
+		if defaults != nil {
+			host = defaults.Host
+		} else {
+			host = defaultServerHost
+		}
+	}
+	port, err := strconv.Atoi(os.Getenv("REC_PORT"))
+	if err != nil || port < 0 {
+		if defaults != nil {
+			port = defaults.Port
+		} else {
+			port = defaultServerPort
+		}
+	}
+	shards := make([]string, 0)
+	for _, url := range strings.Split(os.Getenv("REC_SHARDS"), ",") {
+		url = strings.TrimRight(strings.TrimSpace(url), "/")
+		if url != "" {
+			shards = append(shards, url)
+		}
+	}
+	if len(shards) == 0 && defaults != nil {
+		shards = defaults.Shards
+	}
+	return &Config{
+		Host:   host,
+		Port:   port,
+		Shards: shards,
+	}
+}
+
+// Returns host and port as a string joined with a colon e.g. "localhost:8080".
+func (c *Config) GetHostPort() string {
+	return c.Host + ":" + strconv.Itoa(c.Port)
+}
@@ -0,0 +1,144 @@
+package endpoints
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"recengine/internal/api/router/shards"
+	"recengine/internal/api/shard/dto"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sends the response received from a shard back to the client.
+func WriteShardResponse(ctx *gin.Context, res *shards.Response) {
+	ctx.Data(res.StatusCode, res.ContentType, res.Body)
+}
+
+// Aborts gin handler execution and sends an HTTP response describing the
+// failure of a shard in JSON format.
+func AbortWithShardError(ctx *gin.Context, err error) {
+	ctx.AbortWithStatusJSON(http.StatusBadGateway, dto.FromError(err))
+}
+
+// Forwards the request to the shard and sends its response back.
+func Forward(ctx *gin.Context, shard *shards.Client) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
+		return
+	}
+	res, err := shard.Do(ctx.Request.Method, ctx.Request.URL.RequestURI(), body)
+	if err != nil {
+		AbortWithShardError(ctx, err)
+		return
+	}
+	WriteShardResponse(ctx, res)
+}
+
+// The number of attempts to apply a broadcast modification to a shard that
+// is unavailable or fails internally.
+const broadcastAttempts = 3
+
+// The delay before the first retry, which doubles with every next one.
+var broadcastRetryDelay = 100 * time.Millisecond
+
+// The outcome of a broadcast modification on a shard.
+type ShardStatus struct {
+	URL string `json:"url"`
+	// The status code of the response or 0 if the shard is unavailable.
+	StatusCode int    `json:"status,omitempty"`
+	Applied    bool   `json:"applied"`
+	Error      string `json:"error,omitempty"`
+}
+
+// A response describing a modification applied to some shards only, so that
+// the client can retry it.
+type BroadcastError struct {
+	Message string        `json:"message"`
+	Shards  []ShardStatus `json:"shards"`
+}
+
+// Forwards the request to all the shards retrying the ones that are
+// unavailable or fail internally. A shard responding with the applied status
+// (e.g. 409 to a creation, 0 if none) is considered to have applied the
+// modification earlier, so that a failed broadcast can be safely repeated.
+// Sends back the response of the first shard if all the shards have applied
+// the modification or all of them have rejected it with the same status.
+// Otherwise responds with 502 and the status of every shard.
+func Broadcast(ctx *gin.Context, shardMap *shards.ShardMap, appliedStatus int) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
+		return
+	}
+	responses := make([]*shards.Response, len(shardMap.GetShards()))
+	errs := make([]error, len(responses))
+	shardMap.ForEach(func(i int, shard *shards.Client) error {
+		responses[i], errs[i] = doWithRetries(shard, ctx.Request.Method, ctx.Request.URL.RequestURI(), body)
+		return errs[i]
+	})
+	statuses := make([]ShardStatus, len(responses))
+	numApplied, numSucceeded := 0, 0
+	for i, shard := range shardMap.GetShards() {
+		statuses[i].URL = shard.GetURL()
+		if errs[i] != nil {
+			statuses[i].Error = errs[i].Error()
+			continue
+		}
+		statuses[i].StatusCode = responses[i].StatusCode
+		if isSuccessStatus(responses[i].StatusCode) {
+			numSucceeded++
+		} else if responses[i].StatusCode != appliedStatus {
+			statuses[i].Error = string(responses[i].Body)
+			continue
+		}
+		statuses[i].Applied = true
+		numApplied++
+	}
+	if numSucceeded > 0 && numApplied == len(responses) {
+		for _, res := range responses {
+			if isSuccessStatus(res.StatusCode) {
+				WriteShardResponse(ctx, res)
+				return
+			}
+		}
+	}
+	if numSucceeded == 0 && errs[0] == nil {
+		rejected := true
+		for i, res := range responses {
+			if errs[i] != nil || res.StatusCode != responses[0].StatusCode {
+				rejected = false
+				break
+			}
+		}
+		if rejected {
+			WriteShardResponse(ctx, responses[0])
+			return
+		}
+	}
+	ctx.AbortWithStatusJSON(http.StatusBadGateway, BroadcastError{
+		Message: fmt.Sprintf("the modification is applied to %d of %d shards", numApplied, len(responses)),
+		Shards:  statuses,
+	})
+}
+
+// Sends the request to the shard retrying it while the shard is unavailable
+// or fails internally. Returns the last response or error.
+func doWithRetries(shard *shards.Client, method, path string, body []byte) (*shards.Response, error) {
+	delay := broadcastRetryDelay
+	for attempt := 1; ; attempt++ {
+		res, err := shard.Do(method, path, body)
+		if attempt == broadcastAttempts || (err == nil && res.StatusCode < http.StatusInternalServerError) {
+			return res, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// Tells whether the status code is 2xx.
+func isSuccessStatus(statusCode int) bool {
+	return statusCode >= 200 && statusCode < 300
+}
@@ -0,0 +1,68 @@
+package endpoints
+
+import (
+	"net/http"
+	"recengine/internal/api/router/shards"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Controller for the namespace API endpoint of the router.
+// Every shard has all the namespaces, so the modifications are broadcast to
+// all the shards, while the namespaces are read from the first one.
+type NamespaceEndpoint struct {
+	shardMap *shards.ShardMap
+}
+
+// Creates a NamespaceEndpoint.
+func NewNamespaceEndpoint(shardMap *shards.ShardMap) *NamespaceEndpoint {
+	return &NamespaceEndpoint{
+		shardMap: shardMap,
+	}
+}
+
+// Registers REST API endpoints on a router.
+func (endpoint *NamespaceEndpoint) RegisterRoutes(router gin.IRouter) {
+	router.GET("/api/v1/namespaces", func(ctx *gin.Context) {
+		endpoint.Read(ctx)
+	})
+	router.POST("/api/v1/namespaces", func(ctx *gin.Context) {
+		endpoint.Create(ctx)
+	})
+	router.GET("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
+		endpoint.Read(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
+		endpoint.Modify(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
+		endpoint.Delete(ctx)
+	})
+	router.POST("/api/v1/namespaces/:namespace/compaction", func(ctx *gin.Context) {
+		endpoint.Modify(ctx)
+	})
+}
+
+// Reads namespaces from the first shard.
+func (endpoint *NamespaceEndpoint) Read(ctx *gin.Context) {
+	Forward(ctx, endpoint.shardMap.GetShards()[0])
+}
+
+// Creates the namespace on all the shards. The shards already having the
+// namespace are considered to have created it, so the creation can be
+// repeated if it has failed on some shards.
+func (endpoint *NamespaceEndpoint) Create(ctx *gin.Context) {
+	Broadcast(ctx, endpoint.shardMap, http.StatusConflict)
+}
+
+// Deletes the namespace from all the shards. The shards not having the
+// namespace are considered to have deleted it, so the deletion can be
+// repeated if it has failed on some shards.
+func (endpoint *NamespaceEndpoint) Delete(ctx *gin.Context) {
+	Broadcast(ctx, endpoint.shardMap, http.StatusNotFound)
+}
+
+// Applies the modification to the namespaces of all the shards.
+func (endpoint *NamespaceEndpoint) Modify(ctx *gin.Context) {
+	Broadcast(ctx, endpoint.shardMap, 0)
+}
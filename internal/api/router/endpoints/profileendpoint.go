@@ -0,0 +1,218 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"recengine/internal/api/router/shards"
+	"recengine/internal/api/shard/dto"
+	shardendpoints "recengine/internal/api/shard/endpoints"
+	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Controller for the profile API endpoint of the router.
+// The profiles are modified on the shards owning them, while the similarity
+// queries are scattered across all the shards.
+type ProfileEndpoint struct {
+	shardMap *shards.ShardMap
+}
+
+// Creates a ProfileEndpoint.
+func NewProfileEndpoint(shardMap *shards.ShardMap) *ProfileEndpoint {
+	return &ProfileEndpoint{
+		shardMap: shardMap,
+	}
+}
+
+// Registers REST API endpoints on a router.
+func (endpoint *ProfileEndpoint) RegisterRoutes(router gin.IRouter) {
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user/recommendations", func(ctx *gin.Context) {
+		endpoint.Recommend(ctx)
+	})
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user/similar", func(ctx *gin.Context) {
+		endpoint.Similar(ctx)
+	})
+	router.POST("/api/v1/namespaces/:namespace/similar", func(ctx *gin.Context) {
+		endpoint.SimilarTo(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/likes/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/likes/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/dislikes/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/dislikes/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/ratings/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/ratings/:item", func(ctx *gin.Context) {
+		endpoint.ForwardToOwner(ctx)
+	})
+}
+
+// Forwards the request to the shard owning the profile of the user.
+func (endpoint *ProfileEndpoint) ForwardToOwner(ctx *gin.Context) {
+	user, ok := shardendpoints.ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	Forward(ctx, endpoint.shardMap.GetShardByUser(user))
+}
+
+// Returns the items recommended to the user based on the most similar
+// profiles of all the shards.
+func (endpoint *ProfileEndpoint) Recommend(ctx *gin.Context) {
+	profile, similarProfiles, options := endpoint.querySimilarProfiles(ctx)
+	if options == nil {
+		return
+	}
+	items := make([]domain.RecItem, 0)
+	if profile != nil {
+		items = options.ApplyToRecItems(domain.RecommendItems(profile, similarProfiles))
+	}
+	ctx.IndentedJSON(http.StatusOK, dto.MakeRecItemResponseArray(items))
+}
+
+// Returns the profiles of all the shards most similar to the profile of the
+// user.
+func (endpoint *ProfileEndpoint) Similar(ctx *gin.Context) {
+	_, similarProfiles, options := endpoint.querySimilarProfiles(ctx)
+	if options == nil {
+		return
+	}
+	similarProfiles = options.ApplyToSimilarProfiles(similarProfiles)
+	ctx.IndentedJSON(http.StatusOK, dto.MakeSimilarProfileResponseArray(similarProfiles))
+}
+
+// Returns the profiles of all the shards most similar to the given one.
+func (endpoint *ProfileEndpoint) SimilarTo(ctx *gin.Context) {
+	var req dto.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		shardendpoints.AbortWithBindingErrors(ctx, err)
+		return
+	}
+	var profileReq dto.ProfileRequest
+	if err := ctx.ShouldBindJSON(&profileReq); err != nil {
+		shardendpoints.AbortWithBindingErrors(ctx, err)
+		return
+	}
+	profile := profileReq.ToDomain()
+	namespace := ctx.Param("namespace")
+	ns := endpoint.getNamespace(ctx, endpoint.shardMap.GetShardByUser(profile.UserID))
+	if ns == nil {
+		return
+	}
+	similarProfiles, err := endpoint.scatter(namespace, ns.MaxSimilarProfiles, profile)
+	if err != nil {
+		AbortWithShardError(ctx, err)
+		return
+	}
+	similarProfiles = req.ToDomain().ApplyToSimilarProfiles(similarProfiles)
+	ctx.IndentedJSON(http.StatusOK, dto.MakeSimilarProfileResponseArray(similarProfiles))
+}
+
+// Reads the profile of the user from the owning shard and finds the most
+// similar profiles across all the shards. The profile is nil if it doesn't
+// exist. The returned options are nil if the request has failed.
+func (endpoint *ProfileEndpoint) querySimilarProfiles(
+	ctx *gin.Context,
+) (*domain.Profile, []domain.SimilarProfile, *domain.ListOptions) {
+	user, ok := shardendpoints.ParseIDParam(ctx, "user")
+	if !ok {
+		return nil, nil, nil
+	}
+	var req dto.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		shardendpoints.AbortWithBindingErrors(ctx, err)
+		return nil, nil, nil
+	}
+	namespace := ctx.Param("namespace")
+	owner := endpoint.shardMap.GetShardByUser(user)
+	ns := endpoint.getNamespace(ctx, owner)
+	if ns == nil {
+		return nil, nil, nil
+	}
+	profile, err := owner.GetProfile(namespace, user)
+	if err != nil {
+		AbortWithShardError(ctx, err)
+		return nil, nil, nil
+	}
+	if profile == nil {
+		return nil, []domain.SimilarProfile{}, req.ToDomain()
+	}
+	similarProfiles, err := endpoint.scatter(namespace, ns.MaxSimilarProfiles, profile)
+	if err != nil {
+		AbortWithShardError(ctx, err)
+		return nil, nil, nil
+	}
+	return profile, similarProfiles, req.ToDomain()
+}
+
+// Returns the namespace read from the shard. If there is no such namespace or
+// the similarity queries cannot be scattered across the shards for its type,
+// aborts gin handler execution and returns nil.
+func (endpoint *ProfileEndpoint) getNamespace(
+	ctx *gin.Context,
+	shard *shards.Client,
+) *dto.NamespaceResponse {
+	ns, err := shard.GetNamespace(ctx.Param("namespace"))
+	if err != nil {
+		var resErr *shards.ResponseError
+		if errors.As(err, &resErr) && resErr.StatusCode == http.StatusBadRequest {
+			ctx.Data(resErr.StatusCode, "application/json; charset=utf-8", resErr.Body)
+			ctx.Abort()
+			return nil
+		}
+		AbortWithShardError(ctx, err)
+		return nil
+	}
+	if ns == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, dto.Error{Message: "namespace not found"})
+		return nil
+	}
+	if ns.Type != valueobjects.NamespaceTypeLike {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.Error{
+			Message: "similarity queries aren't supported by the router for " + ns.Type + " namespaces",
+		})
+		return nil
+	}
+	return ns
+}
+
+// Sends the profile to all the shards and merges the most similar profiles
+// they return keeping at most `limit` profiles.
+func (endpoint *ProfileEndpoint) scatter(
+	namespace string,
+	limit uint,
+	profile *domain.Profile,
+) ([]domain.SimilarProfile, error) {
+	results := make([][]domain.SimilarProfile, len(endpoint.shardMap.GetShards()))
+	err := endpoint.shardMap.ForEach(func(i int, shard *shards.Client) error {
+		var err error
+		results[i], err = shard.GetSimilarProfilesTo(namespace, profile)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	collector := domain.NewSimilarProfileCollector(limit)
+	for _, similarProfiles := range results {
+		for _, similar := range similarProfiles {
+			collector.Add(similar.Profile, similar.Similarity)
+		}
+	}
+	return collector.GetProfiles(), nil
+}
@@ -0,0 +1,158 @@
+package shards
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"recengine/internal/api/shard/dto"
+	"recengine/internal/domain"
+	"strconv"
+	"time"
+)
+
+// An error response received from a shard.
+type ResponseError struct {
+	URL        string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("shard %s responded with status %d: %s", e.URL, e.StatusCode, e.Body)
+}
+
+// A response received from a shard.
+type Response struct {
+	StatusCode  int
+	ContentType string
+	Body        []byte
+}
+
+// Calls the REST API of a shard.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Creates a client of the shard listening at the base URL
+// (e.g. "http://localhost:8080").
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Returns the base URL of the shard.
+func (c *Client) GetURL() string {
+	return c.baseURL
+}
+
+// Sends a request to the shard. The path must include the query string if
+// any. The body may be nil.
+func (c *Client) Do(method string, path string, body []byte) (*Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("shard %s is unavailable: %v", c.baseURL, err)
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response of shard %s: %v", c.baseURL, err)
+	}
+	return &Response{
+		StatusCode:  res.StatusCode,
+		ContentType: res.Header.Get("Content-Type"),
+		Body:        resBody,
+	}, nil
+}
+
+// Sends a request to the shard and decodes the JSON response into the result.
+// Returns false if the shard responds with 404.
+func (c *Client) doJSON(method string, path string, body any, result any) (bool, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return false, err
+		}
+	}
+	res, err := c.Do(method, path, data)
+	if err != nil {
+		return false, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return false, &ResponseError{c.baseURL, res.StatusCode, res.Body}
+	}
+	if err := json.Unmarshal(res.Body, result); err != nil {
+		return false, fmt.Errorf("failed to decode response of shard %s: %v", c.baseURL, err)
+	}
+	return true, nil
+}
+
+// Returns the namespace or nil if the shard doesn't have it.
+func (c *Client) GetNamespace(namespace string) (*dto.NamespaceResponse, error) {
+	var ns dto.NamespaceResponse
+	found, err := c.doJSON(http.MethodGet, "/api/v1/namespaces/"+url.PathEscape(namespace), nil, &ns)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &ns, nil
+}
+
+// Returns the profile of the user or nil if the shard doesn't have it.
+func (c *Client) GetProfile(namespace string, user uint64) (*domain.Profile, error) {
+	var profile dto.ProfileResponse
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) +
+		"/profiles/" + strconv.FormatUint(user, 10)
+	found, err := c.doJSON(http.MethodGet, path, nil, &profile)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &domain.Profile{
+		UserID:   profile.User,
+		Likes:    profile.Likes,
+		Dislikes: profile.Dislikes,
+	}, nil
+}
+
+// Returns the profiles stored in the shard that are the most similar to the
+// given one.
+func (c *Client) GetSimilarProfilesTo(
+	namespace string,
+	profile *domain.Profile,
+) ([]domain.SimilarProfile, error) {
+	var responses []dto.SimilarProfileResponse
+	req := dto.ProfileRequest{
+		User:     profile.UserID,
+		Likes:    profile.Likes,
+		Dislikes: profile.Dislikes,
+	}
+	path := "/api/v1/namespaces/" + url.PathEscape(namespace) + "/similar"
+	found, err := c.doJSON(http.MethodPost, path, &req, &responses)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &ResponseError{c.baseURL, http.StatusNotFound, []byte("namespace not found")}
+	}
+	profiles := make([]domain.SimilarProfile, len(responses))
+	for i := range responses {
+		profiles[i] = responses[i].ToDomain()
+	}
+	return profiles, nil
+}
@@ -0,0 +1,67 @@
+package shards
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+// Maps users to the shards owning their profiles.
+type ShardMap struct {
+	shards []*Client
+}
+
+// Creates a shard map of the shards listening at the base URLs. The order of
+// the URLs determines the owners of the profiles, so it must not be changed
+// once the shards have got any data.
+func NewShardMap(urls []string) (*ShardMap, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no shards specified")
+	}
+	shards := make([]*Client, len(urls))
+	for i, url := range urls {
+		shards[i] = NewClient(url)
+	}
+	return &ShardMap{shards: shards}, nil
+}
+
+// Returns all the shards.
+func (m *ShardMap) GetShards() []*Client {
+	return m.shards
+}
+
+// Returns the shard owning the profile of the user.
+func (m *ShardMap) GetShardByUser(user uint64) *Client {
+	return m.shards[GetShardIndex(user, len(m.shards))]
+}
+
+// Returns the index of the shard owning the profile of the user.
+func GetShardIndex(user uint64, numShards int) int {
+	var buffer [8]byte
+	binary.BigEndian.PutUint64(buffer[:], user)
+	hash := fnv.New64a()
+	hash.Write(buffer[:])
+	return int(hash.Sum64() % uint64(numShards))
+}
+
+// Calls the function for each shard concurrently and waits for all of them
+// to return. Returns the first error occurred.
+func (m *ShardMap) ForEach(fn func(i int, shard *Client) error) error {
+	errs := make([]error, len(m.shards))
+	var wg sync.WaitGroup
+	for i, shard := range m.shards {
+		wg.Add(1)
+		go func(i int, shard *Client) {
+			defer wg.Done()
+			errs[i] = fn(i, shard)
+		}(i, shard)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
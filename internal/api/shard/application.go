@@ -27,6 +27,7 @@ type Application struct {
 	httpSrv    *http.Server
 	config     *Config
 	nsEndpoint *endpoints.NamespaceEndpoint
+	pfEndpoint *endpoints.ProfileEndpoint
 }
 
 // Instantiates a new Application.
@@ -41,11 +42,18 @@ func NewApplication(dto *ApplicationDto) *Application {
 		httpSrv:    httpSrv,
 		config:     dto.Config,
 		nsEndpoint: endpoints.NewNamespaceEndpoint(dto.NsService),
+		pfEndpoint: endpoints.NewProfileEndpoint(dto.NsService),
 	}
 	app.nsEndpoint.RegisterRoutes(engine)
+	app.pfEndpoint.RegisterRoutes(engine)
 	return app
 }
 
+// Returns the HTTP handler serving the API.
+func (srv *Application) Handler() http.Handler {
+	return srv.router
+}
+
 // Starts the HTTP server in a dedicated Go routine and blocks current thread
 // execution until either an error occurs or the OS sends a signal to
 // terminate current process.
@@ -63,7 +71,7 @@ func (srv *Application) Run() error {
 
 	// Wait for interrupt signal to gracefully shutdown the server with
 	// a timeout of 5 seconds.
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	// kill (no param) default send syscanll.SIGTERM
 	// kill -2 is syscall.SIGINT
 	// kill -9 is syscall. SIGKILL but can"t be catch, so don't need add it
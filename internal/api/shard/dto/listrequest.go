@@ -0,0 +1,21 @@
+package dto
+
+import "recengine/internal/domain"
+
+// A DTO of the query parameters of the requests returning recommended items
+// or similar profiles.
+type ListRequest struct {
+	Limit        uint     `form:"limit" binding:"omitempty,min=1"`
+	Offset       uint     `form:"offset"`
+	MinRelevance float32  `form:"minRelevance" binding:"omitempty,min=0"`
+	Exclude      []uint64 `form:"exclude"`
+}
+
+func (dto *ListRequest) ToDomain() *domain.ListOptions {
+	return &domain.ListOptions{
+		Limit:        dto.Limit,
+		Offset:       dto.Offset,
+		MinRelevance: dto.MinRelevance,
+		Exclude:      dto.Exclude,
+	}
+}
@@ -8,9 +8,12 @@ import (
 // A DTO for creating a Namespace.
 type NamespaceCreateRequest struct {
 	Name               string  `json:"name" binding:"required,lowercase,alphanum"`
-	Type               string  `json:"type" binding:"required,oneof=like"`
+	Type               string  `json:"type" binding:"required,oneof=like rating"`
 	MaxSimilarProfiles uint    `json:"maxSimilarProfiles" binding:"omitempty,min=1"`
-	DislikeFactor      float32 `json:"dislikeFactor" binding:"required,min=0,max=1"`
+	DislikeFactor      float32 `json:"dislikeFactor" binding:"required_if=Type like,min=0,max=1"`
+	SimilarityMetric   string  `json:"similarityMetric" binding:"omitempty,oneof=jaccard cosine dice overlap llr conflict pearson"`
+	SearchMode         string  `json:"searchMode" binding:"omitempty,oneof=exact approximate"`
+	Durability         string  `json:"durability"`
 }
 
 func (dto *NamespaceCreateRequest) ToDomain() (*domain.NamespaceCreateRequest, error) {
@@ -23,6 +26,18 @@ func (dto *NamespaceCreateRequest) ToDomain() (*domain.NamespaceCreateRequest, e
 	if err != nil {
 		ve = AddValidationErrorField(ve, "type", err)
 	}
+	metric, err := valueobjects.ParseSimilarityMetric(dto.SimilarityMetric)
+	if err != nil {
+		ve = AddValidationErrorField(ve, "similarityMetric", err)
+	}
+	searchMode, err := valueobjects.ParseSearchMode(dto.SearchMode)
+	if err != nil {
+		ve = AddValidationErrorField(ve, "searchMode", err)
+	}
+	durability, err := valueobjects.ParseDurability(dto.Durability)
+	if err != nil {
+		ve = AddValidationErrorField(ve, "durability", err)
+	}
 	if ve != nil {
 		return nil, ve
 	}
@@ -31,6 +46,9 @@ func (dto *NamespaceCreateRequest) ToDomain() (*domain.NamespaceCreateRequest, e
 		Type:               domainType,
 		MaxSimilarProfiles: dto.MaxSimilarProfiles,
 		DislikeFactor:      dto.DislikeFactor,
+		SimilarityMetric:   metric,
+		SearchMode:         searchMode,
+		Durability:         durability,
 	}
 	return domainDto, nil
 }
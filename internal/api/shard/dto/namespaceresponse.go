@@ -1,11 +1,19 @@
 package dto
 
-import "recengine/internal/domain"
+import (
+	"recengine/internal/domain"
+	"time"
+)
 
 type NamespaceResponse struct {
-	Name               string `json:"name"`
-	Type               string `json:"type"`
-	MaxSimilarProfiles uint   `json:"maxSimilarProfiles"`
+	Name               string    `json:"name"`
+	Type               string    `json:"type"`
+	MaxSimilarProfiles uint      `json:"maxSimilarProfiles"`
+	DislikeFactor      float32   `json:"dislikeFactor"`
+	SimilarityMetric   string    `json:"similarityMetric,omitempty"`
+	SearchMode         string    `json:"searchMode,omitempty"`
+	Durability         string    `json:"durability,omitempty"`
+	Created            time.Time `json:"created"`
 }
 
 func NewNamespaceResponse(ns domain.Namespace) *NamespaceResponse {
@@ -13,6 +21,11 @@ func NewNamespaceResponse(ns domain.Namespace) *NamespaceResponse {
 		Name:               ns.GetName().Value(),
 		Type:               ns.GetType().Value(),
 		MaxSimilarProfiles: ns.GetMaxSimilarProfiles(),
+		DislikeFactor:      ns.GetDislikeFactor(),
+		SimilarityMetric:   ns.GetSimilarityMetric().Value(),
+		SearchMode:         ns.GetSearchMode().Value(),
+		Durability:         ns.GetDurability().Value(),
+		Created:            ns.GetCreated(),
 	}
 }
 
@@ -0,0 +1,21 @@
+package dto
+
+import "recengine/internal/domain"
+
+// A DTO of a profile passed in a request body.
+type ProfileRequest struct {
+	User     uint64   `json:"user"`
+	Likes    []uint64 `json:"likes"`
+	Dislikes []uint64 `json:"dislikes"`
+}
+
+func (dto *ProfileRequest) ToDomain() *domain.Profile {
+	profile := domain.NewProfile(dto.User)
+	for _, item := range dto.Dislikes {
+		profile.Dislike(item)
+	}
+	for _, item := range dto.Likes {
+		profile.Like(item)
+	}
+	return profile
+}
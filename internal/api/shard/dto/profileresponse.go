@@ -0,0 +1,17 @@
+package dto
+
+import "recengine/internal/domain"
+
+type ProfileResponse struct {
+	User     uint64   `json:"user"`
+	Likes    []uint64 `json:"likes"`
+	Dislikes []uint64 `json:"dislikes"`
+}
+
+func NewProfileResponse(profile *domain.Profile) *ProfileResponse {
+	return &ProfileResponse{
+		User:     profile.UserID,
+		Likes:    profile.Likes,
+		Dislikes: profile.Dislikes,
+	}
+}
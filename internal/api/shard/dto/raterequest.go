@@ -0,0 +1,6 @@
+package dto
+
+// A DTO for rating an item.
+type RateRequest struct {
+	Score *float32 `json:"score" binding:"required,min=1,max=5"`
+}
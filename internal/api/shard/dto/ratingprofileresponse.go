@@ -0,0 +1,31 @@
+package dto
+
+import "recengine/internal/domain"
+
+type ItemRatingResponse struct {
+	Item  uint64  `json:"item"`
+	Score float32 `json:"score"`
+}
+
+type RatingProfileResponse struct {
+	User    uint64               `json:"user"`
+	Ratings []ItemRatingResponse `json:"ratings"`
+}
+
+func MakeItemRatingResponseArray(ratings []domain.ItemRating) []ItemRatingResponse {
+	responses := make([]ItemRatingResponse, len(ratings))
+	for i := range ratings {
+		responses[i] = ItemRatingResponse{
+			Item:  ratings[i].ItemID,
+			Score: ratings[i].Score,
+		}
+	}
+	return responses
+}
+
+func NewRatingProfileResponse(profile *domain.RatingProfile) *RatingProfileResponse {
+	return &RatingProfileResponse{
+		User:    profile.UserID,
+		Ratings: MakeItemRatingResponseArray(profile.Ratings),
+	}
+}
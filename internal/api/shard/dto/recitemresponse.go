@@ -0,0 +1,19 @@
+package dto
+
+import "recengine/internal/domain"
+
+type RecItemResponse struct {
+	Item      uint64  `json:"item"`
+	Relevance float32 `json:"relevance"`
+}
+
+func MakeRecItemResponseArray(items []domain.RecItem) []RecItemResponse {
+	responses := make([]RecItemResponse, len(items))
+	for i := range items {
+		responses[i] = RecItemResponse{
+			Item:      items[i].ItemID,
+			Relevance: items[i].Relevance,
+		}
+	}
+	return responses
+}
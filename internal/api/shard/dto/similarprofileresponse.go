@@ -0,0 +1,34 @@
+package dto
+
+import "recengine/internal/domain"
+
+type SimilarProfileResponse struct {
+	User       uint64   `json:"user"`
+	Similarity float32  `json:"similarity"`
+	Likes      []uint64 `json:"likes"`
+	Dislikes   []uint64 `json:"dislikes"`
+}
+
+func MakeSimilarProfileResponseArray(profiles []domain.SimilarProfile) []SimilarProfileResponse {
+	responses := make([]SimilarProfileResponse, len(profiles))
+	for i := range profiles {
+		responses[i] = SimilarProfileResponse{
+			User:       profiles[i].Profile.UserID,
+			Similarity: profiles[i].Similarity,
+			Likes:      profiles[i].Profile.Likes,
+			Dislikes:   profiles[i].Profile.Dislikes,
+		}
+	}
+	return responses
+}
+
+func (dto *SimilarProfileResponse) ToDomain() domain.SimilarProfile {
+	return domain.SimilarProfile{
+		Profile: &domain.Profile{
+			UserID:   dto.User,
+			Likes:    dto.Likes,
+			Dislikes: dto.Dislikes,
+		},
+		Similarity: dto.Similarity,
+	}
+}
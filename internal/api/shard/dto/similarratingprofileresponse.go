@@ -0,0 +1,23 @@
+package dto
+
+import "recengine/internal/domain"
+
+type SimilarRatingProfileResponse struct {
+	User       uint64               `json:"user"`
+	Similarity float32              `json:"similarity"`
+	Ratings    []ItemRatingResponse `json:"ratings"`
+}
+
+func MakeSimilarRatingProfileResponseArray(
+	profiles []domain.SimilarRatingProfile,
+) []SimilarRatingProfileResponse {
+	responses := make([]SimilarRatingProfileResponse, len(profiles))
+	for i := range profiles {
+		responses[i] = SimilarRatingProfileResponse{
+			User:       profiles[i].Profile.UserID,
+			Similarity: profiles[i].Similarity,
+			Ratings:    MakeItemRatingResponseArray(profiles[i].Profile.Ratings),
+		}
+	}
+	return responses
+}
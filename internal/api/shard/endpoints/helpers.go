@@ -4,6 +4,7 @@ import (
 	"errors"
 	"net/http"
 	"recengine/internal/api/shard/dto"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -12,12 +13,18 @@ import (
 // Converts validator's FieldError to a message string.
 func getFieldErrorMsg(fieldError validator.FieldError) string {
 	switch fieldError.Tag() {
-	case "required":
+	case "required", "required_if":
 		return "This field is required"
+	case "oneof":
+		return "Should be one of: " + fieldError.Param()
 	case "lte":
 		return "Should be less than " + fieldError.Param()
 	case "gte":
 		return "Should be greater than " + fieldError.Param()
+	case "min":
+		return "Should be at least " + fieldError.Param()
+	case "max":
+		return "Should be at most " + fieldError.Param()
 	}
 	return "Unknown error"
 }
@@ -60,3 +67,15 @@ func AbortWithValidationError(ctx *gin.Context, err error) {
 		"message": err.Error(),
 	})
 }
+
+// Parses a user or item ID path parameter. If the parameter isn't a valid ID,
+// aborts gin handler execution sending an HTTP response containing the error
+// description in JSON format and returns false.
+func ParseIDParam(ctx *gin.Context, param string) (uint64, bool) {
+	id, err := strconv.ParseUint(ctx.Param(param), 10, 64)
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.Error{Message: "invalid " + param + " ID"})
+		return 0, false
+	}
+	return id, true
+}
@@ -1,6 +1,7 @@
 package endpoints
 
 import (
+	"errors"
 	"net/http"
 	"recengine/internal/api/shard/dto"
 	"recengine/internal/domain"
@@ -29,12 +30,18 @@ func (endpoint *NamespaceEndpoint) RegisterRoutes(router gin.IRouter) {
 	router.POST("/api/v1/namespaces", func(ctx *gin.Context) {
 		endpoint.Create(ctx)
 	})
-	router.GET("/api/v1/namespaces/:domain", func(ctx *gin.Context) {
+	router.GET("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
 		endpoint.Get(ctx)
 	})
-	router.PUT("/api/v1/namespaces/:domain", func(ctx *gin.Context) {
+	router.PUT("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
 		endpoint.Update(ctx)
 	})
+	router.DELETE("/api/v1/namespaces/:namespace", func(ctx *gin.Context) {
+		endpoint.Delete(ctx)
+	})
+	router.POST("/api/v1/namespaces/:namespace/compaction", func(ctx *gin.Context) {
+		endpoint.Compact(ctx)
+	})
 }
 
 // @Summary      Creates a namespace.
@@ -44,6 +51,7 @@ func (endpoint *NamespaceEndpoint) RegisterRoutes(router gin.IRouter) {
 // @Param        body body dto.NamespaceCreateRequest true "NamespaceCreateRequest"
 // @Success      200  {object}  dto.NamespaceResponse
 // @Failure      400  {object}  dto.ValidationError
+// @Failure      409  {object}  dto.Error
 // @Router       /api/v1/namespaces [post]
 func (endpoint *NamespaceEndpoint) Create(ctx *gin.Context) {
 	var req dto.NamespaceCreateRequest
@@ -57,6 +65,10 @@ func (endpoint *NamespaceEndpoint) Create(ctx *gin.Context) {
 		return
 	}
 	ns, err := endpoint.nsService.CreateNamespace(domainDto)
+	if errors.Is(err, domain.ErrNamespaceNameTaken) {
+		ctx.AbortWithStatusJSON(http.StatusConflict, dto.FromError(err))
+		return
+	}
 	if err != nil {
 		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
 		return
@@ -143,3 +155,58 @@ func (endpoint *NamespaceEndpoint) Update(ctx *gin.Context) {
 	}
 	ctx.IndentedJSON(http.StatusOK, dto.NewNamespaceResponse(ns))
 }
+
+// @Summary      Deletes a namespace along with its data.
+// @Tags         Namespace
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name} [delete]
+func (endpoint *NamespaceEndpoint) Delete(ctx *gin.Context) {
+	name, err := valueobjects.ParseNamespaceName(ctx.Param("namespace"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
+		return
+	}
+	if endpoint.nsService.GetNamespaceByName(name) == nil {
+		ctx.IndentedJSON(http.StatusNotFound, dto.Error{Message: "namespace not found"})
+		return
+	}
+	if err := endpoint.nsService.DeleteNamespace(name); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary      Applies the accumulated changes to the namespace database.
+// @Tags         Namespace
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/compaction [post]
+func (endpoint *NamespaceEndpoint) Compact(ctx *gin.Context) {
+	name, err := valueobjects.ParseNamespaceName(ctx.Param("namespace"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
+		return
+	}
+	ns := endpoint.nsService.GetNamespaceByName(name)
+	if ns == nil {
+		ctx.IndentedJSON(http.StatusNotFound, dto.Error{Message: "namespace not found"})
+		return
+	}
+	if err := ns.Compact(); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,494 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"recengine/internal/api/shard/dto"
+	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Controller for the profile API endpoint.
+type ProfileEndpoint struct {
+	nsService *domain.NamespaceService
+}
+
+// Creates a ProfileEndpoint.
+func NewProfileEndpoint(nsService *domain.NamespaceService) *ProfileEndpoint {
+	return &ProfileEndpoint{
+		nsService: nsService,
+	}
+}
+
+// Registers REST API endpoints on a router.
+func (endpoint *ProfileEndpoint) RegisterRoutes(router gin.IRouter) {
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user", func(ctx *gin.Context) {
+		endpoint.Get(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user", func(ctx *gin.Context) {
+		endpoint.Delete(ctx)
+	})
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user/recommendations", func(ctx *gin.Context) {
+		endpoint.Recommend(ctx)
+	})
+	router.GET("/api/v1/namespaces/:namespace/profiles/:user/similar", func(ctx *gin.Context) {
+		endpoint.Similar(ctx)
+	})
+	router.POST("/api/v1/namespaces/:namespace/similar", func(ctx *gin.Context) {
+		endpoint.SimilarTo(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/likes/:item", func(ctx *gin.Context) {
+		endpoint.Like(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/likes/:item", func(ctx *gin.Context) {
+		endpoint.DeleteLike(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/dislikes/:item", func(ctx *gin.Context) {
+		endpoint.Dislike(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/dislikes/:item", func(ctx *gin.Context) {
+		endpoint.DeleteDislike(ctx)
+	})
+	router.PUT("/api/v1/namespaces/:namespace/profiles/:user/ratings/:item", func(ctx *gin.Context) {
+		endpoint.Rate(ctx)
+	})
+	router.DELETE("/api/v1/namespaces/:namespace/profiles/:user/ratings/:item", func(ctx *gin.Context) {
+		endpoint.DeleteRating(ctx)
+	})
+}
+
+// Returns the namespace specified in the request path. If there is no such
+// namespace, aborts gin handler execution and returns nil.
+func (endpoint *ProfileEndpoint) getNamespace(ctx *gin.Context) domain.Namespace {
+	name, err := valueobjects.ParseNamespaceName(ctx.Param("namespace"))
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.FromError(err))
+		return nil
+	}
+	ns := endpoint.nsService.GetNamespaceByName(name)
+	if ns == nil {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, dto.Error{Message: "namespace not found"})
+		return nil
+	}
+	return ns
+}
+
+// Returns the like namespace specified in the request path. If there is no
+// such namespace, aborts gin handler execution and returns nil.
+func (endpoint *ProfileEndpoint) getLikeNamespace(ctx *gin.Context) domain.LikeNamespace {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return nil
+	}
+	likeNs, ok := ns.(domain.LikeNamespace)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.Error{Message: "namespace doesn't store likes"})
+		return nil
+	}
+	return likeNs
+}
+
+// Returns the rating namespace specified in the request path. If there is no
+// such namespace, aborts gin handler execution and returns nil.
+func (endpoint *ProfileEndpoint) getRatingNamespace(ctx *gin.Context) domain.RatingNamespace {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return nil
+	}
+	ratingNs, ok := ns.(domain.RatingNamespace)
+	if !ok {
+		ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.Error{Message: "namespace doesn't store ratings"})
+		return nil
+	}
+	return ratingNs
+}
+
+// @Summary      Returns a user profile.
+// @Description  The profiles of rating namespaces are dto.RatingProfileResponse.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Success      200  {object}  dto.ProfileResponse
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user} [get]
+func (endpoint *ProfileEndpoint) Get(ctx *gin.Context) {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	var response any
+	var err error
+	switch ns := ns.(type) {
+	case domain.LikeNamespace:
+		var profile *domain.Profile
+		if profile, err = ns.GetProfile(user); profile != nil {
+			response = dto.NewProfileResponse(profile)
+		}
+	case domain.RatingNamespace:
+		var profile *domain.RatingProfile
+		if profile, err = ns.GetProfile(user); profile != nil {
+			response = dto.NewRatingProfileResponse(profile)
+		}
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	if response == nil {
+		ctx.IndentedJSON(http.StatusNotFound, dto.Error{Message: "profile not found"})
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// @Summary      Deletes a user profile.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user} [delete]
+func (endpoint *ProfileEndpoint) Delete(ctx *gin.Context) {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	var err error
+	switch ns := ns.(type) {
+	case domain.LikeNamespace:
+		err = ns.DeleteProfile(user)
+	case domain.RatingNamespace:
+		err = ns.DeleteProfile(user)
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary      Returns the items recommended to a user.
+// @Description  The relevance of the items of rating namespaces is their predicted score.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        limit query integer false "Maximum number of items"
+// @Param        offset query integer false "Number of items to skip"
+// @Param        minRelevance query number false "Minimum relevance of the items (0-100)"
+// @Param        exclude query []integer false "IDs of the items to leave out" collectionFormat(multi)
+// @Success      200  {array}   dto.RecItemResponse
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.ValidationError
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/recommendations [get]
+func (endpoint *ProfileEndpoint) Recommend(ctx *gin.Context) {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	var req dto.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		AbortWithBindingErrors(ctx, err)
+		return
+	}
+	var items *[]domain.RecItem
+	var err error
+	switch ns := ns.(type) {
+	case domain.LikeNamespace:
+		items, err = ns.RecommendItems(user, req.ToDomain())
+	case domain.RatingNamespace:
+		items, err = ns.RecommendItems(user, req.ToDomain())
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, dto.MakeRecItemResponseArray(*items))
+}
+
+// @Summary      Returns the profiles most similar to the profile of a user.
+// @Description  The profiles of rating namespaces are dto.SimilarRatingProfileResponse.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        limit query integer false "Maximum number of profiles"
+// @Param        offset query integer false "Number of profiles to skip"
+// @Param        minRelevance query number false "Minimum similarity of the profiles (0-100)"
+// @Param        exclude query []integer false "IDs of the users to leave out" collectionFormat(multi)
+// @Success      200  {array}   dto.SimilarProfileResponse
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.ValidationError
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/similar [get]
+func (endpoint *ProfileEndpoint) Similar(ctx *gin.Context) {
+	ns := endpoint.getNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	var req dto.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		AbortWithBindingErrors(ctx, err)
+		return
+	}
+	var response any
+	var err error
+	switch ns := ns.(type) {
+	case domain.LikeNamespace:
+		var profiles *[]domain.SimilarProfile
+		if profiles, err = ns.GetSimilarProfiles(user, req.ToDomain()); err == nil {
+			response = dto.MakeSimilarProfileResponseArray(*profiles)
+		}
+	case domain.RatingNamespace:
+		var profiles *[]domain.SimilarRatingProfile
+		if profiles, err = ns.GetSimilarProfiles(user, req.ToDomain()); err == nil {
+			response = dto.MakeSimilarRatingProfileResponseArray(*profiles)
+		}
+	}
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, response)
+}
+
+// @Summary      Returns the profiles most similar to the given one.
+// @Description  The profile doesn't have to be stored in the namespace.
+// @Description  It's used to scatter similarity queries across shards.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        body body dto.ProfileRequest true "ProfileRequest"
+// @Param        limit query integer false "Maximum number of profiles"
+// @Param        offset query integer false "Number of profiles to skip"
+// @Param        minRelevance query number false "Minimum similarity of the profiles (0-100)"
+// @Param        exclude query []integer false "IDs of the users to leave out" collectionFormat(multi)
+// @Success      200  {array}   dto.SimilarProfileResponse
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.ValidationError
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/similar [post]
+func (endpoint *ProfileEndpoint) SimilarTo(ctx *gin.Context) {
+	ns := endpoint.getLikeNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	var req dto.ListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		AbortWithBindingErrors(ctx, err)
+		return
+	}
+	var profileReq dto.ProfileRequest
+	if err := ctx.ShouldBindJSON(&profileReq); err != nil {
+		AbortWithBindingErrors(ctx, err)
+		return
+	}
+	profiles, err := ns.GetSimilarProfilesTo(profileReq.ToDomain(), req.ToDomain())
+	if err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.IndentedJSON(http.StatusOK, dto.MakeSimilarProfileResponseArray(*profiles))
+}
+
+// @Summary      Marks an item liked by a user.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/likes/{item} [put]
+func (endpoint *ProfileEndpoint) Like(ctx *gin.Context) {
+	endpoint.handleItem(ctx, func(ns domain.LikeNamespace, user, item uint64) error {
+		return ns.Like(user, item)
+	})
+}
+
+// @Summary      Marks an item disliked by a user.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/dislikes/{item} [put]
+func (endpoint *ProfileEndpoint) Dislike(ctx *gin.Context) {
+	endpoint.handleItem(ctx, func(ns domain.LikeNamespace, user, item uint64) error {
+		return ns.Dislike(user, item)
+	})
+}
+
+// @Summary      Removes an item from the likes of a user.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/likes/{item} [delete]
+func (endpoint *ProfileEndpoint) DeleteLike(ctx *gin.Context) {
+	endpoint.handleItem(ctx, func(ns domain.LikeNamespace, user, item uint64) error {
+		return ns.DeleteLike(user, item)
+	})
+}
+
+// @Summary      Removes an item from the dislikes of a user.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/dislikes/{item} [delete]
+func (endpoint *ProfileEndpoint) DeleteDislike(ctx *gin.Context) {
+	endpoint.handleItem(ctx, func(ns domain.LikeNamespace, user, item uint64) error {
+		return ns.DeleteDislike(user, item)
+	})
+}
+
+// Parses the namespace, user and item path parameters and applies the
+// modification to the namespace.
+func (endpoint *ProfileEndpoint) handleItem(
+	ctx *gin.Context,
+	modify func(ns domain.LikeNamespace, user, item uint64) error,
+) {
+	ns := endpoint.getLikeNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	item, ok := ParseIDParam(ctx, "item")
+	if !ok {
+		return
+	}
+	if err := modify(ns, user, item); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, domain.ErrItemNotLiked) || errors.Is(err, domain.ErrItemNotDisliked) {
+			status = http.StatusNotFound
+		}
+		ctx.AbortWithStatusJSON(status, dto.FromError(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// @Summary      Sets the score a user rates an item with.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Param        body body dto.RateRequest true "RateRequest"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.ValidationError
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/ratings/{item} [put]
+func (endpoint *ProfileEndpoint) Rate(ctx *gin.Context) {
+	var req dto.RateRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		AbortWithBindingErrors(ctx, err)
+		return
+	}
+	if err := domain.ValidateRatingScore(*req.Score); err != nil {
+		AbortWithValidationError(ctx, err)
+		return
+	}
+	endpoint.handleRating(ctx, func(ns domain.RatingNamespace, user, item uint64) error {
+		return ns.Rate(user, item, *req.Score)
+	})
+}
+
+// @Summary      Removes the rating of an item from the profile of a user.
+// @Tags         Profile
+// @Accept       json
+// @Produce      json
+// @Param        name path string true "Namespace name"
+// @Param        user path integer true "User ID"
+// @Param        item path integer true "Item ID"
+// @Success      204
+// @Failure      404  {object}  dto.Error
+// @Failure      400  {object}  dto.Error
+// @Failure      500  {object}  dto.Error
+// @Router       /api/v1/namespaces/{name}/profiles/{user}/ratings/{item} [delete]
+func (endpoint *ProfileEndpoint) DeleteRating(ctx *gin.Context) {
+	endpoint.handleRating(ctx, func(ns domain.RatingNamespace, user, item uint64) error {
+		return ns.DeleteItem(user, item)
+	})
+}
+
+// Parses the namespace, user and item path parameters and applies the
+// modification to the rating namespace.
+func (endpoint *ProfileEndpoint) handleRating(
+	ctx *gin.Context,
+	modify func(ns domain.RatingNamespace, user, item uint64) error,
+) {
+	ns := endpoint.getRatingNamespace(ctx)
+	if ns == nil {
+		return
+	}
+	user, ok := ParseIDParam(ctx, "user")
+	if !ok {
+		return
+	}
+	item, ok := ParseIDParam(ctx, "item")
+	if !ok {
+		return
+	}
+	if err := modify(ns, user, item); err != nil {
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, dto.FromError(err))
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
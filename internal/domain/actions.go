@@ -1,5 +1,7 @@
 package domain
 
+import "recengine/internal/domain/valueobjects"
+
 type ActionType = int
 
 const (
@@ -11,6 +13,11 @@ const (
 	ActionDeleteItem         ActionType = iota
 	ActionGetSimilarProfiles ActionType = iota
 	ActionRecommendItems     ActionType = iota
+	ActionCompact            ActionType = iota
+	ActionRename             ActionType = iota
+	ActionRate               ActionType = iota
+	ActionDeleteLike         ActionType = iota
+	ActionDeleteDislike      ActionType = iota
 )
 
 type Action struct {
@@ -35,13 +42,69 @@ type LikePayload struct {
 
 type DislikePayload = LikePayload
 type DeleteItemPayload = LikePayload
+type DeleteLikePayload = LikePayload
+type DeleteDislikePayload = LikePayload
 
 type GetSimilarProfilesPayload struct {
-	UserID   uint64
-	Profiles chan *[]SimilarProfile
+	UserID uint64
+	// The profile to find the similar ones to instead of the stored profile
+	// of the user (optional).
+	Profile *Profile
+	// Maximum number of the profiles to return.
+	Limit uint
+	// The contribution of dislikes to the similarity of profiles.
+	DislikeFactor float32
+	// The measure of similarity of profiles (Jaccard index if nil).
+	Metric SimilarityMetric
+	// Compare only the profiles whose MinHash signatures collide with the
+	// signature of the profile.
+	Approximate bool
+	Profiles    chan *[]SimilarProfile
 }
 
 type RecommendItemsPayload struct {
 	UserID uint64
+	// Maximum number of the similar profiles to take the items from.
+	MaxSimilarProfiles uint
+	// The contribution of dislikes to the similarity of profiles.
+	DislikeFactor float32
+	// The measure of similarity of profiles (Jaccard index if nil).
+	Metric SimilarityMetric
+	// Compare only the profiles whose MinHash signatures collide with the
+	// signature of the profile.
+	Approximate bool
+	Items       chan *[]RecItem
+}
+
+type GetRatingProfilePayload struct {
+	UserID  uint64
+	Profile chan *RatingProfile
+}
+
+type RatePayload struct {
+	UserID uint64
+	ItemID uint64
+	Score  float32
+}
+
+type GetSimilarRatingProfilesPayload struct {
+	UserID uint64
+	// Maximum number of the profiles to return.
+	Limit uint
+	// The measure of similarity of the profiles.
+	Metric   valueobjects.SimilarityMetric
+	Profiles chan *[]SimilarRatingProfile
+}
+
+type PredictRatingsPayload struct {
+	UserID uint64
+	// Maximum number of the similar profiles to take the items from.
+	MaxSimilarProfiles uint
+	// The measure of similarity of the profiles.
+	Metric valueobjects.SimilarityMetric
 	Items  chan *[]RecItem
 }
+
+type RenamePayload struct {
+	Name valueobjects.NamespaceName
+}
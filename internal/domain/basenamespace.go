@@ -0,0 +1,728 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"recengine/internal/domain/valueobjects"
+	"sync"
+	"time"
+)
+
+// Implements the part of the namespaces that doesn't depend on the type of
+// the profiles: the worker thread, the storages and the common settings.
+type baseNamespace struct {
+	name                    valueobjects.NamespaceName
+	maxSimilarProfiles      uint
+	dislikeFactor           float32
+	similarityMetric        valueobjects.SimilarityMetric
+	searchMode              valueobjects.SearchMode
+	durability              valueobjects.Durability
+	actionQueueFillWaitTime time.Duration
+	compactionThreshold     uint64
+	fragmentationThreshold  float64
+	created                 time.Time
+	basePath                string
+	files                   NamespaceFiles
+	deltaStorageFactory     DeltaStorageFactory
+	profileStorageFactory   ProfileStorageFactory
+	indexStorageFactory     IndexStorageFactory
+	itemIndexStorageFactory ItemIndexStorageFactory
+	signatureStorageFactory SignatureStorageFactory
+	action                  chan Action
+	// Closed to make the worker thread stop.
+	quit     chan struct{}
+	stopOnce sync.Once
+	// Closed when the worker thread has stopped and closed the storages.
+	done    chan struct{}
+	started bool
+	// Guards the name and the files, which are changed by the worker thread.
+	mutex sync.RWMutex
+}
+
+// The error sent to the callers waiting for actions of a stopped namespace.
+var errNamespaceStopped = errors.New("the namespace stopped")
+
+// The storages a namespace works with.
+type namespaceStorages struct {
+	delta   DeltaStorage
+	index   IndexStorage
+	profile ProfileStorage
+	// Nil if the namespace has no item index storage factory.
+	itemIndex ItemIndexStorage
+	// Nil unless the namespace searches similar profiles approximately.
+	signatures SignatureStorage
+}
+
+// Creates the channels of the worker thread and sets the defaults of the
+// settings that haven't been set.
+func (ns *baseNamespace) init() {
+	ns.actionQueueFillWaitTime = time.Millisecond * 50
+	ns.action = make(chan Action, 100)
+	ns.quit = make(chan struct{})
+	ns.done = make(chan struct{})
+	if ns.maxSimilarProfiles == 0 {
+		ns.maxSimilarProfiles = 1000
+	}
+	if ns.compactionThreshold == 0 {
+		ns.compactionThreshold = 64 * 1024 * 1024
+	}
+	if ns.fragmentationThreshold == 0 {
+		ns.fragmentationThreshold = 0.5
+	}
+	if ns.created.IsZero() {
+		ns.created = time.Now().UTC()
+	}
+	if ns.files == (NamespaceFiles{}) {
+		ns.files = MakeNamespaceFiles(ns.name)
+	}
+	if ns.files.ItemIndex == "" {
+		ns.files.ItemIndex = MakeNamespaceFiles(ns.name).ItemIndex
+	}
+	if ns.files.Signatures == "" {
+		ns.files.Signatures = MakeNamespaceFiles(ns.name).Signatures
+	}
+}
+
+// Returns the name of the namespace.
+func (ns *baseNamespace) GetName() valueobjects.NamespaceName {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+	return ns.name
+}
+
+// Renames the namespace along with its files. The renaming is processed by
+// the worker thread, and its outcome is sent to the returned channel.
+func (ns *baseNamespace) Rename(name valueobjects.NamespaceName) chan error {
+	err := make(chan error, 1)
+	if sendErr := ns.send(Action{ActionRename, err, RenamePayload{name}}); sendErr != nil {
+		err <- sendErr
+	}
+	return err
+}
+
+// Changes maximum number of similar profiles to be used by recommendation algorithm.
+func (ns *baseNamespace) SetMaxSimilarProfiles(limit uint) {
+	ns.maxSimilarProfiles = limit
+}
+
+// Returns maximum number of similar profiles to be used by recommendation algorithm.
+func (ns *baseNamespace) GetMaxSimilarProfiles() uint {
+	return ns.maxSimilarProfiles
+}
+
+// Changes how much dislikes affect similarity of profiles.
+// The value ranges from 0 to 1. 0.5 means that likes and dislikes has equal
+// effect on similarity. The namespaces without dislikes ignore it.
+func (ns *baseNamespace) SetDislikeFactor(value float32) {
+	ns.dislikeFactor = value
+}
+
+// Returns how much dislikes affect similarity of profiles.
+func (ns *baseNamespace) GetDislikeFactor() float32 {
+	return ns.dislikeFactor
+}
+
+// Returns the measure of similarity of the profiles.
+func (ns *baseNamespace) GetSimilarityMetric() valueobjects.SimilarityMetric {
+	return ns.similarityMetric
+}
+
+// Returns how the similar profiles are searched for.
+func (ns *baseNamespace) GetSearchMode() valueobjects.SearchMode {
+	return ns.searchMode
+}
+
+// Returns when the changes of the profiles are synced to the disk.
+func (ns *baseNamespace) GetDurability() valueobjects.Durability {
+	return ns.durability
+}
+
+// Returns the time the namespace was created at.
+func (ns *baseNamespace) GetCreated() time.Time {
+	return ns.created
+}
+
+// Returns the names of the files storing the data of the namespace.
+func (ns *baseNamespace) GetFiles() NamespaceFiles {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+	return ns.files
+}
+
+// Opens delta storage and recovers it if it is needed.
+func (ns *baseNamespace) openMaybeRecoverDeltaStorage() (DeltaStorage, error) {
+	filePath := ns.basePath + ns.files.Delta
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delta file %s: %w", filePath, err)
+	}
+	storage, err := ns.deltaStorageFactory.OpenMaybeRecover(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open delta storage for %s: %w", ns.name.Value(), err)
+	}
+	storage.SetDurability(ns.durability)
+	return storage, nil
+}
+
+// Opens index storage and rebuilds it from the database file if it is
+// corrupted, which happens if the journal cannot be replayed. The profile
+// storage rebuilds the index from the database file if it's missing.
+func (ns *baseNamespace) openMaybeRebuildIndexStorage() (IndexStorage, error) {
+	filePath := ns.basePath + ns.files.Index
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file %s: %w", filePath, err)
+	}
+	// The factory closes the file on failure
+	storage, err := ns.indexStorageFactory.Open(file, file)
+	if err != nil {
+		if !errors.Is(err, NewCorruptedFileError()) {
+			return nil, fmt.Errorf("failed to open index storage for %s: %w", ns.name.Value(), err)
+		}
+		log.Printf("Namespace %s index is corrupted, rebuilding it\n", ns.name.Value())
+		err = ns.rebuildIndexFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rebuild index of %s: %w", ns.name.Value(), err)
+		}
+		storage, err = ns.indexStorageFactory.OpenFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open index file %s: %w", filePath, err)
+		}
+	}
+	return storage, nil
+}
+
+// Opens item index storage and resets it if it is corrupted. The profile
+// storage rebuilds the empty item index from the database file.
+func (ns *baseNamespace) openMaybeResetItemIndexStorage() (ItemIndexStorage, error) {
+	if ns.itemIndexStorageFactory == nil {
+		return nil, nil
+	}
+	filePath := ns.basePath + ns.files.ItemIndex
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open item index file %s: %w", filePath, err)
+	}
+	// The factory closes the file on failure
+	storage, err := ns.itemIndexStorageFactory.Open(file, file)
+	if err != nil {
+		if !errors.Is(err, NewCorruptedFileError()) {
+			return nil, fmt.Errorf("failed to open item index storage for %s: %w", ns.name.Value(), err)
+		}
+		file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to truncate %s: %w", filePath, err)
+		}
+		storage, err = ns.itemIndexStorageFactory.Open(file, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open item index file %s: %w", filePath, err)
+		}
+	}
+	return storage, nil
+}
+
+// Opens MinHash signature storage and resets it if it is corrupted. The
+// profile storage rebuilds the empty signature storage from the database file.
+// Returns nil if the namespace searches similar profiles exactly.
+func (ns *baseNamespace) openMaybeResetSignatureStorage() (SignatureStorage, error) {
+	if ns.signatureStorageFactory == nil || !ns.searchMode.IsApproximate() {
+		return nil, nil
+	}
+	filePath := ns.basePath + ns.files.Signatures
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signature file %s: %w", filePath, err)
+	}
+	// The factory closes the file on failure
+	storage, err := ns.signatureStorageFactory.Open(file, file)
+	if err != nil {
+		if !errors.Is(err, NewCorruptedFileError()) {
+			return nil, fmt.Errorf("failed to open signature storage for %s: %w", ns.name.Value(), err)
+		}
+		file, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to truncate %s: %w", filePath, err)
+		}
+		storage, err = ns.signatureStorageFactory.Open(file, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open signature file %s: %w", filePath, err)
+		}
+	}
+	return storage, nil
+}
+
+// Opens profile storage and recovers it if it is needed.
+func (ns *baseNamespace) openMaybeRecoverProfileStorage(
+	deltaStorage DeltaStorage,
+	indexStorage IndexStorage,
+	itemIndexStorage ItemIndexStorage,
+	signatureStorage SignatureStorage,
+) (ProfileStorage, error) {
+	filePath := ns.basePath + ns.files.RecDB
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recdb file %s: %w", filePath, err)
+	}
+	storage, err := ns.profileStorageFactory.OpenMaybeRecover(
+		file,
+		deltaStorage,
+		indexStorage,
+		itemIndexStorage,
+		signatureStorage,
+	)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open profile storage for %s: %w", ns.name.Value(), err)
+	}
+	return storage, nil
+}
+
+// Opens all the storages of the namespace recovering them if needed.
+func (ns *baseNamespace) openStorages() (*namespaceStorages, error) {
+	deltaStorage, err := ns.openMaybeRecoverDeltaStorage()
+	if err != nil {
+		return nil, err
+	}
+	indexStorage, err := ns.openMaybeRebuildIndexStorage()
+	if err != nil {
+		deltaStorage.Close()
+		return nil, err
+	}
+	itemIndexStorage, err := ns.openMaybeResetItemIndexStorage()
+	if err != nil {
+		deltaStorage.Close()
+		indexStorage.Close()
+		return nil, err
+	}
+	signatureStorage, err := ns.openMaybeResetSignatureStorage()
+	if err != nil {
+		deltaStorage.Close()
+		indexStorage.Close()
+		if itemIndexStorage != nil {
+			itemIndexStorage.Close()
+		}
+		return nil, err
+	}
+	profileStorage, err := ns.openMaybeRecoverProfileStorage(
+		deltaStorage,
+		indexStorage,
+		itemIndexStorage,
+		signatureStorage,
+	)
+	if err != nil {
+		deltaStorage.Close()
+		indexStorage.Close()
+		if itemIndexStorage != nil {
+			itemIndexStorage.Close()
+		}
+		if signatureStorage != nil {
+			signatureStorage.Close()
+		}
+		return nil, err
+	}
+	return &namespaceStorages{
+		delta:      deltaStorage,
+		index:      indexStorage,
+		profile:    profileStorage,
+		itemIndex:  itemIndexStorage,
+		signatures: signatureStorage,
+	}, nil
+}
+
+// Closes all the storages. Returns the first error occurred.
+func (s *namespaceStorages) close() error {
+	errs := []error{s.profile.Close(), s.delta.Close(), s.index.Close()}
+	if s.itemIndex != nil {
+		errs = append(errs, s.itemIndex.Close())
+	}
+	if s.signatures != nil {
+		errs = append(errs, s.signatures.Close())
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Starts a separate thread to run the work on.
+func (ns *baseNamespace) Start(ctx context.Context) error {
+	storages, err := ns.openStorages()
+	if err != nil {
+		close(ns.done)
+		return err
+	}
+	ns.started = true
+	// The delta is synced periodically if the durability lets the
+	// acknowledged changes wait for it
+	var syncTick <-chan time.Time
+	var ticker *time.Ticker
+	if interval := ns.durability.GetInterval(); interval > 0 {
+		ticker = time.NewTicker(interval)
+		syncTick = ticker.C
+	}
+	go func() {
+		defer close(ns.done)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		defer func() {
+			if storages != nil {
+				storages.close()
+			}
+		}()
+		defer log.Printf("Namespace %s stopped\n", ns.name.Value())
+		for {
+			select {
+			case <-ctx.Done():
+				ns.sendStoppedErrorToActionWaiters(nil)
+				return
+			case <-ns.quit:
+				ns.sendStoppedErrorToActionWaiters(nil)
+				return
+			case <-syncTick:
+				if err := storages.delta.Sync(); err != nil {
+					log.Printf("Namespace %s failed to sync delta: %v\n", ns.name.Value(), err)
+				}
+			case action := <-ns.action:
+				// We wan't to process as many actions as possible at a time.
+				// But not too much, though.
+				time.Sleep(ns.actionQueueFillWaitTime)
+				// Take out actions from the channel
+				actions := make([]Action, len(ns.action)+1)
+				actions[0] = action
+				// Warning. We cannot iterate through the queue itself here!
+				for i := 1; i < len(actions); i++ {
+					actions[i] = <-ns.action
+					if actions[i].ActionType == ActionStop {
+						// The rest of the slice hasn't been taken out yet
+						taken := actions[:i+1]
+						ns.sendStoppedErrorToActionWaiters(&taken)
+						return
+					}
+				}
+				// Renaming requires reopening the storages, so the actions
+				// are processed in chunks separated by the renaming actions.
+				for len(actions) > 0 {
+					i := 0
+					for i < len(actions) && actions[i].ActionType != ActionRename {
+						i++
+					}
+					if i > 0 {
+						storages = ns.processActions(storages, actions[:i])
+						if storages == nil {
+							// The processed actions have been answered already
+							rest := actions[i:]
+							ns.sendStoppedErrorToActionWaiters(&rest)
+							return
+						}
+					}
+					if i == len(actions) {
+						break
+					}
+					// The renaming action is answered by rename() itself
+					storages = ns.rename(storages, actions[i])
+					actions = actions[i+1:]
+					if storages == nil {
+						ns.sendStoppedErrorToActionWaiters(&actions)
+						return
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Processes the actions and compacts the database if the delta grows large.
+// The database is rewritten if the compaction leaves it fragmented. Returns
+// the storages, which are reopened by the rewriting, or nil if they cannot
+// be reopened.
+func (ns *baseNamespace) processActions(
+	storages *namespaceStorages,
+	actions []Action,
+) *namespaceStorages {
+	if err := storages.profile.ProcessActions(actions); err != nil {
+		log.Printf("Namespace %s failed to process actions: %v\n", ns.name.Value(), err)
+	}
+	if storages.delta.GetFileSize() < ns.compactionThreshold {
+		return storages
+	}
+	if err := storages.profile.Compact(); err != nil {
+		log.Printf("Namespace %s failed to compact: %v\n", ns.name.Value(), err)
+		return storages
+	}
+	if storages.profile.GetFragmentation() >= ns.fragmentationThreshold {
+		return ns.defragment(storages)
+	}
+	return storages
+}
+
+// Closes the storages, rewrites the database file dropping the deleted
+// entries and reopens the storages. Returns the reopened storages or nil if
+// they cannot be reopened at all.
+func (ns *baseNamespace) defragment(storages *namespaceStorages) *namespaceStorages {
+	err := storages.close()
+	if err == nil {
+		_, err = ns.rewriteFiles(func(src, dst RandomAccessFile, index IndexStorage) (bool, error) {
+			return true, ns.profileStorageFactory.Rewrite(src, dst, index)
+		})
+	}
+	if err != nil {
+		log.Printf("Namespace %s failed to rewrite database: %v\n", ns.name.Value(), err)
+	}
+	storages, err = ns.openStorages()
+	if err != nil {
+		log.Printf("Namespace %s failed to reopen storages: %v\n", ns.name.Value(), err)
+		return nil
+	}
+	return storages
+}
+
+// Processes the renaming action: closes the storages, renames the files and
+// reopens the storages. If the files cannot be renamed, the storages are
+// reopened under the old name. Returns the reopened storages or nil if they
+// cannot be reopened at all.
+func (ns *baseNamespace) rename(storages *namespaceStorages, action Action) *namespaceStorages {
+	name := action.Payload.(RenamePayload).Name
+	if name == ns.name {
+		action.Error <- nil
+		return storages
+	}
+	err := storages.close()
+	if err == nil {
+		err = ns.renameFiles(name)
+	}
+	storages, openErr := ns.openStorages()
+	if openErr != nil {
+		log.Printf("Namespace %s failed to reopen storages: %v\n", ns.name.Value(), openErr)
+		if err == nil {
+			err = openErr
+		}
+		action.Error <- err
+		return nil
+	}
+	action.Error <- err
+	return storages
+}
+
+// Renames the files of the namespace and then the namespace itself.
+// If any file cannot be renamed, the files renamed so far are renamed back.
+func (ns *baseNamespace) renameFiles(name valueobjects.NamespaceName) error {
+	newFiles := MakeNamespaceFiles(name)
+	oldPaths := ns.files.getPaths()
+	newPaths := newFiles.getPaths()
+	for _, path := range newPaths {
+		if _, err := os.Stat(ns.basePath + path); !os.IsNotExist(err) {
+			return fmt.Errorf("file %s already exists", ns.basePath+path)
+		}
+	}
+	for i := range oldPaths {
+		// The optional files may be missing
+		if _, err := os.Stat(ns.basePath + oldPaths[i]); os.IsNotExist(err) {
+			continue
+		}
+		err := os.Rename(ns.basePath+oldPaths[i], ns.basePath+newPaths[i])
+		if err != nil {
+			for j := i - 1; j >= 0; j-- {
+				os.Rename(ns.basePath+newPaths[j], ns.basePath+oldPaths[j])
+			}
+			return fmt.Errorf("failed to rename namespace files: %v", err)
+		}
+	}
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+	ns.name = name
+	ns.files = newFiles
+	return nil
+}
+
+// Rewrites the database file of the namespace in the current format version
+// along with the index of the offsets of its entries. The item index is
+// removed to be rebuilt upon the next start. The namespace must not be
+// started. Returns false if the file is up to date.
+func (ns *baseNamespace) Upgrade() (bool, error) {
+	if ns.started {
+		return false, fmt.Errorf("namespace %s is running", ns.name.Value())
+	}
+	return ns.rewriteFiles(ns.profileStorageFactory.Upgrade)
+}
+
+// Rewrites the database file along with the index of the offsets of its
+// entries into temporary files by the function, which returns false if
+// nothing has been written, and replaces the files with them. The item index
+// is removed to be rebuilt upon the next start. The storages must be closed.
+func (ns *baseNamespace) rewriteFiles(
+	rewrite func(src, dst RandomAccessFile, indexStorage IndexStorage) (bool, error),
+) (bool, error) {
+	filePath := ns.basePath + ns.files.RecDB
+	src, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to open recdb file %s: %w", filePath, err)
+	}
+	defer src.Close()
+	tmpPath := filePath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", tmpPath, err)
+	}
+	indexPath := ns.basePath + ns.files.Index
+	tmpIndexPath := indexPath + ".tmp"
+	os.Remove(tmpIndexPath)
+	indexStorage, err := ns.indexStorageFactory.OpenFile(tmpIndexPath)
+	if err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to create %s: %w", tmpIndexPath, err)
+	}
+	upgraded, err := rewrite(src, dst, indexStorage)
+	if err == nil && upgraded {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := indexStorage.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || !upgraded {
+		os.Remove(tmpPath)
+		os.Remove(tmpIndexPath)
+		return false, err
+	}
+	if err = os.Rename(tmpIndexPath, indexPath); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %w", indexPath, err)
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %w", filePath, err)
+	}
+	err = os.Remove(ns.basePath + ns.files.ItemIndex)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to remove item index: %w", err)
+	}
+	return true, nil
+}
+
+// Rebuilds the index of the offsets of the database entries from the
+// database file. The namespace must not be started.
+func (ns *baseNamespace) RebuildIndex() error {
+	if ns.started {
+		return fmt.Errorf("namespace %s is running", ns.name.Value())
+	}
+	return ns.rebuildIndexFile()
+}
+
+// Fills a temporary index file with the offsets of the entries of the
+// database file, which is recovered if it's corrupted, and replaces the
+// index file with it. The index is empty if there is no database file yet.
+// The storages must be closed.
+func (ns *baseNamespace) rebuildIndexFile() error {
+	filePath := ns.basePath + ns.files.RecDB
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to open recdb file %s: %w", filePath, err)
+	}
+	if file != nil {
+		defer file.Close()
+	}
+	indexPath := ns.basePath + ns.files.Index
+	tmpIndexPath := indexPath + ".tmp"
+	os.Remove(tmpIndexPath)
+	indexStorage, err := ns.indexStorageFactory.OpenFile(tmpIndexPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", tmpIndexPath, err)
+	}
+	duplicates := 0
+	if info, statErr := os.Stat(filePath); statErr == nil && info.Size() > 0 {
+		duplicates, err = ns.profileStorageFactory.RebuildIndex(file, indexStorage)
+	}
+	if closeErr := indexStorage.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpIndexPath)
+		return err
+	}
+	if duplicates > 0 {
+		log.Printf("Namespace %s has %d duplicate entries\n", ns.name.Value(), duplicates)
+	}
+	if err = os.Rename(tmpIndexPath, indexPath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", indexPath, err)
+	}
+	return nil
+}
+
+// Stops the worker thread started by a call to Start() and waits until it
+// closes the storages.
+func (ns *baseNamespace) Stop() {
+	log.Printf("Stopping namespace %s...\n", ns.GetName().Value())
+	ns.stopOnce.Do(func() {
+		close(ns.quit)
+	})
+	if ns.started {
+		<-ns.done
+	}
+}
+
+// Puts the action into the queue unless the namespace has stopped.
+func (ns *baseNamespace) send(action Action) error {
+	select {
+	case ns.action <- action:
+		return nil
+	case <-ns.done:
+		return errNamespaceStopped
+	}
+}
+
+// Puts the action into the queue and waits for its outcome.
+func (ns *baseNamespace) sendAndWait(action Action) error {
+	if err := ns.send(action); err != nil {
+		return err
+	}
+	select {
+	case err := <-action.Error:
+		return err
+	case <-ns.done:
+		return errNamespaceStopped
+	}
+}
+
+func (ns *baseNamespace) sendStoppedErrorToActionWaiters(takenActions *[]Action) {
+	// Get actions from the buffer and send an error to each one
+	for len(ns.action) > 0 {
+		action := <-ns.action
+		action.Error <- errNamespaceStopped
+	}
+	// Send an error to each action that has been taken out from the buffer
+	// and should has been processed
+	if takenActions != nil {
+		for _, action := range *takenActions {
+			action.Error <- errNamespaceStopped
+		}
+	}
+}
+
+// Removes the profile by its ID.
+// If there is no profile with this ID found, it's NOT considered an error.
+func (ns *baseNamespace) DeleteProfile(user uint64) error {
+	return ns.sendAndWait(Action{ActionDeleteProfile, make(chan error, 1), DeleteProfilePayload{user}})
+}
+
+// Sets an item of the profile undefined.
+func (ns *baseNamespace) DeleteItem(user uint64, item uint64) error {
+	return ns.sendAndWait(Action{ActionDeleteItem, make(chan error, 1), DeleteItemPayload{user, item}})
+}
+
+// Applies the accumulated changes to the database file.
+// Normally it happens automatically once the delta file grows large enough.
+func (ns *baseNamespace) Compact() error {
+	return ns.sendAndWait(Action{ActionCompact, make(chan error, 1), nil})
+}
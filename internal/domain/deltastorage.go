@@ -1,13 +1,53 @@
 package domain
 
-// OpAdd or OpRemove
+import "recengine/internal/domain/valueobjects"
+
+// Type of an operation stored in the delta storage.
 type DeltaOp byte
 
 const (
-	DeltaOpAdd    DeltaOp = '+'
+	// The item has been added to the profile (e.g. liked).
+	DeltaOpAdd DeltaOp = '+'
+	// The item has been removed from the profile.
 	DeltaOpRemove DeltaOp = '-'
+	// The item has been added to the profile as a negative one (disliked).
+	DeltaOpDislike DeltaOp = '!'
+	// The whole profile has been removed. The item ID is ignored.
+	DeltaOpDeleteProfile DeltaOp = 'x'
+	// The item has been rated. The score is encoded in the lower bits of
+	// the operation (see MakeRateDeltaOp).
+	DeltaOpRate DeltaOp = 0x80
 )
 
+// The number of the score steps per unit, i.e. the scores stored in the rating
+// operations are rounded to tenths.
+const deltaScoreScale = 10
+
+// Returns the operation setting the score of an item. The score must pass
+// ValidateRatingScore, so that it's read back as it is.
+func MakeRateDeltaOp(score float32) DeltaOp {
+	return DeltaOpRate | DeltaOp(score*deltaScoreScale+0.5)
+}
+
+// Checks whether the operation sets the score of an item.
+func (op DeltaOp) IsRate() bool {
+	return op&DeltaOpRate != 0
+}
+
+// Returns the score stored in the rating operation.
+func (op DeltaOp) GetScore() float32 {
+	return float32(op&^DeltaOpRate) / deltaScoreScale
+}
+
+// An operation on a profile item stored in the delta storage.
+type DeltaItem struct {
+	Op     DeltaOp
+	ItemID uint64
+	// The number of the operation, which increases in the order the
+	// operations are added to the storage.
+	Seq uint64
+}
+
 // Represents a storage of the database difference data.
 // The delta data complements the data stored in an associated RECDB database,
 // which is immutable in its turn.
@@ -17,6 +57,19 @@ type DeltaStorage interface {
 	// Flushes the internal buffers.
 	Flush() error
 
+	// Flushes the internal buffers and commits the file to the disk.
+	Sync() error
+
+	// Makes the operations added so far durable, unless the durability of the
+	// storage lets them be synced later by a periodic call to Sync().
+	Commit() error
+
+	// Changes when the added operations are synced to the disk.
+	SetDurability(durability valueobjects.Durability)
+
+	// Returns when the added operations are synced to the disk.
+	GetDurability() valueobjects.Durability
+
 	// Closes the delta storage file.  The files not closed with this
 	// function are considered broken and require recovery.
 	Close() error
@@ -34,6 +87,23 @@ type DeltaStorage interface {
 	// This method exists mostly for debugging and testing purposes.
 	Get(user uint64, item uint64) (DeltaOp, bool)
 
+	// Returns the IDs of all the users having at least one operation.
+	GetUsers() []uint64
+
+	// Returns all the operations associated with the user in the order they
+	// must be applied to the profile.
+	GetUserOps(user uint64) []DeltaItem
+
+	// Returns the sequence number of the last added operation. The numbers
+	// keep increasing after the storage is reset.
+	GetLastSeq() uint64
+
 	// Adds an operation of item addition or removal to a user profile.
+	// The operation gets the next sequence number.
 	Add(op DeltaOp, user uint64, item uint64)
+
+	// Removes all the operations from the storage and truncates the file.
+	// It must be called only after the operations have been applied to the
+	// associated database.
+	Reset() error
 }
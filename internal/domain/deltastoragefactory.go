@@ -8,9 +8,11 @@ type DeltaStorageFactory interface {
 	Recover(file RandomAccessFile) error
 
 	// Opens a delta storage file. If the file is empty, writes all necessary data.
+	// The file is never closed on failure, the caller closes it.
 	Open(file RandomAccessFile) (DeltaStorage, error)
 
 	// Opens a delta storage file.  If the file is empty, writes all necessary
-	// data. If the file is corrupted, tries to recover it first.
+	// data. If the file is corrupted, tries to recover it first. The file is
+	// never closed on failure, the caller closes it.
 	OpenMaybeRecover(file RandomAccessFile) (DeltaStorage, error)
 }
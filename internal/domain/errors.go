@@ -1,11 +1,44 @@
 package domain
 
+import "fmt"
+
 type CorruptedFileError struct{}
 
 func (e *CorruptedFileError) Error() string {
 	return "The file hasn't been closed property, it may be corrupted"
 }
 
+// Makes errors.Is() match any CorruptedFileError.
+func (e *CorruptedFileError) Is(target error) bool {
+	_, ok := target.(*CorruptedFileError)
+	return ok
+}
+
 func NewCorruptedFileError() error {
 	return &CorruptedFileError{}
 }
+
+// The checksum of a database entry doesn't match its content, e.g. because
+// of a torn write. The entries around it are still readable.
+type CorruptedEntryError struct {
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *CorruptedEntryError) Error() string {
+	return fmt.Sprintf(
+		"The entry is corrupted: checksum %08x doesn't match the stored one %08x",
+		e.Actual,
+		e.Expected,
+	)
+}
+
+// Makes errors.Is() match any CorruptedEntryError.
+func (e *CorruptedEntryError) Is(target error) bool {
+	_, ok := target.(*CorruptedEntryError)
+	return ok
+}
+
+func NewCorruptedEntryError(expected uint32, actual uint32) error {
+	return &CorruptedEntryError{expected, actual}
+}
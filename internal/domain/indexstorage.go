@@ -13,4 +13,10 @@ type IndexStorage interface {
 
 	// Removes an index from the database.
 	Remove(id uint64) error
+
+	// Returns the number of the IDs having an index.
+	GetNumEntries() int
+
+	// Makes the changes survive a crash.
+	Sync() error
 }
@@ -0,0 +1,18 @@
+package domain
+
+// Inverted index storage, which maps the items to the offsets of the
+// database entries of the profiles having them (posting lists).
+type ItemIndexStorage interface {
+	// Closes the storage file.
+	Close() error
+
+	// Returns the sorted offsets of the entries having any of the items.
+	GetOffsets(items []uint64) []uint64
+
+	// Returns the number of the items having at least one entry.
+	GetNumItems() int
+
+	// Replaces the whole content of the storage by the posting lists, which
+	// must be sorted.
+	Reset(postings map[uint64][]uint64) error
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "io"
+
+// Item index storage factory.
+type ItemIndexStorageFactory interface {
+	// Opens an item index file by the specified path. If the file doesn't
+	// exist yet it will be created.
+	OpenFile(filePath string) (ItemIndexStorage, error)
+
+	// Opens an item index file. If the file is empty, writes all necessary
+	// data. The closer is called upon closing the storage (optional).
+	Open(file io.ReadWriteSeeker, closer io.Closer) (ItemIndexStorage, error)
+}
@@ -1,65 +1,75 @@
 package domain
 
 import (
-	"context"
 	"errors"
-	"fmt"
-	"log"
-	"os"
 	"recengine/internal/domain/valueobjects"
 	"time"
 )
 
-// likeNamespace performs the same function as databases in relational databases.
+var (
+	ErrItemNotLiked    = errors.New("item is not liked by the user")
+	ErrItemNotDisliked = errors.New("item is not disliked by the user")
+)
+
+// likeNamespace stores the likes and dislikes of the users.
 type likeNamespace struct {
-	name                    valueobjects.NamespaceName
-	maxSimilarProfiles      uint
-	dislikeFactor           float32
-	actionQueueFillWaitTime time.Duration
-	basePath                string
-	deltaStorageFactory     DeltaStorageFactory
-	likeStorageFactory      LikeStorageFactory
-	indexStorageFactory     IndexStorageFactory
-	action                  chan Action
+	baseNamespace
+	// The implementation of the similarity metric of the namespace.
+	metric SimilarityMetric
 }
 
 // Compile-time type check
-var _ = (Namespace)((*likeNamespace)(nil))
+var _ = (LikeNamespace)((*likeNamespace)(nil))
 
 // A DTO for creating a LikeNamespace.
 type LikeNamespaceDto struct {
-	Name                valueobjects.NamespaceName
-	MaxSimilarProfiles  uint
-	DislikeFactor       float32
-	BasePath            string
-	DeltaStorageFactory DeltaStorageFactory
-	LikeStorageFactory  LikeStorageFactory
-	IndexStorageFactory IndexStorageFactory
+	Name                    valueobjects.NamespaceName
+	MaxSimilarProfiles      uint
+	DislikeFactor           float32
+	SimilarityMetric        valueobjects.SimilarityMetric
+	SearchMode              valueobjects.SearchMode
+	Durability              valueobjects.Durability
+	CompactionThreshold     uint64
+	FragmentationThreshold  float64
+	Created                 time.Time
+	BasePath                string
+	Files                   NamespaceFiles
+	DeltaStorageFactory     DeltaStorageFactory
+	LikeStorageFactory      ProfileStorageFactory
+	IndexStorageFactory     IndexStorageFactory
+	ItemIndexStorageFactory ItemIndexStorageFactory
+	SignatureStorageFactory SignatureStorageFactory
 }
 
 // Creates a new namespace.
-func NewLikeNamespace(dto *LikeNamespaceDto) *likeNamespace {
-	ns := &likeNamespace{
-		name:                    dto.Name,
-		maxSimilarProfiles:      dto.MaxSimilarProfiles,
-		dislikeFactor:           dto.DislikeFactor,
-		deltaStorageFactory:     dto.DeltaStorageFactory,
-		likeStorageFactory:      dto.LikeStorageFactory,
-		indexStorageFactory:     dto.IndexStorageFactory,
-		basePath:                dto.BasePath,
-		actionQueueFillWaitTime: time.Millisecond * 50,
-		action:                  make(chan Action, 100),
-	}
-	// Set defaults
-	if ns.maxSimilarProfiles == 0 {
-		ns.maxSimilarProfiles = 1000
+func NewLikeNamespace(dto *LikeNamespaceDto) (*likeNamespace, error) {
+	metric, err := NewSimilarityMetric(dto.SimilarityMetric)
+	if err != nil {
+		return nil, err
 	}
-	return ns
-}
-
-// Returns the name of the namespace.
-func (ns *likeNamespace) GetName() valueobjects.NamespaceName {
-	return ns.name
+	ns := &likeNamespace{
+		metric: metric,
+		baseNamespace: baseNamespace{
+			name:                    dto.Name,
+			maxSimilarProfiles:      dto.MaxSimilarProfiles,
+			dislikeFactor:           dto.DislikeFactor,
+			similarityMetric:        dto.SimilarityMetric,
+			searchMode:              dto.SearchMode,
+			durability:              dto.Durability,
+			compactionThreshold:     dto.CompactionThreshold,
+			fragmentationThreshold:  dto.FragmentationThreshold,
+			created:                 dto.Created,
+			files:                   dto.Files,
+			deltaStorageFactory:     dto.DeltaStorageFactory,
+			profileStorageFactory:   dto.LikeStorageFactory,
+			indexStorageFactory:     dto.IndexStorageFactory,
+			itemIndexStorageFactory: dto.ItemIndexStorageFactory,
+			signatureStorageFactory: dto.SignatureStorageFactory,
+			basePath:                dto.BasePath,
+		},
+	}
+	ns.init()
+	return ns, nil
 }
 
 // Returns namespace subtype.
@@ -67,186 +77,22 @@ func (ns *likeNamespace) GetType() valueobjects.NamespaceType {
 	return valueobjects.MakeLikeNamespaceType()
 }
 
-// Renames the namespace.
-func (ns *likeNamespace) Rename(name valueobjects.NamespaceName) chan error {
-	ns.name = name
-	// TODO: rename the files
-	return nil
-}
-
-// Changes maximum number of similar profiles to be used by recommendation algorithm.
-func (ns *likeNamespace) SetMaxSimilarProfiles(limit uint) {
-	ns.maxSimilarProfiles = limit
-}
-
-// Returns maximum number of similar profiles to be used by recommendation algorithm.
-func (ns *likeNamespace) GetMaxSimilarProfiles() uint {
-	return ns.maxSimilarProfiles
-}
-
-// Changes how much dislikes affect similarity of profiles.
-// The value ranges from 0 to 1. 0.5 means that likes and dislikes has equal
-// effect on similarity.
-func (ns *likeNamespace) SetDislikeFactor(value float32) {
-	ns.dislikeFactor = value
-}
-
-// Opens delta storage and recovers it if it is needed.
-func (ns *likeNamespace) openMaybeRecoverDeltaStorage() (DeltaStorage, error) {
-	filePath := ns.basePath + ns.name.Value() + ".delta"
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open delta file %s: %w", filePath, err)
-	}
-	storage, err := ns.deltaStorageFactory.OpenMaybeRecover(file)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to open delta storage for %s: %w", ns.name.Value(), err)
-	}
-	return storage, nil
-}
-
-// Opens delta storage and recovers it if it is needed.
-func (ns *likeNamespace) openMaybeResetIndexStorage() (IndexStorage, error) {
-	filePath := ns.basePath + ns.name.Value() + ".index"
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open delta file %s: %w", filePath, err)
-	}
-	storage, err := ns.indexStorageFactory.Open(file, file)
-	if err != nil {
-		if !errors.Is(err, NewCorruptedFileError()) {
-			file.Close()
-			return nil, fmt.Errorf("failed to open delta storage for %s: %w", ns.name.Value(), err)
-		}
-		err = file.Truncate(0)
-		if err != nil {
-			file.Close()
-			return nil, fmt.Errorf("failed to truncate %s: %w", filePath, err)
-		}
-		storage, err = ns.indexStorageFactory.Open(file, file)
-		if err != nil {
-			file.Close()
-			return nil, fmt.Errorf("failed to open index file %s: %w", filePath, err)
-		}
-	}
-	return storage, nil
-}
-
-// Opens delta storage and recovers it if it is needed.
-func (ns *likeNamespace) openMaybeRecoverLikeStorage(
-	deltaStorage DeltaStorage,
-	indexStorage IndexStorage,
-) (LikeStorage, error) {
-	filePath := ns.basePath + ns.name.Value() + ".recdb"
-	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open recdb file %s: %w", filePath, err)
-	}
-	storage, err := ns.likeStorageFactory.OpenMaybeRecover(file, deltaStorage, indexStorage)
-	if err != nil {
-		file.Close()
-		return nil, fmt.Errorf("failed to open like storage for %s: %w", ns.name.Value(), err)
-	}
-	return storage, nil
-}
-
-// Starts a separate thread to run the work on.
-func (ns *likeNamespace) Start(ctx context.Context) error {
-	deltaStorage, err := ns.openMaybeRecoverDeltaStorage()
-	if err != nil {
-		return err
-	}
-	indexStorage, err := ns.openMaybeResetIndexStorage()
-	if err != nil {
-		deltaStorage.Close()
-		return err
-	}
-	likeStorage, err := ns.openMaybeRecoverLikeStorage(deltaStorage, indexStorage)
-	if err != nil {
-		deltaStorage.Close()
-		indexStorage.Close()
-		return err
-	}
-	go func() {
-		defer likeStorage.Close()
-		defer deltaStorage.Close()
-		defer indexStorage.Close()
-		defer log.Printf("LikeNamespace %s stopped\n", ns.name)
-		for {
-			select {
-			case <-ctx.Done():
-				ns.sendStoppedLikeNamespaceErrorToActionWaiters(nil)
-				return
-			case action, more := <-ns.action:
-				if !more {
-					ns.sendStoppedLikeNamespaceErrorToActionWaiters(nil)
-					return
-				}
-				// We wan't to process as many actions as possible at a time.
-				// But not too much, though.
-				time.Sleep(ns.actionQueueFillWaitTime)
-				// Take out actions from the channel
-				actions := make([]Action, 1, len(ns.action)+1)
-				actions[0] = action
-				// Warning. We cannot iterate through the queue itself here!
-				for i := 1; i < len(actions); i++ {
-					actions[i], more = <-ns.action
-					if !more || actions[i].ActionType == ActionStop {
-						ns.sendStoppedLikeNamespaceErrorToActionWaiters(&actions)
-						return
-					}
-				}
-				likeStorage.ProcessActions(actions)
-			}
-		}
-	}()
-	return nil
-}
-
-// Sends a quit signal to the job worker thread started by a call to Run().
-func (ns *likeNamespace) Stop() {
-	log.Printf("Stopping namespace %s...\n", ns.name)
-	close(ns.action)
-}
-
-func (ns *likeNamespace) sendStoppedLikeNamespaceErrorToActionWaiters(takenActions *[]Action) {
-	// Get actions from the buffer and send an error to each one
-	for {
-		action, more := <-ns.action
-		if !more {
-			break
-		}
-		action.Error <- errors.New("the namespace stopped")
-	}
-	// Send an error to each action that has been taken out from the buffer
-	// and should has been processed
-	if takenActions != nil {
-		for _, action := range *takenActions {
-			action.Error <- errors.New("the namespace stopped")
-		}
-	}
-}
-
-// Removes the profile by its ID.
-// If there is no profile with this ID found, it's NOT considered an error.
-func (ns *likeNamespace) DeleteProfile(user uint64) error {
-	err := make(chan error)
-	ns.action <- Action{ActionDeleteProfile, err, DeleteProfilePayload{user}}
-	return <-err
-}
-
 // Returns the profile by its ID or nil if it isn't found.
 // If there is no profile with this ID found, it's NOT considered an error.
 func (ns *likeNamespace) GetProfile(user uint64) (*Profile, error) {
-	errChan := make(chan error)
-	profileChan := make(chan *Profile)
-	ns.action <- Action{
+	errChan := make(chan error, 1)
+	profileChan := make(chan *Profile, 1)
+	err := ns.send(Action{
 		ActionGetProfile,
 		errChan,
 		GetProfilePayload{user, profileChan},
+	})
+	if err != nil {
+		return nil, err
 	}
 	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
 	case err := <-errChan:
 		return nil, err
 	case profile := <-profileChan:
@@ -256,55 +102,100 @@ func (ns *likeNamespace) GetProfile(user uint64) (*Profile, error) {
 
 // Sets an item of the profile liked.
 func (ns *likeNamespace) Like(user uint64, item uint64) error {
-	err := make(chan error)
-	ns.action <- Action{ActionLike, err, LikePayload{user, item}}
-	return <-err
+	return ns.sendAndWait(Action{ActionLike, make(chan error, 1), LikePayload{user, item}})
 }
 
 // Sets an item of the profile disliked.
 func (ns *likeNamespace) Dislike(user uint64, item uint64) error {
-	err := make(chan error)
-	ns.action <- Action{ActionDislike, err, DislikePayload{user, item}}
-	return <-err
+	return ns.sendAndWait(Action{ActionDislike, make(chan error, 1), DislikePayload{user, item}})
 }
 
-// Sets an item of the profile undefined (not liked nor disliked).
-func (ns *likeNamespace) DeleteItem(user uint64, item uint64) error {
-	err := make(chan error)
-	ns.action <- Action{ActionDeleteItem, err, DeleteItemPayload{user, item}}
-	return <-err
+// Sets an item of the profile undefined if it's liked.
+// Returns ErrItemNotLiked otherwise.
+func (ns *likeNamespace) DeleteLike(user uint64, item uint64) error {
+	return ns.sendAndWait(Action{ActionDeleteLike, make(chan error, 1), DeleteLikePayload{user, item}})
+}
+
+// Sets an item of the profile undefined if it's disliked.
+// Returns ErrItemNotDisliked otherwise.
+func (ns *likeNamespace) DeleteDislike(user uint64, item uint64) error {
+	return ns.sendAndWait(Action{ActionDeleteDislike, make(chan error, 1), DeleteDislikePayload{user, item}})
 }
 
 // Returns the most similar profiles to the given one.
-func (ns *likeNamespace) GetSimilarProfiles(user uint64) (*[]SimilarProfile, error) {
-	errChan := make(chan error)
-	profilesChan := make(chan *[]SimilarProfile)
-	ns.action <- Action{
-		ActionGetSimilarProfiles,
-		errChan,
-		GetSimilarProfilesPayload{user, profilesChan},
+// The options may be nil.
+func (ns *likeNamespace) GetSimilarProfiles(
+	user uint64,
+	options *ListOptions,
+) (*[]SimilarProfile, error) {
+	return ns.getSimilarProfiles(GetSimilarProfilesPayload{UserID: user}, options)
+}
+
+// Returns the most similar profiles to the profile, which doesn't have to be
+// stored in the namespace. The options may be nil.
+func (ns *likeNamespace) GetSimilarProfilesTo(
+	profile *Profile,
+	options *ListOptions,
+) (*[]SimilarProfile, error) {
+	payload := GetSimilarProfilesPayload{UserID: profile.UserID, Profile: profile}
+	return ns.getSimilarProfiles(payload, options)
+}
+
+// Requests the most similar profiles filling the namespace-specific fields of
+// the payload.
+func (ns *likeNamespace) getSimilarProfiles(
+	payload GetSimilarProfilesPayload,
+	options *ListOptions,
+) (*[]SimilarProfile, error) {
+	errChan := make(chan error, 1)
+	profilesChan := make(chan *[]SimilarProfile, 1)
+	payload.Limit = ns.maxSimilarProfiles
+	payload.DislikeFactor = ns.dislikeFactor
+	payload.Metric = ns.metric
+	payload.Approximate = ns.searchMode.IsApproximate()
+	payload.Profiles = profilesChan
+	err := ns.send(Action{ActionGetSimilarProfiles, errChan, payload})
+	if err != nil {
+		return nil, err
 	}
 	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
 	case err := <-errChan:
 		return nil, err
 	case profiles := <-profilesChan:
-		return profiles, nil
+		filtered := options.ApplyToSimilarProfiles(*profiles)
+		return &filtered, nil
 	}
 }
 
 // Returns the recommended items for the user.
-func (ns *likeNamespace) RecommendItems(user uint64) (*[]RecItem, error) {
-	errChan := make(chan error)
-	recsChan := make(chan *[]RecItem)
-	ns.action <- Action{
+// The options may be nil.
+func (ns *likeNamespace) RecommendItems(user uint64, options *ListOptions) (*[]RecItem, error) {
+	errChan := make(chan error, 1)
+	recsChan := make(chan *[]RecItem, 1)
+	err := ns.send(Action{
 		ActionRecommendItems,
 		errChan,
-		RecommendItemsPayload{user, recsChan},
+		RecommendItemsPayload{
+			UserID:             user,
+			MaxSimilarProfiles: ns.maxSimilarProfiles,
+			DislikeFactor:      ns.dislikeFactor,
+			Metric:             ns.metric,
+			Approximate:        ns.searchMode.IsApproximate(),
+			Items:              recsChan,
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
 	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
 	case err := <-errChan:
 		return nil, err
 	case recs := <-recsChan:
-		return recs, nil
+		filtered := options.ApplyToRecItems(*recs)
+		return &filtered, nil
 	}
 }
@@ -0,0 +1,98 @@
+package domain
+
+// Options narrowing down the lists of recommended items and similar profiles.
+type ListOptions struct {
+	// Maximum number of the returned elements. 0 means no limit.
+	Limit uint
+
+	// Number of the elements to skip from the beginning of the list.
+	Offset uint
+
+	// Minimum relevance of the recommended items or minimum similarity of the
+	// similar profiles.
+	MinRelevance float32
+
+	// IDs of the recommended items or similar users to leave out.
+	Exclude []uint64
+}
+
+// Filters and paginates the list of the recommended items.
+// The list must be sorted by relevance in descending order.
+func (o *ListOptions) ApplyToRecItems(items []RecItem) []RecItem {
+	if o == nil {
+		return items
+	}
+	excluded := o.makeExcludedSet()
+	filtered := make([]RecItem, 0, len(items))
+	for _, item := range items {
+		if item.Relevance < o.MinRelevance {
+			break
+		}
+		if !excluded[item.ItemID] {
+			filtered = append(filtered, item)
+		}
+	}
+	return paginate(filtered, o.Offset, o.Limit)
+}
+
+// Filters and paginates the list of the similar profiles.
+// The list must be sorted by similarity in descending order.
+func (o *ListOptions) ApplyToSimilarProfiles(profiles []SimilarProfile) []SimilarProfile {
+	if o == nil {
+		return profiles
+	}
+	excluded := o.makeExcludedSet()
+	filtered := make([]SimilarProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		if profile.Similarity < o.MinRelevance {
+			break
+		}
+		if !excluded[profile.Profile.UserID] {
+			filtered = append(filtered, profile)
+		}
+	}
+	return paginate(filtered, o.Offset, o.Limit)
+}
+
+// Filters and paginates the list of the similar rating profiles.
+// The list must be sorted by similarity in descending order.
+func (o *ListOptions) ApplyToSimilarRatingProfiles(
+	profiles []SimilarRatingProfile,
+) []SimilarRatingProfile {
+	if o == nil {
+		return profiles
+	}
+	excluded := o.makeExcludedSet()
+	filtered := make([]SimilarRatingProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		if profile.Similarity < o.MinRelevance {
+			break
+		}
+		if !excluded[profile.Profile.UserID] {
+			filtered = append(filtered, profile)
+		}
+	}
+	return paginate(filtered, o.Offset, o.Limit)
+}
+
+// Returns the excluded IDs as a set.
+func (o *ListOptions) makeExcludedSet() map[uint64]bool {
+	excluded := make(map[uint64]bool, len(o.Exclude))
+	for _, id := range o.Exclude {
+		excluded[id] = true
+	}
+	return excluded
+}
+
+// Returns the part of the list starting at the offset and containing at most
+// `limit` elements (unless the limit is 0).
+func paginate[T any](list []T, offset uint, limit uint) []T {
+	if offset >= uint(len(list)) {
+		return list[:0]
+	}
+	list = list[offset:]
+	if limit > 0 && limit < uint(len(list)) {
+		list = list[:limit]
+	}
+	return list
+}
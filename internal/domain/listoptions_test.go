@@ -0,0 +1,55 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListOptionsApplyToRecItems(t *testing.T) {
+	items := []RecItem{{1, 90}, {2, 70}, {3, 50}, {4, 30}, {5, 10}}
+	type Fixture struct {
+		name     string
+		options  *ListOptions
+		expected []uint64
+	}
+	fixtures := []Fixture{
+		{"nil options", nil, []uint64{1, 2, 3, 4, 5}},
+		{"no options", &ListOptions{}, []uint64{1, 2, 3, 4, 5}},
+		{"limit", &ListOptions{Limit: 2}, []uint64{1, 2}},
+		{"offset", &ListOptions{Offset: 3}, []uint64{4, 5}},
+		{"offset and limit", &ListOptions{Offset: 1, Limit: 2}, []uint64{2, 3}},
+		{"offset out of range", &ListOptions{Offset: 5}, []uint64{}},
+		{"min relevance", &ListOptions{MinRelevance: 50}, []uint64{1, 2, 3}},
+		{"exclude", &ListOptions{Exclude: []uint64{2, 4}}, []uint64{1, 3, 5}},
+		{
+			"all together",
+			&ListOptions{Offset: 1, Limit: 1, MinRelevance: 20, Exclude: []uint64{1}},
+			[]uint64{3},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			result := fixture.options.ApplyToRecItems(items)
+			got := make([]uint64, len(result))
+			for i := range result {
+				got[i] = result[i].ItemID
+			}
+			if !reflect.DeepEqual(got, fixture.expected) {
+				t.Errorf("Expected items %v, got %v", fixture.expected, got)
+			}
+		})
+	}
+}
+
+func TestListOptionsApplyToSimilarProfiles(t *testing.T) {
+	profiles := []SimilarProfile{
+		{NewProfile(1), 0.9},
+		{NewProfile(2), 0.5},
+		{NewProfile(3), 0.3},
+	}
+	options := &ListOptions{Limit: 1, MinRelevance: 0.4, Exclude: []uint64{1}}
+	result := options.ApplyToSimilarProfiles(profiles)
+	if len(result) != 1 || result[0].Profile.UserID != 2 {
+		t.Errorf("Expected the profile 2 only, got %v", result)
+	}
+}
@@ -0,0 +1,78 @@
+package domain
+
+const (
+	// The number of the LSH bands a MinHash signature is split into.
+	MinHashBands = 32
+	// The number of the MinHash values per LSH band.
+	MinHashRows = 2
+	// The number of the MinHash values of a signature.
+	MinHashSize = MinHashBands * MinHashRows
+)
+
+// MinHash values of an item set. The probability of two signatures having
+// a value in common equals the Jaccard index of the sets. The profiles whose
+// signatures have an entire LSH band in common are considered the candidates
+// for being similar: the pair of sets with Jaccard index s collides with the
+// probability 1 - (1 - s^MinHashRows)^MinHashBands.
+type MinHashSignature [MinHashSize]uint32
+
+// The seeds of the hash functions of the signature values.
+var minHashSeeds = func() [MinHashSize]uint64 {
+	var seeds [MinHashSize]uint64
+	for i := range seeds {
+		seeds[i] = mixHash(uint64(i) + 0x9e3779b97f4a7c15)
+	}
+	return seeds
+}()
+
+// Scrambles the bits of the value (the finalizer of SplitMix64).
+func mixHash(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Computes MinHash signature of the item set, which must not be empty.
+func ComputeMinHashSignature(items []uint64) MinHashSignature {
+	var signature MinHashSignature
+	for i := range signature {
+		signature[i] = ^uint32(0)
+	}
+	for _, item := range items {
+		for i, seed := range minHashSeeds {
+			if h := uint32(mixHash(item ^ seed)); h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+	return signature
+}
+
+// Estimates Jaccard index of the item sets as value in range [0..1].
+func (s *MinHashSignature) EstimateJaccardIndex(other *MinHashSignature) float32 {
+	equal := 0
+	for i := range s {
+		if s[i] == other[i] {
+			equal++
+		}
+	}
+	return float32(equal) / MinHashSize
+}
+
+// Returns the hashes of the LSH bands of the signature. The hashes of
+// different bands never match.
+func (s *MinHashSignature) GetBandHashes() [MinHashBands]uint64 {
+	var hashes [MinHashBands]uint64
+	for band := range hashes {
+		h := uint64(band)
+		for _, value := range s[band*MinHashRows : (band+1)*MinHashRows] {
+			h = mixHash(h<<32 ^ h ^ uint64(value))
+		}
+		// The band number takes the highest bits to keep bands apart
+		hashes[band] = uint64(band)<<56 | h>>8
+	}
+	return hashes
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns the range of the items [from..to).
+func makeTestItemRange(from, to uint64) []uint64 {
+	items := make([]uint64, 0, to-from)
+	for item := from; item < to; item++ {
+		items = append(items, item)
+	}
+	return items
+}
+
+func TestMinHashSignature(t *testing.T) {
+	t.Run("should estimate Jaccard index", func(t *testing.T) {
+		type Fixture struct {
+			itemsA   []uint64
+			itemsB   []uint64
+			expected float64
+		}
+		fixtures := []Fixture{
+			{makeTestItemRange(0, 100), makeTestItemRange(0, 100), 1},
+			{makeTestItemRange(0, 100), makeTestItemRange(100, 200), 0},
+			{makeTestItemRange(0, 100), makeTestItemRange(50, 150), 1. / 3},
+			{makeTestItemRange(0, 100), makeTestItemRange(0, 50), 0.5},
+		}
+		for _, fixture := range fixtures {
+			a := ComputeMinHashSignature(fixture.itemsA)
+			b := ComputeMinHashSignature(fixture.itemsB)
+			got := float64(a.EstimateJaccardIndex(&b))
+			// The standard error is sqrt(s(1-s)/MinHashSize), about 0.06
+			if math.Abs(got-fixture.expected) > 0.2 {
+				t.Errorf("Expected Jaccard index about %f, got %f", fixture.expected, got)
+			}
+		}
+	})
+
+	t.Run("should not depend on the order of the items", func(t *testing.T) {
+		a := ComputeMinHashSignature([]uint64{1, 2, 3})
+		b := ComputeMinHashSignature([]uint64{3, 1, 2})
+		if a != b {
+			t.Errorf("Expected equal signatures, got %v and %v", a, b)
+		}
+	})
+
+	t.Run("should keep the band hashes apart", func(t *testing.T) {
+		a := ComputeMinHashSignature(makeTestItemRange(0, 10))
+		hashes := a.GetBandHashes()
+		seen := make(map[uint64]bool)
+		for _, h := range hashes {
+			if seen[h] {
+				t.Errorf("Duplicate band hash %d", h)
+			}
+			seen[h] = true
+		}
+	})
+}
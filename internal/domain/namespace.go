@@ -3,8 +3,39 @@ package domain
 import (
 	"context"
 	"recengine/internal/domain/valueobjects"
+	"time"
 )
 
+// Names of the files storing the data of a namespace relative to the base
+// path of the engine.
+type NamespaceFiles struct {
+	RecDB string `json:"recdb"`
+	Delta string `json:"delta"`
+	Index string `json:"index"`
+	// The inverted item index, which is absent in the manifests written
+	// before it was introduced.
+	ItemIndex string `json:"itemIndex,omitempty"`
+	// The MinHash signatures of the profiles, which are only kept by the
+	// namespaces searching similar profiles approximately.
+	Signatures string `json:"signatures,omitempty"`
+}
+
+// Returns the default file names of the namespace having the name.
+func MakeNamespaceFiles(name valueobjects.NamespaceName) NamespaceFiles {
+	return NamespaceFiles{
+		RecDB:      name.Value() + ".recdb",
+		Delta:      name.Value() + ".delta",
+		Index:      name.Value() + ".index",
+		ItemIndex:  name.Value() + ".items",
+		Signatures: name.Value() + ".minhash",
+	}
+}
+
+// Returns the paths of all the files relative to the base path.
+func (f NamespaceFiles) getPaths() []string {
+	return []string{f.RecDB, f.Delta, f.Index, f.ItemIndex, f.Signatures}
+}
+
 // Interface that domains of any type must implement.
 // Namespace performs the same function as databases in relational databases.
 type Namespace interface {
@@ -15,5 +46,45 @@ type Namespace interface {
 	SetMaxSimilarProfiles(limit uint)
 	GetMaxSimilarProfiles() uint
 	SetDislikeFactor(value float32)
+	GetDislikeFactor() float32
+	GetSimilarityMetric() valueobjects.SimilarityMetric
+	GetSearchMode() valueobjects.SearchMode
+	GetDurability() valueobjects.Durability
+	GetCreated() time.Time
+	GetFiles() NamespaceFiles
+	Compact() error
+	// Rewrites the database file in the current format version. The namespace
+	// must not be started.
+	Upgrade() (bool, error)
+	// Rebuilds the index of the database file from the file. The namespace
+	// must not be started.
+	RebuildIndex() error
+	// Stops the namespace and waits until it closes its files.
 	Stop()
 }
+
+// Interface of the namespaces storing likes and dislikes of the users.
+type LikeNamespace interface {
+	Namespace
+	GetProfile(user uint64) (*Profile, error)
+	DeleteProfile(user uint64) error
+	Like(user uint64, item uint64) error
+	Dislike(user uint64, item uint64) error
+	DeleteItem(user uint64, item uint64) error
+	DeleteLike(user uint64, item uint64) error
+	DeleteDislike(user uint64, item uint64) error
+	GetSimilarProfiles(user uint64, options *ListOptions) (*[]SimilarProfile, error)
+	GetSimilarProfilesTo(profile *Profile, options *ListOptions) (*[]SimilarProfile, error)
+	RecommendItems(user uint64, options *ListOptions) (*[]RecItem, error)
+}
+
+// Interface of the namespaces storing numeric scores the users rate items with.
+type RatingNamespace interface {
+	Namespace
+	GetProfile(user uint64) (*RatingProfile, error)
+	DeleteProfile(user uint64) error
+	Rate(user uint64, item uint64, score float32) error
+	DeleteItem(user uint64, item uint64) error
+	GetSimilarProfiles(user uint64, options *ListOptions) (*[]SimilarRatingProfile, error)
+	RecommendItems(user uint64, options *ListOptions) (*[]RecItem, error)
+}
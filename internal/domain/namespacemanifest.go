@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"recengine/internal/domain/valueobjects"
+	"time"
+)
+
+// Current version of the namespace manifest file format.
+const NamespaceManifestVersion = 1
+
+// The content of the file listing the namespaces of the engine.
+type namespaceManifest struct {
+	Version    int                      `json:"version"`
+	Namespaces []namespaceManifestEntry `json:"namespaces"`
+}
+
+// Namespace description stored in the manifest.
+type namespaceManifestEntry struct {
+	Name               string         `json:"name"`
+	Type               string         `json:"type"`
+	MaxSimilarProfiles uint           `json:"maxSimilarProfiles"`
+	DislikeFactor      float32        `json:"dislikeFactor"`
+	SimilarityMetric   string         `json:"similarityMetric,omitempty"`
+	SearchMode         string         `json:"searchMode,omitempty"`
+	Durability         string         `json:"durability,omitempty"`
+	Created            time.Time      `json:"created"`
+	Files              NamespaceFiles `json:"files"`
+}
+
+// Builds the manifest describing the namespaces.
+func makeNamespaceManifest(namespaces []Namespace) *namespaceManifest {
+	manifest := &namespaceManifest{
+		Version:    NamespaceManifestVersion,
+		Namespaces: make([]namespaceManifestEntry, len(namespaces)),
+	}
+	for i, ns := range namespaces {
+		manifest.Namespaces[i] = namespaceManifestEntry{
+			Name:               ns.GetName().Value(),
+			Type:               ns.GetType().Value(),
+			MaxSimilarProfiles: ns.GetMaxSimilarProfiles(),
+			DislikeFactor:      ns.GetDislikeFactor(),
+			SimilarityMetric:   ns.GetSimilarityMetric().Value(),
+			SearchMode:         ns.GetSearchMode().Value(),
+			Durability:         ns.GetDurability().Value(),
+			Created:            ns.GetCreated(),
+			Files:              ns.GetFiles(),
+		}
+	}
+	return manifest
+}
+
+// Decodes the manifest file content checking its version.
+func decodeNamespaceManifest(data []byte) (*namespaceManifest, error) {
+	manifest := &namespaceManifest{}
+	err := json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > NamespaceManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// Converts the manifest entry to the namespace creation request.
+func (e *namespaceManifestEntry) toCreateRequest() (*NamespaceCreateRequest, error) {
+	name, err := valueobjects.ParseNamespaceName(e.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, e.Name)
+	}
+	nsType, err := valueobjects.ParseNamespaceType(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := valueobjects.ParseSimilarityMetric(e.SimilarityMetric)
+	if err != nil {
+		return nil, err
+	}
+	searchMode, err := valueobjects.ParseSearchMode(e.SearchMode)
+	if err != nil {
+		return nil, err
+	}
+	durability, err := valueobjects.ParseDurability(e.Durability)
+	if err != nil {
+		return nil, err
+	}
+	return &NamespaceCreateRequest{
+		Name:               name,
+		Type:               nsType,
+		MaxSimilarProfiles: e.MaxSimilarProfiles,
+		DislikeFactor:      e.DislikeFactor,
+		SimilarityMetric:   metric,
+		SearchMode:         searchMode,
+		Durability:         durability,
+		Created:            e.Created,
+		Files:              e.Files,
+	}, nil
+}
+
+// Writes the file atomically: the data is written to a temporary file first,
+// which then replaces the target file.
+func writeFileAtomically(filePath string, data []byte) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
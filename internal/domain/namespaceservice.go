@@ -3,10 +3,15 @@ package domain
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"recengine/internal/domain/valueobjects"
 	"recengine/internal/helpers"
+	"strconv"
+	"sync"
+	"time"
 )
 
 // A DTO for creating a Namespace.
@@ -15,6 +20,23 @@ type NamespaceCreateRequest struct {
 	Type               valueobjects.NamespaceType
 	MaxSimilarProfiles uint
 	DislikeFactor      float32
+
+	// The measure of similarity of the profiles. The default one of the
+	// namespace type is used if zero.
+	SimilarityMetric valueobjects.SimilarityMetric
+
+	// How the similar profiles are searched for. Exact search is used if zero.
+	SearchMode valueobjects.SearchMode
+
+	// When the changes of the profiles are synced to the disk. They are
+	// synced once per processed action batch if zero.
+	Durability valueobjects.Durability
+
+	// Creation time of the namespace. The current time is used if zero.
+	Created time.Time
+
+	// File names of the namespace. The default ones are used if empty.
+	Files NamespaceFiles
 }
 
 // A DTO for updating a Namespace.
@@ -24,31 +46,57 @@ type NamespaceUpdateRequest struct {
 	DislikeFactor      float32
 }
 
+// The error returned on creating a namespace with the name of another one.
+var ErrNamespaceNameTaken = errors.New("the name is already taken")
+
 // Manages namespaces.
 type NamespaceService struct {
-	namespaces          []Namespace
-	context             context.Context
-	basePath            string
-	deltaStorageFactory DeltaStorageFactory
-	indexStorageFactory IndexStorageFactory
+	namespaces              []Namespace
+	context                 context.Context
+	basePath                string
+	trashDays               int
+	deltaStorageFactory     DeltaStorageFactory
+	likeStorageFactory      ProfileStorageFactory
+	ratingStorageFactory    ProfileStorageFactory
+	indexStorageFactory     IndexStorageFactory
+	itemIndexStorageFactory ItemIndexStorageFactory
+	signatureStorageFactory SignatureStorageFactory
+	// The lock file guarding the directory against other processes.
+	lockFile *os.File
+	// Guards the namespace list, which is modified by the API handlers.
+	mutex sync.RWMutex
 }
 
 // Creates a NamespaceService.
 func NewNamespaceService(
 	context context.Context,
 	deltaStorageFactory DeltaStorageFactory,
+	likeStorageFactory ProfileStorageFactory,
+	ratingStorageFactory ProfileStorageFactory,
 	indexStorageFactory IndexStorageFactory,
+	itemIndexStorageFactory ItemIndexStorageFactory,
+	signatureStorageFactory SignatureStorageFactory,
 ) *NamespaceService {
 	basePath := os.Getenv("REC_PATH")
 	if basePath != "" && basePath[len(basePath)-1] != '/' {
 		basePath = basePath + "/"
 	}
+	// The files of the deleted namespaces are removed immediately by default
+	trashDays, err := strconv.Atoi(os.Getenv("REC_TRASH_DAYS"))
+	if err != nil || trashDays < 0 {
+		trashDays = 0
+	}
 	return &NamespaceService{
-		namespaces:          make([]Namespace, 0),
-		context:             context,
-		basePath:            basePath,
-		deltaStorageFactory: deltaStorageFactory,
-		indexStorageFactory: indexStorageFactory,
+		namespaces:              make([]Namespace, 0),
+		context:                 context,
+		basePath:                basePath,
+		trashDays:               trashDays,
+		deltaStorageFactory:     deltaStorageFactory,
+		likeStorageFactory:      likeStorageFactory,
+		ratingStorageFactory:    ratingStorageFactory,
+		indexStorageFactory:     indexStorageFactory,
+		itemIndexStorageFactory: itemIndexStorageFactory,
+		signatureStorageFactory: signatureStorageFactory,
 	}
 }
 
@@ -57,13 +105,47 @@ func (s *NamespaceService) forgeNamespace(dto *NamespaceCreateRequest) (Namespac
 	switch dto.Type.Value() {
 	case valueobjects.NamespaceTypeLike:
 		dto := LikeNamespaceDto{
-			Name:                dto.Name,
-			MaxSimilarProfiles:  dto.MaxSimilarProfiles,
-			DislikeFactor:       dto.DislikeFactor,
-			DeltaStorageFactory: s.deltaStorageFactory,
-			IndexStorageFactory: s.indexStorageFactory,
+			Name:                    dto.Name,
+			MaxSimilarProfiles:      dto.MaxSimilarProfiles,
+			DislikeFactor:           dto.DislikeFactor,
+			SimilarityMetric:        dto.SimilarityMetric,
+			SearchMode:              dto.SearchMode,
+			Durability:              dto.Durability,
+			Created:                 dto.Created,
+			BasePath:                s.basePath,
+			Files:                   dto.Files,
+			DeltaStorageFactory:     s.deltaStorageFactory,
+			LikeStorageFactory:      s.likeStorageFactory,
+			IndexStorageFactory:     s.indexStorageFactory,
+			ItemIndexStorageFactory: s.itemIndexStorageFactory,
+			SignatureStorageFactory: s.signatureStorageFactory,
+		}
+		ns, err := NewLikeNamespace(&dto)
+		if err != nil {
+			return nil, err
+		}
+		return ns, nil
+	case valueobjects.NamespaceTypeRating:
+		if dto.SearchMode.IsApproximate() {
+			return nil, fmt.Errorf("rating namespaces don't support approximate search")
+		}
+		dto := RatingNamespaceDto{
+			Name:                    dto.Name,
+			MaxSimilarProfiles:      dto.MaxSimilarProfiles,
+			SimilarityMetric:        dto.SimilarityMetric,
+			Durability:              dto.Durability,
+			Created:                 dto.Created,
+			BasePath:                s.basePath,
+			Files:                   dto.Files,
+			DeltaStorageFactory:     s.deltaStorageFactory,
+			RatingStorageFactory:    s.ratingStorageFactory,
+			IndexStorageFactory:     s.indexStorageFactory,
+			ItemIndexStorageFactory: s.itemIndexStorageFactory,
+		}
+		ns, err := NewRatingNamespace(&dto)
+		if err != nil {
+			return nil, err
 		}
-		ns := NewLikeNamespace(&dto)
 		return ns, nil
 	default:
 		return nil, fmt.Errorf("unknown domain type %s", dto.Type)
@@ -72,40 +154,103 @@ func (s *NamespaceService) forgeNamespace(dto *NamespaceCreateRequest) (Namespac
 
 // Starts all namespaces to run their jobs on separate threads.
 func (s *NamespaceService) Start(ctx context.Context) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	if err := s.purgeTrash(); err != nil {
+		log.Printf("Warning: failed to purge the trash: %v\n", err)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	for _, ns := range s.namespaces {
-		ns.Start(ctx)
+		if err := ns.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start namespace %s: %v", ns.GetName().Value(), err)
+		}
 	}
 	return nil
 }
 
+// Stops all namespaces and waits until they close their files.
+func (s *NamespaceService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, ns := range s.namespaces {
+		ns.Stop()
+	}
+	if s.lockFile != nil {
+		s.lockFile.Close()
+		s.lockFile = nil
+	}
+}
+
 func (s *NamespaceService) getNamespacesJsonPath() string {
 	return s.basePath + "namespaces.json"
 }
 
+// Takes the exclusive lock of the directory unless it's already held, so
+// that no other process opens the files of the namespaces.
+func (s *NamespaceService) lock() error {
+	if s.lockFile != nil {
+		return nil
+	}
+	filePath := s.basePath + helpers.LockFileName
+	file, err := helpers.OpenLockFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", filePath, err)
+	}
+	s.lockFile = file
+	return nil
+}
+
 // Loads namespace list from the file.
 // Warning the function is not thread-safe, so must be called only before
 // starting the engine.
 func (s *NamespaceService) LoadNamespaces() error {
+	if err := s.lock(); err != nil {
+		return err
+	}
 	filePath := s.getNamespacesJsonPath()
 	data, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open %s: %v", filePath, err)
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
 	}
-	err = json.Unmarshal(data, &s.namespaces)
+	manifest, err := decodeNamespaceManifest(data)
 	if err != nil {
-		return fmt.Errorf("failed to decode %s: %v", filePath, err)
+		return fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+	namespaces := make([]Namespace, 0, len(manifest.Namespaces))
+	for _, entry := range manifest.Namespaces {
+		dto, err := entry.toCreateRequest()
+		if err != nil {
+			return fmt.Errorf("invalid namespace in %s: %w", filePath, err)
+		}
+		ns, err := s.forgeNamespace(dto)
+		if err != nil {
+			return fmt.Errorf("invalid namespace in %s: %w", filePath, err)
+		}
+		namespaces = append(namespaces, ns)
 	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.namespaces = namespaces
 	return nil
 }
 
 // Saves namespace list to the file.
 func (s *NamespaceService) SaveNamespaces() error {
-	data, err := json.Marshal(s.namespaces)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.saveNamespaces()
+}
+
+// Saves namespace list to the file. The caller must hold the mutex.
+func (s *NamespaceService) saveNamespaces() error {
+	data, err := json.MarshalIndent(makeNamespaceManifest(s.namespaces), "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to encode namespaces: %v", err)
 	}
 	filePath := s.getNamespacesJsonPath()
-	err = os.WriteFile(filePath, data, 0644)
+	err = writeFileAtomically(filePath, data)
 	if err != nil {
 		return fmt.Errorf("failed to write to %s: %v", filePath, err)
 	}
@@ -114,10 +259,13 @@ func (s *NamespaceService) SaveNamespaces() error {
 
 // Returns the list of currently loaded namespaces.
 func (s *NamespaceService) GetNamespaces() []Namespace {
-	return s.namespaces
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]Namespace{}, s.namespaces...)
 }
 
-// Returns the index of the namespace in the namespace list.
+// Returns the index of the namespace in the namespace list. The caller must
+// hold the mutex.
 func (s *NamespaceService) getNamespaceIndexByName(name valueobjects.NamespaceName) int {
 	for i, ns := range s.namespaces {
 		if ns.GetName() == name {
@@ -129,6 +277,8 @@ func (s *NamespaceService) getNamespaceIndexByName(name valueobjects.NamespaceNa
 
 // Returns the pointer to the namespace by its name, or nil if not found.
 func (s *NamespaceService) GetNamespaceByName(name valueobjects.NamespaceName) Namespace {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 	index := s.getNamespaceIndexByName(name)
 	if index < 0 {
 		return nil
@@ -136,19 +286,25 @@ func (s *NamespaceService) GetNamespaceByName(name valueobjects.NamespaceName) N
 	return s.namespaces[index]
 }
 
-// Adds domain registration to the engine and persists the change.
+// Adds domain registration to the engine, starts the namespace and persists
+// the change.
 func (s *NamespaceService) CreateNamespace(
 	dto *NamespaceCreateRequest,
 ) (Namespace, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	if s.getNamespaceIndexByName(dto.Name) >= 0 {
-		return nil, fmt.Errorf("namespace name %s is already taken", dto.Name)
+		return nil, fmt.Errorf("namespace %s: %w", dto.Name, ErrNamespaceNameTaken)
 	}
 	ns, err := s.forgeNamespace(dto)
 	if err != nil {
 		return nil, err
 	}
+	if err = ns.Start(s.context); err != nil {
+		return nil, err
+	}
 	s.namespaces = append(s.namespaces, ns)
-	if err = s.SaveNamespaces(); err != nil {
+	if err = s.saveNamespaces(); err != nil {
 		return nil, err
 	}
 	return ns, nil
@@ -159,10 +315,13 @@ func (s *NamespaceService) UpdateNamespace(
 	name valueobjects.NamespaceName,
 	dto *NamespaceUpdateRequest,
 ) (Namespace, error) {
-	ns := s.GetNamespaceByName(name)
-	if ns == nil {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	index := s.getNamespaceIndexByName(name)
+	if index < 0 {
 		return nil, fmt.Errorf("namespace %s not found", name)
 	}
+	ns := s.namespaces[index]
 	if ns.GetName() != dto.Name && s.getNamespaceIndexByName(dto.Name) >= 0 {
 		return nil, fmt.Errorf("namespace name %s is already taken", dto.Name)
 	}
@@ -171,23 +330,109 @@ func (s *NamespaceService) UpdateNamespace(
 	}
 	ns.SetDislikeFactor(dto.DislikeFactor)
 	ns.SetMaxSimilarProfiles(dto.MaxSimilarProfiles)
-	if err := s.SaveNamespaces(); err != nil {
+	if err := s.saveNamespaces(); err != nil {
 		return nil, err
 	}
 	return ns, nil
 }
 
-// Removes namespace registration from the engine and persists the change.
-// The deleted namespace stops running automatically.
+// Removes namespace registration from the engine, persists the change and
+// removes the namespace files. The deleted namespace stops running
+// automatically. If the trash is enabled, the files are moved to the trash
+// directory instead of being removed.
 func (s *NamespaceService) DeleteNamespace(name valueobjects.NamespaceName) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 	index := s.getNamespaceIndexByName(name)
 	if index < 0 {
 		return fmt.Errorf("no namespace %s", name)
 	}
-	s.namespaces[index].Stop()
+	ns := s.namespaces[index]
+	ns.Stop()
 	s.namespaces = helpers.Remove(s.namespaces, index)
-	if err := s.SaveNamespaces(); err != nil {
+	if err := s.saveNamespaces(); err != nil {
+		return err
+	}
+	paths := ns.GetFiles().getPaths()
+	if s.trashDays > 0 {
+		return s.moveToTrash(name, paths)
+	}
+	for _, path := range paths {
+		err := os.Remove(s.basePath + path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// Rewrites the database files of the namespaces in the current format
+// version. Must be called only before starting the engine.
+func (s *NamespaceService) UpgradeNamespaces() error {
+	for _, ns := range s.namespaces {
+		upgraded, err := ns.Upgrade()
+		if err != nil {
+			return fmt.Errorf("failed to upgrade namespace %s: %v", ns.GetName().Value(), err)
+		}
+		if upgraded {
+			log.Printf("Namespace %s upgraded\n", ns.GetName().Value())
+		}
+	}
+	return nil
+}
+
+// Rebuilds the indexes of the database files of the namespaces from the
+// files. Must be called only before starting the engine.
+func (s *NamespaceService) RebuildIndexes() error {
+	for _, ns := range s.namespaces {
+		if err := ns.RebuildIndex(); err != nil {
+			return fmt.Errorf("failed to rebuild index of namespace %s: %v", ns.GetName().Value(), err)
+		}
+		log.Printf("Namespace %s index rebuilt\n", ns.GetName().Value())
+	}
+	return nil
+}
+
+func (s *NamespaceService) getTrashPath() string {
+	return s.basePath + "trash/"
+}
+
+// Moves the files of the deleted namespace to a new directory in the trash.
+func (s *NamespaceService) moveToTrash(name valueobjects.NamespaceName, paths []string) error {
+	dirPath := fmt.Sprintf("%s%s.%d/", s.getTrashPath(), name.Value(), time.Now().UnixNano())
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", dirPath, err)
+	}
+	for _, path := range paths {
+		err := os.Rename(s.basePath+path, dirPath+path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to move %s to the trash: %v", path, err)
+		}
+	}
+	return s.purgeTrash()
+}
+
+// Removes the files that have been in the trash longer than configured.
+func (s *NamespaceService) purgeTrash() error {
+	entries, err := os.ReadDir(s.getTrashPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
+	expiration := time.Now().Add(-time.Duration(s.trashDays) * 24 * time.Hour)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(expiration) {
+			err = os.RemoveAll(s.getTrashPath() + entry.Name())
+			if err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
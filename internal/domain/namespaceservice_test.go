@@ -0,0 +1,560 @@
+package domain_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+	"recengine/internal/helpers"
+	"recengine/internal/infra/delta"
+	"recengine/internal/infra/index"
+	"recengine/internal/infra/itemindex"
+	"recengine/internal/infra/minhash"
+	"recengine/internal/infra/recdb"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Creates a namespace service storing the files in the directory.
+func makeTestNamespaceService(t *testing.T, ctx context.Context, dir string) *domain.NamespaceService {
+	t.Setenv("REC_PATH", dir)
+	service := domain.NewNamespaceService(
+		ctx,
+		delta.NewStorageFactory(),
+		recdb.NewStorageFactory(),
+		recdb.NewRatingStorageFactory(),
+		index.NewStorageFactory(),
+		itemindex.NewStorageFactory(),
+		minhash.NewStorageFactory(),
+	)
+	// The namespaces must close their files before the directory is removed
+	t.Cleanup(service.Stop)
+	return service
+}
+
+func TestNamespaceServiceSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("should restore created namespaces after restart", func(t *testing.T) {
+		service := makeTestNamespaceService(t, ctx, dir)
+		llr, _ := valueobjects.ParseSimilarityMetric(valueobjects.SimilarityMetricLogLikelihood)
+		requests := []domain.NamespaceCreateRequest{
+			{Type: valueobjects.MakeLikeNamespaceType(), MaxSimilarProfiles: 10, DislikeFactor: 0.25},
+			{
+				Type:               valueobjects.MakeLikeNamespaceType(),
+				MaxSimilarProfiles: 20,
+				DislikeFactor:      0.75,
+				SimilarityMetric:   llr,
+				SearchMode:         valueobjects.MakeApproximateSearchMode(),
+			},
+			{
+				Type:               valueobjects.MakeRatingNamespaceType(),
+				MaxSimilarProfiles: 30,
+				SimilarityMetric:   valueobjects.MakeCosineSimilarityMetric(),
+				Durability:         valueobjects.MakeIntervalDurability(100 * time.Millisecond),
+			},
+		}
+		for i, name := range []string{"movies", "books", "stars"} {
+			requests[i].Name, _ = valueobjects.ParseNamespaceName(name)
+			if _, err := service.CreateNamespace(&requests[i]); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "namespaces.json.tmp")); !os.IsNotExist(err) {
+			t.Error("The temporary manifest file is left")
+		}
+		cancel()
+
+		restarted := makeTestNamespaceService(t, context.Background(), dir)
+		if err := restarted.LoadNamespaces(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		saved := service.GetNamespaces()
+		loaded := restarted.GetNamespaces()
+		if len(loaded) != len(saved) {
+			t.Fatalf("Expected %d namespaces, got %d", len(saved), len(loaded))
+		}
+		for i := range saved {
+			if loaded[i].GetName() != saved[i].GetName() ||
+				loaded[i].GetType() != saved[i].GetType() ||
+				loaded[i].GetMaxSimilarProfiles() != saved[i].GetMaxSimilarProfiles() ||
+				loaded[i].GetDislikeFactor() != saved[i].GetDislikeFactor() ||
+				loaded[i].GetSimilarityMetric() != saved[i].GetSimilarityMetric() ||
+				loaded[i].GetSearchMode() != saved[i].GetSearchMode() ||
+				loaded[i].GetDurability() != saved[i].GetDurability() ||
+				!loaded[i].GetCreated().Equal(saved[i].GetCreated()) ||
+				loaded[i].GetFiles() != saved[i].GetFiles() {
+				t.Errorf("Namespace %s hasn't been restored properly", saved[i].GetName().Value())
+			}
+		}
+	})
+
+	t.Run("should fail loading unsupported manifest version", func(t *testing.T) {
+		filePath := filepath.Join(dir, "namespaces.json")
+		err := os.WriteFile(filePath, []byte(`{"version":1000,"namespaces":[]}`), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		service := makeTestNamespaceService(t, context.Background(), dir)
+		err = service.LoadNamespaces()
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected an error other than a missing manifest, got %v", err)
+		}
+	})
+
+	t.Run("should report a missing manifest", func(t *testing.T) {
+		service := makeTestNamespaceService(t, context.Background(), t.TempDir())
+		if err := service.LoadNamespaces(); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+	})
+}
+
+func TestNamespaceServiceCreateNamespace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service := makeTestNamespaceService(t, ctx, t.TempDir())
+
+	t.Run("should reject similarity metrics not applicable to the type", func(t *testing.T) {
+		jaccard, _ := valueobjects.ParseSimilarityMetric(valueobjects.SimilarityMetricJaccard)
+		requests := []domain.NamespaceCreateRequest{
+			{
+				Type:             valueobjects.MakeLikeNamespaceType(),
+				SimilarityMetric: valueobjects.MakePearsonSimilarityMetric(),
+			},
+			{
+				Type:             valueobjects.MakeRatingNamespaceType(),
+				SimilarityMetric: jaccard,
+			},
+		}
+		for i := range requests {
+			requests[i].Name, _ = valueobjects.ParseNamespaceName("movies")
+			if _, err := service.CreateNamespace(&requests[i]); err == nil {
+				t.Errorf("Created %s namespace with %s metric", requests[i].Type.Value(),
+					requests[i].SimilarityMetric.Value())
+			}
+		}
+	})
+
+	t.Run("should reject approximate search of rating namespaces", func(t *testing.T) {
+		request := domain.NamespaceCreateRequest{
+			Type:       valueobjects.MakeRatingNamespaceType(),
+			SearchMode: valueobjects.MakeApproximateSearchMode(),
+		}
+		request.Name, _ = valueobjects.ParseNamespaceName("stars")
+		if _, err := service.CreateNamespace(&request); err == nil {
+			t.Error("Created rating namespace searching approximately")
+		}
+	})
+}
+
+func TestNamespaceServiceUpdateNamespace(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service := makeTestNamespaceService(t, ctx, dir)
+	oldName, _ := valueobjects.ParseNamespaceName("movies")
+	newName, _ := valueobjects.ParseNamespaceName("films")
+	ns, err := service.CreateNamespace(&domain.NamespaceCreateRequest{
+		Name:          oldName,
+		Type:          valueobjects.MakeLikeNamespaceType(),
+		DislikeFactor: 0.5,
+	})
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	likeNs := ns.(domain.LikeNamespace)
+	if err = likeNs.Like(1, 42); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	t.Run("should rename the namespace files", func(t *testing.T) {
+		_, err := service.UpdateNamespace(oldName, &domain.NamespaceUpdateRequest{
+			Name:          newName,
+			DislikeFactor: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if service.GetNamespaceByName(newName) == nil {
+			t.Error("The namespace cannot be found by the new name")
+		}
+		oldFiles := domain.MakeNamespaceFiles(oldName)
+		newFiles := domain.MakeNamespaceFiles(newName)
+		if ns.GetFiles() != newFiles {
+			t.Errorf("Expected files %v, got %v", newFiles, ns.GetFiles())
+		}
+		for _, file := range []string{oldFiles.RecDB, oldFiles.Delta, oldFiles.Index, oldFiles.ItemIndex} {
+			if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+				t.Errorf("The file %s still exists", file)
+			}
+		}
+		for _, file := range []string{newFiles.RecDB, newFiles.Delta, newFiles.Index, newFiles.ItemIndex} {
+			if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+				t.Errorf("The file %s doesn't exist: %v", file, err)
+			}
+		}
+		profile, err := likeNs.GetProfile(1)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if profile == nil || len(profile.Likes) != 1 || profile.Likes[0] != 42 {
+			t.Errorf("The profile has been lost after renaming: %v", profile)
+		}
+	})
+
+	t.Run("should keep the name if the files cannot be renamed", func(t *testing.T) {
+		takenFiles := domain.MakeNamespaceFiles(oldName)
+		err := os.WriteFile(filepath.Join(dir, takenFiles.Index), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = service.UpdateNamespace(newName, &domain.NamespaceUpdateRequest{
+			Name:          oldName,
+			DislikeFactor: 0.5,
+		})
+		if err == nil {
+			t.Error("Renamed the namespace over existing files without an error")
+		}
+		if ns.GetName() != newName {
+			t.Errorf("Expected name %s, got %s", newName.Value(), ns.GetName().Value())
+		}
+		if _, err := likeNs.GetProfile(1); err != nil {
+			t.Errorf("The namespace doesn't work after failed renaming: %v", err)
+		}
+	})
+}
+
+func TestNamespaceServiceConcurrentAccess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service := makeTestNamespaceService(t, ctx, t.TempDir())
+	names := []string{"movies", "books", "songs", "games"}
+	var wg sync.WaitGroup
+	for _, value := range names {
+		name, _ := valueobjects.ParseNamespaceName(value)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := service.CreateNamespace(&domain.NamespaceCreateRequest{
+				Name:          name,
+				Type:          valueobjects.MakeLikeNamespaceType(),
+				DislikeFactor: 0.5,
+			})
+			if err != nil {
+				t.Errorf("Got error: %v", err)
+				return
+			}
+			if err = service.DeleteNamespace(name); err != nil {
+				t.Errorf("Got error: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				service.GetNamespaceByName(name)
+				service.GetNamespaces()
+			}
+		}()
+	}
+	wg.Wait()
+	if namespaces := service.GetNamespaces(); len(namespaces) != 0 {
+		t.Errorf("Expected no namespaces, got %d", len(namespaces))
+	}
+}
+
+func TestNamespaceServiceDeleteNamespace(t *testing.T) {
+	// Creates a namespace and returns the paths of its files.
+	createNamespace := func(t *testing.T, service *domain.NamespaceService) []string {
+		name, _ := valueobjects.ParseNamespaceName("movies")
+		ns, err := service.CreateNamespace(&domain.NamespaceCreateRequest{
+			Name:          name,
+			Type:          valueobjects.MakeLikeNamespaceType(),
+			DislikeFactor: 0.5,
+		})
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		files := ns.GetFiles()
+		return []string{files.RecDB, files.Delta, files.Index, files.ItemIndex}
+	}
+	name, _ := valueobjects.ParseNamespaceName("movies")
+
+	t.Run("should remove the namespace files", func(t *testing.T) {
+		dir := t.TempDir()
+		service := makeTestNamespaceService(t, context.Background(), dir)
+		files := createNamespace(t, service)
+		if err := service.DeleteNamespace(name); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if service.GetNamespaceByName(name) != nil {
+			t.Error("The namespace hasn't been removed")
+		}
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(dir, file)); !os.IsNotExist(err) {
+				t.Errorf("The file %s still exists", file)
+			}
+		}
+	})
+
+	t.Run("should move the namespace files to the trash", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("REC_TRASH_DAYS", "3")
+		service := makeTestNamespaceService(t, context.Background(), dir)
+		// Make an expired trash entry
+		expiredPath := filepath.Join(dir, "trash", "books.1")
+		if err := os.MkdirAll(expiredPath, 0755); err != nil {
+			t.Fatal(err)
+		}
+		expirationTime := time.Now().Add(-4 * 24 * time.Hour)
+		if err := os.Chtimes(expiredPath, expirationTime, expirationTime); err != nil {
+			t.Fatal(err)
+		}
+		files := createNamespace(t, service)
+		if err := service.DeleteNamespace(name); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if _, err := os.Stat(expiredPath); !os.IsNotExist(err) {
+			t.Error("The expired trash entry hasn't been purged")
+		}
+		trashed, err := filepath.Glob(filepath.Join(dir, "trash", "movies.*"))
+		if err != nil || len(trashed) != 1 {
+			t.Fatalf("Expected the namespace to be in the trash, got %v", trashed)
+		}
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(trashed[0], file)); err != nil {
+				t.Errorf("The file %s isn't in the trash: %v", file, err)
+			}
+		}
+	})
+}
+
+// Likes items in the namespace of the durability from several goroutines
+// until the process is killed, printing the acknowledged users.
+func runCrashingLikes(t *testing.T, dir string, durability string) {
+	service := makeTestNamespaceService(t, context.Background(), dir)
+	request := domain.NamespaceCreateRequest{Type: valueobjects.MakeLikeNamespaceType()}
+	request.Name, _ = valueobjects.ParseNamespaceName("crash")
+	request.Durability, _ = valueobjects.ParseDurability(durability)
+	ns, err := service.CreateNamespace(&request)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	const numWriters = 8
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < numWriters; i++ {
+		wg.Add(1)
+		go func(user uint64) {
+			defer wg.Done()
+			for ; ; user += numWriters {
+				if err := ns.(domain.LikeNamespace).Like(user, user+1); err != nil {
+					return
+				}
+				mutex.Lock()
+				fmt.Printf("ack %d\n", user)
+				mutex.Unlock()
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+}
+
+func TestNamespaceCrashDurability(t *testing.T) {
+	if dir := os.Getenv("REC_CRASH_TEST_PATH"); dir != "" {
+		runCrashingLikes(t, dir, os.Getenv("REC_CRASH_TEST_DURABILITY"))
+		return
+	}
+	for _, durability := range []string{valueobjects.DurabilityBatch, valueobjects.DurabilityAlways} {
+		t.Run("shouldn't lose acknowledged likes with "+durability+" durability", func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestNamespaceCrashDurability$")
+			cmd.Env = append(os.Environ(),
+				"REC_CRASH_TEST_PATH="+dir+"/",
+				"REC_CRASH_TEST_DURABILITY="+durability,
+			)
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			// Kill the child once enough likes have been acknowledged
+			acked := make([]uint64, 0)
+			scanner := bufio.NewScanner(stdout)
+			for len(acked) < 100 && scanner.Scan() {
+				if line := scanner.Text(); strings.HasPrefix(line, "ack ") {
+					n, _ := strconv.ParseUint(line[len("ack "):], 10, 64)
+					acked = append(acked, n)
+				}
+			}
+			cmd.Process.Kill()
+			cmd.Wait()
+			if len(acked) < 100 {
+				t.Fatalf("The child has exited after %d likes", len(acked))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			service := makeTestNamespaceService(t, ctx, dir)
+			if err = service.LoadNamespaces(); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if err = service.Start(ctx); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			defer service.Stop()
+			name, _ := valueobjects.ParseNamespaceName("crash")
+			ns := service.GetNamespaceByName(name).(domain.LikeNamespace)
+			// The profiles are requested at once to be read in a single batch
+			var wg sync.WaitGroup
+			for _, user := range acked {
+				wg.Add(1)
+				go func(user uint64) {
+					defer wg.Done()
+					profile, err := ns.GetProfile(user)
+					if err != nil {
+						t.Errorf("Got error: %v", err)
+					} else if profile == nil || len(profile.Likes) != 1 || profile.Likes[0] != user+1 {
+						t.Errorf("The acknowledged like of user %d has been lost: %v", user, profile)
+					}
+				}(user)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestNamespaceServiceRebuildIndex(t *testing.T) {
+	dir := t.TempDir() + "/"
+	name, _ := valueobjects.ParseNamespaceName("movies")
+	ctx, cancel := context.WithCancel(context.Background())
+	service := makeTestNamespaceService(t, ctx, dir)
+	if err := service.Start(ctx); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	request := domain.NamespaceCreateRequest{Name: name, Type: valueobjects.MakeLikeNamespaceType()}
+	ns, err := service.CreateNamespace(&request)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for user := uint64(1); user <= 3; user++ {
+		if err = ns.(domain.LikeNamespace).Like(user, user+1); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+	}
+	if err = ns.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	service.Stop()
+	cancel()
+	indexPath := dir + ns.GetFiles().Index
+
+	// Restarts the service and checks the profiles.
+	checkProfiles := func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		service := makeTestNamespaceService(t, ctx, dir)
+		if err := service.LoadNamespaces(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer service.Stop()
+		ns := service.GetNamespaceByName(name).(domain.LikeNamespace)
+		for user := uint64(1); user <= 3; user++ {
+			profile, err := ns.GetProfile(user)
+			if err != nil || profile == nil || len(profile.Likes) != 1 || profile.Likes[0] != user+1 {
+				t.Errorf("Unexpected profile of user %d: %v, %v", user, profile, err)
+			}
+		}
+	}
+
+	t.Run("should rebuild a corrupted index upon start", func(t *testing.T) {
+		data, err := os.ReadFile(indexPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[len(data)-1]++
+		if err = os.WriteFile(indexPath, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		checkProfiles(t)
+	})
+
+	t.Run("should rebuild the index on demand", func(t *testing.T) {
+		if err := os.WriteFile(indexPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		service := makeTestNamespaceService(t, context.Background(), dir)
+		if err := service.LoadNamespaces(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if err := service.RebuildIndexes(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		service.Stop()
+		if info, err := os.Stat(indexPath); err != nil || info.Size() == 0 {
+			t.Fatalf("Expected the index to be rebuilt, got %v", err)
+		}
+		checkProfiles(t)
+	})
+}
+
+func TestNamespaceServiceLock(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The files aren't locked on Windows")
+	}
+	dir := t.TempDir() + "/"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	service := makeTestNamespaceService(t, ctx, dir)
+	if err := service.Start(ctx); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	name, _ := valueobjects.ParseNamespaceName("movies")
+	request := domain.NamespaceCreateRequest{Name: name, Type: valueobjects.MakeLikeNamespaceType()}
+	if _, err := service.CreateNamespace(&request); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	t.Run("should refuse to load the namespaces locked by another service", func(t *testing.T) {
+		other := makeTestNamespaceService(t, ctx, dir)
+		err := other.LoadNamespaces()
+		var lockedErr *helpers.FileLockedError
+		if !errors.As(err, &lockedErr) {
+			t.Fatalf("Expected FileLockedError, got %v", err)
+		}
+		if lockedErr.PID != os.Getpid() {
+			t.Errorf("Expected the PID %d, got %d", os.Getpid(), lockedErr.PID)
+		}
+		if !strings.Contains(err.Error(), strconv.Itoa(os.Getpid())) {
+			t.Errorf("Expected the error to name the PID, got %v", err)
+		}
+	})
+
+	t.Run("should load the namespaces once the lock is released", func(t *testing.T) {
+		service.Stop()
+		other := makeTestNamespaceService(t, ctx, dir)
+		if err := other.LoadNamespaces(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if err := other.Start(ctx); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		other.Stop()
+	})
+}
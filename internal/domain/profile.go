@@ -29,6 +29,27 @@ func NewProfile(UserID uint64) *Profile {
 	}
 }
 
+// Returns a deep copy of the profile.
+func (p *Profile) Clone() *Profile {
+	return &Profile{
+		UserID:   p.UserID,
+		Likes:    append(make([]uint64, 0, len(p.Likes)), p.Likes...),
+		Dislikes: append(make([]uint64, 0, len(p.Dislikes)), p.Dislikes...),
+	}
+}
+
+// Returns the ID of the user the profile belongs to.
+func (p *Profile) GetUserID() uint64 {
+	return p.UserID
+}
+
+// Returns the IDs of the liked and the disliked items.
+func (p *Profile) GetItems() []uint64 {
+	items := make([]uint64, 0, len(p.Likes)+len(p.Dislikes))
+	items = append(items, p.Likes...)
+	return append(items, p.Dislikes...)
+}
+
 // Returns 1 if the profile contains the item and it's liked, -1 if disliked and
 // 0 if the profile doesn't have the item.
 func (p *Profile) QualifyItem(item uint64) int {
@@ -75,31 +96,11 @@ func (p *Profile) RemoveItem(item uint64) {
 	p.Undislike(item)
 }
 
-// Computes the degree of similarity between two sets as value in range [0..1].
-// Given sets A and B, similarity rate = | A ^ B | / | A v B |
-// The second returned value is the size of the union of the sets.
-func computeSimilarityBetweenSets(itemsA []uint64, itemsB []uint64) (float32, int) {
-	conjunction := 0
-	for _, item := range itemsA {
-		if helpers.BinaryIndexOf(itemsB, item) >= 0 {
-			conjunction++
-		}
-	}
-	disjunction := len(itemsA) + len(itemsB) - conjunction
-	if disjunction == 0 {
-		return 0, 0
-	}
-	return float32(conjunction) / float32(disjunction), disjunction
-}
-
 // Computes similarity between two profiles as value in range [0..100].
-// The value is computed as weighted sum of similarities of likes and dislikes.
-// The dislikeFactor is the value from 0 to 1 that may be used to change
-// the contribution of dislikes to the result.
+// The value is computed as weighted sum of Jaccard indices of likes and
+// dislikes. The dislikeFactor is the value from 0 to 1 that may be used to
+// change the contribution of dislikes to the result.
 func (p1 *Profile) ComputeSimilarity(p2 Profile, dislikeFactor float32) float32 {
-	likesSim, likesWeight := computeSimilarityBetweenSets(p1.Likes, p2.Likes)
-	dislikesSim, dislikesWeight := computeSimilarityBetweenSets(p1.Dislikes, p2.Dislikes)
-	dislikesWeight = int(float32(dislikesWeight) * dislikeFactor)
-	return 100 * ((likesSim*float32(likesWeight) + dislikesSim*float32(dislikesWeight)) /
-		(float32(likesWeight) + float32(dislikesWeight)))
+	jaccard := setSimilarityMetric{compareSets: computeJaccardIndex}
+	return jaccard.ComputeSimilarity(p1, &p2, SimilarityParams{DislikeFactor: dislikeFactor})
 }
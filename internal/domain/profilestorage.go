@@ -0,0 +1,21 @@
+package domain
+
+// Represents an abstract profile data storage.
+type ProfileStorage interface {
+	// Closes the storage file. The files not closed with this
+	// function are considered broken and require recovery.
+	Close() error
+
+	// Executes a set of tasks sequently reading and/or modifiying entries in
+	// the corresponding database file.
+	ProcessActions(actions []Action) error
+
+	// Applies all the operations of the delta storage to the database file,
+	// updates the index storage accordingly and resets the delta storage.
+	Compact() error
+
+	// Returns the share of the database file taken by the deleted entries,
+	// which can be reused by the relocated profiles. The file is worth being
+	// rewritten if the share grows large.
+	GetFragmentation() float64
+}
@@ -0,0 +1,56 @@
+package domain
+
+// ProfileStorage factory.
+type ProfileStorageFactory interface {
+	// If the file is corrupted, recovers it making its data consistent.
+	// All inconsistent data is skipped (removed).  The file is considered
+	// corrupted if it's locked, which means it hasn't been closed properly.
+	Recover(file RandomAccessFile) error
+
+	// Rewrites the entries of the database file in the current file format
+	// version into the empty destination file, filling the index storage with
+	// their new offsets. The file is recovered first if it's corrupted.
+	// Returns false without writing anything if the file is up to date.
+	Upgrade(src RandomAccessFile, dst RandomAccessFile, indexStorage IndexStorage) (bool, error)
+
+	// Rewrites the entries of the database file into the empty destination
+	// file like Upgrade() does, even if the file is up to date. The deleted
+	// entries are dropped, so the file isn't fragmented anymore.
+	Rewrite(src RandomAccessFile, dst RandomAccessFile, indexStorage IndexStorage) error
+
+	// Fills the empty index storage with the offsets of the live entries of
+	// the database file keeping the newest entry of every user. The file is
+	// recovered first if it's corrupted. Returns the number of the duplicate
+	// entries left by an interrupted compaction.
+	RebuildIndex(file RandomAccessFile, indexStorage IndexStorage) (int, error)
+
+	// Opens a storage file. If the file is empty, writes all necessary data.
+	// Profile storage also depends on a corresponding delta, index, item index
+	// and signature storage objects, but it doesn't close them automatically
+	// upon closing itself. Without the item index storage (nil) every
+	// similarity query scans the whole database file. Without the signature
+	// storage (nil) the approximate queries are answered exactly. The file is
+	// never closed on failure, the caller closes it.
+	Open(
+		file RandomAccessFile,
+		deltaStorage DeltaStorage,
+		indexStorage IndexStorage,
+		itemIndexStorage ItemIndexStorage,
+		signatureStorage SignatureStorage,
+	) (ProfileStorage, error)
+
+	// Opens a storage file.  If the file is empty, writes all necessary
+	// data. If the file is corrupted, tries to recover it first.
+	// Profile storage also depends on a corresponding delta, index, item index
+	// and signature storage objects, but it doesn't close them automatically
+	// upon closing itself. The item index and the signature storages are
+	// optional (nil). The file is never closed on failure, the caller closes
+	// it.
+	OpenMaybeRecover(
+		file RandomAccessFile,
+		deltaStorage DeltaStorage,
+		indexStorage IndexStorage,
+		itemIndexStorage ItemIndexStorage,
+		signatureStorage SignatureStorage,
+	) (ProfileStorage, error)
+}
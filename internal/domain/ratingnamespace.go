@@ -0,0 +1,154 @@
+package domain
+
+import (
+	"recengine/internal/domain/valueobjects"
+	"time"
+)
+
+// ratingNamespace stores the scores the users rate items with.
+type ratingNamespace struct {
+	baseNamespace
+}
+
+// Compile-time type check
+var _ = (RatingNamespace)((*ratingNamespace)(nil))
+
+// A DTO for creating a RatingNamespace.
+type RatingNamespaceDto struct {
+	Name                    valueobjects.NamespaceName
+	MaxSimilarProfiles      uint
+	SimilarityMetric        valueobjects.SimilarityMetric
+	Durability              valueobjects.Durability
+	CompactionThreshold     uint64
+	FragmentationThreshold  float64
+	Created                 time.Time
+	BasePath                string
+	Files                   NamespaceFiles
+	DeltaStorageFactory     DeltaStorageFactory
+	RatingStorageFactory    ProfileStorageFactory
+	IndexStorageFactory     IndexStorageFactory
+	ItemIndexStorageFactory ItemIndexStorageFactory
+}
+
+// Creates a new namespace.
+func NewRatingNamespace(dto *RatingNamespaceDto) (*ratingNamespace, error) {
+	if err := ValidateRatingSimilarityMetric(dto.SimilarityMetric); err != nil {
+		return nil, err
+	}
+	ns := &ratingNamespace{
+		baseNamespace: baseNamespace{
+			name:                    dto.Name,
+			maxSimilarProfiles:      dto.MaxSimilarProfiles,
+			similarityMetric:        dto.SimilarityMetric,
+			durability:              dto.Durability,
+			compactionThreshold:     dto.CompactionThreshold,
+			fragmentationThreshold:  dto.FragmentationThreshold,
+			created:                 dto.Created,
+			files:                   dto.Files,
+			deltaStorageFactory:     dto.DeltaStorageFactory,
+			profileStorageFactory:   dto.RatingStorageFactory,
+			indexStorageFactory:     dto.IndexStorageFactory,
+			itemIndexStorageFactory: dto.ItemIndexStorageFactory,
+			basePath:                dto.BasePath,
+		},
+	}
+	ns.init()
+	return ns, nil
+}
+
+// Returns namespace subtype.
+func (ns *ratingNamespace) GetType() valueobjects.NamespaceType {
+	return valueobjects.MakeRatingNamespaceType()
+}
+
+// Returns the profile by its ID or nil if it isn't found.
+// If there is no profile with this ID found, it's NOT considered an error.
+func (ns *ratingNamespace) GetProfile(user uint64) (*RatingProfile, error) {
+	errChan := make(chan error, 1)
+	profileChan := make(chan *RatingProfile, 1)
+	err := ns.send(Action{
+		ActionGetProfile,
+		errChan,
+		GetRatingProfilePayload{user, profileChan},
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
+	case err := <-errChan:
+		return nil, err
+	case profile := <-profileChan:
+		return profile, nil
+	}
+}
+
+// Sets the score of an item of the profile.
+func (ns *ratingNamespace) Rate(user uint64, item uint64, score float32) error {
+	if err := ValidateRatingScore(score); err != nil {
+		return err
+	}
+	return ns.sendAndWait(Action{ActionRate, make(chan error, 1), RatePayload{user, item, score}})
+}
+
+// Returns the most similar profiles to the given one.
+// The options may be nil.
+func (ns *ratingNamespace) GetSimilarProfiles(
+	user uint64,
+	options *ListOptions,
+) (*[]SimilarRatingProfile, error) {
+	errChan := make(chan error, 1)
+	profilesChan := make(chan *[]SimilarRatingProfile, 1)
+	err := ns.send(Action{
+		ActionGetSimilarProfiles,
+		errChan,
+		GetSimilarRatingProfilesPayload{
+			UserID:   user,
+			Limit:    ns.maxSimilarProfiles,
+			Metric:   ns.similarityMetric,
+			Profiles: profilesChan,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
+	case err := <-errChan:
+		return nil, err
+	case profiles := <-profilesChan:
+		filtered := options.ApplyToSimilarRatingProfiles(*profiles)
+		return &filtered, nil
+	}
+}
+
+// Returns the items recommended to the user along with their predicted
+// scores as the relevance. The options may be nil.
+func (ns *ratingNamespace) RecommendItems(user uint64, options *ListOptions) (*[]RecItem, error) {
+	errChan := make(chan error, 1)
+	recsChan := make(chan *[]RecItem, 1)
+	err := ns.send(Action{
+		ActionRecommendItems,
+		errChan,
+		PredictRatingsPayload{
+			UserID:             user,
+			MaxSimilarProfiles: ns.maxSimilarProfiles,
+			Metric:             ns.similarityMetric,
+			Items:              recsChan,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ns.done:
+		return nil, errNamespaceStopped
+	case err := <-errChan:
+		return nil, err
+	case recs := <-recsChan:
+		filtered := options.ApplyToRecItems(*recs)
+		return &filtered, nil
+	}
+}
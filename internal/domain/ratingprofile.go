@@ -0,0 +1,212 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"recengine/internal/domain/valueobjects"
+	"sort"
+)
+
+const (
+	// The lowest score an item can be rated with.
+	MinRatingScore float32 = 1
+	// The highest score an item can be rated with.
+	MaxRatingScore float32 = 5
+)
+
+// A score given to an item by a user.
+type ItemRating struct {
+	ItemID uint64  `json:"item"`
+	Score  float32 `json:"score"`
+}
+
+// Encapsulates all the items rated by a user.
+type RatingProfile struct {
+	// User or compilation ID.
+	UserID uint64 `json:"user"`
+
+	// The ratings of the items sorted by item ID.
+	Ratings []ItemRating `json:"ratings"`
+}
+
+// Creates new empty rating profile object.
+func NewRatingProfile(userID uint64) *RatingProfile {
+	return &RatingProfile{
+		UserID:  userID,
+		Ratings: make([]ItemRating, 0),
+	}
+}
+
+// Checks whether the score is in the range of the valid scores and is a
+// whole number of tenths, which is how the delta storage keeps the scores.
+func ValidateRatingScore(score float32) error {
+	if !(score >= MinRatingScore && score <= MaxRatingScore) {
+		return fmt.Errorf("the score must range from %v to %v", MinRatingScore, MaxRatingScore)
+	}
+	steps := float64(score) * deltaScoreScale
+	if math.Abs(steps-math.Round(steps)) > 0.001 {
+		return fmt.Errorf("the score must be a whole number of tenths, got %v", score)
+	}
+	return nil
+}
+
+// Checks whether the similarity metric is applicable to rating profiles.
+func ValidateRatingSimilarityMetric(metric valueobjects.SimilarityMetric) error {
+	switch metric.Value() {
+	case "", valueobjects.SimilarityMetricPearson, valueobjects.SimilarityMetricCosine:
+		return nil
+	}
+	return fmt.Errorf("similarity metric %s is not applicable to rating profiles", metric.Value())
+}
+
+// Returns a deep copy of the profile.
+func (p *RatingProfile) Clone() *RatingProfile {
+	return &RatingProfile{
+		UserID:  p.UserID,
+		Ratings: append(make([]ItemRating, 0, len(p.Ratings)), p.Ratings...),
+	}
+}
+
+// Returns the ID of the user the profile belongs to.
+func (p *RatingProfile) GetUserID() uint64 {
+	return p.UserID
+}
+
+// Returns the IDs of the rated items.
+func (p *RatingProfile) GetItems() []uint64 {
+	items := make([]uint64, len(p.Ratings))
+	for i, rating := range p.Ratings {
+		items[i] = rating.ItemID
+	}
+	return items
+}
+
+// Returns the position of the item in the ratings and whether it's there.
+func (p *RatingProfile) find(item uint64) (int, bool) {
+	i := sort.Search(len(p.Ratings), func(i int) bool {
+		return p.Ratings[i].ItemID >= item
+	})
+	return i, i < len(p.Ratings) && p.Ratings[i].ItemID == item
+}
+
+// Returns the score of the item and whether the item has been rated at all.
+func (p *RatingProfile) GetScore(item uint64) (float32, bool) {
+	if i, ok := p.find(item); ok {
+		return p.Ratings[i].Score, true
+	}
+	return 0, false
+}
+
+// Sets the score of the item.
+func (p *RatingProfile) Rate(item uint64, score float32) {
+	i, ok := p.find(item)
+	if ok {
+		p.Ratings[i].Score = score
+		return
+	}
+	p.Ratings = append(p.Ratings, ItemRating{})
+	copy(p.Ratings[i+1:], p.Ratings[i:])
+	p.Ratings[i] = ItemRating{item, score}
+}
+
+// Removes the item from the profile.
+func (p *RatingProfile) RemoveItem(item uint64) {
+	if i, ok := p.find(item); ok {
+		p.Ratings = append(p.Ratings[:i], p.Ratings[i+1:]...)
+	}
+}
+
+// Returns the average score of the items of the profile or 0 if the profile
+// is empty.
+func (p *RatingProfile) GetMeanScore() float32 {
+	if len(p.Ratings) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, rating := range p.Ratings {
+		sum += float64(rating.Score)
+	}
+	return float32(sum / float64(len(p.Ratings)))
+}
+
+// Calls the callback for every item rated in both profiles.
+func (p1 *RatingProfile) forEachCommonItem(p2 *RatingProfile, callback func(a, b float64)) {
+	i, j := 0, 0
+	for i < len(p1.Ratings) && j < len(p2.Ratings) {
+		switch {
+		case p1.Ratings[i].ItemID < p2.Ratings[j].ItemID:
+			i++
+		case p1.Ratings[i].ItemID > p2.Ratings[j].ItemID:
+			j++
+		default:
+			callback(float64(p1.Ratings[i].Score), float64(p2.Ratings[j].Score))
+			i++
+			j++
+		}
+	}
+}
+
+// Computes the Pearson correlation coefficient of the scores of the items
+// rated in both profiles as value in range [-1..1]. Less than two common
+// items or constant scores give no correlation.
+func (p1 *RatingProfile) computePearsonCorrelation(p2 *RatingProfile) float64 {
+	var n, sumA, sumB float64
+	p1.forEachCommonItem(p2, func(a, b float64) {
+		n++
+		sumA += a
+		sumB += b
+	})
+	if n < 2 {
+		return 0
+	}
+	meanA, meanB := sumA/n, sumB/n
+	var cov, varA, varB float64
+	p1.forEachCommonItem(p2, func(a, b float64) {
+		cov += (a - meanA) * (b - meanB)
+		varA += (a - meanA) * (a - meanA)
+		varB += (b - meanB) * (b - meanB)
+	})
+	if varA == 0 || varB == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(varA*varB)
+}
+
+// Computes the cosine of the angle between the score vectors of the profiles,
+// the items not rated being zeros, as value in range [0..1].
+func (p1 *RatingProfile) computeCosineSimilarity(p2 *RatingProfile) float64 {
+	var dot, normA, normB float64
+	p1.forEachCommonItem(p2, func(a, b float64) {
+		dot += a * b
+	})
+	for _, rating := range p1.Ratings {
+		normA += float64(rating.Score) * float64(rating.Score)
+	}
+	for _, rating := range p2.Ratings {
+		normB += float64(rating.Score) * float64(rating.Score)
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// Computes similarity between two profiles as value in range [0..100] using
+// the metric (Pearson correlation by default). Negative correlation is
+// considered no similarity.
+func (p1 *RatingProfile) ComputeSimilarity(
+	p2 *RatingProfile,
+	metric valueobjects.SimilarityMetric,
+) float32 {
+	var similarity float64
+	switch metric.Value() {
+	case valueobjects.SimilarityMetricCosine:
+		similarity = p1.computeCosineSimilarity(p2)
+	default:
+		similarity = p1.computePearsonCorrelation(p2)
+	}
+	if similarity <= 0 {
+		return 0
+	}
+	return float32(100 * math.Min(similarity, 1))
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"math"
+	"recengine/internal/domain/valueobjects"
+	"reflect"
+	"testing"
+)
+
+// Creates a rating profile from the item-score pairs.
+func makeTestRatingProfile(user uint64, ratings map[uint64]float32) *RatingProfile {
+	profile := NewRatingProfile(user)
+	for item, score := range ratings {
+		profile.Rate(item, score)
+	}
+	return profile
+}
+
+func TestRatingProfileRating(t *testing.T) {
+	p := NewRatingProfile(1)
+	p.Rate(20, 3)
+	p.Rate(10, 5)
+	p.Rate(30, 1)
+	p.Rate(20, 4)
+	expected := []ItemRating{{10, 5}, {20, 4}, {30, 1}}
+	if !reflect.DeepEqual(p.Ratings, expected) {
+		t.Errorf("Ratings = %v; want %v", p.Ratings, expected)
+	}
+	if got := p.GetMeanScore(); got != 10.0/3 {
+		t.Errorf("GetMeanScore() = %f; want %f", got, 10.0/3)
+	}
+	p.RemoveItem(20)
+	p.RemoveItem(40)
+	if _, ok := p.GetScore(20); ok {
+		t.Error("GetScore(20) found a removed item")
+	}
+	if got, ok := p.GetScore(30); !ok || got != 1 {
+		t.Errorf("GetScore(30) = %f, %v; want 1, true", got, ok)
+	}
+}
+
+func TestRatingProfileComputeSimilarity(t *testing.T) {
+	type Fixture struct {
+		metric   valueobjects.SimilarityMetric
+		ratingsA map[uint64]float32
+		ratingsB map[uint64]float32
+		expected float32
+	}
+	pearson := valueobjects.MakePearsonSimilarityMetric()
+	cosine := valueobjects.MakeCosineSimilarityMetric()
+	fixtures := []Fixture{
+		{pearson, map[uint64]float32{1: 5, 2: 3, 3: 1}, map[uint64]float32{1: 4, 2: 2, 3: 0}, 100},
+		{pearson, map[uint64]float32{1: 5, 2: 3, 3: 1}, map[uint64]float32{1: 1, 2: 3, 3: 5}, 0},
+		{pearson, map[uint64]float32{1: 5, 2: 3, 3: 1}, map[uint64]float32{1: 5, 2: 1, 3: 3}, 50},
+		{pearson, map[uint64]float32{1: 5}, map[uint64]float32{1: 5, 2: 3}, 0},
+		{pearson, map[uint64]float32{1: 3, 2: 3}, map[uint64]float32{1: 1, 2: 5}, 0},
+		{valueobjects.SimilarityMetric{}, map[uint64]float32{1: 5, 2: 3, 3: 1}, map[uint64]float32{1: 5, 2: 1, 3: 3}, 50},
+		{cosine, map[uint64]float32{1: 3, 2: 4}, map[uint64]float32{1: 3, 2: 4}, 100},
+		{cosine, map[uint64]float32{1: 1}, map[uint64]float32{2: 1}, 0},
+		{cosine, map[uint64]float32{1: 3, 2: 4}, map[uint64]float32{1: 4, 3: 3}, 48},
+		{cosine, map[uint64]float32{}, map[uint64]float32{1: 4}, 0},
+	}
+	for _, fixture := range fixtures {
+		a := makeTestRatingProfile(1, fixture.ratingsA)
+		b := makeTestRatingProfile(2, fixture.ratingsB)
+		got := a.ComputeSimilarity(b, fixture.metric)
+		if math.Abs(float64(got-fixture.expected)) > float64(0.001) {
+			t.Errorf(
+				"%v.ComputeSimilarity(%v, %s) = %f; want %f",
+				fixture.ratingsA,
+				fixture.ratingsB,
+				fixture.metric.Value(),
+				got,
+				fixture.expected,
+			)
+		}
+	}
+}
+
+func TestPredictRatings(t *testing.T) {
+	profile := makeTestRatingProfile(1, map[uint64]float32{1: 4, 2: 2})
+	similarProfiles := []SimilarRatingProfile{
+		{makeTestRatingProfile(2, map[uint64]float32{1: 5, 3: 5, 4: 1}), 50},
+		{makeTestRatingProfile(3, map[uint64]float32{3: 2, 4: 5}), 100},
+	}
+	items := PredictRatings(profile, similarProfiles)
+	expected := []RecItem{{4, 3 + 1.0/9}, {3, 3 - 5.0/9}}
+	if len(items) != len(expected) {
+		t.Fatalf("PredictRatings() = %v; want %v", items, expected)
+	}
+	for i := range items {
+		if items[i].ItemID != expected[i].ItemID ||
+			math.Abs(float64(items[i].Relevance-expected[i].Relevance)) > 0.001 {
+			t.Errorf("PredictRatings() = %v; want %v", items, expected)
+		}
+	}
+}
+
+func TestRateDeltaOp(t *testing.T) {
+	for _, score := range []float32{MinRatingScore, 1.1, 2.5, 4.7, MaxRatingScore} {
+		op := MakeRateDeltaOp(score)
+		if !op.IsRate() {
+			t.Errorf("MakeRateDeltaOp(%v).IsRate() = false", score)
+		}
+		if got := op.GetScore(); got != score {
+			t.Errorf("MakeRateDeltaOp(%v).GetScore() = %v", score, got)
+		}
+	}
+	for _, op := range []DeltaOp{DeltaOpAdd, DeltaOpRemove, DeltaOpDislike, DeltaOpDeleteProfile} {
+		if op.IsRate() {
+			t.Errorf("%c.IsRate() = true", op)
+		}
+	}
+}
+
+func TestValidateRatingScore(t *testing.T) {
+	for _, score := range []float32{MinRatingScore, 1.1, 3, 4.7, MaxRatingScore} {
+		if err := ValidateRatingScore(score); err != nil {
+			t.Errorf("ValidateRatingScore(%v) = %v; want nil", score, err)
+		}
+	}
+	for _, score := range []float32{0, 0.5, 4.75, 5.1, 10, float32(math.NaN())} {
+		if err := ValidateRatingScore(score); err == nil {
+			t.Errorf("ValidateRatingScore(%v) = nil; want an error", score)
+		}
+	}
+}
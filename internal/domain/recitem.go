@@ -1,6 +1,82 @@
 package domain
 
+import (
+	"math"
+	"sort"
+)
+
 type RecItem struct {
 	ItemID    uint64
 	Relevance float32
 }
+
+// Computes the items recommended to the profile based on the most similar
+// profiles. The relevance of an item is the similarity-weighted difference
+// between the likes and dislikes of the item in range [0..100]. Only the
+// items unknown to the profile and having positive relevance are returned.
+// The items are sorted by relevance in descending order.
+func RecommendItems(profile *Profile, similarProfiles []SimilarProfile) []RecItem {
+	var totalSimilarity float32
+	scores := make(map[uint64]float32)
+	for _, similar := range similarProfiles {
+		totalSimilarity += similar.Similarity
+		for _, item := range similar.Profile.Likes {
+			if profile.QualifyItem(item) == ItemUnknown {
+				scores[item] += similar.Similarity
+			}
+		}
+		for _, item := range similar.Profile.Dislikes {
+			if profile.QualifyItem(item) == ItemUnknown {
+				scores[item] -= similar.Similarity
+			}
+		}
+	}
+	items := make([]RecItem, 0, len(scores))
+	for item, score := range scores {
+		if score > 0 {
+			items = append(items, RecItem{item, 100 * score / totalSimilarity})
+		}
+	}
+	sortRecItems(items)
+	return items
+}
+
+// Predicts the scores the profile would give to the items rated by the most
+// similar profiles. The predicted score is the mean score of the profile
+// adjusted by the similarity-weighted average deviation of the scores from
+// the mean scores of the similar profiles. It's returned as the relevance
+// clamped to the range of the valid scores. Only the items unknown to the
+// profile are returned sorted by the predicted score in descending order.
+func PredictRatings(profile *RatingProfile, similarProfiles []SimilarRatingProfile) []RecItem {
+	deviations := make(map[uint64]float64)
+	weights := make(map[uint64]float64)
+	for _, similar := range similarProfiles {
+		mean := similar.Profile.GetMeanScore()
+		for _, rating := range similar.Profile.Ratings {
+			if _, ok := profile.GetScore(rating.ItemID); ok {
+				continue
+			}
+			deviations[rating.ItemID] += float64(similar.Similarity) * float64(rating.Score-mean)
+			weights[rating.ItemID] += float64(similar.Similarity)
+		}
+	}
+	mean := float64(profile.GetMeanScore())
+	items := make([]RecItem, 0, len(deviations))
+	for item, deviation := range deviations {
+		score := mean + deviation/weights[item]
+		score = math.Max(float64(MinRatingScore), math.Min(float64(MaxRatingScore), score))
+		items = append(items, RecItem{item, float32(score)})
+	}
+	sortRecItems(items)
+	return items
+}
+
+// Sorts the items by relevance in descending order and then by ID.
+func sortRecItems(items []RecItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Relevance == items[j].Relevance {
+			return items[i].ItemID < items[j].ItemID
+		}
+		return items[i].Relevance > items[j].Relevance
+	})
+}
@@ -0,0 +1,21 @@
+package domain
+
+// Storage of the MinHash signatures of the profiles, which finds the
+// candidates for being similar to a profile by the LSH bands.
+type SignatureStorage interface {
+	// Closes the storage file.
+	Close() error
+
+	// Returns the users whose signatures have at least one LSH band in
+	// common with the signature.
+	GetCandidates(signature *MinHashSignature) []uint64
+
+	// Sets the signature of the user's profile.
+	Put(user uint64, signature *MinHashSignature) error
+
+	// Removes the signature of the user's profile.
+	Remove(user uint64) error
+
+	// Returns the number of the users having a signature.
+	GetNumUsers() int
+}
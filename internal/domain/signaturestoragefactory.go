@@ -0,0 +1,14 @@
+package domain
+
+import "io"
+
+// Signature storage factory.
+type SignatureStorageFactory interface {
+	// Opens a signature file by the specified path. If the file doesn't exist
+	// yet it will be created.
+	OpenFile(filePath string) (SignatureStorage, error)
+
+	// Opens a signature file. If the file is empty, writes all necessary
+	// data. The closer is called upon closing the storage (optional).
+	Open(file io.ReadWriteSeeker, closer io.Closer) (SignatureStorage, error)
+}
@@ -0,0 +1,216 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"recengine/internal/domain/valueobjects"
+)
+
+// The parameters of the similarity computation that don't depend on the
+// profiles being compared.
+type SimilarityParams struct {
+	// The value from 0 to 1 that changes the contribution of dislikes to the
+	// similarity of profiles.
+	DislikeFactor float32
+	// The number of distinct items of the namespace. Required only by the
+	// metrics reporting NeedsNumItems.
+	NumItems int
+}
+
+// Measures similarity between like profiles.
+type SimilarityMetric interface {
+	// Computes similarity between two profiles as value in range [0..100].
+	ComputeSimilarity(p1, p2 *Profile, params SimilarityParams) float32
+
+	// Checks whether the metric needs the number of all the items of the
+	// namespace, which is costly to count.
+	NeedsNumItems() bool
+}
+
+// Computes the similarity of two sets of items as value in range [0..1]
+// given the size of their intersection, the sizes of the sets and the number
+// of all the items.
+type setSimilarityFunc func(common, sizeA, sizeB, numItems int) float64
+
+// Compares the likes and the dislikes of the profiles separately and returns
+// the weighted sum of the results, where the weight of a part is the size of
+// the union of the corresponding sets.
+type setSimilarityMetric struct {
+	compareSets   setSimilarityFunc
+	needsNumItems bool
+}
+
+// Compile-time type check
+var _ = (SimilarityMetric)((*setSimilarityMetric)(nil))
+
+// Penalizes the profiles for the items liked by one user and disliked by the
+// other one: similarity = (agreements - conflicts) / total.
+type conflictPenaltyMetric struct{}
+
+// Compile-time type check
+var _ = (SimilarityMetric)((*conflictPenaltyMetric)(nil))
+
+// Returns the like profile similarity metric by its name. The default metric
+// is Jaccard index.
+func NewSimilarityMetric(metric valueobjects.SimilarityMetric) (SimilarityMetric, error) {
+	switch metric.Value() {
+	case "", valueobjects.SimilarityMetricJaccard:
+		return &setSimilarityMetric{compareSets: computeJaccardIndex}, nil
+	case valueobjects.SimilarityMetricCosine:
+		return &setSimilarityMetric{compareSets: computeSetCosine}, nil
+	case valueobjects.SimilarityMetricDice:
+		return &setSimilarityMetric{compareSets: computeDiceCoefficient}, nil
+	case valueobjects.SimilarityMetricOverlap:
+		return &setSimilarityMetric{compareSets: computeOverlapCoefficient}, nil
+	case valueobjects.SimilarityMetricLogLikelihood:
+		return &setSimilarityMetric{
+			compareSets:   computeLogLikelihoodSimilarity,
+			needsNumItems: true,
+		}, nil
+	case valueobjects.SimilarityMetricConflictPenalty:
+		return &conflictPenaltyMetric{}, nil
+	}
+	return nil, fmt.Errorf("similarity metric %s is not applicable to like profiles", metric.Value())
+}
+
+// Counts the items present in both of the sorted sets.
+func countCommonItems(itemsA []uint64, itemsB []uint64) int {
+	common := 0
+	i, j := 0, 0
+	for i < len(itemsA) && j < len(itemsB) {
+		switch {
+		case itemsA[i] < itemsB[j]:
+			i++
+		case itemsA[i] > itemsB[j]:
+			j++
+		default:
+			common++
+			i++
+			j++
+		}
+	}
+	return common
+}
+
+// Given sets A and B, similarity = | A ^ B | / | A v B |
+func computeJaccardIndex(common, sizeA, sizeB, numItems int) float64 {
+	union := sizeA + sizeB - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// Given sets A and B, similarity = | A ^ B | / sqrt(|A| * |B|)
+func computeSetCosine(common, sizeA, sizeB, numItems int) float64 {
+	if sizeA == 0 || sizeB == 0 {
+		return 0
+	}
+	return float64(common) / math.Sqrt(float64(sizeA)*float64(sizeB))
+}
+
+// Given sets A and B, similarity = 2 * | A ^ B | / (|A| + |B|)
+func computeDiceCoefficient(common, sizeA, sizeB, numItems int) float64 {
+	if sizeA+sizeB == 0 {
+		return 0
+	}
+	return 2 * float64(common) / float64(sizeA+sizeB)
+}
+
+// Given sets A and B, similarity = | A ^ B | / min(|A|, |B|)
+func computeOverlapCoefficient(common, sizeA, sizeB, numItems int) float64 {
+	if sizeA == 0 || sizeB == 0 {
+		return 0
+	}
+	if sizeA < sizeB {
+		return float64(common) / float64(sizeA)
+	}
+	return float64(common) / float64(sizeB)
+}
+
+// Returns x * ln(x) assuming 0 * ln(0) = 0.
+func xLogX(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x * math.Log(x)
+}
+
+// Computes the unnormalized Shannon entropy of the counts.
+func computeEntropy(counts ...float64) float64 {
+	var sum, result float64
+	for _, count := range counts {
+		sum += count
+		result -= xLogX(count)
+	}
+	return result + xLogX(sum)
+}
+
+// Computes Dunning's log-likelihood ratio of the co-occurrence of the items
+// in the sets and maps it to range [0..1] as 1 - 1 / (1 + LLR). The sets
+// co-occurring less than by chance are considered not similar at all.
+func computeLogLikelihoodSimilarity(common, sizeA, sizeB, numItems int) float64 {
+	union := sizeA + sizeB - common
+	if numItems < union {
+		numItems = union
+	}
+	if common == 0 || common*numItems <= sizeA*sizeB {
+		return 0
+	}
+	k11 := float64(common)
+	k12 := float64(sizeA - common)
+	k21 := float64(sizeB - common)
+	k22 := float64(numItems - union)
+	rowEntropy := computeEntropy(k11+k12, k21+k22)
+	columnEntropy := computeEntropy(k11+k21, k12+k22)
+	matrixEntropy := computeEntropy(k11, k12, k21, k22)
+	if rowEntropy+columnEntropy < matrixEntropy {
+		// Round-off error
+		return 0
+	}
+	llr := 2 * (rowEntropy + columnEntropy - matrixEntropy)
+	return 1 - 1/(1+llr)
+}
+
+// Computes the similarity of the sets and the size of their union.
+func (m *setSimilarityMetric) compare(itemsA, itemsB []uint64, numItems int) (float64, int) {
+	common := countCommonItems(itemsA, itemsB)
+	union := len(itemsA) + len(itemsB) - common
+	if union == 0 {
+		return 0, 0
+	}
+	return m.compareSets(common, len(itemsA), len(itemsB), numItems), union
+}
+
+func (m *setSimilarityMetric) ComputeSimilarity(p1, p2 *Profile, params SimilarityParams) float32 {
+	likesSim, likesWeight := m.compare(p1.Likes, p2.Likes, params.NumItems)
+	dislikesSim, dislikesWeight := m.compare(p1.Dislikes, p2.Dislikes, params.NumItems)
+	dislikesWeight = int(float32(dislikesWeight) * params.DislikeFactor)
+	if likesWeight+dislikesWeight == 0 {
+		return 0
+	}
+	return float32(100 * ((likesSim*float64(likesWeight) + dislikesSim*float64(dislikesWeight)) /
+		(float64(likesWeight) + float64(dislikesWeight))))
+}
+
+func (m *setSimilarityMetric) NeedsNumItems() bool {
+	return m.needsNumItems
+}
+
+func (m *conflictPenaltyMetric) ComputeSimilarity(p1, p2 *Profile, params SimilarityParams) float32 {
+	commonLikes := countCommonItems(p1.Likes, p2.Likes)
+	commonDislikes := countCommonItems(p1.Dislikes, p2.Dislikes)
+	conflicts := countCommonItems(p1.Likes, p2.Dislikes) + countCommonItems(p1.Dislikes, p2.Likes)
+	factor := float64(params.DislikeFactor)
+	agreements := float64(commonLikes) + float64(commonDislikes)*factor
+	total := float64(len(p1.Likes)+len(p2.Likes)-commonLikes) +
+		float64(len(p1.Dislikes)+len(p2.Dislikes)-commonDislikes)*factor
+	if total == 0 || agreements <= float64(conflicts) {
+		return 0
+	}
+	return float32(100 * (agreements - float64(conflicts)) / total)
+}
+
+func (m *conflictPenaltyMetric) NeedsNumItems() bool {
+	return false
+}
@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"math"
+	"recengine/internal/domain/valueobjects"
+	"testing"
+)
+
+func TestSimilarityMetrics(t *testing.T) {
+	type Fixture struct {
+		metric        string
+		likesA        []uint64
+		likesB        []uint64
+		dislikesA     []uint64
+		dislikesB     []uint64
+		dislikeFactor float32
+		numItems      int
+		expected      float32
+	}
+	fixtures := []Fixture{
+		{"", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 40},
+		{"jaccard", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 40},
+		{"jaccard", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, []uint64{10}, []uint64{10, 20}, 1, 0, 42.857},
+		{"jaccard", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, []uint64{10}, []uint64{10, 20}, 0.5, 0, 41.667},
+		{"cosine", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 57.735},
+		{"cosine", []uint64{1, 2, 3}, []uint64{1, 2, 3}, nil, nil, 1, 0, 100},
+		{"dice", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 57.143},
+		{"dice", []uint64{1, 2, 3}, []uint64{4, 5, 6}, nil, nil, 1, 0, 0},
+		{"overlap", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 66.667},
+		{"overlap", []uint64{1, 2}, []uint64{1, 2, 4, 5}, nil, nil, 1, 0, 100},
+		{"llr", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 100, 91.139},
+		{"llr", []uint64{1, 2, 3}, []uint64{1, 2, 3}, nil, nil, 1, 100, 96.422},
+		{"llr", []uint64{1, 2}, []uint64{3, 4}, nil, nil, 1, 100, 0},
+		{"llr", []uint64{1, 2, 3}, []uint64{1, 2, 4, 5}, nil, nil, 1, 5, 0},
+		{"conflict", []uint64{1, 2, 3}, []uint64{1, 2, 4}, nil, []uint64{3}, 1, 0, 20},
+		{"conflict", []uint64{1, 2, 3}, []uint64{1, 10}, []uint64{10}, []uint64{3}, 1, 0, 0},
+		{"conflict", []uint64{1, 2, 3}, []uint64{1, 2, 3}, []uint64{10}, []uint64{10}, 1, 0, 100},
+	}
+	for _, fixture := range fixtures {
+		name, err := valueobjects.ParseSimilarityMetric(fixture.metric)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metric, err := NewSimilarityMetric(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := Profile{1, fixture.likesA, fixture.dislikesA}
+		b := Profile{2, fixture.likesB, fixture.dislikesB}
+		params := SimilarityParams{fixture.dislikeFactor, fixture.numItems}
+		got := metric.ComputeSimilarity(&a, &b, params)
+		if math.Abs(float64(got-fixture.expected)) > float64(0.001) {
+			t.Errorf(
+				"%s: {{%v}{%v}}.ComputeSimilarity({{%v}{%v}},%v) = %f; want %f",
+				fixture.metric,
+				fixture.likesA,
+				fixture.dislikesA,
+				fixture.likesB,
+				fixture.dislikesB,
+				params,
+				got,
+				fixture.expected,
+			)
+		}
+	}
+}
+
+func TestNewSimilarityMetric(t *testing.T) {
+	t.Run("should reject metrics not applicable to like profiles", func(t *testing.T) {
+		if _, err := NewSimilarityMetric(valueobjects.MakePearsonSimilarityMetric()); err == nil {
+			t.Error("Pearson correlation is accepted")
+		}
+	})
+
+	t.Run("should report the metrics depending on the number of items", func(t *testing.T) {
+		for _, name := range []string{"jaccard", "cosine", "dice", "overlap", "llr", "conflict"} {
+			value, _ := valueobjects.ParseSimilarityMetric(name)
+			metric, err := NewSimilarityMetric(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := metric.NeedsNumItems(); got != (name == "llr") {
+				t.Errorf("%s.NeedsNumItems() = %v", name, got)
+			}
+		}
+	})
+}
@@ -1,6 +1,170 @@
 package domain
 
+import (
+	"container/heap"
+	"sort"
+)
+
 type SimilarProfile struct {
 	Profile    *Profile
 	Similarity float32
 }
+
+type SimilarRatingProfile struct {
+	Profile    *RatingProfile
+	Similarity float32
+}
+
+// A profile of any type along with its similarity to some profile.
+type scoredProfile[P any] struct {
+	profile    P
+	similarity float32
+}
+
+// Min-heap of similar profiles ordered by similarity.
+type similarProfileHeap[P any] []scoredProfile[P]
+
+func (h similarProfileHeap[P]) Len() int           { return len(h) }
+func (h similarProfileHeap[P]) Less(i, j int) bool { return h[i].similarity < h[j].similarity }
+func (h similarProfileHeap[P]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *similarProfileHeap[P]) Push(x any) {
+	*h = append(*h, x.(scoredProfile[P]))
+}
+
+func (h *similarProfileHeap[P]) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// Keeps track of the most similar profiles of any type.
+type similarProfileSelector[P any] struct {
+	limit    int
+	profiles similarProfileHeap[P]
+	// Copies the profile being kept.
+	clone func(profile P) P
+}
+
+// Offers a profile to the selector. A copy of the profile is kept only if
+// it's one of the most similar ones. Profiles having no similarity at all are
+// ignored.
+func (s *similarProfileSelector[P]) add(profile P, similarity float32) {
+	if s.accepts(similarity) {
+		s.keep(scoredProfile[P]{s.clone(profile), similarity})
+	}
+}
+
+// Adds the profiles kept by another selector, which are copies already.
+func (s *similarProfileSelector[P]) merge(other *similarProfileSelector[P]) {
+	for _, scored := range other.profiles {
+		if s.accepts(scored.similarity) {
+			s.keep(scored)
+		}
+	}
+}
+
+// Returns true if a profile of the similarity would be kept.
+func (s *similarProfileSelector[P]) accepts(similarity float32) bool {
+	if similarity <= 0 || s.limit == 0 {
+		return false
+	}
+	return len(s.profiles) < s.limit || s.profiles[0].similarity < similarity
+}
+
+// Keeps the profile replacing the least similar one if the limit is reached.
+func (s *similarProfileSelector[P]) keep(scored scoredProfile[P]) {
+	if len(s.profiles) < s.limit {
+		heap.Push(&s.profiles, scored)
+		return
+	}
+	s.profiles[0] = scored
+	heap.Fix(&s.profiles, 0)
+}
+
+// Returns the selected profiles sorted by similarity in descending order.
+func (s *similarProfileSelector[P]) sorted() []scoredProfile[P] {
+	profiles := make([]scoredProfile[P], len(s.profiles))
+	copy(profiles, s.profiles)
+	sort.SliceStable(profiles, func(i, j int) bool {
+		return profiles[i].similarity > profiles[j].similarity
+	})
+	return profiles
+}
+
+// Keeps track of the most similar profiles to some profile.
+type SimilarProfileCollector struct {
+	selector similarProfileSelector[*Profile]
+}
+
+// Creates a collector keeping at most `limit` most similar profiles.
+func NewSimilarProfileCollector(limit uint) *SimilarProfileCollector {
+	return &SimilarProfileCollector{
+		selector: similarProfileSelector[*Profile]{
+			limit: int(limit),
+			clone: (*Profile).Clone,
+		},
+	}
+}
+
+// Offers a profile to the collector. The profile is kept only if it's one of
+// the most similar ones. Profiles having no similarity at all are ignored.
+// The collector keeps a copy of the profile, so the profile can be reused.
+func (c *SimilarProfileCollector) Add(profile *Profile, similarity float32) {
+	c.selector.add(profile, similarity)
+}
+
+// Adds the profiles collected by another collector having the same limit,
+// e.g. the one that has processed another part of the profiles.
+func (c *SimilarProfileCollector) Merge(other *SimilarProfileCollector) {
+	c.selector.merge(&other.selector)
+}
+
+// Returns the collected profiles sorted by similarity in descending order.
+func (c *SimilarProfileCollector) GetProfiles() []SimilarProfile {
+	sorted := c.selector.sorted()
+	profiles := make([]SimilarProfile, len(sorted))
+	for i, scored := range sorted {
+		profiles[i] = SimilarProfile{scored.profile, scored.similarity}
+	}
+	return profiles
+}
+
+// Keeps track of the most similar rating profiles to some profile.
+type SimilarRatingProfileCollector struct {
+	selector similarProfileSelector[*RatingProfile]
+}
+
+// Creates a collector keeping at most `limit` most similar profiles.
+func NewSimilarRatingProfileCollector(limit uint) *SimilarRatingProfileCollector {
+	return &SimilarRatingProfileCollector{
+		selector: similarProfileSelector[*RatingProfile]{
+			limit: int(limit),
+			clone: (*RatingProfile).Clone,
+		},
+	}
+}
+
+// Offers a profile to the collector. The profile is kept only if it's one of
+// the most similar ones. Profiles having no similarity at all are ignored.
+// The collector keeps a copy of the profile, so the profile can be reused.
+func (c *SimilarRatingProfileCollector) Add(profile *RatingProfile, similarity float32) {
+	c.selector.add(profile, similarity)
+}
+
+// Adds the profiles collected by another collector having the same limit,
+// e.g. the one that has processed another part of the profiles.
+func (c *SimilarRatingProfileCollector) Merge(other *SimilarRatingProfileCollector) {
+	c.selector.merge(&other.selector)
+}
+
+// Returns the collected profiles sorted by similarity in descending order.
+func (c *SimilarRatingProfileCollector) GetProfiles() []SimilarRatingProfile {
+	sorted := c.selector.sorted()
+	profiles := make([]SimilarRatingProfile, len(sorted))
+	for i, scored := range sorted {
+		profiles[i] = SimilarRatingProfile{scored.profile, scored.similarity}
+	}
+	return profiles
+}
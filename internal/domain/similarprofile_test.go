@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimilarProfileCollector(t *testing.T) {
+	type Fixture struct {
+		limit        uint
+		similarities []float32
+		expected     []float32
+	}
+	fixtures := []Fixture{
+		{3, []float32{10, 50, 20, 40, 30}, []float32{50, 40, 30}},
+		{3, []float32{10, 20}, []float32{20, 10}},
+		{3, []float32{0, 10, 0}, []float32{10}},
+		{0, []float32{10, 20}, []float32{}},
+	}
+	for _, fixture := range fixtures {
+		collector := NewSimilarProfileCollector(fixture.limit)
+		for i, similarity := range fixture.similarities {
+			collector.Add(NewProfile(uint64(i)), similarity)
+		}
+		profiles := collector.GetProfiles()
+		got := make([]float32, len(profiles))
+		for i := range profiles {
+			got[i] = profiles[i].Similarity
+		}
+		if !reflect.DeepEqual(got, fixture.expected) {
+			t.Errorf(
+				"collecting %v with limit %d = %v; want %v",
+				fixture.similarities,
+				fixture.limit,
+				got,
+				fixture.expected,
+			)
+		}
+	}
+}
+
+func TestSimilarProfileCollectorMerge(t *testing.T) {
+	type Fixture struct {
+		limit    uint
+		first    []float32
+		second   []float32
+		expected []float32
+	}
+	fixtures := []Fixture{
+		{3, []float32{10, 50}, []float32{20, 40, 30}, []float32{50, 40, 30}},
+		{3, []float32{10}, []float32{}, []float32{10}},
+		{2, []float32{}, []float32{30, 0, 20}, []float32{30, 20}},
+		{2, []float32{60, 50}, []float32{40, 30}, []float32{60, 50}},
+	}
+	for _, fixture := range fixtures {
+		collector := NewSimilarProfileCollector(fixture.limit)
+		for i, similarity := range fixture.first {
+			collector.Add(NewProfile(uint64(i)), similarity)
+		}
+		other := NewSimilarProfileCollector(fixture.limit)
+		for i, similarity := range fixture.second {
+			other.Add(NewProfile(uint64(len(fixture.first)+i)), similarity)
+		}
+		collector.Merge(other)
+		profiles := collector.GetProfiles()
+		got := make([]float32, len(profiles))
+		for i := range profiles {
+			got[i] = profiles[i].Similarity
+		}
+		if !reflect.DeepEqual(got, fixture.expected) {
+			t.Errorf(
+				"merging %v into %v with limit %d = %v; want %v",
+				fixture.second,
+				fixture.first,
+				fixture.limit,
+				got,
+				fixture.expected,
+			)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package valueobjects
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DurabilityAlways   string = "always"
+	DurabilityBatch    string = "batch"
+	DurabilityInterval string = "interval"
+)
+
+// When the changes of the profiles are synced to the disk. The zero value
+// stands for the batch durability.
+type Durability struct {
+	value    string
+	interval time.Duration
+}
+
+// Parses the durability: "always" syncs every change before it's
+// acknowledged, "batch" syncs the changes once per processed action batch,
+// "interval:<ms>" syncs them periodically, so the changes acknowledged
+// during the last period may be lost on crash.
+func ParseDurability(value string) (Durability, error) {
+	d := Durability{value: value}
+	switch value {
+	case "", DurabilityAlways, DurabilityBatch:
+		return d, nil
+	}
+	prefix := DurabilityInterval + ":"
+	if !strings.HasPrefix(value, prefix) {
+		return d, fmt.Errorf("invalid durability '%s'", value)
+	}
+	ms := value[len(prefix):]
+	n, err := strconv.ParseUint(ms, 10, 32)
+	if err != nil || n == 0 {
+		return d, fmt.Errorf("invalid durability interval '%s'", ms)
+	}
+	d.interval = time.Duration(n) * time.Millisecond
+	return d, nil
+}
+
+func MakeAlwaysDurability() Durability {
+	return Durability{value: DurabilityAlways}
+}
+
+func MakeIntervalDurability(interval time.Duration) Durability {
+	return Durability{
+		value:    fmt.Sprintf("%s:%d", DurabilityInterval, interval.Milliseconds()),
+		interval: interval,
+	}
+}
+
+func (d Durability) Value() string {
+	return d.value
+}
+
+// Checks whether every change is synced separately.
+func (d Durability) IsAlways() bool {
+	return d.value == DurabilityAlways
+}
+
+// Returns the period of syncing the changes or zero if they are synced
+// before being acknowledged.
+func (d Durability) GetInterval() time.Duration {
+	return d.interval
+}
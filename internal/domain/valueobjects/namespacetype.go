@@ -3,7 +3,8 @@ package valueobjects
 import "fmt"
 
 const (
-	NamespaceTypeLike string = "like"
+	NamespaceTypeLike   string = "like"
+	NamespaceTypeRating string = "rating"
 )
 
 type NamespaceType struct {
@@ -12,7 +13,7 @@ type NamespaceType struct {
 
 func ParseNamespaceType(value string) (NamespaceType, error) {
 	t := NamespaceType{value}
-	if value != NamespaceTypeLike {
+	if value != NamespaceTypeLike && value != NamespaceTypeRating {
 		return t, fmt.Errorf("invalid namespace type '%s'", value)
 	}
 	return t, nil
@@ -22,6 +23,10 @@ func MakeLikeNamespaceType() NamespaceType {
 	return NamespaceType{NamespaceTypeLike}
 }
 
+func MakeRatingNamespaceType() NamespaceType {
+	return NamespaceType{NamespaceTypeRating}
+}
+
 func (t NamespaceType) Value() string {
 	return t.value
 }
@@ -0,0 +1,36 @@
+package valueobjects
+
+import "fmt"
+
+const (
+	SearchModeExact       string = "exact"
+	SearchModeApproximate string = "approximate"
+)
+
+// The way the similar profiles are searched for. The zero value stands for
+// the exact search.
+type SearchMode struct {
+	value string
+}
+
+func ParseSearchMode(value string) (SearchMode, error) {
+	m := SearchMode{value}
+	if value != "" && value != SearchModeExact && value != SearchModeApproximate {
+		return m, fmt.Errorf("invalid search mode '%s'", value)
+	}
+	return m, nil
+}
+
+func MakeApproximateSearchMode() SearchMode {
+	return SearchMode{SearchModeApproximate}
+}
+
+func (m SearchMode) Value() string {
+	return m.value
+}
+
+// Checks whether only the candidate profiles found by MinHash signatures are
+// compared instead of all the profiles.
+func (m SearchMode) IsApproximate() bool {
+	return m.value == SearchModeApproximate
+}
@@ -0,0 +1,52 @@
+package valueobjects
+
+import "fmt"
+
+const (
+	SimilarityMetricJaccard         string = "jaccard"
+	SimilarityMetricCosine          string = "cosine"
+	SimilarityMetricDice            string = "dice"
+	SimilarityMetricOverlap         string = "overlap"
+	SimilarityMetricLogLikelihood   string = "llr"
+	SimilarityMetricConflictPenalty string = "conflict"
+	SimilarityMetricPearson         string = "pearson"
+)
+
+// The measure of similarity between profiles. The zero value stands for the
+// default metric of the namespace type.
+type SimilarityMetric struct {
+	value string
+}
+
+func ParseSimilarityMetric(value string) (SimilarityMetric, error) {
+	m := SimilarityMetric{value}
+	switch value {
+	case "",
+		SimilarityMetricJaccard,
+		SimilarityMetricCosine,
+		SimilarityMetricDice,
+		SimilarityMetricOverlap,
+		SimilarityMetricLogLikelihood,
+		SimilarityMetricConflictPenalty,
+		SimilarityMetricPearson:
+		return m, nil
+	}
+	return m, fmt.Errorf("invalid similarity metric '%s'", value)
+}
+
+func MakePearsonSimilarityMetric() SimilarityMetric {
+	return SimilarityMetric{SimilarityMetricPearson}
+}
+
+func MakeCosineSimilarityMetric() SimilarityMetric {
+	return SimilarityMetric{SimilarityMetricCosine}
+}
+
+func (m SimilarityMetric) Value() string {
+	return m.value
+}
+
+// Checks whether the metric is the default one of the namespace type.
+func (m SimilarityMetric) IsDefault() bool {
+	return m.value == ""
+}
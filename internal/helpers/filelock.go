@@ -0,0 +1,96 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The name of the lock file guarding namespaces.json, which stores the PID
+// of the process owning the files of its directory.
+const LockFileName = "namespaces.json.lock"
+
+// A file the operating system can lock, e.g. *os.File.
+type LockableFile interface {
+	Name() string
+	Fd() uintptr
+}
+
+// The file is locked by another process, which owns the files of the
+// directory.
+type FileLockedError struct {
+	Path string
+	// The PID of the process holding the lock or 0 if it's unknown.
+	PID int
+}
+
+func (e *FileLockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("The file %s is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("The file %s is locked by another process (PID %d)", e.Path, e.PID)
+}
+
+// Makes errors.Is() match any FileLockedError.
+func (e *FileLockedError) Is(target error) bool {
+	_, ok := target.(*FileLockedError)
+	return ok
+}
+
+func NewFileLockedError(path string, pid int) error {
+	return &FileLockedError{path, pid}
+}
+
+// Takes an exclusive lock of the file, which is held until the file is
+// closed. Fails with FileLockedError if the file is locked by another
+// process, which is looked up in the lock file of the file's directory.
+func LockFile(file LockableFile) error {
+	locked, err := tryLockFile(file)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		pid := readLockFilePID(filepath.Join(filepath.Dir(file.Name()), LockFileName))
+		return NewFileLockedError(file.Name(), pid)
+	}
+	return nil
+}
+
+// Returns the PID stored in the lock file or 0 if it cannot be read.
+func readLockFilePID(filePath string) int {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// Opens the lock file, takes an exclusive lock of it and writes the PID of
+// the process into it. The lock is held until the file is closed.
+func OpenLockFile(filePath string) (*os.File, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := tryLockFile(file)
+	if err == nil && !locked {
+		err = NewFileLockedError(filePath, readLockFilePID(filePath))
+	}
+	if err == nil {
+		err = file.Truncate(0)
+	}
+	if err == nil {
+		_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package helpers
+
+// The files aren't locked on the platforms without flock.
+func tryLockFile(file LockableFile) (bool, error) {
+	return true, nil
+}
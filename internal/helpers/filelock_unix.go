@@ -0,0 +1,15 @@
+//go:build unix
+
+package helpers
+
+import "syscall"
+
+// Takes an exclusive flock of the file without waiting. Returns false if the
+// file is locked by another process or another descriptor of the file.
+func tryLockFile(file LockableFile) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
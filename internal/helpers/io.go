@@ -7,9 +7,6 @@ import (
 // Static zero byte buffer that are used for filling free space in files.
 var zeros = [100]byte{}
 
-// /dev/null
-var dump = [100]byte{}
-
 // Effectively writes continuous range of zero-filled bytes into a writer.
 func WriteZeros(size int, writer io.Writer) (int, error) {
 	total := 0
@@ -27,22 +24,21 @@ func WriteZeros(size int, writer io.Writer) (int, error) {
 	return total, nil
 }
 
-// Skips some number of bytes in io.Reader.
+// Skips some number of bytes in io.Reader. Safe for concurrent use with
+// different readers.
 func SkipReading(size int, reader io.Reader) (int, error) {
 	if size == 0 {
 		return 0, nil
 	}
-	skipped := 0
-	for skipped < size {
-		chunk := size - skipped
-		if chunk > len(dump) {
-			chunk = len(dump)
-		}
-		read, err := reader.Read(dump[:chunk])
-		skipped += read
-		if err != nil {
-			return skipped, err
-		}
+	skipped, err := io.CopyN(io.Discard, reader, int64(size))
+	return int(skipped), err
+}
+
+// Commits the file contents to stable storage if the file supports it
+// (e.g. *os.File). Does nothing otherwise.
+func Sync(file any) error {
+	if syncer, ok := file.(interface{ Sync() error }); ok {
+		return syncer.Sync()
 	}
-	return skipped, nil
+	return nil
 }
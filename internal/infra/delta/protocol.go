@@ -3,37 +3,98 @@ package delta
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"recengine/internal/domain"
 	"reflect"
 )
 
-// Delta file Header.
+// Delta file Header. Since version 3, it stores the sequence number of the
+// last operation preceding the entries of the file, which were applied to
+// the database and removed.
 type Header struct {
 	Version    uint8
 	Locked     uint8
 	NumEntries uint32
+	BaseSeq    uint64
 }
 
-// Delta file Entry.
+// Delta file Entry. Since version 2, every flush of the entries is followed
+// by a commit entry, whose ItemID stores the number of the flushed entries.
+// Since version 3, the entries store the sequence numbers of the operations,
+// which increase in the order the operations are added (the commit entries
+// have no sequence numbers). The entries of the older versions are numbered
+// by their position in the file.
 type Entry struct {
 	Op       domain.DeltaOp
 	UserID   uint64
 	ItemID   uint64
-	Checksum byte
+	Seq      uint64
+	Checksum uint32
 }
 
-// File format Version.
-const Version = 1
+// Returns true if the entry marks the end of a flush.
+func (e *Entry) IsCommit() bool {
+	return e.Op == opCommit
+}
+
+// File format Version. Version 1 protects the entries with a byte sum,
+// version 2 uses CRC32C and commits every flush with a commit entry, and
+// version 3 adds the sequence numbers of the operations.
+const Version = 3
+
+// The oldest file format version that can still be read and written.
+const MinVersion = 1
+
+// The first file format version having the commit entries.
+const commitVersion = 2
+
+// The first file format version having the sequence numbers.
+const seqVersion = 3
+
+// The operation of the commit entries.
+const opCommit domain.DeltaOp = '='
+
+// The table of the CRC32C (Castagnoli) polynomial the checksums use.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
 
 // Header size in bytes (the prefix is not part of the header).
 // WARNING: because of the padding the header size may not equal sizeof(header)!
 const headerSize = 1 + 1 + 4
 
-// Entry size in bytes.
+// Header size in bytes since the file format version 3.
+const headerSizeV3 = headerSize + 8
+
+// Returns the header size in bytes in the file format version.
+func getHeaderSize(version byte) int {
+	if version >= seqVersion {
+		return headerSizeV3
+	}
+	return headerSize
+}
+
+// Entry size in bytes in the file format version 1.
 // WARNING: because of the padding the entry size may not equal sizeof(entry)!
 const entrySize = 1 + 8 + 8 + 1
 
+// Entry size in bytes in the file format version 2.
+const entrySizeV2 = 1 + 8 + 8 + 4
+
+// Entry size in bytes since the file format version 3.
+const entrySizeV3 = 1 + 8 + 8 + 8 + 4
+
+// Returns the entry size in bytes in the file format version.
+func getEntrySize(version byte) int {
+	if version >= seqVersion {
+		return entrySizeV3
+	}
+	if version >= commitVersion {
+		return entrySizeV2
+	}
+	return entrySize
+}
+
 // The file prefix (aka "Magic number").
 var prefix = [...]byte{'R', 'E', 'C', 'D', 'E', 'L', 'T', 'A'}
 
@@ -42,24 +103,36 @@ const lockedOffset = len(prefix) + 1
 
 // Provides delta file functions.
 type Protocol interface {
+	// Returns the protocol reading and writing the entries in the file format
+	// version or an error if the version isn't supported.
+	ForVersion(version byte) (Protocol, error)
+
+	// Returns the file format version the entries are read and written in.
+	GetVersion() byte
+
 	// Writes the file prefix, aka "Magic number", which verifies type of the file.
 	WritePrefix(writer io.Writer) error
 
 	// Reads the file prefix, aka "Magic number", which verifies type of the file.
 	ReadPrefix(reader io.Reader) error
 
-	// Writes file header (without the prefix).
+	// Writes file header (without the prefix) in the version of the header.
 	WriteHeader(header *Header, writer io.Writer) error
 
-	// Reads database header (without the prefix).
+	// Reads database header (without the prefix) in the version it has.
 	ReadHeader(header *Header, reader io.Reader) error
 
-	// Calculates a byte checksum for an entry.
-	CalcEntryChecksum(entry *Entry) byte
+	// Calculates the checksum of an entry: a byte sum in version 1 and
+	// CRC32C since version 2.
+	CalcEntryChecksum(entry *Entry) uint32
 
 	// Writes a file entry. Returns number of bytes written.
 	WriteEntry(entry *Entry, writer io.Writer) error
 
+	// Writes the commit entry ending a flush of the number of entries.
+	// Does nothing in the versions having no commit entries.
+	WriteCommit(numEntries uint32, writer io.Writer) error
+
 	// Reads a file entry. Returns the number of bytes read.
 	ReadEntry(entry *Entry, reader io.Reader) error
 
@@ -78,19 +151,38 @@ type Protocol interface {
 
 	// Recovers a corrupted file making its data consistent. All inconsistent
 	// data is skipped. The file is considered corrupted if it's locked, which
-	// means it hasn't been closed properly.
+	// means it hasn't been closed properly. The file is recovered in its
+	// version; since version 2 the flushes having no valid commit entry are
+	// rolled back entirely.
 	RecoverTo(reader io.Reader, writer io.WriteSeeker) error
 }
 
 // Implements delta file functions.
-type protocol struct{}
+type protocol struct {
+	version byte
+}
 
 // Compile-time type check
 var _ = (Protocol)((*protocol)(nil))
 
-// Returns new protocol instance.
+// Returns new protocol instance working with the current file format
+// version.
 func NewProtocol() Protocol {
-	return &protocol{}
+	return &protocol{Version}
+}
+
+// Returns the protocol reading and writing the entries in the file format
+// version or an error if the version isn't supported.
+func (p *protocol) ForVersion(version byte) (Protocol, error) {
+	if version < MinVersion || version > Version {
+		return nil, fmt.Errorf("unsupported delta version %d", version)
+	}
+	return &protocol{version}, nil
+}
+
+// Returns the file format version the entries are read and written in.
+func (p *protocol) GetVersion() byte {
+	return p.version
 }
 
 // Writes the file prefix, aka "Magic number", which verifies type of the file.
@@ -112,29 +204,36 @@ func (p *protocol) ReadPrefix(reader io.Reader) error {
 	return nil
 }
 
-// Writes file header (without the prefix).
+// Writes file header (without the prefix) in the version of the header.
 func (p *protocol) WriteHeader(header *Header, writer io.Writer) error {
-	err := binary.Write(writer, binary.BigEndian, header.Version)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(writer, binary.BigEndian, header.Locked)
-	if err != nil {
-		return err
+	buffer := make([]byte, 0, headerSizeV3)
+	buffer = append(buffer, header.Version, header.Locked)
+	buffer = binary.BigEndian.AppendUint32(buffer, header.NumEntries)
+	if header.Version >= seqVersion {
+		buffer = binary.BigEndian.AppendUint64(buffer, header.BaseSeq)
 	}
-	return binary.Write(writer, binary.BigEndian, header.NumEntries)
+	_, err := writer.Write(buffer)
+	return err
 }
 
-// Reads database header (without the prefix).
+// Reads database header (without the prefix) in the version it has.
 func (p *protocol) ReadHeader(header *Header, reader io.Reader) error {
-	buffer := make([]byte, headerSize)
-	_, err := io.ReadFull(reader, buffer)
+	buffer := make([]byte, headerSizeV3)
+	_, err := io.ReadFull(reader, buffer[:headerSize])
 	if err != nil {
 		return err
 	}
 	header.Version = buffer[0]
 	header.Locked = buffer[1]
 	header.NumEntries = binary.BigEndian.Uint32(buffer[2:])
+	header.BaseSeq = 0
+	if header.Version >= seqVersion {
+		_, err = io.ReadFull(reader, buffer[headerSize:])
+		if err != nil {
+			return err
+		}
+		header.BaseSeq = binary.BigEndian.Uint64(buffer[headerSize:])
+	}
 	return nil
 }
 
@@ -149,43 +248,69 @@ func (p *protocol) calcUint64Checksum(n uint64) byte {
 	return sum
 }
 
-// Calculates a byte checksum for an entry.
-func (p *protocol) CalcEntryChecksum(entry *Entry) byte {
-	return byte(entry.Op) + p.calcUint64Checksum(entry.UserID) + p.calcUint64Checksum(entry.ItemID)
+// Calculates the checksum of an entry: a byte sum in version 1 and CRC32C
+// since version 2.
+func (p *protocol) CalcEntryChecksum(entry *Entry) uint32 {
+	if p.version < commitVersion {
+		sum := byte(entry.Op) + p.calcUint64Checksum(entry.UserID) + p.calcUint64Checksum(entry.ItemID)
+		return uint32(sum)
+	}
+	return crc32.Checksum(p.appendEntryFields(nil, entry), checksumTable)
+}
+
+// Appends the fields of the entry preceding the checksum to the buffer.
+func (p *protocol) appendEntryFields(buffer []byte, entry *Entry) []byte {
+	buffer = append(buffer, byte(entry.Op))
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.UserID)
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.ItemID)
+	if p.version >= seqVersion {
+		buffer = binary.BigEndian.AppendUint64(buffer, entry.Seq)
+	}
+	return buffer
 }
 
 // Writes a file entry. Returns number of bytes written.
 func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) error {
-	err := binary.Write(writer, binary.BigEndian, entry.Op)
-	if err != nil {
-		return err
-	}
-	err = binary.Write(writer, binary.BigEndian, entry.UserID)
-	if err != nil {
-		return err
+	buffer := p.appendEntryFields(make([]byte, 0, entrySizeV3), entry)
+	if p.version < commitVersion {
+		buffer = append(buffer, byte(p.CalcEntryChecksum(entry)))
+	} else {
+		buffer = binary.BigEndian.AppendUint32(buffer, p.CalcEntryChecksum(entry))
 	}
-	err = binary.Write(writer, binary.BigEndian, entry.ItemID)
-	if err != nil {
-		return err
+	_, err := writer.Write(buffer)
+	return err
+}
+
+// Writes the commit entry ending a flush of the number of entries.
+// Does nothing in the versions having no commit entries.
+func (p *protocol) WriteCommit(numEntries uint32, writer io.Writer) error {
+	if p.version < commitVersion {
+		return nil
 	}
-	return binary.Write(writer, binary.BigEndian, p.CalcEntryChecksum(entry))
+	return p.WriteEntry(&Entry{Op: opCommit, ItemID: uint64(numEntries)}, writer)
 }
 
 // Reads a file entry. Returns the number of bytes read.
 func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) error {
-	err := binary.Read(reader, binary.BigEndian, &entry.Op)
-	if err != nil {
-		return err
-	}
-	err = binary.Read(reader, binary.BigEndian, &entry.UserID)
+	buffer := make([]byte, getEntrySize(p.version))
+	_, err := io.ReadFull(reader, buffer)
 	if err != nil {
 		return err
 	}
-	err = binary.Read(reader, binary.BigEndian, &entry.ItemID)
-	if err != nil {
-		return err
+	entry.Op = domain.DeltaOp(buffer[0])
+	entry.UserID = binary.BigEndian.Uint64(buffer[1:])
+	entry.ItemID = binary.BigEndian.Uint64(buffer[9:])
+	entry.Seq = 0
+	switch {
+	case p.version >= seqVersion:
+		entry.Seq = binary.BigEndian.Uint64(buffer[17:])
+		entry.Checksum = binary.BigEndian.Uint32(buffer[25:])
+	case p.version >= commitVersion:
+		entry.Checksum = binary.BigEndian.Uint32(buffer[17:])
+	default:
+		entry.Checksum = uint32(buffer[17])
 	}
-	return binary.Read(reader, binary.BigEndian, &entry.Checksum)
+	return nil
 }
 
 // Returns true if the checksum of the entry is valid or false otherwise.
@@ -249,7 +374,10 @@ func (p *protocol) IsLocked(file io.ReadSeeker) (bool, error) {
 
 // Recovers a corrupted file making its data consistent. All inconsistent
 // data is skipped. The file is considered corrupted if it's locked, which
-// means it hasn't been closed properly.
+// means it hasn't been closed properly. The file is recovered in its
+// version; since version 2 the flushes having no valid commit entry are
+// rolled back entirely, and since version 3 the entries not following the
+// base sequence number (left behind by an interrupted reset) are dropped.
 func (p *protocol) RecoverTo(reader io.Reader, writer io.WriteSeeker) error {
 	hdr := Header{
 		Version:    Version,
@@ -270,10 +398,11 @@ func (p *protocol) RecoverTo(reader io.Reader, writer io.WriteSeeker) error {
 
 	// Try to read header
 	err = p.ReadHeader(&hdr, reader)
-	hdr.Version = Version
 	hdr.Locked = 0
-	if err != nil {
+	if err != nil || hdr.Version < MinVersion || hdr.Version > Version {
+		hdr.Version = Version
 		hdr.NumEntries = 0
+		hdr.BaseSeq = 0
 		return p.WriteHeader(&hdr, writer)
 	}
 	err = p.WriteHeader(&hdr, writer)
@@ -282,32 +411,103 @@ func (p *protocol) RecoverTo(reader io.Reader, writer io.WriteSeeker) error {
 	}
 
 	// Copy valid entries
+	proto := &protocol{hdr.Version}
+	var entriesRecovered uint32
+	if proto.version < commitVersion {
+		entriesRecovered, err = proto.recoverEntries(reader, writer)
+	} else {
+		entriesRecovered, err = proto.recoverCommits(reader, writer, hdr.BaseSeq)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Update entry count in the destination file's header
+	if hdr.NumEntries != entriesRecovered {
+		_, err = writer.Seek(int64(len(prefix)), io.SeekStart)
+		if err != nil {
+			return err
+		}
+		hdr.NumEntries = entriesRecovered
+		return p.WriteHeader(&hdr, writer)
+	}
+
+	return nil
+}
+
+// Copies the entries having a valid checksum. Returns the number of the
+// entries copied.
+func (p *protocol) recoverEntries(reader io.Reader, writer io.Writer) (uint32, error) {
 	entry := Entry{}
 	var entriesRecovered uint32 = 0
 	for {
-		err = p.ReadEntry(&entry, reader)
+		err := p.ReadEntry(&entry, reader)
 		if err != nil {
 			break
 		}
-		if p.CalcEntryChecksum(&entry) != entry.Checksum {
+		if !p.ValidateEntryChecksum(&entry) {
 			continue
 		}
 		err = p.WriteEntry(&entry, writer)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		entriesRecovered++
 	}
+	return entriesRecovered, nil
+}
 
-	// Update entry count in the destination file's header
-	if hdr.NumEntries != entriesRecovered {
-		_, err = writer.Seek(int64(len(prefix)), io.SeekStart)
+// Copies the flushes whose entries all have a valid checksum and are
+// followed by a valid commit entry, except the entries numbered up to the
+// base sequence number. Returns the number of the entries copied, not
+// counting the commit entries.
+func (p *protocol) recoverCommits(reader io.Reader, writer io.Writer, baseSeq uint64) (uint32, error) {
+	entries := make([]Entry, 0)
+	valid := true
+	var entriesRecovered uint32 = 0
+	for {
+		entry := Entry{}
+		err := p.ReadEntry(&entry, reader)
 		if err != nil {
-			return err
+			// The tail having no commit entry is rolled back
+			break
 		}
-		hdr.NumEntries = entriesRecovered
-		return p.WriteHeader(&hdr, writer)
+		valid = valid && p.ValidateEntryChecksum(&entry)
+		if !entry.IsCommit() {
+			entries = append(entries, entry)
+			continue
+		}
+		valid = valid && entry.ItemID == uint64(len(entries))
+		// The entries applied before an interrupted reset of the file
+		if valid && p.version >= seqVersion {
+			entries = dropAppliedEntries(entries, baseSeq)
+		}
+		if valid && len(entries) > 0 {
+			for i := range entries {
+				err = p.WriteEntry(&entries[i], writer)
+				if err != nil {
+					return 0, err
+				}
+			}
+			err = p.WriteCommit(uint32(len(entries)), writer)
+			if err != nil {
+				return 0, err
+			}
+			entriesRecovered += uint32(len(entries))
+		}
+		entries = entries[:0]
+		valid = true
 	}
+	return entriesRecovered, nil
+}
 
-	return nil
+// Removes the entries numbered up to the base sequence number.
+func dropAppliedEntries(entries []Entry, baseSeq uint64) []Entry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Seq > baseSeq {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
 }
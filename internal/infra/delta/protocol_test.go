@@ -37,79 +37,143 @@ func TestReadPrefix(t *testing.T) {
 	}
 }
 
+// The headers of the file format versions and their data.
+var headerFixtures = []struct {
+	header Header
+	data   []byte
+}{
+	{Header{1, 0, 42, 0}, []byte{1, 0, 0, 0, 0, 42}},
+	{Header{2, 1, 42, 0}, []byte{2, 1, 0, 0, 0, 42}},
+	{Header{3, 1, 42, 9}, []byte{3, 1, 0, 0, 0, 42, 0, 0, 0, 0, 0, 0, 0, 9}},
+}
+
 func TestWriteHeader(t *testing.T) {
 	proto := NewProtocol()
-	header := Header{1, 0, 42}
-	expected := []byte{1, 0, 0, 0, 0, 42}
-	buf := bytes.NewBuffer(nil)
-	err := proto.WriteHeader(&header, buf)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
-	}
-	if !reflect.DeepEqual(expected, buf.Bytes()) {
-		t.Errorf("Header expected %v, got %v", expected, buf.Bytes())
-		return
+	for _, fixture := range headerFixtures {
+		buf := bytes.NewBuffer(nil)
+		err := proto.WriteHeader(&fixture.header, buf)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(fixture.data, buf.Bytes()) {
+			t.Errorf("Header expected %v, got %v", fixture.data, buf.Bytes())
+			return
+		}
 	}
 }
 
 func TestReadHeader(t *testing.T) {
 	proto := NewProtocol()
-	data := []byte{2, 1, 0, 0, 0, 42}
-	expected := Header{2, 1, 42}
-	header := Header{}
-	reader := bytes.NewReader(append(data, 7))
-	err := proto.ReadHeader(&header, reader)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
+	for _, fixture := range headerFixtures {
+		header := Header{}
+		reader := bytes.NewReader(append(fixture.data, 7))
+		err := proto.ReadHeader(&header, reader)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		pos, _ := reader.Seek(0, io.SeekCurrent)
+		if pos != int64(len(fixture.data)) {
+			t.Errorf("Position after read expected %d, got %d", len(fixture.data), pos)
+			return
+		}
+		if !reflect.DeepEqual(fixture.header, header) {
+			t.Errorf("Header expected %v, got %v", fixture.header, header)
+			return
+		}
 	}
-	pos, _ := reader.Seek(0, io.SeekCurrent)
-	if pos != int64(len(data)) {
-		t.Errorf("Position after read expected %d, got %d", len(data), pos)
-		return
+}
+
+func TestWriteEntry(t *testing.T) {
+	entry := Entry{'-', 7, 13, 5, 0}
+	fixtures := []struct {
+		version  byte
+		expected []byte
+	}{
+		{1, []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 65}},
+		{2, []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 174, 12, 82, 147}},
+		{3, []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 0, 0, 0, 0, 0, 0, 0, 5, 22, 249, 63, 121}},
 	}
-	if !reflect.DeepEqual(expected, header) {
-		t.Errorf("Header expected %v, got %v", expected, header)
-		return
+	for _, fixture := range fixtures {
+		proto, _ := NewProtocol().ForVersion(fixture.version)
+		buf := bytes.NewBuffer(nil)
+		err := proto.WriteEntry(&entry, buf)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(fixture.expected, buf.Bytes()) {
+			t.Errorf("Version %d entry expected %v, got %v", fixture.version, fixture.expected, buf.Bytes())
+			return
+		}
 	}
 }
 
-func TestWriteEntry(t *testing.T) {
-	proto := NewProtocol()
-	entry := Entry{'-', 7, 13, 65}
-	expected := []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 65}
-	buf := bytes.NewBuffer(nil)
-	err := proto.WriteEntry(&entry, buf)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
+func TestWriteCommit(t *testing.T) {
+	fixtures := []struct {
+		version  byte
+		expected []byte
+	}{
+		{1, []byte{}},
+		{2, []byte{'=', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 200, 63, 59, 156}},
+		{3, []byte{'=', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 55, 114, 44, 159}},
 	}
-	if !reflect.DeepEqual(expected, buf.Bytes()) {
-		t.Errorf("Entry expected %v, got %v", expected, buf.Bytes())
-		return
+	for _, fixture := range fixtures {
+		proto, _ := NewProtocol().ForVersion(fixture.version)
+		buf := bytes.NewBuffer([]byte{})
+		err := proto.WriteCommit(1, buf)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(fixture.expected, buf.Bytes()) {
+			t.Errorf("Version %d commit expected %v, got %v", fixture.version, fixture.expected, buf.Bytes())
+			return
+		}
 	}
 }
 
 func TestReadEntry(t *testing.T) {
-	proto := NewProtocol()
-	data := []byte{'+', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 65}
-	expected := Entry{'+', 7, 13, 65}
-	entry := Entry{}
-	reader := bytes.NewReader(append(data, 42))
-	err := proto.ReadEntry(&entry, reader)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
+	fixtures := []struct {
+		version  byte
+		data     []byte
+		expected Entry
+	}{
+		{
+			1,
+			[]byte{'+', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 65},
+			Entry{'+', 7, 13, 0, 65},
+		},
+		{
+			2,
+			[]byte{'+', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 107, 186, 237, 160},
+			Entry{'+', 7, 13, 0, 0x6bbaeda0},
+		},
+		{
+			3,
+			[]byte{'+', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 0, 0, 0, 0, 0, 0, 0, 5, 242, 67, 134, 55},
+			Entry{'+', 7, 13, 5, 0xf2438637},
+		},
 	}
-	pos, _ := reader.Seek(0, io.SeekCurrent)
-	if pos != int64(len(data)) {
-		t.Errorf("Position after read expected %d, got %d", len(data), pos)
-		return
-	}
-	if !reflect.DeepEqual(expected, entry) {
-		t.Errorf("Header expected %v, got %v", expected, entry)
-		return
+	for _, fixture := range fixtures {
+		proto, _ := NewProtocol().ForVersion(fixture.version)
+		entry := Entry{}
+		reader := bytes.NewReader(append(fixture.data, 42))
+		err := proto.ReadEntry(&entry, reader)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		pos, _ := reader.Seek(0, io.SeekCurrent)
+		if pos != int64(len(fixture.data)) {
+			t.Errorf("Position after read expected %d, got %d", len(fixture.data), pos)
+			return
+		}
+		if !reflect.DeepEqual(fixture.expected, entry) {
+			t.Errorf("Version %d entry expected %v, got %v", fixture.version, fixture.expected, entry)
+			return
+		}
 	}
 }
 
@@ -182,6 +246,8 @@ func TestRecoverTo(t *testing.T) {
 	validEntry := []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 65}
 	invalidEntry := []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 13, 0}
 	halfEntry := []byte{'-', 0, 0, 0, 0, 0, 0, 0, 7, 0, 0}
+	// The unreadable files are recreated in the current version
+	newHeader := append(prefix[:], Version, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
 
 	t.Run("should recover from unexpected EOF in prefix", func(t *testing.T) {
 		proto := NewProtocol()
@@ -192,11 +258,11 @@ func TestRecoverTo(t *testing.T) {
 			t.Errorf("Got error: %v", err)
 			return
 		}
-		if dstBuf.Len() != len(emptyHeader) {
-			t.Errorf("Length expected %v, got %v", len(emptyHeader), dstBuf.Len())
+		if dstBuf.Len() != len(newHeader) {
+			t.Errorf("Length expected %v, got %v", len(newHeader), dstBuf.Len())
 		}
-		if !reflect.DeepEqual(dstBuf.Bytes(), emptyHeader) {
-			t.Errorf("Expected data \n%v, got \n%v", emptyHeader, dstBuf.Bytes())
+		if !reflect.DeepEqual(dstBuf.Bytes(), newHeader) {
+			t.Errorf("Expected data \n%v, got \n%v", newHeader, dstBuf.Bytes())
 		}
 	})
 
@@ -209,11 +275,11 @@ func TestRecoverTo(t *testing.T) {
 			t.Errorf("Got error: %v", err)
 			return
 		}
-		if dstBuf.Len() != len(emptyHeader) {
-			t.Errorf("Length expected %v, got %v", len(emptyHeader), dstBuf.Len())
+		if dstBuf.Len() != len(newHeader) {
+			t.Errorf("Length expected %v, got %v", len(newHeader), dstBuf.Len())
 		}
-		if !reflect.DeepEqual(dstBuf.Bytes(), emptyHeader) {
-			t.Errorf("Expected data \n%v, got \n%v", emptyHeader, dstBuf.Bytes())
+		if !reflect.DeepEqual(dstBuf.Bytes(), newHeader) {
+			t.Errorf("Expected data \n%v, got \n%v", newHeader, dstBuf.Bytes())
 		}
 	})
 
@@ -274,3 +340,80 @@ func TestRecoverTo(t *testing.T) {
 		}
 	})
 }
+
+func TestRecoverToCommits(t *testing.T) {
+	proto := NewProtocol()
+	lockedHeader := append(prefix[:], Version, 1, 0, 0, 0, 42, 0, 0, 0, 0, 0, 0, 0, 9)
+	expectedHeader := append(prefix[:], Version, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 9)
+	// Returns the data of a flush of the entries.
+	makeFlush := func(entries ...Entry) []byte {
+		buf := bytes.NewBuffer(nil)
+		for i := range entries {
+			proto.WriteEntry(&entries[i], buf)
+		}
+		proto.WriteCommit(uint32(len(entries)), buf)
+		return buf.Bytes()
+	}
+	flush := makeFlush(
+		Entry{Op: '+', UserID: 7, ItemID: 13, Seq: 10},
+		Entry{Op: '-', UserID: 7, ItemID: 14, Seq: 11},
+	)
+	otherFlush := makeFlush(Entry{Op: '+', UserID: 8, ItemID: 15, Seq: 12})
+
+	t.Run("should roll back a partially written flush", func(t *testing.T) {
+		fileData := append(append(lockedHeader, flush...), otherFlush[:entrySizeV3+3]...)
+		expected := append(expectedHeader, flush...)
+		dstBuf := helpers.NewFileBuffer(nil)
+		err := proto.RecoverTo(helpers.NewFileBuffer(fileData), dstBuf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(dstBuf.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, dstBuf.Bytes())
+		}
+	})
+
+	t.Run("should roll back a flush missing the commit", func(t *testing.T) {
+		fileData := append(append(lockedHeader, flush...), otherFlush[:entrySizeV3]...)
+		expected := append(expectedHeader, flush...)
+		dstBuf := helpers.NewFileBuffer(nil)
+		err := proto.RecoverTo(helpers.NewFileBuffer(fileData), dstBuf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(dstBuf.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, dstBuf.Bytes())
+		}
+	})
+
+	t.Run("should drop the entries numbered up to the base sequence number", func(t *testing.T) {
+		resetHeader := append(prefix[:], Version, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10)
+		fileData := append(append(resetHeader, flush...), otherFlush...)
+		expected := append(prefix[:], Version, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 10)
+		expected = append(expected, makeFlush(Entry{Op: '-', UserID: 7, ItemID: 14, Seq: 11})...)
+		expected = append(expected, otherFlush...)
+		dstBuf := helpers.NewFileBuffer(nil)
+		err := proto.RecoverTo(helpers.NewFileBuffer(fileData), dstBuf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(dstBuf.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, dstBuf.Bytes())
+		}
+	})
+
+	t.Run("should drop a flush having a corrupted entry", func(t *testing.T) {
+		brokenFlush := append([]byte{}, otherFlush...)
+		brokenFlush[3] ^= 0x30 // Swapped bits in the user ID
+		fileData := append(append(lockedHeader, brokenFlush...), flush...)
+		expected := append(expectedHeader, flush...)
+		dstBuf := helpers.NewFileBuffer(nil)
+		err := proto.RecoverTo(helpers.NewFileBuffer(fileData), dstBuf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(dstBuf.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, dstBuf.Bytes())
+		}
+	})
+}
@@ -5,29 +5,41 @@ import (
 	"fmt"
 	"io"
 	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+	"recengine/internal/helpers"
 )
 
 // An item of the delta list corresponding to some user.
 type itemDelta struct {
 	item uint64
 	op   domain.DeltaOp
+	seq  uint64
 }
 
 // Implements a storage of the database difference data.
 type storage struct {
-	// The whole file data loaded into the memory.
+	// All the operations (flushed + unflushed) in the order they were added.
 	// The map key stores the user id.
 	deltaCache map[uint64][]itemDelta
-	// Unsaved changes. The map key stores the user id.
-	newDelta map[uint64][]itemDelta
+	// Unsaved operations in the order they were added.
+	newEntries []Entry
 	// Total item count (flushed + unflushed).
 	totalItemCount int
-	// Number of unflushed items.
-	unflushedItemCount int
+	// The sequence number of the last operation preceding the operations of
+	// the file.
+	baseSeq uint64
+	// The sequence number of the last added operation.
+	lastSeq uint64
+	// Number of the commit entries in the file.
+	numCommits int
 	// Storage file.
 	file domain.RandomAccessFile
-	// Delta file functions.
+	// Delta file functions of the file's version.
 	proto Protocol
+	// When the added operations are synced to the disk.
+	durability valueobjects.Durability
+	// Whether the file has been written since the last sync.
+	dirty bool
 }
 
 // Compile-time type check
@@ -35,11 +47,11 @@ var _ = (domain.DeltaStorage)((*storage)(nil))
 
 // Rewrites file header with actual data.
 func (s *storage) flushHeader() error {
-	fmt.Println(s)
 	hdr := &Header{
-		Version:    Version,
+		Version:    s.proto.GetVersion(),
 		Locked:     1,
 		NumEntries: uint32(s.GetTotalItemCount()),
+		BaseSeq:    s.baseSeq,
 	}
 	s.file.Seek(int64(len(prefix)), io.SeekStart)
 	writer := bufio.NewWriter(s.file)
@@ -54,55 +66,89 @@ func (s *storage) flushHeader() error {
 	return nil
 }
 
-// Writes entries to disk.
+// Writes entries to disk followed by the commit entry (if the version has
+// them), so a partially written flush is rolled back upon recovery.
 func (s *storage) flushEntries() error {
+	if len(s.newEntries) == 0 {
+		return nil
+	}
 	// Write to file
 	s.file.Seek(0, io.SeekEnd)
 	writer := bufio.NewWriter(s.file)
-	for user, deltas := range s.newDelta {
-		for _, delta := range deltas {
-			// Write to file
-			dto := &Entry{
-				Op:     delta.op,
-				UserID: user,
-				ItemID: delta.item,
-			}
-			err := s.proto.WriteEntry(dto, writer)
-			if err != nil {
-				return fmt.Errorf("failed to write entry: %v", err)
-			}
-			// Add to cache
-			_, exists := s.deltaCache[user]
-			if !exists {
-				s.deltaCache[user] = make([]itemDelta, 0)
-			}
-			s.deltaCache[user] = append(s.deltaCache[user], delta)
+	for i := range s.newEntries {
+		err := s.proto.WriteEntry(&s.newEntries[i], writer)
+		if err != nil {
+			return fmt.Errorf("failed to write entry: %v", err)
 		}
 	}
+	err := s.proto.WriteCommit(uint32(len(s.newEntries)), writer)
+	if err != nil {
+		return fmt.Errorf("failed to write commit: %v", err)
+	}
+	if s.proto.GetVersion() >= commitVersion {
+		s.numCommits++
+	}
 	// Flush the buffer
-	err := writer.Flush()
+	err = writer.Flush()
 	if err != nil {
 		return fmt.Errorf("failed to flush buffer: %v", err)
 	}
 	// Reset the unflushed data
-	s.unflushedItemCount = 0
-	s.newDelta = make(map[uint64][]itemDelta)
+	s.dirty = true
+	s.newEntries = s.newEntries[:0]
 	return nil
 }
 
-// Flushes the internal buffers.
+// Flushes the internal buffers. The entries are written before the header,
+// whose entry count must not exceed the number of the entries in the file.
 func (s *storage) Flush() error {
-	err := s.flushHeader()
+	err := s.flushEntries()
+	if err != nil {
+		return fmt.Errorf("failed to flush entries: %v", err)
+	}
+	err = s.flushHeader()
 	if err != nil {
 		return fmt.Errorf("failed to flush header: %v", err)
 	}
-	err = s.flushEntries()
+	return nil
+}
+
+// Flushes the internal buffers and commits the file to the disk.
+func (s *storage) Sync() error {
+	if len(s.newEntries) == 0 && !s.dirty {
+		return nil
+	}
+	err := s.Flush()
 	if err != nil {
-		return fmt.Errorf("failed to flush entries: %v", err)
+		return err
 	}
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to sync the file: %v", err)
+	}
+	s.dirty = false
 	return nil
 }
 
+// Makes the operations added so far durable, unless the durability of the
+// storage lets them be synced later by a periodic call to Sync().
+func (s *storage) Commit() error {
+	if s.durability.GetInterval() > 0 || len(s.newEntries) == 0 {
+		return nil
+	}
+	return s.Sync()
+}
+
+// Changes when the added operations are synced to the disk.
+func (s *storage) SetDurability(durability valueobjects.Durability) {
+	s.durability = durability
+}
+
+// Returns when the added operations are synced to the disk.
+func (s *storage) GetDurability() valueobjects.Durability {
+	return s.durability
+}
+
 // Closes the delta storage file.  The files not closed with this
 // function are considered broken and require recovery.
 func (s *storage) Close() error {
@@ -121,16 +167,48 @@ func (s *storage) Close() error {
 	return nil
 }
 
+// Removes all the operations from the storage and truncates the file.
+// It must be called only after the operations have been applied to the
+// associated database.
+// The sequence numbers of the operations added afterwards continue the ones
+// of the removed operations.
+func (s *storage) Reset() error {
+	s.deltaCache = make(map[uint64][]itemDelta)
+	s.newEntries = s.newEntries[:0]
+	s.totalItemCount = 0
+	s.baseSeq = s.lastSeq
+	s.numCommits = 0
+	// The emptied file is continued in the current version
+	proto, err := s.proto.ForVersion(Version)
+	if err != nil {
+		return err
+	}
+	s.proto = proto
+	// The entries are cut off before the header gets the new base sequence
+	// number, which they mustn't be replayed after
+	err = s.file.Truncate(int64(s.GetFileSize()))
+	if err != nil {
+		return fmt.Errorf("failed to truncate the file: %v", err)
+	}
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to sync the file: %v", err)
+	}
+	err = s.flushHeader()
+	if err != nil {
+		return fmt.Errorf("failed to flush header: %v", err)
+	}
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to sync the file: %v", err)
+	}
+	s.dirty = false
+	return nil
+}
+
 // Returns the number of users currently stored in the storage.
 func (s *storage) GetUserCount() int {
-	unflushedCount := 0
-	for user := range s.newDelta {
-		_, exists := s.deltaCache[user]
-		if !exists {
-			unflushedCount++
-		}
-	}
-	return unflushedCount + len(s.deltaCache)
+	return len(s.deltaCache)
 }
 
 // Returns the number of items currently stored in the storage.
@@ -140,47 +218,70 @@ func (s *storage) GetTotalItemCount() int {
 
 // Returns the storage file size required to keep all the data.
 func (s *storage) GetFileSize() uint64 {
-	return uint64(s.GetTotalItemCount())*entrySize + headerSize + uint64(len(prefix))
+	numEntries := uint64(s.GetTotalItemCount() + s.numCommits)
+	version := s.proto.GetVersion()
+	return numEntries*uint64(getEntrySize(version)) + uint64(getHeaderSize(version)+len(prefix))
 }
 
 // Returns the last operation associated with the specified user-item pair.
 // This method exists mostly for debugging and testing purposes.
 func (s *storage) Get(user uint64, item uint64) (domain.DeltaOp, bool) {
-	deltas, exists := s.newDelta[user]
-	if !exists {
-		deltas, exists = s.deltaCache[user]
-	}
-	if !exists {
-		return domain.DeltaOpAdd, false
-	}
-	for i := range deltas {
-		delta := deltas[len(deltas)-i-1]
-		if delta.item == item {
-			return delta.op, true
+	ops := s.GetUserOps(user)
+	for i := len(ops) - 1; i >= 0; i-- {
+		if ops[i].ItemID == item || ops[i].Op == domain.DeltaOpDeleteProfile {
+			return ops[i].Op, true
 		}
 	}
 	return domain.DeltaOpAdd, false
 }
 
+// Returns the IDs of all the users having at least one operation.
+func (s *storage) GetUsers() []uint64 {
+	users := make([]uint64, 0, s.GetUserCount())
+	for user := range s.deltaCache {
+		users = append(users, user)
+	}
+	return users
+}
+
+// Returns all the operations associated with the user in the order they
+// must be applied to the profile.
+func (s *storage) GetUserOps(user uint64) []domain.DeltaItem {
+	deltas := s.deltaCache[user]
+	ops := make([]domain.DeltaItem, len(deltas))
+	for i, delta := range deltas {
+		ops[i] = domain.DeltaItem{Op: delta.op, ItemID: delta.item, Seq: delta.seq}
+	}
+	return ops
+}
+
+// Returns the sequence number of the last added operation.
+func (s *storage) GetLastSeq() uint64 {
+	return s.lastSeq
+}
+
 // Adds an operation of item addition or removal to a user profile.
+// The operation gets the next sequence number.
 func (s *storage) Add(op domain.DeltaOp, user uint64, item uint64) {
-	deltas, exists := s.newDelta[user]
-	if !exists {
-		s.newDelta[user] = make([]itemDelta, 0)
-	} else {
-		// Try to replace the duplicate or opposite operation (if any)
-		for i := range deltas {
-			if deltas[i].item == item {
-				deltas[i].op = op
-				return
-			}
-		}
+	if op == domain.DeltaOpDeleteProfile {
+		item = 0
 	}
-	// Add a new operation
-	s.newDelta[user] = append(deltas, itemDelta{
-		item: item,
-		op:   op,
+	s.lastSeq++
+	s.newEntries = append(s.newEntries, Entry{
+		Op:     op,
+		UserID: user,
+		ItemID: item,
+		Seq:    s.lastSeq,
 	})
-	s.unflushedItemCount++
+	s.cacheOp(user, itemDelta{item: item, op: op, seq: s.lastSeq})
 	s.totalItemCount++
 }
+
+// Appends the operation to the operations of the user.
+func (s *storage) cacheOp(user uint64, delta itemDelta) {
+	deltas, exists := s.deltaCache[user]
+	if !exists {
+		deltas = make([]itemDelta, 0, 8)
+	}
+	s.deltaCache[user] = append(deltas, delta)
+}
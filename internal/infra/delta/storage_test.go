@@ -2,15 +2,19 @@ package delta
 
 import (
 	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
 	"recengine/internal/helpers"
+	"reflect"
 	"testing"
+	"time"
 )
 
-func makeTestHeaderData(locked bool, numEntries int) []byte {
+func makeTestHeaderData(locked bool, numEntries int, baseSeq uint64) []byte {
 	hdr := &Header{
 		Version:    Version,
 		Locked:     0,
 		NumEntries: uint32(numEntries),
+		BaseSeq:    baseSeq,
 	}
 	if locked {
 		hdr.Locked = 1
@@ -23,11 +27,12 @@ func makeTestHeaderData(locked bool, numEntries int) []byte {
 	return file.Bytes()
 }
 
-func makeTestEntryData(op domain.DeltaOp, user uint64, item uint64) []byte {
+func makeTestEntryData(op domain.DeltaOp, user uint64, item uint64, seq uint64) []byte {
 	dto := &Entry{
 		Op:     op,
 		UserID: user,
 		ItemID: item,
+		Seq:    seq,
 	}
 	deltaFile := NewProtocol()
 	dto.Checksum = deltaFile.CalcEntryChecksum(dto)
@@ -37,6 +42,13 @@ func makeTestEntryData(op domain.DeltaOp, user uint64, item uint64) []byte {
 	return file.Bytes()
 }
 
+func makeTestCommitData(numEntries int) []byte {
+	file := helpers.NewFileBuffer(nil)
+	defer file.Close()
+	NewProtocol().WriteCommit(uint32(numEntries), file)
+	return file.Bytes()
+}
+
 func TestClose(t *testing.T) {
 	factory := NewStorageFactory()
 
@@ -136,7 +148,7 @@ func TestAdd(t *testing.T) {
 		}
 	})
 
-	t.Run("shouldn't add duplicate entries", func(t *testing.T) {
+	t.Run("should keep duplicate entries", func(t *testing.T) {
 		// Add items
 		file := helpers.NewFileBuffer(nil)
 		storage, err := factory.Open(file)
@@ -148,15 +160,15 @@ func TestAdd(t *testing.T) {
 		storage.Add(domain.DeltaOpAdd, 7, 13)
 		storage.Add(domain.DeltaOpAdd, 7, 13)
 		// Check
-		if storage.GetTotalItemCount() != 1 {
-			t.Errorf("total item count expected %d, got %d", 1, storage.GetTotalItemCount())
+		if storage.GetTotalItemCount() != 2 {
+			t.Errorf("total item count expected %d, got %d", 2, storage.GetTotalItemCount())
 		}
 		if storage.GetUserCount() != 1 {
 			t.Errorf("user count expected %d, got %d", 1, storage.GetUserCount())
 		}
 	})
 
-	t.Run("should remove opposite entries", func(t *testing.T) {
+	t.Run("should let the last of opposite entries win", func(t *testing.T) {
 		// Add items
 		file := helpers.NewFileBuffer(nil)
 		storage, err := factory.Open(file)
@@ -169,8 +181,8 @@ func TestAdd(t *testing.T) {
 		storage.Add(domain.DeltaOpAdd, 7, 13)
 		storage.Add(domain.DeltaOpRemove, 7, 13)
 		// Check
-		if storage.GetTotalItemCount() != 2 {
-			t.Errorf("total item count expected %d, got %d", 1, storage.GetTotalItemCount())
+		if storage.GetTotalItemCount() != 3 {
+			t.Errorf("total item count expected %d, got %d", 3, storage.GetTotalItemCount())
 		}
 		op, exists := storage.Get(7, 13)
 		if !exists || op != domain.DeltaOpRemove {
@@ -178,3 +190,179 @@ func TestAdd(t *testing.T) {
 		}
 	})
 }
+
+func TestGetUserOps(t *testing.T) {
+	factory := NewStorageFactory()
+
+	t.Run("should return flushed and unflushed operations in order", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file)
+		if err != nil {
+			t.Errorf("Got error creating the file: %v", err)
+			return
+		}
+		defer storage.Close()
+		storage.Add(domain.DeltaOpAdd, 7, 13)
+		storage.Flush()
+		storage.Add(domain.DeltaOpDislike, 7, 42)
+		storage.Add(domain.DeltaOpAdd, 5, 42)
+		expected := []domain.DeltaItem{
+			{Op: domain.DeltaOpAdd, ItemID: 13, Seq: 1},
+			{Op: domain.DeltaOpDislike, ItemID: 42, Seq: 2},
+		}
+		if ops := storage.GetUserOps(7); !reflect.DeepEqual(ops, expected) {
+			t.Errorf("Expected operations %v, got %v", expected, ops)
+		}
+	})
+
+	t.Run("should keep the operations preceding profile deletion", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file)
+		if err != nil {
+			t.Errorf("Got error creating the file: %v", err)
+			return
+		}
+		defer storage.Close()
+		storage.Add(domain.DeltaOpAdd, 7, 13)
+		storage.Add(domain.DeltaOpAdd, 7, 42)
+		storage.Add(domain.DeltaOpDeleteProfile, 7, 0)
+		storage.Add(domain.DeltaOpAdd, 7, 0)
+		expected := []domain.DeltaItem{
+			{Op: domain.DeltaOpAdd, ItemID: 13, Seq: 1},
+			{Op: domain.DeltaOpAdd, ItemID: 42, Seq: 2},
+			{Op: domain.DeltaOpDeleteProfile, ItemID: 0, Seq: 3},
+			{Op: domain.DeltaOpAdd, ItemID: 0, Seq: 4},
+		}
+		if ops := storage.GetUserOps(7); !reflect.DeepEqual(ops, expected) {
+			t.Errorf("Expected operations %v, got %v", expected, ops)
+		}
+		if storage.GetTotalItemCount() != 4 {
+			t.Errorf("total item count expected %d, got %d", 4, storage.GetTotalItemCount())
+		}
+		if op, exists := storage.Get(7, 13); !exists || op != domain.DeltaOpDeleteProfile {
+			t.Errorf("Item {user: 7, item: 13} expected to be deleted: %v, %v", op, exists)
+		}
+	})
+}
+
+func TestFlush(t *testing.T) {
+	factory := NewStorageFactory()
+	file := helpers.NewFileBuffer(nil)
+	storage, err := factory.Open(file)
+	if err != nil {
+		t.Fatalf("Got error creating the file: %v", err)
+	}
+	users := []uint64{9, 3, 7, 1, 5}
+	expected := makeTestHeaderData(true, len(users), 0)
+	for i, user := range users {
+		storage.Add(domain.DeltaOpAdd, user, 42)
+		expected = append(expected, makeTestEntryData(domain.DeltaOpAdd, user, 42, uint64(i+1))...)
+	}
+	expected = append(expected, makeTestCommitData(len(users))...)
+
+	t.Run("should write the operations in the order they were added", func(t *testing.T) {
+		if err := storage.Flush(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+
+	t.Run("should continue the sequence after reopening", func(t *testing.T) {
+		storage.Close()
+		storage, err := factory.Open(helpers.NewFileBuffer(file.Bytes()))
+		if err != nil {
+			t.Fatalf("Got error opening the file: %v", err)
+		}
+		defer storage.Close()
+		if storage.GetLastSeq() != uint64(len(users)) {
+			t.Errorf("Expected the last sequence number %d, got %d", len(users), storage.GetLastSeq())
+		}
+		storage.Add(domain.DeltaOpRemove, 3, 42)
+		expectedOps := []domain.DeltaItem{
+			{Op: domain.DeltaOpAdd, ItemID: 42, Seq: 2},
+			{Op: domain.DeltaOpRemove, ItemID: 42, Seq: uint64(len(users) + 1)},
+		}
+		if ops := storage.GetUserOps(3); !reflect.DeepEqual(ops, expectedOps) {
+			t.Errorf("Expected operations %v, got %v", expectedOps, ops)
+		}
+	})
+}
+
+func TestReset(t *testing.T) {
+	factory := NewStorageFactory()
+	file := helpers.NewFileBuffer(nil)
+	storage, err := factory.Open(file)
+	if err != nil {
+		t.Errorf("Got error creating the file: %v", err)
+		return
+	}
+	storage.Add(domain.DeltaOpAdd, 7, 13)
+	storage.Flush()
+	storage.Add(domain.DeltaOpAdd, 5, 42)
+	err = storage.Reset()
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	if storage.GetTotalItemCount() != 0 || storage.GetUserCount() != 0 {
+		t.Errorf("Expected the storage to be empty, got %d items", storage.GetTotalItemCount())
+	}
+	if storage.GetLastSeq() != 2 {
+		t.Errorf("Expected the last sequence number %d, got %d", 2, storage.GetLastSeq())
+	}
+	storage.Close()
+	// The sequence continues after the reset
+	expected := makeTestHeaderData(false, 0, 2)
+	if !reflect.DeepEqual(file.Bytes(), expected) {
+		t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+	}
+}
+
+func TestCommit(t *testing.T) {
+	factory := NewStorageFactory()
+	header := makeTestHeaderData(true, 1, 0)
+	committed := append(append(header, makeTestEntryData(domain.DeltaOpAdd, 7, 13, 1)...), makeTestCommitData(1)...)
+
+	t.Run("should write the operations unless synced periodically", func(t *testing.T) {
+		durabilities := []valueobjects.Durability{{}, valueobjects.MakeAlwaysDurability()}
+		for _, durability := range durabilities {
+			file := helpers.NewFileBuffer(nil)
+			storage, err := factory.Open(file)
+			if err != nil {
+				t.Fatalf("Got error creating the file: %v", err)
+			}
+			storage.SetDurability(durability)
+			storage.Add(domain.DeltaOpAdd, 7, 13)
+			if err = storage.Commit(); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(file.Bytes(), committed) {
+				t.Errorf("Expected data \n%v, got \n%v", committed, file.Bytes())
+			}
+		}
+	})
+
+	t.Run("should leave the operations to the periodic sync", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file)
+		if err != nil {
+			t.Fatalf("Got error creating the file: %v", err)
+		}
+		storage.SetDurability(valueobjects.MakeIntervalDurability(time.Second))
+		storage.Add(domain.DeltaOpAdd, 7, 13)
+		if err = storage.Commit(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if file.Len() != len(makeTestHeaderData(true, 0, 0)) {
+			t.Errorf("Expected the operations to be left in memory, got file \n%v", file.Bytes())
+		}
+		if err = storage.Sync(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(file.Bytes(), committed) {
+			t.Errorf("Expected data \n%v, got \n%v", committed, file.Bytes())
+		}
+	})
+}
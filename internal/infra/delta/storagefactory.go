@@ -1,6 +1,7 @@
 package delta
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io"
@@ -60,18 +61,22 @@ func (f *storageFactory) Recover(file domain.RandomAccessFile) error {
 
 // Opens a delta storage file. If the file is empty, writes all necessary data.
 func (f *storageFactory) Open(file domain.RandomAccessFile) (domain.DeltaStorage, error) {
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			return nil, fmt.Errorf("failed to lock delta file: %w", err)
+		}
+	}
 	size, err := file.Seek(0, io.SeekEnd)
 	if err != nil {
 		return nil, err
 	}
 
 	storage := storage{
-		deltaCache:         make(map[uint64][]itemDelta),
-		newDelta:           make(map[uint64][]itemDelta),
-		totalItemCount:     0,
-		unflushedItemCount: 0,
-		file:               file,
-		proto:              f.proto,
+		deltaCache:     make(map[uint64][]itemDelta),
+		newEntries:     make([]Entry, 0),
+		totalItemCount: 0,
+		file:           file,
+		proto:          f.proto,
 	}
 
 	if size == 0 {
@@ -81,7 +86,7 @@ func (f *storageFactory) Open(file domain.RandomAccessFile) (domain.DeltaStorage
 			return nil, err
 		}
 		hdr := Header{
-			Version:    Version,
+			Version:    f.proto.GetVersion(),
 			Locked:     0,
 			NumEntries: 0,
 		}
@@ -107,23 +112,50 @@ func (f *storageFactory) Open(file domain.RandomAccessFile) (domain.DeltaStorage
 		if hdr.Locked != 0 {
 			return nil, errors.New("the file is corrupted (locked)")
 		}
+		// The entries are read and written in the version of the file
+		storage.proto, err = f.proto.ForVersion(hdr.Version)
+		if err != nil {
+			return nil, err
+		}
 		storage.totalItemCount = int(hdr.NumEntries)
+		storage.baseSeq = hdr.BaseSeq
+		storage.lastSeq = hdr.BaseSeq
+		reader := bufio.NewReader(file)
 		entry := Entry{}
-		for i := 0; i < int(hdr.NumEntries); i++ {
-			err = f.proto.ReadEntry(&entry, file)
+		for i := 0; i < int(hdr.NumEntries); {
+			err = storage.proto.ReadEntry(&entry, reader)
 			if err != nil {
 				return nil, fmt.Errorf("cannot read %dth entry: %v", i, err)
 			}
-			items, exists := storage.deltaCache[entry.UserID]
-			if !exists {
-				items = make([]itemDelta, 0, 100)
-				storage.deltaCache[entry.UserID] = items
+			if !storage.proto.ValidateEntryChecksum(&entry) {
+				return nil, fmt.Errorf("the file is corrupted (%dth entry checksum)", i)
+			}
+			if entry.IsCommit() {
+				storage.numCommits++
+				continue
 			}
-			storage.deltaCache[entry.UserID] = append(items, itemDelta{
+			// The entries of the older versions are numbered by position
+			if storage.proto.GetVersion() < seqVersion {
+				entry.Seq = storage.lastSeq + 1
+			} else if entry.Seq <= storage.lastSeq {
+				return nil, fmt.Errorf("the file is corrupted (%dth entry sequence number)", i)
+			}
+			i++
+			storage.lastSeq = entry.Seq
+			storage.cacheOp(entry.UserID, itemDelta{
 				op:   entry.Op,
 				item: entry.ItemID,
+				seq:  entry.Seq,
 			})
 		}
+		// The last flush is followed by its commit entry
+		if storage.proto.GetVersion() >= commitVersion && hdr.NumEntries > 0 {
+			err = storage.proto.ReadEntry(&entry, reader)
+			if err != nil || !entry.IsCommit() {
+				return nil, errors.New("the file is corrupted (uncommitted entries)")
+			}
+			storage.numCommits++
+		}
 	}
 
 	// Lock the file
@@ -138,20 +170,31 @@ func (f *storageFactory) Open(file domain.RandomAccessFile) (domain.DeltaStorage
 // Opens a delta storage file.  If the file is empty, writes all necessary
 // data. If the file is corrupted, tries to recover it first.
 func (f *storageFactory) OpenMaybeRecover(file domain.RandomAccessFile) (domain.DeltaStorage, error) {
-	locked, err := f.proto.IsLocked(file)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check if file is locked: %v", err)
-	}
-	if locked {
-		err = f.Recover(file)
-		if err != nil {
-			return nil, fmt.Errorf("failed to recover: %v", err)
+	// The file must not be recovered while another process is writing it
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			return nil, fmt.Errorf("failed to lock delta file: %w", err)
 		}
 	}
-	storage, err := f.Open(file)
+	size, err := file.Seek(0, io.SeekEnd)
 	if err != nil {
-		file.Close()
 		return nil, err
 	}
-	return storage, nil
+	if size > 0 {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		locked, err := f.proto.IsLocked(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if file is locked: %v", err)
+		}
+		if locked {
+			err = f.Recover(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to recover: %v", err)
+			}
+		}
+	}
+	return f.Open(file)
 }
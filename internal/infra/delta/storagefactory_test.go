@@ -11,13 +11,15 @@ func TestRecover(t *testing.T) {
 	factory := NewStorageFactory()
 
 	t.Run("should recover corrupted files", func(t *testing.T) {
-		lockedHeader := makeTestHeaderData(true, 42)
-		soleHeader := makeTestHeaderData(false, 1)
-		validEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13)
-		invalidEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13)
-		invalidEntry[len(invalidEntry)-1] = 0 // Checksum
-		fileData := append(append(lockedHeader, validEntry...), invalidEntry...)
-		expected := append(soleHeader, validEntry...)
+		lockedHeader := makeTestHeaderData(true, 42, 0)
+		soleHeader := makeTestHeaderData(false, 1, 0)
+		validEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13, 1)
+		invalidEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13, 1)
+		invalidEntry[len(invalidEntry)-1]++ // Checksum
+		commit := makeTestCommitData(1)
+		fileData := append(append(lockedHeader, validEntry...), commit...)
+		fileData = append(append(fileData, invalidEntry...), commit...)
+		expected := append(append(soleHeader, validEntry...), commit...)
 		file := helpers.NewFileBuffer(fileData)
 		err := factory.Recover(file)
 		if err != nil {
@@ -34,7 +36,7 @@ func TestOpen(t *testing.T) {
 	factory := NewStorageFactory()
 
 	t.Run("should create a new one if the file is empty", func(t *testing.T) {
-		expectedFileData := makeTestHeaderData(true, 0)
+		expectedFileData := makeTestHeaderData(true, 0, 0)
 		file := helpers.NewFileBuffer(nil)
 		storage, err := factory.Open(file)
 		if err != nil {
@@ -48,8 +50,9 @@ func TestOpen(t *testing.T) {
 	})
 
 	t.Run("should open the file if it is not empty", func(t *testing.T) {
-		headerData := makeTestHeaderData(false, 1)
-		entryData := makeTestEntryData(domain.DeltaOpRemove, 7, 13)
+		headerData := makeTestHeaderData(false, 1, 0)
+		entryData := makeTestEntryData(domain.DeltaOpRemove, 7, 13, 1)
+		entryData = append(entryData, makeTestCommitData(1)...)
 		file := helpers.NewFileBuffer(append(headerData, entryData...))
 		storage, err := factory.Open(file)
 		if err != nil {
@@ -65,8 +68,42 @@ func TestOpen(t *testing.T) {
 		}
 	})
 
+	t.Run("should fail opening a file with unordered sequence numbers", func(t *testing.T) {
+		fileData := makeTestHeaderData(false, 2, 0)
+		fileData = append(fileData, makeTestEntryData(domain.DeltaOpAdd, 7, 13, 2)...)
+		fileData = append(fileData, makeTestEntryData(domain.DeltaOpAdd, 5, 13, 1)...)
+		fileData = append(fileData, makeTestCommitData(2)...)
+		storage, err := factory.Open(helpers.NewFileBuffer(fileData))
+		if err == nil {
+			storage.Close()
+			t.Error("Opened a file with unordered sequence numbers without an error")
+		}
+	})
+
+	t.Run("should number the entries of version 2 by position", func(t *testing.T) {
+		proto, _ := NewProtocol().ForVersion(2)
+		file := helpers.NewFileBuffer(nil)
+		proto.WritePrefix(file)
+		proto.WriteHeader(&Header{Version: 2, NumEntries: 2}, file)
+		proto.WriteEntry(&Entry{Op: domain.DeltaOpAdd, UserID: 7, ItemID: 13}, file)
+		proto.WriteEntry(&Entry{Op: domain.DeltaOpAdd, UserID: 7, ItemID: 42}, file)
+		proto.WriteCommit(2, file)
+		storage, err := factory.Open(file)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer storage.Close()
+		expected := []domain.DeltaItem{
+			{Op: domain.DeltaOpAdd, ItemID: 13, Seq: 1},
+			{Op: domain.DeltaOpAdd, ItemID: 42, Seq: 2},
+		}
+		if ops := storage.GetUserOps(7); !reflect.DeepEqual(ops, expected) {
+			t.Errorf("Expected operations %v, got %v", expected, ops)
+		}
+	})
+
 	t.Run("should fail opening a locked file", func(t *testing.T) {
-		headerData := makeTestHeaderData(true, 0)
+		headerData := makeTestHeaderData(true, 0, 0)
 		file := helpers.NewFileBuffer(headerData)
 		storage, err := factory.Open(file)
 		if err == nil {
@@ -76,7 +113,7 @@ func TestOpen(t *testing.T) {
 	})
 
 	t.Run("should fail opening a malformed file", func(t *testing.T) {
-		headerData := makeTestHeaderData(true, 1)
+		headerData := makeTestHeaderData(true, 1, 0)
 		file := helpers.NewFileBuffer(headerData)
 		storage, err := factory.Open(file)
 		if err == nil {
@@ -105,20 +142,57 @@ func TestOpenMaybeRecover(t *testing.T) {
 	factory := NewStorageFactory()
 
 	t.Run("should recover corrupted files", func(t *testing.T) {
-		lockedHeader := makeTestHeaderData(true, 42)
-		soleHeader := makeTestHeaderData(false, 1)
-		validEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13)
-		invalidEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13)
-		invalidEntry[len(invalidEntry)-1] = 0 // Checksum
-		fileData := append(append(lockedHeader, validEntry...), invalidEntry...)
-		expected := append(soleHeader, validEntry...)
+		lockedHeader := makeTestHeaderData(true, 42, 0)
+		soleHeader := makeTestHeaderData(false, 1, 0)
+		validEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13, 1)
+		invalidEntry := makeTestEntryData(domain.DeltaOpRemove, 7, 13, 1)
+		invalidEntry[len(invalidEntry)-1]++ // Checksum
+		commit := makeTestCommitData(1)
+		fileData := append(append(lockedHeader, validEntry...), commit...)
+		fileData = append(append(fileData, invalidEntry...), commit...)
+		expected := append(append(soleHeader, validEntry...), commit...)
+		file := helpers.NewFileBuffer(fileData)
+		storage, err := factory.OpenMaybeRecover(file)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		storage.Close()
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+	t.Run("should open a file whose reset has been interrupted", func(t *testing.T) {
+		resetHeader := makeTestHeaderData(true, 0, 2)
+		fileData := append(resetHeader, makeTestEntryData(domain.DeltaOpAdd, 7, 13, 1)...)
+		fileData = append(fileData, makeTestCommitData(1)...)
+		fileData = append(fileData, makeTestEntryData(domain.DeltaOpAdd, 7, 14, 2)...)
+		fileData = append(fileData, makeTestCommitData(1)...)
 		file := helpers.NewFileBuffer(fileData)
 		storage, err := factory.OpenMaybeRecover(file)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if storage.GetTotalItemCount() != 0 || storage.GetLastSeq() != 2 {
+			t.Errorf("Expected an empty storage at sequence number 2, got %d items at %d",
+				storage.GetTotalItemCount(), storage.GetLastSeq())
+		}
+		storage.Close()
+		expected := makeTestHeaderData(false, 0, 2)
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+
+	t.Run("should create an empty file", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.OpenMaybeRecover(file)
 		if err != nil {
 			t.Errorf("Got error: %v", err)
 			return
 		}
 		storage.Close()
+		expected := makeTestHeaderData(false, 0, 0)
 		if !reflect.DeepEqual(file.Bytes(), expected) {
 			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
 		}
@@ -3,33 +3,65 @@ package index
 import (
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"io"
 	"reflect"
 )
 
-// Database index file format Version.
-const Version = 1
+// Database index file format Version. Version 2 protects the table of the
+// entries with a CRC32C checksum and follows it by the journal of the changes
+// made since the table was written, and version 3 guarantees the entries of
+// the table to be sorted by ID, so they're searched in place.
+const Version = 3
+
+// The first file format version having the journal.
+const journalVersion = 2
+
+// The first file format version having the entries sorted.
+const sortedVersion = 3
+
+// The table of the CRC32C (Castagnoli) polynomial the checksums use.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
 
 // Header size in bytes (the prefix is not part of the header).
 const headerSize = 1 + 1 + 4
 
+// Header size in bytes since the file format version 2.
+const headerSizeV2 = headerSize + 4
+
+// Returns the header size in bytes in the file format version.
+func getHeaderSize(version byte) int {
+	if version >= journalVersion {
+		return headerSizeV2
+	}
+	return headerSize
+}
+
 // Entry size in bytes
 const entrySize = 8 + 8
 
+// Journal entry size in bytes.
+const journalEntrySize = 1 + 8 + 8 + 4
+
 // The file prefix (aka "Magic number").
 var prefix = [...]byte{'R', 'E', 'C', 'I', 'D', 'X'}
 
-// The offset of the first entry byte from the beginning of the file.
-const entriesOffset = len(prefix) + headerSize
+// Returns the offset of the first entry byte from the beginning of the file
+// in the file format version.
+func getEntriesOffset(version byte) int {
+	return len(prefix) + getHeaderSize(version)
+}
 
 // The offset of the lock byte of the header from the beginning of the file.
 const lockedOffset = len(prefix) + 1
 
-// Database index file Header.
+// Database index file Header. Since version 2, it stores the CRC32C
+// checksum of the entries.
 type Header struct {
 	Version    uint8
 	Locked     uint8
 	NumEntries uint32
+	Checksum   uint32
 }
 
 // Database index record.
@@ -38,6 +70,20 @@ type Entry struct {
 	Index uint64
 }
 
+// The operations of the journal entries.
+const (
+	JournalPut    byte = '+'
+	JournalRemove byte = '-'
+)
+
+// The change of the index made since the entries were written.
+type JournalEntry struct {
+	Op       byte
+	ID       uint64
+	Index    uint64
+	Checksum uint32
+}
+
 // Provides index file functions.
 type Protocol interface {
 	// Writes the file prefix, aka "Magic number", which verifies type of the file.
@@ -46,10 +92,10 @@ type Protocol interface {
 	// Reads the file prefix, aka "Magic number", which verifies type of the file.
 	ReadPrefix(reader io.Reader) (int, error)
 
-	// Writes file header (without the prefix).
+	// Writes file header (without the prefix) in the version of the header.
 	WriteHeader(header *Header, writer io.Writer) (int, error)
 
-	// Reads database header (without the prefix).
+	// Reads database header (without the prefix) in the version it has.
 	ReadHeader(header *Header, reader io.Reader) (int, error)
 
 	// Writes a file entry. Returns number of bytes written.
@@ -58,6 +104,18 @@ type Protocol interface {
 	// Reads a database entry. Returns the number of bytes read.
 	ReadEntry(entry *Entry, reader io.Reader) (int, error)
 
+	// Calculates the CRC32C checksum of a journal entry continuing the
+	// checksum of the entries preceding the journal, so the entries left
+	// from the journals of the previous tables never pass the check.
+	CalcJournalEntryChecksum(entry *JournalEntry, tableChecksum uint32) uint32
+
+	// Writes a journal entry along with its checksum, which must have been
+	// calculated. Returns number of bytes written.
+	WriteJournalEntry(entry *JournalEntry, writer io.Writer) (int, error)
+
+	// Reads a journal entry. Returns the number of bytes read.
+	ReadJournalEntry(entry *JournalEntry, reader io.Reader) (int, error)
+
 	// Writes the "locked" field of the file's header without changing file
 	// pointer position.
 	WriteLocked(locked bool, file io.WriteSeeker) error
@@ -100,33 +158,36 @@ func (p *protocol) ReadPrefix(reader io.Reader) (int, error) {
 	return n, nil
 }
 
-// Writes file header (without the prefix).
+// Writes file header (without the prefix) in the version of the header.
 func (p *protocol) WriteHeader(header *Header, writer io.Writer) (int, error) {
-	err := binary.Write(writer, binary.BigEndian, header.Version)
-	if err != nil {
-		return 0, err
-	}
-	err = binary.Write(writer, binary.BigEndian, header.Locked)
-	if err != nil {
-		return 0, err
+	buffer := make([]byte, 0, headerSizeV2)
+	buffer = append(buffer, header.Version, header.Locked)
+	buffer = binary.BigEndian.AppendUint32(buffer, header.NumEntries)
+	if header.Version >= journalVersion {
+		buffer = binary.BigEndian.AppendUint32(buffer, header.Checksum)
 	}
-	err = binary.Write(writer, binary.BigEndian, header.NumEntries)
-	if err != nil {
-		return 0, err
-	}
-	return headerSize, nil
+	return writer.Write(buffer)
 }
 
-// Reads database header (without the prefix).
+// Reads database header (without the prefix) in the version it has.
 func (p *protocol) ReadHeader(header *Header, reader io.Reader) (int, error) {
-	buffer := make([]byte, headerSize)
-	n, err := io.ReadFull(reader, buffer)
+	buffer := make([]byte, headerSizeV2)
+	n, err := io.ReadFull(reader, buffer[:headerSize])
 	if err != nil {
 		return n, err
 	}
 	header.Version = buffer[0]
 	header.Locked = buffer[1]
 	header.NumEntries = binary.BigEndian.Uint32(buffer[2:])
+	header.Checksum = 0
+	if header.Version >= journalVersion {
+		m, err := io.ReadFull(reader, buffer[headerSize:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		header.Checksum = binary.BigEndian.Uint32(buffer[headerSize:])
+	}
 	return n, nil
 }
 
@@ -158,6 +219,50 @@ func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
 	return entrySize, nil
 }
 
+// Appends the encoded entry to the buffer.
+func appendEntry(buffer []byte, entry *Entry) []byte {
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.ID)
+	return binary.BigEndian.AppendUint64(buffer, entry.Index)
+}
+
+// Appends the fields of the journal entry preceding the checksum to the
+// buffer.
+func appendJournalEntryFields(buffer []byte, entry *JournalEntry) []byte {
+	buffer = append(buffer, entry.Op)
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.ID)
+	return binary.BigEndian.AppendUint64(buffer, entry.Index)
+}
+
+// Calculates the CRC32C checksum of a journal entry continuing the checksum
+// of the entries preceding the journal, so the entries left from the
+// journals of the previous tables never pass the check.
+func (p *protocol) CalcJournalEntryChecksum(entry *JournalEntry, tableChecksum uint32) uint32 {
+	buffer := appendJournalEntryFields(make([]byte, 0, journalEntrySize), entry)
+	return crc32.Update(tableChecksum, checksumTable, buffer)
+}
+
+// Writes a journal entry along with its checksum, which must have been
+// calculated. Returns number of bytes written.
+func (p *protocol) WriteJournalEntry(entry *JournalEntry, writer io.Writer) (int, error) {
+	buffer := appendJournalEntryFields(make([]byte, 0, journalEntrySize), entry)
+	buffer = binary.BigEndian.AppendUint32(buffer, entry.Checksum)
+	return writer.Write(buffer)
+}
+
+// Reads a journal entry. Returns the number of bytes read.
+func (p *protocol) ReadJournalEntry(entry *JournalEntry, reader io.Reader) (int, error) {
+	buffer := make([]byte, journalEntrySize)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	entry.Op = buffer[0]
+	entry.ID = binary.BigEndian.Uint64(buffer[1:])
+	entry.Index = binary.BigEndian.Uint64(buffer[9:])
+	entry.Checksum = binary.BigEndian.Uint32(buffer[17:])
+	return n, nil
+}
+
 // Writes the "locked" field of the file's header without changing file
 // pointer position.
 func (p *protocol) WriteLocked(locked bool, file io.WriteSeeker) error {
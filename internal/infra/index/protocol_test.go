@@ -45,49 +45,56 @@ func TestReadPrefix(t *testing.T) {
 	}
 }
 
+// The header fixtures in the file format versions.
+var testHeaders = []struct {
+	name   string
+	header Header
+	data   []byte
+}{
+	{"version 1", Header{1, 1, 42, 0}, []byte{1, 1, 0, 0, 0, 42}},
+	{"version 2", Header{2, 1, 42, 7}, []byte{2, 1, 0, 0, 0, 42, 0, 0, 0, 7}},
+}
+
 func TestWriteHeader(t *testing.T) {
-	header := Header{1, 0, 42}
-	expected := []byte{1, 0, 0, 0, 0, 42}
-	buf := bytes.NewBuffer(nil)
-	proto := NewProtocol()
-	n, err := proto.WriteHeader(&header, buf)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
-	}
-	if n != len(expected) {
-		t.Errorf("Write length expected %d, got %d", len(expected), n)
-		return
-	}
-	if !reflect.DeepEqual(expected, buf.Bytes()) {
-		t.Errorf("Header expected %v, got %v", expected, buf.Bytes())
-		return
+	for _, fixture := range testHeaders {
+		t.Run(fixture.name, func(t *testing.T) {
+			buf := bytes.NewBuffer(nil)
+			proto := NewProtocol()
+			n, err := proto.WriteHeader(&fixture.header, buf)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if n != len(fixture.data) {
+				t.Errorf("Write length expected %d, got %d", len(fixture.data), n)
+			}
+			if !reflect.DeepEqual(fixture.data, buf.Bytes()) {
+				t.Errorf("Header expected %v, got %v", fixture.data, buf.Bytes())
+			}
+		})
 	}
 }
 
 func TestReadHeader(t *testing.T) {
-	data := []byte{2, 1, 0, 0, 0, 42}
-	expected := Header{2, 1, 42}
-	header := Header{}
-	reader := bytes.NewReader(append(data, 7))
-	proto := NewProtocol()
-	n, err := proto.ReadHeader(&header, reader)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
-	}
-	if n != len(data) {
-		t.Errorf("Read length expected %d, got %d", len(data), n)
-		return
-	}
-	pos, _ := reader.Seek(0, io.SeekCurrent)
-	if pos != int64(len(data)) {
-		t.Errorf("Position after read expected %d, got %d", len(data), pos)
-		return
-	}
-	if !reflect.DeepEqual(expected, header) {
-		t.Errorf("Header expected %v, got %v", expected, header)
-		return
+	for _, fixture := range testHeaders {
+		t.Run(fixture.name, func(t *testing.T) {
+			header := Header{}
+			reader := bytes.NewReader(append(append([]byte{}, fixture.data...), 7))
+			proto := NewProtocol()
+			n, err := proto.ReadHeader(&header, reader)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if n != len(fixture.data) {
+				t.Errorf("Read length expected %d, got %d", len(fixture.data), n)
+			}
+			pos, _ := reader.Seek(0, io.SeekCurrent)
+			if pos != int64(len(fixture.data)) {
+				t.Errorf("Position after read expected %d, got %d", len(fixture.data), pos)
+			}
+			if !reflect.DeepEqual(fixture.header, header) {
+				t.Errorf("Header expected %v, got %v", fixture.header, header)
+			}
+		})
 	}
 }
 
@@ -137,6 +144,40 @@ func TestReadEntry(t *testing.T) {
 	}
 }
 
+func TestJournalEntry(t *testing.T) {
+	proto := NewProtocol()
+	entry := JournalEntry{Op: JournalPut, ID: 7, Index: 13}
+	entry.Checksum = proto.CalcJournalEntryChecksum(&entry, 42)
+	buf := bytes.NewBuffer(nil)
+
+	t.Run("should write an entry", func(t *testing.T) {
+		n, err := proto.WriteJournalEntry(&entry, buf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if n != journalEntrySize || buf.Len() != journalEntrySize {
+			t.Errorf("Write length expected %d, got %d", journalEntrySize, n)
+		}
+	})
+
+	t.Run("should read the entry", func(t *testing.T) {
+		read := JournalEntry{}
+		n, err := proto.ReadJournalEntry(&read, bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if n != journalEntrySize || read != entry {
+			t.Errorf("Entry expected %v, got %v", entry, read)
+		}
+	})
+
+	t.Run("should continue the checksum of the table", func(t *testing.T) {
+		if proto.CalcJournalEntryChecksum(&entry, 43) == entry.Checksum {
+			t.Error("Expected the checksum to depend on the table checksum")
+		}
+	})
+}
+
 func TestWriteLocked(t *testing.T) {
 	unlockedHeader := append(prefix[:], 1, 0, 0, 0, 0, 42)
 	lockedHeader := append(prefix[:], 1, 1, 0, 0, 0, 42)
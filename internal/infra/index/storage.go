@@ -4,16 +4,48 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"os"
 	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"sort"
 )
 
-// Implements database index storage.
+// The journal is never merged into the table before it gets this long.
+const minCheckpointJournalLen = 1024
+
+// The journal is merged into the table once the table has at most this many
+// times more entries, which keeps the overlay small.
+const checkpointTableRatio = 8
+
+// The change of an entry of the table made since the table was written.
+type overlayEntry struct {
+	index   uint64
+	removed bool
+}
+
+// Implements database index storage. The entries are looked up in the table
+// sorted by ID, which is mapped into memory, and in the overlay of the
+// changes made since the table was written. The changes are appended to the
+// journal following the table as well, and the table is rewritten merging the
+// overlay (a checkpoint) upon syncing once the journal grows large and upon
+// closing.
 type storage struct {
 	file    io.ReadWriteSeeker
 	closer  io.Closer
-	indices map[uint64]uint64
-	proto   Protocol
+	table   *table
+	overlay map[uint64]overlayEntry
+	// The number of the IDs having an index.
+	numEntries int
+	proto      Protocol
+	// The checksum of the table, which the checksums of the journal entries
+	// continue.
+	checksum uint32
+	// Buffers the journal entries until they're synced.
+	journal *bufio.Writer
+	// The number of the journal entries following the table.
+	journalLen int
 }
 
 // Compile-time type check
@@ -28,7 +60,7 @@ func (s *storage) create() error {
 		return fmt.Errorf("failed to write index prefix: %v", err)
 	}
 	// Header
-	header := Header{Version, 1, 0}
+	header := Header{Version, 1, 0, 0}
 	_, err = s.proto.WriteHeader(&header, writer)
 	if err != nil {
 		return fmt.Errorf("failed to write index header: %v", err)
@@ -41,8 +73,10 @@ func (s *storage) create() error {
 	return nil
 }
 
-// Loads the index file into memory.
-func (s *storage) load() error {
+// Loads the index file of the size replaying the journal. The torn tail of
+// the journal left by a crash is cut off. The files of the older versions are
+// converted to the current one.
+func (s *storage) load(size int64) error {
 	_, err := s.file.Seek(0, io.SeekStart)
 	if err != nil {
 		return err
@@ -58,121 +92,409 @@ func (s *storage) load() error {
 	if err != nil {
 		return fmt.Errorf("failed to read index header: %v", err)
 	}
-	if header.Locked != 0 {
-		return errors.New("broken index file (after unexpected termination)")
+	if header.Version > Version {
+		return fmt.Errorf("unsupported index file version %d", header.Version)
+	}
+	// The older versions write the entries upon closing only
+	if header.Locked != 0 && header.Version < journalVersion {
+		return domain.NewCorruptedFileError()
+	}
+	offset := int64(getEntriesOffset(header.Version)) + int64(header.NumEntries)*entrySize
+	if offset > size {
+		return domain.NewCorruptedFileError()
+	}
+	if header.Version >= sortedVersion {
+		s.table, err = loadTable(s.file, int64(getEntriesOffset(header.Version)), header.NumEntries)
+		if err != nil {
+			return fmt.Errorf("failed to load index entries: %v", err)
+		}
+		s.numEntries = s.table.Len()
+		// A checkpoint has been interrupted or the file is damaged
+		if crc32.Checksum(s.table.data, checksumTable) != header.Checksum {
+			return domain.NewCorruptedFileError()
+		}
+		// The journal follows the table
+		_, err = s.file.Seek(offset, io.SeekStart)
+		if err != nil {
+			return fmt.Errorf("failed to seek: %v", err)
+		}
+		reader.Reset(s.file)
+	} else {
+		err = s.loadUnsortedTable(&header, reader)
+		if err != nil {
+			return err
+		}
+	}
+	if header.Version >= journalVersion {
+		s.checksum = header.Checksum
+		offset, err = s.replayJournal(reader, offset)
+		if err != nil {
+			return err
+		}
 	}
 	// Lock
 	err = s.proto.WriteLocked(true, s.file)
 	if err != nil {
 		return fmt.Errorf("failed to write file lock: %v", err)
 	}
-	// Load entries
+	if header.Version < Version {
+		return s.checkpoint(true)
+	}
+	if truncater, ok := s.file.(interface{ Truncate(size int64) error }); ok {
+		err = truncater.Truncate(offset)
+		if err != nil {
+			return fmt.Errorf("failed to truncate journal: %v", err)
+		}
+	}
+	_, err = s.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	return nil
+}
+
+// Reads the table of the entries of the older versions, which may be
+// unsorted, into the overlay to be merged into a sorted table.
+func (s *storage) loadUnsortedTable(header *Header, reader io.Reader) error {
+	s.table = &table{}
+	hash := crc32.New(checksumTable)
+	entryReader := io.TeeReader(reader, hash)
 	entry := Entry{}
-	offset := int64(entriesOffset)
-	var size int
 	for i := uint(0); i < uint(header.NumEntries); i++ {
-		size, err = s.proto.ReadEntry(&entry, reader)
-		offset += int64(size)
+		_, err := s.proto.ReadEntry(&entry, entryReader)
 		if err != nil {
 			return fmt.Errorf("failed to read index entry: %v", err)
 		}
-		s.indices[entry.ID] = entry.Index
+		s.putOverlay(entry.ID, entry.Index)
+	}
+	// A checkpoint has been interrupted
+	if header.Version >= journalVersion && hash.Sum32() != header.Checksum {
+		return domain.NewCorruptedFileError()
 	}
 	return nil
 }
 
+// Applies the journal entries starting at the offset until the end of the
+// file or the first torn entry. Returns the offset following the last
+// applied entry.
+func (s *storage) replayJournal(reader io.Reader, offset int64) (int64, error) {
+	entry := JournalEntry{}
+	for {
+		_, err := s.proto.ReadJournalEntry(&entry, reader)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read journal entry: %v", err)
+		}
+		if s.proto.CalcJournalEntryChecksum(&entry, s.checksum) != entry.Checksum {
+			return offset, nil
+		}
+		switch entry.Op {
+		case JournalPut:
+			s.putOverlay(entry.ID, entry.Index)
+		case JournalRemove:
+			s.removeOverlay(entry.ID)
+		default:
+			return offset, nil
+		}
+		offset += journalEntrySize
+		s.journalLen++
+	}
+}
+
 // Closes the storage file.
 func (s *storage) Close() error {
-	err := s.saveHeader(false)
-	if err != nil {
-		if s.closer != nil {
-			s.closer.Close()
+	err := s.checkpoint(false)
+	if closeErr := s.table.Close(); err == nil {
+		err = closeErr
+	}
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
 		}
-		return err
 	}
-	err = s.saveEntries()
-	if err != nil {
-		if s.closer != nil {
-			s.closer.Close()
+	return err
+}
+
+// Returns the entries of the table merged with the overlay, encoded.
+func (s *storage) mergeOverlay() []byte {
+	ids := make([]uint64, 0, len(s.overlay))
+	for id := range s.overlay {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	buffer := make([]byte, 0, s.numEntries*entrySize)
+	entry := Entry{}
+	i, n := 0, s.table.Len()
+	for _, id := range ids {
+		for ; i < n && s.table.getID(i) < id; i++ {
+			entry = s.table.getEntry(i)
+			buffer = appendEntry(buffer, &entry)
+		}
+		// The overlay supersedes the entry of the table
+		if i < n && s.table.getID(i) == id {
+			i++
+		}
+		if !s.overlay[id].removed {
+			entry = Entry{id, s.overlay[id].index}
+			buffer = appendEntry(buffer, &entry)
 		}
-		return err
 	}
-	if s.closer != nil {
-		return s.closer.Close()
+	for ; i < n; i++ {
+		entry = s.table.getEntry(i)
+		buffer = appendEntry(buffer, &entry)
 	}
-	return nil
+	return buffer
 }
 
-// Saves the header corresponding to the current state of the storage.
-func (s *storage) saveHeader(locked bool) error {
+// Writes the table of all the entries replacing the journal, and commits the
+// file to stable storage. Unless closing, the storage goes on with the new
+// table mapped into memory.
+func (s *storage) checkpoint(locked bool) error {
+	entries := s.mergeOverlay()
 	lockedByte := byte(0)
 	if locked {
 		lockedByte = 1
 	}
-	header := Header{Version, lockedByte, uint32(len(s.indices))}
-	_, err := s.file.Seek(int64(len(prefix)), io.SeekStart)
+	numEntries := uint32(len(entries) / entrySize)
+	header := Header{Version, lockedByte, numEntries, crc32.Checksum(entries, checksumTable)}
+	var err error
+	if file, ok := s.getOwnFile(); ok {
+		err = s.replaceFile(file, &header, entries)
+	} else {
+		err = s.rewriteInPlace(&header, entries)
+	}
 	if err != nil {
-		if s.closer != nil {
-			s.closer.Close()
-		}
-		return fmt.Errorf("failed to seek: %v", err)
+		return err
 	}
-	writer := bufio.NewWriter(s.file)
-	_, err = s.proto.WriteHeader(&header, writer)
+	s.checksum = header.Checksum
+	s.journalLen = 0
+	s.overlay = make(map[uint64]overlayEntry)
+	if !locked {
+		return nil
+	}
+	offset := int64(getEntriesOffset(Version))
+	s.table, err = loadTable(s.file, offset, numEntries)
 	if err != nil {
-		if s.closer != nil {
-			s.closer.Close()
-		}
-		return fmt.Errorf("failed to write index header: %v", err)
+		return fmt.Errorf("failed to load index entries: %v", err)
 	}
-	err = writer.Flush()
+	_, err = s.file.Seek(offset+int64(len(entries)), io.SeekStart)
 	if err != nil {
-		return fmt.Errorf("failed flush buffer: %v", err)
+		return fmt.Errorf("failed to seek: %v", err)
 	}
 	return nil
 }
 
-// Saves cached entries into the disk.
-func (s *storage) saveEntries() error {
-	_, err := s.file.Seek(int64(entriesOffset), io.SeekStart)
+// Returns the file of the storage if it's a regular file closed by the
+// storage itself, which can be replaced then.
+func (s *storage) getOwnFile() (*os.File, bool) {
+	file, ok := s.file.(*os.File)
+	return file, ok && s.closer == io.Closer(file)
+}
+
+// Writes the file with the header and the table to a temporary file, which
+// then replaces the file of the storage. The storage goes on with the new file
+// unless the header is unlocked (closing). If the file cannot be replaced, the
+// storage goes on with the old one.
+func (s *storage) replaceFile(file *os.File, header *Header, entries []byte) error {
+	filePath := file.Name()
+	tmpPath := filePath + ".tmp"
+	err := writeTableFile(tmpPath, s.proto, header, entries)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+	// The old file keeps the whole journal in case it's not replaced
+	err = s.journal.Flush()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	// The table mustn't be mapped when the file is closed
+	oldNumEntries := uint32(s.table.Len())
+	err = s.table.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to release index entries: %v", err)
+	}
+	s.table = &table{}
+	// The file must be closed to be replaced on some systems
+	err = file.Close()
+	s.closer = nil
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to close index: %v", err)
+	}
+	renameErr := os.Rename(tmpPath, filePath)
+	if renameErr != nil {
+		os.Remove(tmpPath)
+	} else if header.Locked == 0 {
+		return nil
+	}
+	file, err = os.OpenFile(filePath, os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen index: %v", err)
+	}
+	err = helpers.LockFile(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to lock index file: %w", err)
+	}
+	s.file = file
+	s.closer = file
+	s.journal.Reset(file)
+	if renameErr == nil {
+		return nil
+	}
+	// The overlay and the journal of the old file are still valid
+	s.table, err = loadTable(file, int64(getEntriesOffset(Version)), oldNumEntries)
+	if err != nil {
+		return fmt.Errorf("failed to load index entries: %v", err)
+	}
+	_, err = file.Seek(0, io.SeekEnd)
 	if err != nil {
 		return fmt.Errorf("failed to seek: %v", err)
 	}
-	writer := bufio.NewWriter(s.file)
-	entry := Entry{}
-	for id, idx := range s.indices {
-		entry.ID = id
-		entry.Index = idx
-		_, err = s.proto.WriteEntry(&entry, writer)
+	return fmt.Errorf("failed to replace %s: %v", filePath, renameErr)
+}
+
+// Rewrites the table of the file in place cutting off the journal. The header
+// is written last, so an interrupted rewrite fails the checksum.
+func (s *storage) rewriteInPlace(header *Header, entries []byte) error {
+	// The buffered journal entries are superseded by the table
+	s.journal.Reset(s.file)
+	// The table mustn't be mapped while the file is being rewritten
+	err := s.table.Close()
+	if err != nil {
+		return fmt.Errorf("failed to release index entries: %v", err)
+	}
+	s.table = &table{}
+	offset := int64(getEntriesOffset(Version))
+	_, err = s.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	_, err = s.file.Write(entries)
+	if err != nil {
+		return fmt.Errorf("failed to write entries: %v", err)
+	}
+	if truncater, ok := s.file.(interface{ Truncate(size int64) error }); ok {
+		err = truncater.Truncate(offset + int64(len(entries)))
 		if err != nil {
-			return fmt.Errorf("failed to write entry: %v", err)
+			return fmt.Errorf("failed to truncate journal: %v", err)
 		}
 	}
-	err = writer.Flush()
+	_, err = s.file.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	_, err = s.proto.WriteHeader(header, s.file)
 	if err != nil {
-		return fmt.Errorf("failed flush buffer: %v", err)
+		return fmt.Errorf("failed to write index header: %v", err)
 	}
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to sync index: %v", err)
+	}
+	return nil
+}
+
+// Creates the index file of the header and the table, and commits it to
+// stable storage.
+func writeTableFile(filePath string, proto Protocol, header *Header, entries []byte) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	_, err = proto.WritePrefix(writer)
+	if err == nil {
+		_, err = proto.WriteHeader(header, writer)
+	}
+	if err == nil {
+		_, err = writer.Write(entries)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Appends the change to the journal.
+func (s *storage) writeJournalEntry(entry JournalEntry) error {
+	entry.Checksum = s.proto.CalcJournalEntryChecksum(&entry, s.checksum)
+	_, err := s.proto.WriteJournalEntry(&entry, s.journal)
+	if err != nil {
+		return fmt.Errorf("failed to write journal entry: %v", err)
+	}
+	s.journalLen++
 	return nil
 }
 
+// Writes the buffered journal entries and commits the file to stable storage.
+// Writes a checkpoint instead if the journal has grown large. The changes made
+// since the last sync must point to the data that is already synced, as the
+// checkpoint makes them survive a crash too.
+func (s *storage) Sync() error {
+	if s.journalLen >= minCheckpointJournalLen && s.journalLen*checkpointTableRatio >= s.numEntries {
+		return s.checkpoint(true)
+	}
+	err := s.journal.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	return helpers.Sync(s.file)
+}
+
 // Returns the index associated with the specified ID.
 func (s *storage) Get(id uint64) (uint64, bool) {
-	idx, ok := s.indices[id]
-	return idx, ok
+	if entry, ok := s.overlay[id]; ok {
+		return entry.index, !entry.removed
+	}
+	return s.table.Get(id)
+}
+
+// Returns the number of the IDs having an index.
+func (s *storage) GetNumEntries() int {
+	return s.numEntries
+}
+
+// Associates the index with the ID in the overlay.
+func (s *storage) putOverlay(id uint64, index uint64) {
+	if _, ok := s.Get(id); !ok {
+		s.numEntries++
+	}
+	s.overlay[id] = overlayEntry{index: index}
+}
+
+// Removes the index of the ID in the overlay. Returns false if there is no
+// such index.
+func (s *storage) removeOverlay(id uint64) bool {
+	if _, ok := s.Get(id); !ok {
+		return false
+	}
+	s.numEntries--
+	s.overlay[id] = overlayEntry{removed: true}
+	return true
 }
 
 // Associates an index with an ID.
 func (s *storage) Put(id uint64, index uint64) error {
-	// Update the in-memory map
-	s.indices[id] = index
-	return nil
+	s.putOverlay(id, index)
+	return s.writeJournalEntry(JournalEntry{Op: JournalPut, ID: id, Index: index})
 }
 
 // Removes an index from the database.
 func (s *storage) Remove(id uint64) error {
-	if _, hasIndex := s.indices[id]; !hasIndex {
+	if !s.removeOverlay(id) {
 		return nil
 	}
-	delete(s.indices, id)
-	return nil
+	return s.writeJournalEntry(JournalEntry{Op: JournalRemove, ID: id})
 }
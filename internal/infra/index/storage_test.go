@@ -1,7 +1,13 @@
 package index
 
 import (
+	"bytes"
+	"errors"
+	"hash/crc32"
 	"io"
+	"os"
+	"path/filepath"
+	"recengine/internal/domain"
 	"recengine/internal/helpers"
 	"testing"
 )
@@ -189,3 +195,273 @@ func TestRemove(t *testing.T) {
 		}
 	})
 }
+
+// Returns a copy of the file as it would be left by a crash.
+func copyTestFile(file *helpers.FileBuffer) *helpers.FileBuffer {
+	return helpers.NewFileBuffer(append([]byte{}, file.Bytes()...))
+}
+
+func TestJournal(t *testing.T) {
+	factory := NewStorageFactory()
+	file := helpers.NewFileBuffer(nil)
+	storage, err := factory.Open(file, nil)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer storage.Close()
+	storage.Put(7, 42)
+	storage.Put(13, 11)
+	storage.Remove(7)
+	if err = storage.Sync(); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+
+	t.Run("should replay the journal of a crashed storage", func(t *testing.T) {
+		crashed := copyTestFile(file)
+		storage, err := factory.Open(crashed, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		if _, ok := storage.Get(7); ok || storage.GetNumEntries() != 1 {
+			t.Errorf("Expected 1 index, got %d", storage.GetNumEntries())
+		}
+		if idx, ok := storage.Get(13); !ok || idx != 11 {
+			t.Errorf("Expected index to be 11, got %d (%v)", idx, ok)
+		}
+	})
+
+	t.Run("should cut off the torn journal entry", func(t *testing.T) {
+		crashed := copyTestFile(file)
+		size := crashed.Len()
+		crashed.Seek(0, io.SeekEnd)
+		crashed.Write([]byte{JournalPut, 0, 0, 0})
+		storage, err := factory.Open(crashed, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		if storage.GetNumEntries() != 1 || crashed.Len() != size {
+			t.Errorf("Expected the file of %d bytes with 1 index, got %d, %d", size, crashed.Len(), storage.GetNumEntries())
+		}
+		storage.Close()
+	})
+
+	t.Run("should fail if a checkpoint has been interrupted", func(t *testing.T) {
+		crashed := copyTestFile(file)
+		// The table doesn't match the checksum of the header
+		crashed.Bytes()[len(prefix)+headerSize]++
+		_, err := factory.Open(crashed, nil)
+		if !errors.Is(err, &domain.CorruptedFileError{}) {
+			t.Errorf("Expected CorruptedFileError, got %v", err)
+		}
+	})
+
+	t.Run("should replay the journal following the table", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		storage.Put(7, 42)
+		storage.Close()
+		storage, err = factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		storage.Put(13, 11)
+		storage.Sync()
+		storage, err = factory.Open(copyTestFile(file), nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		if idx, ok := storage.Get(13); !ok || idx != 11 || storage.GetNumEntries() != 2 {
+			t.Errorf("Expected index to be 11 of 2 entries, got %d (%v)", idx, ok)
+		}
+	})
+
+	t.Run("should write a checkpoint once the journal outgrows the table", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		for i := 0; i <= minCheckpointJournalLen; i++ {
+			storage.Put(uint64(i%10), uint64(i))
+		}
+		storage.Sync()
+		header := Header{}
+		file.Seek(int64(len(prefix)), io.SeekStart)
+		NewProtocol().ReadHeader(&header, file)
+		if header.NumEntries != 10 || file.Len() != getEntriesOffset(Version)+10*entrySize {
+			t.Errorf("Expected the table of 10 entries only, got %d entries", header.NumEntries)
+		}
+	})
+
+	t.Run("should not write a checkpoint until synced", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		for i := 0; i <= 2*minCheckpointJournalLen; i++ {
+			storage.Put(uint64(i%10), uint64(i))
+		}
+		header := Header{}
+		file.Seek(int64(len(prefix)), io.SeekStart)
+		NewProtocol().ReadHeader(&header, file)
+		if header.NumEntries != 0 {
+			t.Errorf("Expected an empty table, got %d entries", header.NumEntries)
+		}
+	})
+
+	t.Run("should replace a regular file upon a checkpoint", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "index")
+		storage, err := factory.OpenFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		for i := 0; i <= minCheckpointJournalLen; i++ {
+			storage.Put(uint64(i%10), uint64(i))
+		}
+		if err = storage.Sync(); err != nil {
+			t.Fatalf("Failed to sync: %v", err)
+		}
+		info, err := os.Stat(filePath)
+		if err != nil || info.Size() != int64(getEntriesOffset(Version)+10*entrySize) {
+			t.Errorf("Expected the table of 10 entries only, got %v (%v)", info, err)
+		}
+		if _, err = os.Stat(filePath + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("Expected the temporary file to be gone, got %v", err)
+		}
+		storage.Put(11, 42)
+		if err = storage.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		storage, err = factory.OpenFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		if idx, ok := storage.Get(11); !ok || idx != 42 || storage.GetNumEntries() != 11 {
+			t.Errorf("Expected index to be 42 of 11 entries, got %d (%v)", idx, ok)
+		}
+	})
+}
+
+func TestOpenVersion1(t *testing.T) {
+	data := append(prefix[:], 1, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 42)
+	factory := NewStorageFactory()
+
+	t.Run("should convert the file to the current version", func(t *testing.T) {
+		file := helpers.NewFileBuffer(append([]byte{}, data...))
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		storage.Put(8, 43)
+		storage.Close()
+		storage, err = factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		if file.Bytes()[len(prefix)] != Version || storage.GetNumEntries() != 2 {
+			t.Errorf("Expected version %d with 2 indexes, got %d", Version, storage.GetNumEntries())
+		}
+		if idx, ok := storage.Get(7); !ok || idx != 42 {
+			t.Errorf("Expected index to be 42, got %d (%v)", idx, ok)
+		}
+	})
+
+	t.Run("should fail opening a locked file", func(t *testing.T) {
+		file := helpers.NewFileBuffer(append([]byte{}, data...))
+		file.Bytes()[lockedOffset] = 1
+		_, err := factory.Open(file, nil)
+		if !errors.Is(err, &domain.CorruptedFileError{}) {
+			t.Errorf("Expected CorruptedFileError, got %v", err)
+		}
+	})
+}
+
+func TestOpenVersion2(t *testing.T) {
+	proto := NewProtocol()
+	entries := appendEntry(appendEntry(nil, &Entry{13, 11}), &Entry{7, 42})
+	header := Header{2, 1, 2, crc32.Checksum(entries, checksumTable)}
+	file := helpers.NewFileBuffer(nil)
+	proto.WritePrefix(file)
+	proto.WriteHeader(&header, file)
+	file.Write(entries)
+	journalEntry := JournalEntry{Op: JournalRemove, ID: 13}
+	journalEntry.Checksum = proto.CalcJournalEntryChecksum(&journalEntry, header.Checksum)
+	proto.WriteJournalEntry(&journalEntry, file)
+	storage, err := NewStorageFactory().Open(file, nil)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer storage.Close()
+	if file.Bytes()[len(prefix)] != Version {
+		t.Errorf("Expected version %d, got %d", Version, file.Bytes()[len(prefix)])
+	}
+	expected := appendEntry(nil, &Entry{7, 42})
+	if !bytes.Equal(file.Bytes()[getEntriesOffset(Version):], expected) {
+		t.Errorf("Expected entries %v, got %v", expected, file.Bytes()[getEntriesOffset(Version):])
+	}
+}
+
+func TestStorageFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.index")
+	factory := NewStorageFactory()
+	storage, err := factory.OpenFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	for id := uint64(0); id < 1000; id++ {
+		storage.Put(id*2, id)
+	}
+	if err = storage.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	storage, err = factory.OpenFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	t.Run("should search the table", func(t *testing.T) {
+		if idx, ok := storage.Get(998); !ok || idx != 499 {
+			t.Errorf("Expected index to be 499, got %d (%v)", idx, ok)
+		}
+		if _, ok := storage.Get(999); ok {
+			t.Error("Found the index of a missing ID")
+		}
+	})
+
+	t.Run("should merge the overlay into the table", func(t *testing.T) {
+		storage.Put(999, 7)
+		storage.Put(998, 8)
+		storage.Remove(0)
+		if storage.GetNumEntries() != 1000 {
+			t.Errorf("Expected 1000 entries, got %d", storage.GetNumEntries())
+		}
+		if err := storage.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		storage, err := factory.OpenFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		expected := map[uint64]uint64{2: 1, 998: 8, 999: 7}
+		for id, index := range expected {
+			if idx, ok := storage.Get(id); !ok || idx != index {
+				t.Errorf("Expected index of %d to be %d, got %d (%v)", id, index, idx, ok)
+			}
+		}
+		if _, ok := storage.Get(0); ok || storage.GetNumEntries() != 1000 {
+			t.Errorf("Expected 1000 entries without 0, got %d", storage.GetNumEntries())
+		}
+	})
+}
@@ -1,10 +1,12 @@
 package index
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"recengine/internal/domain"
+	"recengine/internal/helpers"
 )
 
 // Index storage factory.
@@ -44,11 +46,21 @@ func (f *storageFactory) Open(
 	file io.ReadWriteSeeker,
 	closer io.Closer,
 ) (domain.IndexStorage, error) {
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, fmt.Errorf("failed to lock index file: %w", err)
+		}
+	}
 	storage := &storage{
 		file:    file,
 		closer:  closer,
-		indices: make(map[uint64]uint64),
+		table:   &table{},
+		overlay: make(map[uint64]overlayEntry),
 		proto:   f.proto,
+		journal: bufio.NewWriter(file),
 	}
 	size, err := file.Seek(0, io.SeekEnd)
 	if err != nil {
@@ -58,12 +70,14 @@ func (f *storageFactory) Open(
 		return nil, err
 	}
 	if size > 0 {
-		err = storage.load()
+		err = storage.load(size)
 		if err != nil {
-			if closer != nil {
-				closer.Close()
+			storage.table.Close()
+			// The upgrade of the file may have replaced it
+			if storage.closer != nil {
+				storage.closer.Close()
 			}
-			return nil, fmt.Errorf("failed to load index: %v", err)
+			return nil, fmt.Errorf("failed to load index: %w", err)
 		}
 	} else {
 		err = storage.create()
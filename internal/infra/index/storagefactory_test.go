@@ -1,8 +1,11 @@
 package index
 
 import (
+	"errors"
 	"io"
+	"path/filepath"
 	"recengine/internal/helpers"
+	"runtime"
 	"testing"
 )
 
@@ -46,8 +49,8 @@ func TestOpen(t *testing.T) {
 			t.Errorf("Expected to have 0 entries, got %d", header.NumEntries)
 			return
 		}
-		if file.Len() != len(prefix)+headerSize {
-			t.Errorf("Expected be of %d bytes, got %d", file.Len(), len(prefix)+headerSize)
+		if file.Len() != getEntriesOffset(Version) {
+			t.Errorf("Expected be of %d bytes, got %d", getEntriesOffset(Version), file.Len())
 			return
 		}
 	})
@@ -76,4 +79,26 @@ func TestOpen(t *testing.T) {
 			t.Error("The storage is locked after closed")
 		}
 	})
+
+	t.Run("should refuse to open a file opened by another storage", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("The files aren't locked on Windows")
+		}
+		filePath := filepath.Join(t.TempDir(), "index.idx")
+		factory := NewStorageFactoryForProtocol(proto)
+		storage, err := factory.OpenFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		_, err = factory.OpenFile(filePath)
+		if !errors.Is(err, &helpers.FileLockedError{}) {
+			t.Errorf("Expected FileLockedError, got %v", err)
+		}
+		storage.Close()
+		storage, err = factory.OpenFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to open after closed: %v", err)
+		}
+		storage.Close()
+	})
 }
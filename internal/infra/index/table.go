@@ -0,0 +1,55 @@
+package index
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+)
+
+// The table of the entries sorted by ID, which is searched in place. On
+// Linux the table of a regular file is mapped into memory rather than read.
+type table struct {
+	// The encoded entries.
+	data []byte
+	// The mapping of the file the entries are a part of, if any.
+	mapping []byte
+}
+
+// Reads the table of the entries located at the offset into memory.
+func readTable(file io.ReadSeeker, offset int64, numEntries uint32) (*table, error) {
+	data := make([]byte, int(numEntries)*entrySize)
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.ReadFull(file, data)
+	if err != nil {
+		return nil, err
+	}
+	return &table{data: data}, nil
+}
+
+// Returns the number of the entries.
+func (t *table) Len() int {
+	return len(t.data) / entrySize
+}
+
+// Returns the ID of the i-th entry.
+func (t *table) getID(i int) uint64 {
+	return binary.BigEndian.Uint64(t.data[i*entrySize:])
+}
+
+// Returns the i-th entry.
+func (t *table) getEntry(i int) Entry {
+	return Entry{t.getID(i), binary.BigEndian.Uint64(t.data[i*entrySize+8:])}
+}
+
+// Returns the index associated with the ID by binary search.
+func (t *table) Get(id uint64) (uint64, bool) {
+	n := t.Len()
+	i := sort.Search(n, func(i int) bool { return t.getID(i) >= id })
+	if i == n || t.getID(i) != id {
+		return 0, false
+	}
+	return t.getEntry(i).Index, true
+}
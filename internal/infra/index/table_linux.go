@@ -0,0 +1,37 @@
+//go:build linux
+
+package index
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// Maps the table of the entries located at the offset of a regular file into
+// memory. The table of the other streams is read into memory.
+func loadTable(file io.ReadSeeker, offset int64, numEntries uint32) (*table, error) {
+	osFile, ok := file.(*os.File)
+	if !ok || numEntries == 0 {
+		return readTable(file, offset, numEntries)
+	}
+	end := int(offset) + int(numEntries)*entrySize
+	mapping, err := syscall.Mmap(int(osFile.Fd()), 0, end, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	// The advice is a hint only, so its failure doesn't matter
+	syscall.Madvise(mapping, syscall.MADV_RANDOM)
+	return &table{data: mapping[offset:end], mapping: mapping}, nil
+}
+
+// Releases the memory mapping of the table, if any.
+func (t *table) Close() error {
+	if t.mapping == nil {
+		return nil
+	}
+	err := syscall.Munmap(t.mapping)
+	t.mapping = nil
+	t.data = nil
+	return err
+}
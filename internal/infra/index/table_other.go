@@ -0,0 +1,16 @@
+//go:build !linux
+
+package index
+
+import "io"
+
+// Reads the table of the entries located at the offset into memory.
+func loadTable(file io.ReadSeeker, offset int64, numEntries uint32) (*table, error) {
+	return readTable(file, offset, numEntries)
+}
+
+// Releases the memory taken by the table.
+func (t *table) Close() error {
+	t.data = nil
+	return nil
+}
@@ -0,0 +1,211 @@
+package itemindex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Item index file format Version.
+const Version = 1
+
+// Header size in bytes (the prefix is not part of the header).
+const headerSize = 1 + 1 + 4
+
+// The size of the entry fields preceding the offsets.
+const entryHeaderSize = 8 + 4
+
+// The file prefix (aka "Magic number").
+var prefix = [...]byte{'R', 'E', 'C', 'I', 'T', 'M'}
+
+// The offset of the first entry byte from the beginning of the file.
+const entriesOffset = len(prefix) + headerSize
+
+// The offset of the lock byte of the header from the beginning of the file.
+const lockedOffset = len(prefix) + 1
+
+// Item index file Header.
+type Header struct {
+	Version  uint8
+	Locked   uint8
+	NumItems uint32
+}
+
+// Item index record: the posting list of an item.
+type Entry struct {
+	ItemID uint64
+	// The sorted offsets of the database entries of the profiles having
+	// the item.
+	Offsets []uint64
+}
+
+// Provides item index file functions.
+type Protocol interface {
+	// Writes the file prefix, aka "Magic number", which verifies type of the file.
+	WritePrefix(writer io.Writer) (int, error)
+
+	// Reads the file prefix, aka "Magic number", which verifies type of the file.
+	ReadPrefix(reader io.Reader) (int, error)
+
+	// Writes file header (without the prefix).
+	WriteHeader(header *Header, writer io.Writer) (int, error)
+
+	// Reads file header (without the prefix).
+	ReadHeader(header *Header, reader io.Reader) (int, error)
+
+	// Writes a file entry. Returns number of bytes written.
+	WriteEntry(entry *Entry, writer io.Writer) (int, error)
+
+	// Reads a file entry. Returns the number of bytes read.
+	ReadEntry(entry *Entry, reader io.Reader) (int, error)
+
+	// Writes the "locked" field of the file's header without changing file
+	// pointer position.
+	WriteLocked(locked bool, file io.WriteSeeker) error
+
+	// Checks whether the file has the locked field set true without changing
+	// the file pointer.
+	IsLocked(file io.ReadSeeker) (bool, error)
+}
+
+// Implements item index file functions.
+type protocol struct{}
+
+// Compile-time type check
+var _ = (Protocol)((*protocol)(nil))
+
+// Returns a new Protocol instance.
+func NewProtocol() Protocol {
+	return &protocol{}
+}
+
+// Writes the file prefix, aka "Magic number", which verifies type of the file.
+func (p *protocol) WritePrefix(writer io.Writer) (int, error) {
+	return writer.Write(prefix[:])
+}
+
+// Reads the file prefix, aka "Magic number", which verifies type of the file.
+func (p *protocol) ReadPrefix(reader io.Reader) (int, error) {
+	buffer := make([]byte, len(prefix))
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	if !reflect.DeepEqual(buffer, prefix[:]) {
+		return n, errors.New("not an item index file")
+	}
+	return n, nil
+}
+
+// Writes file header (without the prefix).
+func (p *protocol) WriteHeader(header *Header, writer io.Writer) (int, error) {
+	buffer := make([]byte, 0, headerSize)
+	buffer = append(buffer, header.Version, header.Locked)
+	buffer = binary.BigEndian.AppendUint32(buffer, header.NumItems)
+	return writer.Write(buffer)
+}
+
+// Reads file header (without the prefix).
+func (p *protocol) ReadHeader(header *Header, reader io.Reader) (int, error) {
+	buffer := make([]byte, headerSize)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	header.Version = buffer[0]
+	header.Locked = buffer[1]
+	header.NumItems = binary.BigEndian.Uint32(buffer[2:])
+	if header.Version != Version {
+		return n, fmt.Errorf("unsupported item index version %d", header.Version)
+	}
+	return n, nil
+}
+
+// Writes a file entry. Returns number of bytes written.
+func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) (int, error) {
+	buffer := make([]byte, 0, entryHeaderSize+8*len(entry.Offsets))
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.ItemID)
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(entry.Offsets)))
+	for _, offset := range entry.Offsets {
+		buffer = binary.BigEndian.AppendUint64(buffer, offset)
+	}
+	return writer.Write(buffer)
+}
+
+// Reads a file entry. Returns the number of bytes read.
+func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
+	buffer := make([]byte, entryHeaderSize)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	entry.ItemID = binary.BigEndian.Uint64(buffer)
+	numOffsets := int(binary.BigEndian.Uint32(buffer[8:]))
+	// The offsets are read by chunks not to allocate much for broken counts
+	entry.Offsets = make([]uint64, 0)
+	var chunk [8 * 512]byte
+	for numOffsets > 0 {
+		size := numOffsets
+		if size > len(chunk)/8 {
+			size = len(chunk) / 8
+		}
+		read, err := io.ReadFull(reader, chunk[:8*size])
+		n += read
+		if err != nil {
+			return n, err
+		}
+		for i := 0; i < size; i++ {
+			entry.Offsets = append(entry.Offsets, binary.BigEndian.Uint64(chunk[8*i:]))
+		}
+		numOffsets -= size
+	}
+	return n, nil
+}
+
+// Writes the "locked" field of the file's header without changing file
+// pointer position.
+func (p *protocol) WriteLocked(locked bool, file io.WriteSeeker) error {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(int64(lockedOffset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	bytes := []byte{0}
+	if locked {
+		bytes[0] = 1
+	}
+	_, err = file.Write(bytes)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(pos, io.SeekStart)
+	return err
+}
+
+// Checks whether the file has the locked field set true without changing
+// the file pointer.
+func (p *protocol) IsLocked(file io.ReadSeeker) (bool, error) {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(int64(lockedOffset), io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+	bytes := []byte{0}
+	_, err = io.ReadFull(file, bytes)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(pos, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+	return bytes[0] != 0, nil
+}
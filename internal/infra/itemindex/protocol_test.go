@@ -0,0 +1,75 @@
+package itemindex
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	proto := NewProtocol()
+
+	t.Run("should write and read the header", func(t *testing.T) {
+		header := Header{Version, 1, 42}
+		expected := []byte{Version, 1, 0, 0, 0, 42}
+		buf := bytes.NewBuffer(nil)
+		if _, err := proto.WriteHeader(&header, buf); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(buf.Bytes(), expected) {
+			t.Errorf("Header expected %v, got %v", expected, buf.Bytes())
+		}
+		got := Header{}
+		if _, err := proto.ReadHeader(&got, buf); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if got != header {
+			t.Errorf("Header expected %v, got %v", header, got)
+		}
+	})
+
+	t.Run("should refuse unknown versions", func(t *testing.T) {
+		header := Header{}
+		reader := bytes.NewReader([]byte{Version + 1, 0, 0, 0, 0, 0})
+		if _, err := proto.ReadHeader(&header, reader); err == nil {
+			t.Error("Read unknown version without an error")
+		}
+	})
+}
+
+func TestEntry(t *testing.T) {
+	proto := NewProtocol()
+
+	t.Run("should write and read the entry", func(t *testing.T) {
+		entry := Entry{7, []uint64{10, 300}}
+		expected := []byte{
+			0, 0, 0, 0, 0, 0, 0, 7, // item
+			0, 0, 0, 2, // offset count
+			0, 0, 0, 0, 0, 0, 0, 10, // offset #1
+			0, 0, 0, 0, 0, 0, 1, 44, // offset #2
+		}
+		buf := bytes.NewBuffer(nil)
+		n, err := proto.WriteEntry(&entry, buf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if n != len(expected) || !reflect.DeepEqual(buf.Bytes(), expected) {
+			t.Errorf("Entry expected %v, got %v", expected, buf.Bytes())
+		}
+		got := Entry{}
+		n, err = proto.ReadEntry(&got, buf)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if n != len(expected) || !reflect.DeepEqual(got, entry) {
+			t.Errorf("Entry expected %v, got %v", entry, got)
+		}
+	})
+
+	t.Run("should fail reading truncated offsets", func(t *testing.T) {
+		data := []byte{0, 0, 0, 0, 0, 0, 0, 7, 255, 255, 255, 255, 0, 0, 0}
+		if _, err := proto.ReadEntry(&Entry{}, bytes.NewReader(data)); err == nil {
+			t.Error("Read truncated entry without an error")
+		}
+	})
+}
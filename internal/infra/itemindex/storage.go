@@ -0,0 +1,147 @@
+package itemindex
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"recengine/internal/domain"
+	"sort"
+)
+
+// Implements the inverted item index storage. The posting lists are kept in
+// memory and written to the file upon closing.
+type storage struct {
+	file     io.ReadWriteSeeker
+	closer   io.Closer
+	postings map[uint64][]uint64
+	proto    Protocol
+}
+
+// Compile-time type check
+var _ = (domain.ItemIndexStorage)((*storage)(nil))
+
+// Initializes an empty item index file.
+func (s *storage) create() error {
+	writer := bufio.NewWriter(s.file)
+	_, err := s.proto.WritePrefix(writer)
+	if err != nil {
+		return fmt.Errorf("failed to write item index prefix: %v", err)
+	}
+	header := Header{Version, 1, 0}
+	_, err = s.proto.WriteHeader(&header, writer)
+	if err != nil {
+		return fmt.Errorf("failed to write item index header: %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush writer: %v", err)
+	}
+	return nil
+}
+
+// Loads the item index file into memory and locks it.
+func (s *storage) load() error {
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(s.file)
+	_, err = s.proto.ReadPrefix(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read item index prefix: %v", err)
+	}
+	header := Header{}
+	_, err = s.proto.ReadHeader(&header, reader)
+	if err != nil {
+		return fmt.Errorf("failed to read item index header: %v", err)
+	}
+	if header.Locked != 0 {
+		return domain.NewCorruptedFileError()
+	}
+	for i := uint32(0); i < header.NumItems; i++ {
+		entry := Entry{}
+		_, err = s.proto.ReadEntry(&entry, reader)
+		if err != nil {
+			return fmt.Errorf("failed to read item index entry: %v", err)
+		}
+		s.postings[entry.ItemID] = entry.Offsets
+	}
+	err = s.proto.WriteLocked(true, s.file)
+	if err != nil {
+		return fmt.Errorf("failed to write file lock: %v", err)
+	}
+	return nil
+}
+
+// Writes the posting lists to the file and unlocks it.
+func (s *storage) save() error {
+	_, err := s.file.Seek(int64(entriesOffset), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	// Write the entries in a stable order
+	items := make([]uint64, 0, len(s.postings))
+	for item := range s.postings {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i] < items[j] })
+	writer := bufio.NewWriter(s.file)
+	for _, item := range items {
+		_, err = s.proto.WriteEntry(&Entry{item, s.postings[item]}, writer)
+		if err != nil {
+			return fmt.Errorf("failed to write entry: %v", err)
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush buffer: %v", err)
+	}
+	// The header goes last, so the file stays locked until it's consistent
+	_, err = s.file.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	_, err = s.proto.WriteHeader(&Header{Version, 0, uint32(len(s.postings))}, s.file)
+	if err != nil {
+		return fmt.Errorf("failed to write item index header: %v", err)
+	}
+	return nil
+}
+
+// Closes the storage file.
+func (s *storage) Close() error {
+	err := s.save()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Returns the sorted offsets of the entries having any of the items.
+func (s *storage) GetOffsets(items []uint64) []uint64 {
+	offsets := make([]uint64, 0)
+	for _, item := range items {
+		offsets = append(offsets, s.postings[item]...)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	unique := offsets[:0]
+	for i, offset := range offsets {
+		if i == 0 || offset != offsets[i-1] {
+			unique = append(unique, offset)
+		}
+	}
+	return unique
+}
+
+// Returns the number of the items having at least one entry.
+func (s *storage) GetNumItems() int {
+	return len(s.postings)
+}
+
+// Replaces the whole content of the storage by the posting lists.
+func (s *storage) Reset(postings map[uint64][]uint64) error {
+	s.postings = postings
+	return nil
+}
@@ -0,0 +1,67 @@
+package itemindex
+
+import (
+	"errors"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"reflect"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	factory := NewStorageFactory()
+	postings := map[uint64][]uint64{
+		1: {20, 40},
+		2: {20, 60},
+		3: {80},
+	}
+
+	t.Run("should merge the posting lists of the items", func(t *testing.T) {
+		storage, err := factory.Open(helpers.NewFileBuffer(nil), nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		storage.Reset(postings)
+		expected := []uint64{20, 40, 60}
+		if got := storage.GetOffsets([]uint64{2, 1, 4}); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected offsets %v, got %v", expected, got)
+		}
+		if got := storage.GetNumItems(); got != 3 {
+			t.Errorf("Expected 3 items, got %d", got)
+		}
+	})
+
+	t.Run("should persist the posting lists", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		storage.Reset(postings)
+		if err = storage.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		storage, err = factory.Open(helpers.NewFileBuffer(file.Bytes()), nil)
+		if err != nil {
+			t.Fatalf("Failed to reopen: %v", err)
+		}
+		defer storage.Close()
+		for item, offsets := range postings {
+			if got := storage.GetOffsets([]uint64{item}); !reflect.DeepEqual(got, offsets) {
+				t.Errorf("Expected offsets %v of item %d, got %v", offsets, item, got)
+			}
+		}
+	})
+
+	t.Run("should refuse to open a file that hasn't been closed", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		if _, err := factory.Open(file, nil); err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		_, err := factory.Open(helpers.NewFileBuffer(file.Bytes()), nil)
+		if !errors.Is(err, domain.NewCorruptedFileError()) {
+			t.Errorf("Expected CorruptedFileError, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package itemindex
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+)
+
+// Item index storage factory.
+type storageFactory struct {
+	proto Protocol
+}
+
+// Compile-time type check
+var _ = (domain.ItemIndexStorageFactory)((*storageFactory)(nil))
+
+// Instantiates an item index storage factory.
+func NewStorageFactory() domain.ItemIndexStorageFactory {
+	return NewStorageFactoryForProtocol(NewProtocol())
+}
+
+// Instantiates an item index storage factory.
+func NewStorageFactoryForProtocol(proto Protocol) domain.ItemIndexStorageFactory {
+	return &storageFactory{
+		proto: proto,
+	}
+}
+
+// Opens an item index file by the specified path. If the file doesn't exist
+// yet it will be created.
+func (f *storageFactory) OpenFile(filePath string) (domain.ItemIndexStorage, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open(file, file)
+}
+
+// Opens an item index file. If the file is empty, writes all necessary data.
+// The closer is called upon closing the storage or on failure (optional).
+func (f *storageFactory) Open(
+	file io.ReadWriteSeeker,
+	closer io.Closer,
+) (domain.ItemIndexStorage, error) {
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, fmt.Errorf("failed to lock item index file: %w", err)
+		}
+	}
+	storage := &storage{
+		file:     file,
+		closer:   closer,
+		postings: make(map[uint64][]uint64),
+		proto:    f.proto,
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err == nil {
+		if size > 0 {
+			err = storage.load()
+		} else {
+			err = storage.create()
+		}
+	}
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("failed to open item index: %w", err)
+	}
+	return storage, nil
+}
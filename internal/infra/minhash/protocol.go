@@ -0,0 +1,166 @@
+package minhash
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"recengine/internal/domain"
+	"reflect"
+)
+
+// Signature file format Version.
+const Version = 1
+
+// Header size in bytes (the prefix is not part of the header).
+const headerSize = 1 + 1 + 4
+
+// Entry size in bytes.
+const entrySize = 8 + 4*domain.MinHashSize
+
+// The file prefix (aka "Magic number").
+var prefix = [...]byte{'R', 'E', 'C', 'S', 'I', 'G'}
+
+// The offset of the first entry byte from the beginning of the file.
+const entriesOffset = len(prefix) + headerSize
+
+// The offset of the lock byte of the header from the beginning of the file.
+const lockedOffset = len(prefix) + 1
+
+// Signature file Header.
+type Header struct {
+	Version  uint8
+	Locked   uint8
+	NumUsers uint32
+}
+
+// Signature file record.
+type Entry struct {
+	UserID    uint64
+	Signature domain.MinHashSignature
+}
+
+// Provides signature file functions.
+type Protocol interface {
+	// Writes the file prefix, aka "Magic number", which verifies type of the file.
+	WritePrefix(writer io.Writer) (int, error)
+
+	// Reads the file prefix, aka "Magic number", which verifies type of the file.
+	ReadPrefix(reader io.Reader) (int, error)
+
+	// Writes file header (without the prefix).
+	WriteHeader(header *Header, writer io.Writer) (int, error)
+
+	// Reads file header (without the prefix).
+	ReadHeader(header *Header, reader io.Reader) (int, error)
+
+	// Writes a file entry. Returns number of bytes written.
+	WriteEntry(entry *Entry, writer io.Writer) (int, error)
+
+	// Reads a file entry. Returns the number of bytes read.
+	ReadEntry(entry *Entry, reader io.Reader) (int, error)
+
+	// Writes the "locked" field of the file's header without changing file
+	// pointer position.
+	WriteLocked(locked bool, file io.WriteSeeker) error
+}
+
+// Implements signature file functions.
+type protocol struct{}
+
+// Compile-time type check
+var _ = (Protocol)((*protocol)(nil))
+
+// Returns a new Protocol instance.
+func NewProtocol() Protocol {
+	return &protocol{}
+}
+
+// Writes the file prefix, aka "Magic number", which verifies type of the file.
+func (p *protocol) WritePrefix(writer io.Writer) (int, error) {
+	return writer.Write(prefix[:])
+}
+
+// Reads the file prefix, aka "Magic number", which verifies type of the file.
+func (p *protocol) ReadPrefix(reader io.Reader) (int, error) {
+	buffer := make([]byte, len(prefix))
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	if !reflect.DeepEqual(buffer, prefix[:]) {
+		return n, errors.New("not a signature file")
+	}
+	return n, nil
+}
+
+// Writes file header (without the prefix).
+func (p *protocol) WriteHeader(header *Header, writer io.Writer) (int, error) {
+	buffer := make([]byte, 0, headerSize)
+	buffer = append(buffer, header.Version, header.Locked)
+	buffer = binary.BigEndian.AppendUint32(buffer, header.NumUsers)
+	return writer.Write(buffer)
+}
+
+// Reads file header (without the prefix).
+func (p *protocol) ReadHeader(header *Header, reader io.Reader) (int, error) {
+	buffer := make([]byte, headerSize)
+	n, err := io.ReadFull(reader, buffer)
+	if err != nil {
+		return n, err
+	}
+	header.Version = buffer[0]
+	header.Locked = buffer[1]
+	header.NumUsers = binary.BigEndian.Uint32(buffer[2:])
+	if header.Version != Version {
+		return n, fmt.Errorf("unsupported signature file version %d", header.Version)
+	}
+	return n, nil
+}
+
+// Writes a file entry. Returns number of bytes written.
+func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) (int, error) {
+	buffer := make([]byte, 0, entrySize)
+	buffer = binary.BigEndian.AppendUint64(buffer, entry.UserID)
+	for _, value := range entry.Signature {
+		buffer = binary.BigEndian.AppendUint32(buffer, value)
+	}
+	return writer.Write(buffer)
+}
+
+// Reads a file entry. Returns the number of bytes read.
+func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
+	var buffer [entrySize]byte
+	n, err := io.ReadFull(reader, buffer[:])
+	if err != nil {
+		return n, err
+	}
+	entry.UserID = binary.BigEndian.Uint64(buffer[:])
+	for i := range entry.Signature {
+		entry.Signature[i] = binary.BigEndian.Uint32(buffer[8+4*i:])
+	}
+	return n, nil
+}
+
+// Writes the "locked" field of the file's header without changing file
+// pointer position.
+func (p *protocol) WriteLocked(locked bool, file io.WriteSeeker) error {
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(int64(lockedOffset), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	bytes := []byte{0}
+	if locked {
+		bytes[0] = 1
+	}
+	_, err = file.Write(bytes)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(pos, io.SeekStart)
+	return err
+}
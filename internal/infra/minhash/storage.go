@@ -0,0 +1,179 @@
+package minhash
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"recengine/internal/domain"
+	"sort"
+)
+
+// Implements the signature storage. The signatures and the LSH buckets are
+// kept in memory, and the signatures are written to the file upon closing.
+type storage struct {
+	file       io.ReadWriteSeeker
+	closer     io.Closer
+	signatures map[uint64]*domain.MinHashSignature
+	// The users by the hashes of the LSH bands of their signatures.
+	buckets map[uint64][]uint64
+	proto   Protocol
+}
+
+// Compile-time type check
+var _ = (domain.SignatureStorage)((*storage)(nil))
+
+// Initializes an empty signature file.
+func (s *storage) create() error {
+	writer := bufio.NewWriter(s.file)
+	_, err := s.proto.WritePrefix(writer)
+	if err != nil {
+		return fmt.Errorf("failed to write signature file prefix: %v", err)
+	}
+	header := Header{Version, 1, 0}
+	_, err = s.proto.WriteHeader(&header, writer)
+	if err != nil {
+		return fmt.Errorf("failed to write signature file header: %v", err)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush writer: %v", err)
+	}
+	return nil
+}
+
+// Loads the signature file into memory and locks it.
+func (s *storage) load() error {
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(s.file)
+	_, err = s.proto.ReadPrefix(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read signature file prefix: %v", err)
+	}
+	header := Header{}
+	_, err = s.proto.ReadHeader(&header, reader)
+	if err != nil {
+		return fmt.Errorf("failed to read signature file header: %v", err)
+	}
+	if header.Locked != 0 {
+		return domain.NewCorruptedFileError()
+	}
+	for i := uint32(0); i < header.NumUsers; i++ {
+		entry := Entry{}
+		_, err = s.proto.ReadEntry(&entry, reader)
+		if err != nil {
+			return fmt.Errorf("failed to read signature file entry: %v", err)
+		}
+		s.Put(entry.UserID, &entry.Signature)
+	}
+	err = s.proto.WriteLocked(true, s.file)
+	if err != nil {
+		return fmt.Errorf("failed to write file lock: %v", err)
+	}
+	return nil
+}
+
+// Writes the signatures to the file and unlocks it.
+func (s *storage) save() error {
+	_, err := s.file.Seek(int64(entriesOffset), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	// Write the entries in a stable order
+	users := make([]uint64, 0, len(s.signatures))
+	for user := range s.signatures {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+	writer := bufio.NewWriter(s.file)
+	for _, user := range users {
+		_, err = s.proto.WriteEntry(&Entry{user, *s.signatures[user]}, writer)
+		if err != nil {
+			return fmt.Errorf("failed to write entry: %v", err)
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush buffer: %v", err)
+	}
+	// The header goes last, so the file stays locked until it's consistent
+	_, err = s.file.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek: %v", err)
+	}
+	_, err = s.proto.WriteHeader(&Header{Version, 0, uint32(len(s.signatures))}, s.file)
+	if err != nil {
+		return fmt.Errorf("failed to write signature file header: %v", err)
+	}
+	return nil
+}
+
+// Closes the storage file.
+func (s *storage) Close() error {
+	err := s.save()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Returns the users whose signatures have at least one LSH band in common
+// with the signature.
+func (s *storage) GetCandidates(signature *domain.MinHashSignature) []uint64 {
+	seen := make(map[uint64]bool)
+	users := make([]uint64, 0)
+	for _, h := range signature.GetBandHashes() {
+		for _, user := range s.buckets[h] {
+			if !seen[user] {
+				seen[user] = true
+				users = append(users, user)
+			}
+		}
+	}
+	return users
+}
+
+// Sets the signature of the user's profile.
+func (s *storage) Put(user uint64, signature *domain.MinHashSignature) error {
+	s.Remove(user)
+	signatureCopy := *signature
+	s.signatures[user] = &signatureCopy
+	for _, h := range signature.GetBandHashes() {
+		s.buckets[h] = append(s.buckets[h], user)
+	}
+	return nil
+}
+
+// Removes the signature of the user's profile.
+func (s *storage) Remove(user uint64) error {
+	signature, ok := s.signatures[user]
+	if !ok {
+		return nil
+	}
+	delete(s.signatures, user)
+	for _, h := range signature.GetBandHashes() {
+		bucket := s.buckets[h]
+		for i := range bucket {
+			if bucket[i] == user {
+				bucket[i] = bucket[len(bucket)-1]
+				bucket = bucket[:len(bucket)-1]
+				break
+			}
+		}
+		if len(bucket) == 0 {
+			delete(s.buckets, h)
+		} else {
+			s.buckets[h] = bucket
+		}
+	}
+	return nil
+}
+
+// Returns the number of the users having a signature.
+func (s *storage) GetNumUsers() int {
+	return len(s.signatures)
+}
@@ -0,0 +1,85 @@
+package minhash
+
+import (
+	"errors"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	factory := NewStorageFactory()
+	signatures := map[uint64]domain.MinHashSignature{
+		1: domain.ComputeMinHashSignature([]uint64{1, 2, 3, 4}),
+		2: domain.ComputeMinHashSignature([]uint64{1, 2, 3, 4}),
+		3: domain.ComputeMinHashSignature([]uint64{100, 200, 300, 400}),
+	}
+	// Returns the sorted candidates for the signature of the user.
+	getCandidates := func(storage domain.SignatureStorage, user uint64) []uint64 {
+		signature := signatures[user]
+		users := storage.GetCandidates(&signature)
+		sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+		return users
+	}
+
+	t.Run("should find the users having similar signatures", func(t *testing.T) {
+		storage, err := factory.Open(helpers.NewFileBuffer(nil), nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		defer storage.Close()
+		for user, signature := range signatures {
+			signature := signature
+			storage.Put(user, &signature)
+		}
+		if got := getCandidates(storage, 1); !reflect.DeepEqual(got, []uint64{1, 2}) {
+			t.Errorf("Expected candidates [1 2], got %v", got)
+		}
+		storage.Remove(2)
+		if got := getCandidates(storage, 1); !reflect.DeepEqual(got, []uint64{1}) {
+			t.Errorf("Expected candidates [1], got %v", got)
+		}
+		if got := storage.GetNumUsers(); got != 2 {
+			t.Errorf("Expected 2 users, got %d", got)
+		}
+	})
+
+	t.Run("should persist the signatures", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		storage, err := factory.Open(file, nil)
+		if err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		for user, signature := range signatures {
+			signature := signature
+			storage.Put(user, &signature)
+		}
+		if err = storage.Close(); err != nil {
+			t.Fatalf("Failed to close: %v", err)
+		}
+		storage, err = factory.Open(helpers.NewFileBuffer(file.Bytes()), nil)
+		if err != nil {
+			t.Fatalf("Failed to reopen: %v", err)
+		}
+		defer storage.Close()
+		if got := getCandidates(storage, 2); !reflect.DeepEqual(got, []uint64{1, 2}) {
+			t.Errorf("Expected candidates [1 2], got %v", got)
+		}
+		if got := getCandidates(storage, 3); !reflect.DeepEqual(got, []uint64{3}) {
+			t.Errorf("Expected candidates [3], got %v", got)
+		}
+	})
+
+	t.Run("should refuse to open a file that hasn't been closed", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		if _, err := factory.Open(file, nil); err != nil {
+			t.Fatalf("Failed to open: %v", err)
+		}
+		_, err := factory.Open(helpers.NewFileBuffer(file.Bytes()), nil)
+		if !errors.Is(err, domain.NewCorruptedFileError()) {
+			t.Errorf("Expected CorruptedFileError, got %v", err)
+		}
+	})
+}
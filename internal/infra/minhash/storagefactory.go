@@ -0,0 +1,77 @@
+package minhash
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+)
+
+// Signature storage factory.
+type storageFactory struct {
+	proto Protocol
+}
+
+// Compile-time type check
+var _ = (domain.SignatureStorageFactory)((*storageFactory)(nil))
+
+// Instantiates a signature storage factory.
+func NewStorageFactory() domain.SignatureStorageFactory {
+	return NewStorageFactoryForProtocol(NewProtocol())
+}
+
+// Instantiates a signature storage factory.
+func NewStorageFactoryForProtocol(proto Protocol) domain.SignatureStorageFactory {
+	return &storageFactory{
+		proto: proto,
+	}
+}
+
+// Opens a signature file by the specified path. If the file doesn't exist
+// yet it will be created.
+func (f *storageFactory) OpenFile(filePath string) (domain.SignatureStorage, error) {
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return f.Open(file, file)
+}
+
+// Opens a signature file. If the file is empty, writes all necessary data.
+// The closer is called upon closing the storage or on failure (optional).
+func (f *storageFactory) Open(
+	file io.ReadWriteSeeker,
+	closer io.Closer,
+) (domain.SignatureStorage, error) {
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			if closer != nil {
+				closer.Close()
+			}
+			return nil, fmt.Errorf("failed to lock signature file: %w", err)
+		}
+	}
+	storage := &storage{
+		file:       file,
+		closer:     closer,
+		signatures: make(map[uint64]*domain.MinHashSignature),
+		buckets:    make(map[uint64][]uint64),
+		proto:      f.proto,
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err == nil {
+		if size > 0 {
+			err = storage.load()
+		} else {
+			err = storage.create()
+		}
+	}
+	if err != nil {
+		if closer != nil {
+			closer.Close()
+		}
+		return nil, fmt.Errorf("failed to open signature storage: %w", err)
+	}
+	return storage, nil
+}
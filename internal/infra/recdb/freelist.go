@@ -0,0 +1,82 @@
+package recdb
+
+import "math/bits"
+
+// The space of a deleted entry, which may be reused by another entry.
+type freeSlot struct {
+	offset   int64
+	capacity uint32
+}
+
+// Keeps the slots of the deleted entries grouped by capacity class, which
+// is the number of the significant bits of the capacity. Since the capacity
+// of an entry is stored in the entry, a slot is reused as a whole.
+type freeList struct {
+	classes [][]freeSlot
+	// The total capacity of the slots.
+	freeBytes int64
+}
+
+// Creates an empty free list.
+func newFreeList() *freeList {
+	return &freeList{classes: make([][]freeSlot, 33)}
+}
+
+// Returns the capacity class of the slots having the capacity.
+func getCapacityClass(capacity uint32) int {
+	return bits.Len32(capacity)
+}
+
+// Adds the slot of a deleted entry.
+func (l *freeList) Put(offset int64, capacity uint32) {
+	class := getCapacityClass(capacity)
+	l.classes[class] = append(l.classes[class], freeSlot{offset, capacity})
+	l.freeBytes += int64(capacity)
+}
+
+// Removes and returns a slot located at the minimal offset or further that
+// can hold an entry of the size. The slots of the size's class are checked
+// first, then a slot of the smallest greater class is taken. Returns false
+// if there is no such slot.
+func (l *freeList) Take(size int, minOffset int64) (freeSlot, bool) {
+	class := getCapacityClass(uint32(size))
+	slots := l.classes[class]
+	for i := range slots {
+		if int(slots[i].capacity) >= size && slots[i].offset >= minOffset {
+			return l.remove(class, i), true
+		}
+	}
+	for class++; class < len(l.classes); class++ {
+		slots := l.classes[class]
+		for i := len(slots) - 1; i >= 0; i-- {
+			if slots[i].offset >= minOffset {
+				return l.remove(class, i), true
+			}
+		}
+	}
+	return freeSlot{}, false
+}
+
+// Removes the slot by its index in the class.
+func (l *freeList) remove(class int, i int) freeSlot {
+	slots := l.classes[class]
+	slot := slots[i]
+	slots[i] = slots[len(slots)-1]
+	l.classes[class] = slots[:len(slots)-1]
+	l.freeBytes -= int64(slot.capacity)
+	return slot
+}
+
+// Returns the total capacity of the slots.
+func (l *freeList) GetFreeBytes() int64 {
+	return l.freeBytes
+}
+
+// Returns the number of the slots.
+func (l *freeList) Len() int {
+	n := 0
+	for _, slots := range l.classes {
+		n += len(slots)
+	}
+	return n
+}
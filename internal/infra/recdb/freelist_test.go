@@ -0,0 +1,49 @@
+package recdb
+
+import "testing"
+
+func TestFreeList(t *testing.T) {
+	t.Run("should take a slot large enough", func(t *testing.T) {
+		list := newFreeList()
+		list.Put(100, 20)
+		list.Put(200, 30)
+		list.Put(300, 70)
+		slot, ok := list.Take(25, 0)
+		if !ok || slot != (freeSlot{200, 30}) {
+			t.Errorf("Expected slot at 200, got %v, %v", slot, ok)
+		}
+		slot, ok = list.Take(25, 0)
+		if !ok || slot != (freeSlot{300, 70}) {
+			t.Errorf("Expected slot at 300, got %v, %v", slot, ok)
+		}
+		if list.Len() != 1 || list.GetFreeBytes() != 20 {
+			t.Errorf("Expected 1 slot of 20 bytes, got %d of %d", list.Len(), list.GetFreeBytes())
+		}
+	})
+
+	t.Run("should fail if there is no slot large enough", func(t *testing.T) {
+		list := newFreeList()
+		list.Put(100, 20)
+		if slot, ok := list.Take(21, 0); ok {
+			t.Errorf("Expected no slot, got %v", slot)
+		}
+	})
+
+	t.Run("should take a slot located at the minimal offset or further", func(t *testing.T) {
+		list := newFreeList()
+		list.Put(100, 30)
+		list.Put(200, 70)
+		list.Put(300, 30)
+		slot, ok := list.Take(25, 150)
+		if !ok || slot != (freeSlot{300, 30}) {
+			t.Errorf("Expected slot at 300, got %v, %v", slot, ok)
+		}
+		slot, ok = list.Take(25, 150)
+		if !ok || slot != (freeSlot{200, 70}) {
+			t.Errorf("Expected slot at 200, got %v, %v", slot, ok)
+		}
+		if slot, ok := list.Take(25, 150); ok {
+			t.Errorf("Expected no slot, got %v", slot)
+		}
+	})
+}
@@ -23,6 +23,14 @@ type Iterator interface {
 
 	// Rewrites a previously read entry. The capacity must be left unchanged.
 	SetPrevious(entry *Entry) error
+
+	// Returns the offset of the previously read entry from the beginning of
+	// the file.
+	GetPreviousOffset() int64
+
+	// Returns the offset from the beginning of the file of the entry that
+	// will be read next (or the offset of the end of the entries).
+	GetNextOffset() int64
 }
 
 // The database entry iterator.
@@ -57,9 +65,19 @@ func NewIterator(file io.ReadWriteSeeker, proto Protocol) (Iterator, error) {
 	if header.Locked != 0 {
 		return nil, domain.NewCorruptedFileError()
 	}
+	proto, err = proto.ForVersion(header.Version)
+	if err != nil {
+		return nil, err
+	}
+	return newIterator(file, proto, &header), nil
+}
+
+// Creates a new database entry iterator for a file whose header has already
+// been read. The header isn't copied, so the changes of the entry count are
+// visible to the iterator. The file pointer must point to the first entry.
+func newIterator(file io.ReadWriteSeeker, proto Protocol, header *Header) *iterator {
 	reader := bufio.NewReader(file)
-	iter := &iterator{&header, file, reader, 0, 0, Entry{}, proto}
-	return iter, nil
+	return &iterator{header, file, reader, 0, int64(entriesOffset), Entry{}, proto}
 }
 
 // Sets the iterator pointer to the beginging of the entries.
@@ -82,12 +100,18 @@ func (iter *iterator) HasNext() bool {
 // Returns the current entry and iterates next.
 // The returned entry pointer shouldn't be changed or taken over: it points to
 // the same struct in memory in every iteration.
+// A corrupted entry is skipped returning domain.CorruptedEntryError.
 func (iter *iterator) Next() (*Entry, error) {
 	if !iter.HasNext() {
 		return nil, errors.New("failed to iterate next: the last entry reached")
 	}
 	size, err := iter.proto.ReadEntry(&iter.entry, iter.reader)
 	iter.fileOffset += int64(size)
+	if errors.Is(err, &domain.CorruptedEntryError{}) {
+		// The entry has been read entirely, so the next one can be read
+		iter.entryIndex++
+		return nil, fmt.Errorf("failed to iterate next: %w", err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to iterate next: %v", err)
 	}
@@ -105,7 +129,7 @@ func (iter *iterator) SetPrevious(entry *Entry) error {
 	if iter.entry.Capacity != entry.Capacity {
 		return errors.New("entry capacity mismatch")
 	}
-	_, err := iter.file.Seek(-int64(entry.Capacity), io.SeekCurrent)
+	_, err := iter.file.Seek(iter.GetPreviousOffset(), io.SeekStart)
 	if err != nil {
 		return fmt.Errorf(msg, err)
 	}
@@ -119,3 +143,15 @@ func (iter *iterator) SetPrevious(entry *Entry) error {
 	iter.reader.Reset(iter.file)
 	return nil
 }
+
+// Returns the offset of the previously read entry from the beginning of
+// the file.
+func (iter *iterator) GetPreviousOffset() int64 {
+	return iter.fileOffset - int64(iter.entry.Capacity)
+}
+
+// Returns the offset from the beginning of the file of the entry that
+// will be read next (or the offset of the end of the entries).
+func (iter *iterator) GetNextOffset() int64 {
+	return iter.fileOffset
+}
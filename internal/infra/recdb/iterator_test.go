@@ -325,3 +325,40 @@ func TestIteratorSetPrevious(t *testing.T) {
 		}
 	})
 }
+
+func TestIteratorOffsets(t *testing.T) {
+	data := append(mockLikeRecDbHeaderBytes(false, 2), mockLikeRecDbEntryBytes(false)...)
+	data = append(data, mockLikeRecDbEntryBytes(false)...)
+	buffer := helpers.NewFileBuffer(data)
+	iter, err := NewIterator(buffer, NewProtocol(NewLikeProtocol()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	entrySize := int64(len(mockLikeRecDbEntryBytes(false)))
+	for i := int64(0); i < 2; i++ {
+		if offset := iter.GetNextOffset(); offset != int64(entriesOffset)+i*entrySize {
+			t.Errorf("Expected next offset %d, got %d", int64(entriesOffset)+i*entrySize, offset)
+		}
+		_, err = iter.Next()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if offset := iter.GetPreviousOffset(); offset != int64(entriesOffset)+i*entrySize {
+			t.Errorf("Expected previous offset %d, got %d", int64(entriesOffset)+i*entrySize, offset)
+		}
+	}
+	// Only the last read entry must be rewritten
+	entry := mockLikeRecDbEntry(true)
+	err = iter.SetPrevious(entry)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := append(mockLikeRecDbHeaderBytes(false, 2), mockLikeRecDbEntryBytes(false)...)
+	expected = append(expected, mockLikeRecDbEntryBytes(true)...)
+	if !reflect.DeepEqual(buffer.Bytes(), expected) {
+		t.Errorf("Expected data \n%v, got \n%v", expected, buffer.Bytes())
+	}
+}
@@ -23,57 +23,132 @@ func NewLikeProtocol() ConcreteProtocol {
 // Reads entry data filling the `Entry.Data` struct.
 // Returns the number of the bytes having read.
 // The returned size can vary from 0 to `Entry.Capacity`.
-func (p *likeProtocol) ReadEntryData(entry *Entry, reader io.Reader) (int, error) {
+func (p *likeProtocol) ReadEntryData(entry *Entry, version byte, reader io.Reader) (int, error) {
+	var profile *domain.Profile
+	var err error
+	if version == 1 {
+		profile, err = p.readProfileV1(reader)
+	} else {
+		profile, err = p.readProfileV2(reader, int(entry.Capacity)-getEntryHeaderSize(version))
+	}
+	if err != nil {
+		return 0, err
+	}
+	entry.Data = profile
+	// Check data integrity
+	size, err := p.PredictDataSize(entry.Data, version)
+	if err != nil {
+		return 0, fmt.Errorf("cannot predict data size: %w", err)
+	}
+	if size > int(entry.Capacity)-getEntryHeaderSize(version) {
+		return 0, fmt.Errorf("entry's capacity=%d is less than data len=%d",
+			entry.Capacity, size)
+	}
+	return size, nil
+}
+
+// Reads the profile stored with fixed size item IDs.
+func (p *likeProtocol) readProfileV1(reader io.Reader) (*domain.Profile, error) {
 	// Read user ID
 	var userId uint64
 	err := binary.Read(reader, binary.BigEndian, &userId)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	// Read likes
 	var numLikes uint32
 	err = binary.Read(reader, binary.BigEndian, &numLikes)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	likes := make([]uint64, numLikes)
 	err = binary.Read(reader, binary.BigEndian, likes)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	// Read dislikes
 	var numDislikes uint32
 	err = binary.Read(reader, binary.BigEndian, &numDislikes)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	dislikes := make([]uint64, numDislikes)
 	err = binary.Read(reader, binary.BigEndian, dislikes)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	// Update entry.Data
-	entry.Data = &domain.Profile{
+	return &domain.Profile{
 		UserID:   userId,
 		Likes:    likes,
 		Dislikes: dislikes,
+	}, nil
+}
+
+// Reads the profile stored with delta-encoded item IDs. The size limits
+// the number of the bytes the data can span.
+func (p *likeProtocol) readProfileV2(reader io.Reader, size int) (*domain.Profile, error) {
+	byteReader := &countingByteReader{reader: reader}
+	// Read user ID
+	var userId uint64
+	err := binary.Read(byteReader, binary.BigEndian, &userId)
+	if err != nil {
+		return nil, err
 	}
-	// Check data integrity
-	size, err := p.PredictDataSize(entry.Data)
+	// Read likes
+	likes, err := readDeltaUvarints(byteReader, size)
 	if err != nil {
-		return 0, fmt.Errorf("cannot predict data size: %w", err)
+		return nil, err
 	}
-	if size > int(entry.Capacity-entryHeaderSize) {
-		return 0, fmt.Errorf("entry's capacity=%d is less than data len=%d",
-			entry.Capacity, size)
+	// Read dislikes
+	dislikes, err := readDeltaUvarints(byteReader, size)
+	if err != nil {
+		return nil, err
 	}
-	return size, nil
+	return &domain.Profile{
+		UserID:   userId,
+		Likes:    likes,
+		Dislikes: dislikes,
+	}, nil
+}
+
+// Decodes entry data from the buffer, which spans the data up to
+// `Entry.Capacity`. The profile of the entry and its slices are reused.
+// Returns the number of the bytes having decoded.
+func (p *likeProtocol) DecodeEntryData(entry *Entry, version byte, data []byte) (int, error) {
+	profile, ok := entry.Data.(*domain.Profile)
+	if !ok {
+		profile = domain.NewProfile(0)
+		entry.Data = profile
+	}
+	if len(data) < 8 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	profile.UserID = binary.BigEndian.Uint64(data)
+	n := 8
+	var err error
+	if version == 1 {
+		profile.Likes, n, err = decodeFixedList(profile.Likes[:0], data, n)
+		if err != nil {
+			return 0, err
+		}
+		profile.Dislikes, n, err = decodeFixedList(profile.Dislikes[:0], data, n)
+	} else {
+		profile.Likes, n, err = decodeDeltaUvarints(profile.Likes[:0], data, n)
+		if err != nil {
+			return 0, err
+		}
+		profile.Dislikes, n, err = decodeDeltaUvarints(profile.Dislikes[:0], data, n)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
 // Writes entry data from the `Entry.Data` field into the stream.
 // Returns the number of the bytes having read.
 // The data length cannot be greater than `Entry.Capacity`.
-func (p *likeProtocol) WriteEntryData(entry *Entry, writer io.Writer) (int, error) {
+func (p *likeProtocol) WriteEntryData(entry *Entry, version byte, writer io.Writer) (int, error) {
 	// Get profile
 	profile, ok := entry.Data.(*domain.Profile)
 	if !ok {
@@ -82,30 +157,26 @@ func (p *likeProtocol) WriteEntryData(entry *Entry, writer io.Writer) (int, erro
 			reflect.TypeOf(entry.Data).Name(),
 		)
 	}
-	// Write user ID
-	err := binary.Write(writer, binary.BigEndian, profile.UserID)
-	if err != nil {
-		return 0, err
-	}
-	// Write likes
-	err = binary.Write(writer, binary.BigEndian, uint32(len(profile.Likes)))
+	size, err := p.PredictDataSize(profile, version)
 	if err != nil {
 		return 0, err
 	}
-	err = binary.Write(writer, binary.BigEndian, profile.Likes)
-	if err != nil {
-		return 0, err
-	}
-	// Write dislikes
-	err = binary.Write(writer, binary.BigEndian, uint32(len(profile.Dislikes)))
-	if err != nil {
-		return 0, err
-	}
-	err = binary.Write(writer, binary.BigEndian, profile.Dislikes)
-	if err != nil {
-		return 0, err
+	buffer := make([]byte, 0, size)
+	buffer = binary.BigEndian.AppendUint64(buffer, profile.UserID)
+	if version == 1 {
+		buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(profile.Likes)))
+		for _, item := range profile.Likes {
+			buffer = binary.BigEndian.AppendUint64(buffer, item)
+		}
+		buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(profile.Dislikes)))
+		for _, item := range profile.Dislikes {
+			buffer = binary.BigEndian.AppendUint64(buffer, item)
+		}
+	} else {
+		buffer = appendDeltaUvarints(buffer, profile.Likes)
+		buffer = appendDeltaUvarints(buffer, profile.Dislikes)
 	}
-	return p.PredictDataSize(profile)
+	return writer.Write(buffer)
 }
 
 // Returns the type code of the data stored in the `Entry.Data` field of
@@ -115,10 +186,135 @@ func (p *likeProtocol) GetEntryType() [8]byte {
 }
 
 // Returns the minimum number of bytes it the entry will span after serialization.
-func (p *likeProtocol) PredictDataSize(data any) (int, error) {
+func (p *likeProtocol) PredictDataSize(data any, version byte) (int, error) {
 	profile, ok := data.(*domain.Profile)
 	if !ok {
 		return 0, errors.New("unknown data type")
 	}
-	return 8 + 4 + len(profile.Likes)*8 + 4 + len(profile.Dislikes)*8, nil
+	if version == 1 {
+		return 8 + 4 + len(profile.Likes)*8 + 4 + len(profile.Dislikes)*8, nil
+	}
+	return 8 + getDeltaUvarintsSize(profile.Likes) + getDeltaUvarintsSize(profile.Dislikes), nil
+}
+
+// Counts the bytes read from the underlying reader byte by byte, so nothing
+// is read beyond the entry data.
+type countingByteReader struct {
+	reader io.Reader
+	n      int
+	buffer [1]byte
+}
+
+func (r *countingByteReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+func (r *countingByteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(r, r.buffer[:])
+	return r.buffer[0], err
+}
+
+// Appends the length of the sorted list and the differences between its
+// adjacent values (the first value is the difference with zero) as uvarints.
+func appendDeltaUvarints(buffer []byte, list []uint64) []byte {
+	buffer = binary.AppendUvarint(buffer, uint64(len(list)))
+	var previous uint64
+	for _, value := range list {
+		buffer = binary.AppendUvarint(buffer, value-previous)
+		previous = value
+	}
+	return buffer
+}
+
+// Returns the number of bytes the sorted list spans when encoded as uvarint
+// deltas.
+func getDeltaUvarintsSize(list []uint64) int {
+	size := getUvarintSize(uint64(len(list)))
+	var previous uint64
+	for _, value := range list {
+		size += getUvarintSize(value - previous)
+		previous = value
+	}
+	return size
+}
+
+// Returns the number of bytes the value spans when encoded as uvarint.
+func getUvarintSize(value uint64) int {
+	size := 1
+	for value >= 0x80 {
+		value >>= 7
+		size++
+	}
+	return size
+}
+
+// Appends the list of fixed size values preceded by its 4-byte length
+// located at the offset of the buffer to the list. Returns the list and the
+// offset following it.
+func decodeFixedList(list []uint64, data []byte, offset int) ([]uint64, int, error) {
+	if len(data) < offset+4 {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	length := int(binary.BigEndian.Uint32(data[offset:]))
+	offset += 4
+	if (len(data)-offset)/8 < length {
+		return nil, 0, fmt.Errorf("list length %d exceeds the entry data", length)
+	}
+	for i := 0; i < length; i++ {
+		list = append(list, binary.BigEndian.Uint64(data[offset:]))
+		offset += 8
+	}
+	return list, offset, nil
+}
+
+// Appends the sorted list encoded as uvarint deltas located at the offset of
+// the buffer to the list. Returns the list and the offset following it.
+func decodeDeltaUvarints(list []uint64, data []byte, offset int) ([]uint64, int, error) {
+	length, n := binary.Uvarint(data[offset:])
+	if n <= 0 {
+		return nil, 0, errors.New("broken list length")
+	}
+	offset += n
+	// Every value takes at least one byte
+	if length > uint64(len(data)-offset) {
+		return nil, 0, fmt.Errorf("list length %d exceeds the entry data", length)
+	}
+	var previous uint64
+	for i := uint64(0); i < length; i++ {
+		delta, n := binary.Uvarint(data[offset:])
+		if n <= 0 {
+			return nil, 0, errors.New("broken list value")
+		}
+		offset += n
+		previous += delta
+		list = append(list, previous)
+	}
+	return list, offset, nil
+}
+
+// Reads the sorted list encoded as uvarint deltas. The list can't span
+// beyond the size, which protects against allocating memory for the lists
+// whose length is broken.
+func readDeltaUvarints(reader *countingByteReader, size int) ([]uint64, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	// Every value takes at least one byte
+	if remaining := size - reader.n; remaining < 0 || length > uint64(remaining) {
+		return nil, fmt.Errorf("list length %d exceeds the entry data", length)
+	}
+	list := make([]uint64, length)
+	var previous uint64
+	for i := range list {
+		delta, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		previous += delta
+		list[i] = previous
+	}
+	return list, nil
 }
@@ -28,7 +28,7 @@ func TestLikeProtocolReadEntryData(t *testing.T) {
 		entry := &Entry{
 			Capacity: uint32(len(profileData) + entryHeaderSize),
 		}
-		n, err := proto.ReadEntryData(entry, bytes.NewReader(profileData))
+		n, err := proto.ReadEntryData(entry, 1, bytes.NewReader(profileData))
 		if err != nil {
 			t.Error(err)
 			return
@@ -52,7 +52,7 @@ func TestLikeProtocolReadEntryData(t *testing.T) {
 		entry := &Entry{
 			Capacity: uint32(len(profileData)),
 		}
-		_, err := proto.ReadEntryData(entry, bytes.NewReader(profileData))
+		_, err := proto.ReadEntryData(entry, 1, bytes.NewReader(profileData))
 		if err == nil {
 			t.Error("Expected an error")
 			return
@@ -60,6 +60,25 @@ func TestLikeProtocolReadEntryData(t *testing.T) {
 	})
 }
 
+func TestLikeProtocolReadEntryDataV2(t *testing.T) {
+	proto := NewLikeProtocol()
+
+	t.Run("should fail reading a list longer than the capacity", func(t *testing.T) {
+		profileData := []byte{
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			0xff, 0xff, 0xff, 0xff, 0x0f, // like count
+			7,
+		}
+		entry := &Entry{
+			Capacity: uint32(len(profileData) + entryHeaderSize),
+		}
+		_, err := proto.ReadEntryData(entry, 2, bytes.NewReader(profileData))
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
 func TestLikeProtocolWriteEntryData(t *testing.T) {
 	proto := NewLikeProtocol()
 	profileData := []byte{
@@ -83,7 +102,7 @@ func TestLikeProtocolWriteEntryData(t *testing.T) {
 			Deleted:  0,
 			Data:     &profile,
 		}
-		n, err := proto.WriteEntryData(&entry, buffer)
+		n, err := proto.WriteEntryData(&entry, 1, buffer)
 		if err != nil {
 			t.Error(err)
 			return
@@ -3,54 +3,311 @@ package recdb
 import (
 	"fmt"
 	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
 )
 
+// Implements the like profile storage on top of a RECDB file, which is
+// complemented by the data of the delta storage.
 type likeStorage struct {
+	*profileStorage[*domain.Profile]
 }
 
 // Compile-time type check
-var _ = (domain.LikeStorage)((*likeStorage)(nil))
+var _ = (domain.ProfileStorage)((*likeStorage)(nil))
 
-// Returns new like storage instance.
-func NewLikeStorage() domain.LikeStorage {
-	return &likeStorage{}
+// A pending request for similar profiles or recommendations.
+type similarityQuery struct {
+	action      domain.Action
+	profile     *domain.Profile
+	metric      domain.SimilarityMetric
+	params      domain.SimilarityParams
+	approximate bool
+	limit       uint
+	collector   *domain.SimilarProfileCollector
 }
 
-func (s *likeStorage) Close() error {
-	// TODO
-	return nil
+// Returns the similarity metric of the query falling back to the default one.
+func makeSimilarityMetric(metric domain.SimilarityMetric) domain.SimilarityMetric {
+	if metric == nil {
+		metric, _ = domain.NewSimilarityMetric(valueobjects.SimilarityMetric{})
+	}
+	return metric
+}
+
+// Returns new like storage instance working with an existing RECDB file.
+// The file gets locked until the storage is closed.
+func newLikeStorage(
+	file domain.RandomAccessFile,
+	proto Protocol,
+	deltaStorage domain.DeltaStorage,
+	indexStorage domain.IndexStorage,
+	itemIndexStorage domain.ItemIndexStorage,
+	signatureStorage domain.SignatureStorage,
+	numSegments int,
+) (domain.ProfileStorage, error) {
+	s := &likeStorage{&profileStorage[*domain.Profile]{
+		file:             file,
+		proto:            proto,
+		deltaStorage:     deltaStorage,
+		indexStorage:     indexStorage,
+		itemIndexStorage: itemIndexStorage,
+		signatureStorage: signatureStorage,
+		newProfile:       domain.NewProfile,
+		signatureItems:   getLikedItems,
+		numSegments:      numSegments,
+		applyOp:          applyLikeDeltaOp,
+	}}
+	if err := s.open(NewLikeProtocol().GetEntryType()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Returns the items the signature of the like profile is computed of.
+func getLikedItems(profile *domain.Profile) []uint64 {
+	return profile.Likes
 }
 
+// Executes a set of tasks sequently reading and/or modifiying entries in
+// the corresponding database file.
+// The modifications are stored in the delta storage, while the requests are
+// answered after a single pass over the database file.
 func (s *likeStorage) ProcessActions(actions []domain.Action) error {
-	for _, action := range actions {
-		switch action.ActionType {
-		case domain.ActionDeleteProfile:
-			action.Error <- nil
-			// TODO
-		case domain.ActionGetProfile:
-			payload := action.Payload.(domain.GetProfilePayload)
-			payload.Profile <- nil
-			// TODO
-		case domain.ActionLike:
-			action.Error <- nil
-			// TODO
-		case domain.ActionDislike:
-			action.Error <- nil
-			// TODO
-		case domain.ActionDeleteItem:
-			action.Error <- nil
-			// TODO
-		case domain.ActionGetSimilarProfiles:
-			payload := action.Payload.(domain.GetSimilarProfilesPayload)
-			payload.Profiles <- &[]domain.SimilarProfile{}
-			// TODO
-		case domain.ActionRecommendItems:
-			payload := action.Payload.(domain.RecommendItemsPayload)
-			payload.Items <- &[]domain.RecItem{}
-			// TODO
-		default:
-			action.Error <- fmt.Errorf("unknown action %d", action.ActionType)
+	return s.processActions(actions, s.toDeltaOp, s.processRequests)
+}
+
+// Converts the action modifying a like profile to the delta operation.
+// The removal of a like or a dislike is checked against the profile as
+// modified by the preceding actions.
+func (s *likeStorage) toDeltaOp(action domain.Action) (domain.DeltaOp, uint64, uint64, error) {
+	switch action.ActionType {
+	case domain.ActionLike:
+		payload := action.Payload.(domain.LikePayload)
+		return domain.DeltaOpAdd, payload.UserID, payload.ItemID, nil
+	case domain.ActionDislike:
+		payload := action.Payload.(domain.DislikePayload)
+		return domain.DeltaOpDislike, payload.UserID, payload.ItemID, nil
+	case domain.ActionDeleteItem:
+		payload := action.Payload.(domain.DeleteItemPayload)
+		return domain.DeltaOpRemove, payload.UserID, payload.ItemID, nil
+	case domain.ActionDeleteLike:
+		payload := action.Payload.(domain.DeleteLikePayload)
+		err := s.checkQualification(payload, domain.ItemLiked, domain.ErrItemNotLiked)
+		return domain.DeltaOpRemove, payload.UserID, payload.ItemID, err
+	case domain.ActionDeleteDislike:
+		payload := action.Payload.(domain.DeleteDislikePayload)
+		err := s.checkQualification(payload, domain.ItemDisliked, domain.ErrItemNotDisliked)
+		return domain.DeltaOpRemove, payload.UserID, payload.ItemID, err
+	}
+	return 0, 0, 0, fmt.Errorf("unknown action %d", action.ActionType)
+}
+
+// Returns notFoundErr unless the user of the payload has qualified the item as
+// specified (liked or disliked).
+func (s *likeStorage) checkQualification(
+	payload domain.LikePayload,
+	qualification int,
+	notFoundErr error,
+) error {
+	profile, err := s.readProfile(payload.UserID)
+	if err != nil {
+		return err
+	}
+	if profile == nil || profile.QualifyItem(payload.ItemID) != qualification {
+		return notFoundErr
+	}
+	return nil
+}
+
+// Applies the item operation of the delta storage to the like profile.
+func applyLikeDeltaOp(user uint64, profile *domain.Profile, op domain.DeltaItem) *domain.Profile {
+	switch op.Op {
+	case domain.DeltaOpAdd:
+		if profile == nil {
+			profile = domain.NewProfile(user)
+		}
+		profile.Like(op.ItemID)
+	case domain.DeltaOpDislike:
+		if profile == nil {
+			profile = domain.NewProfile(user)
+		}
+		profile.Dislike(op.ItemID)
+	case domain.DeltaOpRemove:
+		if profile != nil {
+			profile.RemoveItem(op.ItemID)
+		}
+	}
+	return profile
+}
+
+// Answers the actions that read the profiles. The modifications must have
+// been applied to the delta storage at this point.
+func (s *likeStorage) processRequests(requests []domain.Action) error {
+	queries := make([]*similarityQuery, 0, len(requests))
+	for i, action := range requests {
+		var user uint64
+		var profile *domain.Profile
+		switch payload := action.Payload.(type) {
+		case domain.GetProfilePayload:
+			user = payload.UserID
+		case domain.GetSimilarProfilesPayload:
+			user = payload.UserID
+			profile = payload.Profile
+		case domain.RecommendItemsPayload:
+			user = payload.UserID
+		}
+		if profile == nil {
+			var err error
+			profile, err = s.readProfile(user)
+			if err != nil {
+				sendError(requests[i:], err)
+				return err
+			}
+		}
+		switch payload := action.Payload.(type) {
+		case domain.GetProfilePayload:
+			payload.Profile <- profile
+		case domain.GetSimilarProfilesPayload:
+			if profile == nil {
+				payload.Profiles <- &[]domain.SimilarProfile{}
+				continue
+			}
+			queries = append(queries, &similarityQuery{
+				action:      action,
+				profile:     profile,
+				metric:      makeSimilarityMetric(payload.Metric),
+				params:      domain.SimilarityParams{DislikeFactor: payload.DislikeFactor},
+				approximate: payload.Approximate && s.signatureStorage != nil,
+				limit:       payload.Limit,
+				collector:   domain.NewSimilarProfileCollector(payload.Limit),
+			})
+		case domain.RecommendItemsPayload:
+			if profile == nil {
+				payload.Items <- &[]domain.RecItem{}
+				continue
+			}
+			queries = append(queries, &similarityQuery{
+				action:      action,
+				profile:     profile,
+				metric:      makeSimilarityMetric(payload.Metric),
+				params:      domain.SimilarityParams{DislikeFactor: payload.DislikeFactor},
+				approximate: payload.Approximate && s.signatureStorage != nil,
+				limit:       payload.MaxSimilarProfiles,
+				collector:   domain.NewSimilarProfileCollector(payload.MaxSimilarProfiles),
+			})
+		}
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	exactQueries := make([]*similarityQuery, 0, len(queries))
+	approximateQueries := make([]*similarityQuery, 0)
+	for _, query := range queries {
+		if query.approximate {
+			approximateQueries = append(approximateQueries, query)
+		} else {
+			exactQueries = append(exactQueries, query)
 		}
 	}
+	err := s.fillNumItems(queries)
+	if err == nil && len(exactQueries) > 0 {
+		items := make([]uint64, 0)
+		for _, query := range exactQueries {
+			items = append(items, query.profile.GetItems()...)
+		}
+		segments := splitSimilarityQueries(exactQueries, s.numSegments)
+		callbacks := make([]func(profile *domain.Profile), len(segments))
+		for i, segmentQueries := range segments {
+			callbacks[i] = evaluateSimilarityQueries(segmentQueries)
+		}
+		err = s.scanSharing(items, callbacks)
+		mergeSimilarityQueries(segments)
+	}
+	if err == nil && len(approximateQueries) > 0 {
+		users := make([]uint64, 0)
+		for _, query := range approximateQueries {
+			if len(query.profile.Likes) > 0 {
+				signature := domain.ComputeMinHashSignature(query.profile.Likes)
+				users = append(users, s.signatureStorage.GetCandidates(&signature)...)
+			}
+		}
+		err = s.scanUsers(users, evaluateSimilarityQueries(approximateQueries))
+	}
+	if err != nil {
+		for _, query := range queries {
+			query.action.Error <- err
+		}
+		return err
+	}
+	for _, query := range queries {
+		similarProfiles := query.collector.GetProfiles()
+		switch payload := query.action.Payload.(type) {
+		case domain.GetSimilarProfilesPayload:
+			payload.Profiles <- &similarProfiles
+		case domain.RecommendItemsPayload:
+			items := domain.RecommendItems(query.profile, similarProfiles)
+			payload.Items <- &items
+		}
+	}
+	return nil
+}
+
+// Returns the queries for every scan segment. The segments other than the
+// first one get copies of the queries having their own collectors.
+func splitSimilarityQueries(queries []*similarityQuery, numSegments int) [][]*similarityQuery {
+	segments := make([][]*similarityQuery, 0, numSegments)
+	segments = append(segments, queries)
+	for i := 1; i < numSegments; i++ {
+		segmentQueries := make([]*similarityQuery, len(queries))
+		for j, query := range queries {
+			segmentQuery := *query
+			segmentQuery.collector = domain.NewSimilarProfileCollector(query.limit)
+			segmentQueries[j] = &segmentQuery
+		}
+		segments = append(segments, segmentQueries)
+	}
+	return segments
+}
+
+// Merges the collectors of the segment queries into the ones of the first
+// segment.
+func mergeSimilarityQueries(segments [][]*similarityQuery) {
+	for _, segmentQueries := range segments[1:] {
+		for j, query := range segmentQueries {
+			segments[0][j].collector.Merge(query.collector)
+		}
+	}
+}
+
+// Returns the callback comparing a profile with the profiles of the queries.
+func evaluateSimilarityQueries(queries []*similarityQuery) func(profile *domain.Profile) {
+	return func(profile *domain.Profile) {
+		for _, query := range queries {
+			if profile.UserID == query.profile.UserID {
+				continue
+			}
+			similarity := query.metric.ComputeSimilarity(query.profile, profile, query.params)
+			query.collector.Add(profile, similarity)
+		}
+	}
+}
+
+// Counts the distinct items of the storage if any of the queries' metrics
+// needs it.
+func (s *likeStorage) fillNumItems(queries []*similarityQuery) error {
+	needed := false
+	for _, query := range queries {
+		needed = needed || query.metric.NeedsNumItems()
+	}
+	if !needed {
+		return nil
+	}
+	numItems, err := s.countItems()
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		query.params.NumItems = numItems
+	}
 	return nil
 }
@@ -0,0 +1,864 @@
+package recdb
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+	"recengine/internal/helpers"
+	"recengine/internal/infra/delta"
+	"recengine/internal/infra/index"
+	"reflect"
+	"testing"
+)
+
+// Creates a like storage whose database file contains the profiles.
+func makeTestLikeStorage(t *testing.T, profiles ...*domain.Profile) domain.ProfileStorage {
+	proto := NewProtocol(NewLikeProtocol())
+	file := helpers.NewFileBuffer(nil)
+	proto.WritePrefix(file)
+	header := Header{Version, NewLikeProtocol().GetEntryType(), 0, uint32(len(profiles))}
+	proto.WriteHeader(&header, file)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	for _, profile := range profiles {
+		entry := Entry{Data: profile}
+		capacity, _ := proto.PredictEntryCapacity(&entry)
+		entry.Capacity = uint32(capacity)
+		offset, _ := file.Seek(0, io.SeekCurrent)
+		proto.WriteEntry(&entry, file)
+		indexStorage.Put(profile.UserID, uint64(offset))
+	}
+	// The item index is rebuilt from the database file upon opening
+	storage, err := NewStorageFactory().Open(file, deltaStorage, indexStorage, openTestItemIndex(t), nil)
+	if err != nil {
+		t.Fatalf("Failed to open like storage: %v", err)
+	}
+	return storage
+}
+
+// Processes a modifying action and returns the result.
+func processTestWriteAction(storage domain.ProfileStorage, actionType domain.ActionType, payload any) error {
+	errChan := make(chan error)
+	action := domain.Action{ActionType: actionType, Error: errChan, Payload: payload}
+	go storage.ProcessActions([]domain.Action{action})
+	return <-errChan
+}
+
+// Processes ActionGetProfile and returns the result.
+func processTestGetProfile(storage domain.ProfileStorage, user uint64) (*domain.Profile, error) {
+	errChan := make(chan error)
+	profileChan := make(chan *domain.Profile)
+	action := domain.Action{
+		ActionType: domain.ActionGetProfile,
+		Error:      errChan,
+		Payload:    domain.GetProfilePayload{UserID: user, Profile: profileChan},
+	}
+	go storage.ProcessActions([]domain.Action{action})
+	select {
+	case err := <-errChan:
+		return nil, err
+	case profile := <-profileChan:
+		return profile, nil
+	}
+}
+
+// Processes ActionGetSimilarProfiles and returns the result.
+func processTestGetSimilarProfiles(
+	storage domain.ProfileStorage,
+	user uint64,
+	limit uint,
+) ([]domain.SimilarProfile, error) {
+	errChan := make(chan error)
+	profilesChan := make(chan *[]domain.SimilarProfile)
+	action := domain.Action{
+		ActionType: domain.ActionGetSimilarProfiles,
+		Error:      errChan,
+		Payload: domain.GetSimilarProfilesPayload{
+			UserID:        user,
+			Limit:         limit,
+			DislikeFactor: 1,
+			Profiles:      profilesChan,
+		},
+	}
+	go storage.ProcessActions([]domain.Action{action})
+	select {
+	case err := <-errChan:
+		return nil, err
+	case profiles := <-profilesChan:
+		return *profiles, nil
+	}
+}
+
+// Processes ActionRecommendItems and returns the result.
+func processTestRecommendItems(storage domain.ProfileStorage, user uint64) ([]domain.RecItem, error) {
+	errChan := make(chan error)
+	itemsChan := make(chan *[]domain.RecItem)
+	action := domain.Action{
+		ActionType: domain.ActionRecommendItems,
+		Error:      errChan,
+		Payload: domain.RecommendItemsPayload{
+			UserID:             user,
+			MaxSimilarProfiles: 10,
+			DislikeFactor:      1,
+			Items:              itemsChan,
+		},
+	}
+	go storage.ProcessActions([]domain.Action{action})
+	select {
+	case err := <-errChan:
+		return nil, err
+	case items := <-itemsChan:
+		return *items, nil
+	}
+}
+
+func TestLikeStorageGetProfile(t *testing.T) {
+	t.Run("should return a profile from the database", func(t *testing.T) {
+		expected := &domain.Profile{UserID: 7, Likes: []uint64{1, 2}, Dislikes: []uint64{3}}
+		storage := makeTestLikeStorage(t, domain.NewProfile(5), expected)
+		defer storage.Close()
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(profile, expected) {
+			t.Errorf("Expected profile %v, got %v", expected, profile)
+		}
+	})
+
+	t.Run("should return nil if there is no profile", func(t *testing.T) {
+		storage := makeTestLikeStorage(t, domain.NewProfile(5))
+		defer storage.Close()
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if profile != nil {
+			t.Errorf("Expected nil, got %v", profile)
+		}
+	})
+
+	t.Run("should apply the delta to the profile", func(t *testing.T) {
+		initial := &domain.Profile{UserID: 7, Likes: []uint64{1, 2}, Dislikes: []uint64{3}}
+		storage := makeTestLikeStorage(t, initial)
+		defer storage.Close()
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 7, ItemID: 3})
+		processTestWriteAction(storage, domain.ActionDislike, domain.DislikePayload{UserID: 7, ItemID: 4})
+		processTestWriteAction(storage, domain.ActionDeleteItem, domain.DeleteItemPayload{UserID: 7, ItemID: 1})
+		expected := &domain.Profile{UserID: 7, Likes: []uint64{2, 3}, Dislikes: []uint64{4}}
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(profile, expected) {
+			t.Errorf("Expected profile %v, got %v", expected, profile)
+		}
+	})
+
+	t.Run("should return a profile existing in the delta only", func(t *testing.T) {
+		storage := makeTestLikeStorage(t)
+		defer storage.Close()
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 7, ItemID: 3})
+		expected := &domain.Profile{UserID: 7, Likes: []uint64{3}, Dislikes: []uint64{}}
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(profile, expected) {
+			t.Errorf("Expected profile %v, got %v", expected, profile)
+		}
+	})
+
+	t.Run("should not return a deleted profile", func(t *testing.T) {
+		storage := makeTestLikeStorage(t, &domain.Profile{UserID: 7, Likes: []uint64{1}})
+		defer storage.Close()
+		err := processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 7})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if profile != nil {
+			t.Errorf("Expected nil, got %v", profile)
+		}
+	})
+}
+
+func TestLikeStorageDeleteQualifiedItem(t *testing.T) {
+	t.Run("should remove the like or the dislike only", func(t *testing.T) {
+		initial := &domain.Profile{UserID: 7, Likes: []uint64{1}, Dislikes: []uint64{2}}
+		storage := makeTestLikeStorage(t, initial)
+		defer storage.Close()
+		payloads := []domain.LikePayload{{UserID: 7, ItemID: 2}, {UserID: 7, ItemID: 3}, {UserID: 8, ItemID: 1}}
+		for _, payload := range payloads {
+			err := processTestWriteAction(storage, domain.ActionDeleteLike, payload)
+			if !errors.Is(err, domain.ErrItemNotLiked) {
+				t.Errorf("Expected ErrItemNotLiked for %v, got %v", payload, err)
+			}
+		}
+		err := processTestWriteAction(storage, domain.ActionDeleteDislike, domain.LikePayload{UserID: 7, ItemID: 1})
+		if !errors.Is(err, domain.ErrItemNotDisliked) {
+			t.Errorf("Expected ErrItemNotDisliked, got %v", err)
+		}
+		err = processTestWriteAction(storage, domain.ActionDeleteLike, domain.LikePayload{UserID: 7, ItemID: 1})
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		err = processTestWriteAction(storage, domain.ActionDeleteDislike, domain.LikePayload{UserID: 7, ItemID: 2})
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil || profile == nil || len(profile.Likes) != 0 || len(profile.Dislikes) != 0 {
+			t.Errorf("Expected an empty profile, got %v (%v)", profile, err)
+		}
+	})
+
+	t.Run("should check the item as modified by the preceding actions", func(t *testing.T) {
+		storage := makeTestLikeStorage(t, &domain.Profile{UserID: 7, Likes: []uint64{1}})
+		defer storage.Close()
+		dislike := domain.Action{
+			ActionType: domain.ActionDislike,
+			Error:      make(chan error, 1),
+			Payload:    domain.DislikePayload{UserID: 7, ItemID: 1},
+		}
+		deleteLike := domain.Action{
+			ActionType: domain.ActionDeleteLike,
+			Error:      make(chan error, 1),
+			Payload:    domain.DeleteLikePayload{UserID: 7, ItemID: 1},
+		}
+		storage.ProcessActions([]domain.Action{dislike, deleteLike})
+		if err := <-dislike.Error; err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if err := <-deleteLike.Error; !errors.Is(err, domain.ErrItemNotLiked) {
+			t.Errorf("Expected ErrItemNotLiked, got %v", err)
+		}
+		profile, err := processTestGetProfile(storage, 7)
+		if err != nil || profile == nil || !reflect.DeepEqual(profile.Dislikes, []uint64{1}) {
+			t.Errorf("Expected the dislike to stay, got %v (%v)", profile, err)
+		}
+	})
+}
+
+func TestLikeStorageGetSimilarProfiles(t *testing.T) {
+	t.Run("should return the most similar profiles", func(t *testing.T) {
+		storage := makeTestLikeStorage(t,
+			&domain.Profile{UserID: 1, Likes: []uint64{1, 2, 3, 4}},
+			&domain.Profile{UserID: 2, Likes: []uint64{1, 2, 3, 5}},
+			&domain.Profile{UserID: 3, Likes: []uint64{1, 6, 7, 8}},
+			&domain.Profile{UserID: 4, Likes: []uint64{9}},
+			&domain.Profile{UserID: 5, Likes: []uint64{1, 2, 7, 8}},
+		)
+		defer storage.Close()
+		// User 6 exists in the delta only
+		for _, item := range []uint64{1, 2, 3, 4} {
+			processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 6, ItemID: item})
+		}
+		profiles, err := processTestGetSimilarProfiles(storage, 1, 3)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		users := make([]uint64, len(profiles))
+		for i := range profiles {
+			users[i] = profiles[i].Profile.UserID
+		}
+		expected := []uint64{6, 2, 5}
+		if !reflect.DeepEqual(users, expected) {
+			t.Errorf("Expected users %v, got %v", expected, users)
+		}
+	})
+
+	t.Run("should return the profiles most similar to a given profile", func(t *testing.T) {
+		storage := makeTestLikeStorage(t,
+			&domain.Profile{UserID: 1, Likes: []uint64{1, 2}},
+			&domain.Profile{UserID: 2, Likes: []uint64{3, 4}},
+			&domain.Profile{UserID: 3, Likes: []uint64{1, 2, 3, 4}},
+		)
+		defer storage.Close()
+		errChan := make(chan error, 1)
+		profilesChan := make(chan *[]domain.SimilarProfile, 1)
+		storage.ProcessActions([]domain.Action{{
+			ActionType: domain.ActionGetSimilarProfiles,
+			Error:      errChan,
+			Payload: domain.GetSimilarProfilesPayload{
+				UserID:        1,
+				Profile:       &domain.Profile{UserID: 1, Likes: []uint64{3, 4}},
+				Limit:         3,
+				DislikeFactor: 1,
+				Profiles:      profilesChan,
+			},
+		}})
+		select {
+		case err := <-errChan:
+			t.Error(err)
+		case profiles := <-profilesChan:
+			users := make([]uint64, len(*profiles))
+			for i, profile := range *profiles {
+				users[i] = profile.Profile.UserID
+			}
+			expected := []uint64{2, 3}
+			if !reflect.DeepEqual(users, expected) {
+				t.Errorf("Expected users %v, got %v", expected, users)
+			}
+		}
+	})
+
+	t.Run("should compare the profiles by the metric of the request", func(t *testing.T) {
+		storage := makeTestLikeStorage(t,
+			&domain.Profile{UserID: 1, Likes: []uint64{1, 2}},
+			&domain.Profile{UserID: 2, Likes: []uint64{1, 2, 3, 4, 5, 6, 7, 8}},
+			&domain.Profile{UserID: 3, Likes: []uint64{1, 9}},
+			&domain.Profile{UserID: 4, Likes: []uint64{10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20}},
+		)
+		defer storage.Close()
+		fixtures := []struct {
+			metric   string
+			expected []uint64
+		}{
+			{valueobjects.SimilarityMetricJaccard, []uint64{3, 2}},
+			{valueobjects.SimilarityMetricOverlap, []uint64{2, 3}},
+			// Takes the items of user 4 into account, otherwise user 2 would
+			// co-occur no more than by chance.
+			{valueobjects.SimilarityMetricLogLikelihood, []uint64{2, 3}},
+		}
+		for _, fixture := range fixtures {
+			value, _ := valueobjects.ParseSimilarityMetric(fixture.metric)
+			metric, err := domain.NewSimilarityMetric(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errChan := make(chan error, 1)
+			profilesChan := make(chan *[]domain.SimilarProfile, 1)
+			storage.ProcessActions([]domain.Action{{
+				ActionType: domain.ActionGetSimilarProfiles,
+				Error:      errChan,
+				Payload: domain.GetSimilarProfilesPayload{
+					UserID:   1,
+					Limit:    3,
+					Metric:   metric,
+					Profiles: profilesChan,
+				},
+			}})
+			select {
+			case err := <-errChan:
+				t.Error(err)
+			case profiles := <-profilesChan:
+				users := make([]uint64, 0, len(*profiles))
+				for _, profile := range *profiles {
+					if profile.Similarity > 0 {
+						users = append(users, profile.Profile.UserID)
+					}
+				}
+				if !reflect.DeepEqual(users, fixture.expected) {
+					t.Errorf("%s: expected users %v, got %v", fixture.metric, fixture.expected, users)
+				}
+			}
+		}
+	})
+
+	t.Run("should return nothing for unknown profile", func(t *testing.T) {
+		storage := makeTestLikeStorage(t, &domain.Profile{UserID: 1, Likes: []uint64{1}})
+		defer storage.Close()
+		profiles, err := processTestGetSimilarProfiles(storage, 2, 3)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(profiles) != 0 {
+			t.Errorf("Expected no profiles, got %v", profiles)
+		}
+	})
+}
+
+func TestLikeStorageApproximateSearch(t *testing.T) {
+	const numClusters = 20
+	const clusterSize = 30
+	const usersPerCluster = 25
+	const limit = 10
+	file := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	factory := NewStorageFactory()
+	storage, err := factory.Open(file, deltaStorage, indexStorage, nil, openTestSignatures(t))
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	defer storage.Close()
+	// Each user likes most items of its cluster and a couple of random ones
+	random := rand.New(rand.NewSource(1))
+	actions := make([]domain.Action, 0)
+	for user := uint64(0); user < numClusters*usersPerCluster; user++ {
+		items := make([]uint64, 0)
+		for _, item := range random.Perm(clusterSize)[:15+random.Intn(6)] {
+			items = append(items, user/usersPerCluster*clusterSize+uint64(item))
+		}
+		for i := 0; i < 2; i++ {
+			items = append(items, numClusters*clusterSize+uint64(random.Intn(1000)))
+		}
+		for _, item := range items {
+			actions = append(actions, domain.Action{
+				ActionType: domain.ActionLike,
+				Error:      make(chan error, 1),
+				Payload:    domain.LikePayload{UserID: user, ItemID: item},
+			})
+		}
+	}
+	if err := storage.ProcessActions(actions); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	// The signatures are stored upon compaction
+	if err := storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	// Returns the similar profiles found by the search of the mode.
+	getSimilarProfiles := func(user uint64, approximate bool) []domain.SimilarProfile {
+		errChan := make(chan error, 1)
+		profilesChan := make(chan *[]domain.SimilarProfile, 1)
+		storage.ProcessActions([]domain.Action{{
+			ActionType: domain.ActionGetSimilarProfiles,
+			Error:      errChan,
+			Payload: domain.GetSimilarProfilesPayload{
+				UserID:      user,
+				Limit:       limit,
+				Approximate: approximate,
+				Profiles:    profilesChan,
+			},
+		}})
+		select {
+		case err := <-errChan:
+			t.Fatalf("Got error: %v", err)
+		case profiles := <-profilesChan:
+			return *profiles
+		}
+		return nil
+	}
+	// The approximate results are considered relevant if they are as similar
+	// as the least similar exact result, which makes the ties irrelevant.
+	var relevant, total int
+	for user := uint64(0); user < numClusters*usersPerCluster; user += usersPerCluster / 5 {
+		exact := getSimilarProfiles(user, false)
+		approximate := getSimilarProfiles(user, true)
+		if len(exact) != limit {
+			t.Fatalf("Expected %d exact results, got %d", limit, len(exact))
+		}
+		threshold := exact[len(exact)-1].Similarity
+		for _, profile := range approximate {
+			if profile.Similarity >= threshold {
+				relevant++
+			}
+		}
+		total += len(exact)
+	}
+	recall := float64(relevant) / float64(total)
+	if recall < 0.9 {
+		t.Errorf("Expected recall at least 0.9, got %.3f", recall)
+	}
+}
+
+func TestLikeStorageParallelScan(t *testing.T) {
+	const numUsers = 300
+	const limit = 10
+	for _, withItemIndex := range []bool{false, true} {
+		name := "should find the same profiles as the sequential scan"
+		if withItemIndex {
+			name += " using the item index"
+		}
+		t.Run(name, func(t *testing.T) {
+			// The segments are only read concurrently from the regular files
+			file, err := os.Create(filepath.Join(t.TempDir(), "test.recdb"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+			var itemIndexStorage domain.ItemIndexStorage
+			if withItemIndex {
+				itemIndexStorage = openTestItemIndex(t)
+			}
+			factory := NewStorageFactory().(*storageFactory)
+			factory.numSegments = 4
+			storage, err := factory.Open(file, deltaStorage, indexStorage, itemIndexStorage, nil)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			defer storage.Close()
+			// Some of the profiles stay in the delta storage only
+			random := rand.New(rand.NewSource(1))
+			for user := uint64(0); user < numUsers; user++ {
+				for i := 0; i < 5+random.Intn(10); i++ {
+					payload := domain.LikePayload{UserID: user, ItemID: uint64(random.Intn(100))}
+					processTestWriteAction(storage, domain.ActionLike, payload)
+				}
+				if user == numUsers*2/3 {
+					if err := storage.Compact(); err != nil {
+						t.Fatalf("Got error: %v", err)
+					}
+				}
+			}
+			// Returns the similarities of the profiles found with the segments.
+			getSimilarities := func(user uint64, numSegments int) []float32 {
+				storage.(*likeStorage).numSegments = numSegments
+				profiles, err := processTestGetSimilarProfiles(storage, user, limit)
+				if err != nil {
+					t.Fatalf("Got error: %v", err)
+				}
+				similarities := make([]float32, len(profiles))
+				for i, profile := range profiles {
+					similarities[i] = profile.Similarity
+				}
+				return similarities
+			}
+			for user := uint64(0); user < numUsers; user += 30 {
+				expected := getSimilarities(user, 1)
+				got := getSimilarities(user, factory.numSegments)
+				if len(expected) != limit || !reflect.DeepEqual(got, expected) {
+					t.Errorf("Expected similarities %v for user %d, got %v", expected, user, got)
+				}
+			}
+		})
+	}
+}
+
+func TestLikeStorageCorruptedEntry(t *testing.T) {
+	proto := NewProtocol(NewLikeProtocol())
+	file := helpers.NewFileBuffer(nil)
+	proto.WritePrefix(file)
+	header := Header{Version, NewLikeProtocol().GetEntryType(), 0, 3}
+	proto.WriteHeader(&header, file)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	offsets := make([]int64, 0)
+	for user := uint64(1); user <= 3; user++ {
+		entry := Entry{Data: &domain.Profile{UserID: user, Likes: []uint64{1, 2}}}
+		capacity, _ := proto.PredictEntryCapacity(&entry)
+		entry.Capacity = uint32(capacity)
+		offset, _ := file.Seek(0, io.SeekCurrent)
+		proto.WriteEntry(&entry, file)
+		indexStorage.Put(user, uint64(offset))
+		offsets = append(offsets, offset)
+	}
+	// A torn write in the middle of the second entry
+	file.Bytes()[offsets[1]+int64(getEntryHeaderSize(Version))+8+2]++
+	storage, err := NewStorageFactory().Open(file, deltaStorage, indexStorage, openTestItemIndex(t), nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	defer storage.Close()
+
+	t.Run("should skip the entry while scanning", func(t *testing.T) {
+		profiles, err := processTestGetSimilarProfiles(storage, 1, 10)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if len(profiles) != 1 || profiles[0].Profile.UserID != 3 {
+			t.Errorf("Expected the profile of user 3 only, got %v", profiles)
+		}
+	})
+
+	t.Run("should fail reading the profile", func(t *testing.T) {
+		_, err := processTestGetProfile(storage, 2)
+		if !errors.Is(err, &domain.CorruptedEntryError{}) {
+			t.Errorf("Expected CorruptedEntryError, got %v", err)
+		}
+	})
+
+	t.Run("should quarantine the entry upon compaction", func(t *testing.T) {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 3, ItemID: 4})
+		if err := storage.Compact(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if file.Bytes()[offsets[1]+entryDeletedOffset] != 1 {
+			t.Error("Expected the entry to be marked deleted")
+		}
+		profile, err := processTestGetProfile(storage, 2)
+		if err != nil || profile != nil {
+			t.Errorf("Expected no profile, got %v, %v", profile, err)
+		}
+	})
+}
+
+func TestLikeStorageRecommendItems(t *testing.T) {
+	storage := makeTestLikeStorage(t,
+		&domain.Profile{UserID: 1, Likes: []uint64{1, 2}},
+		&domain.Profile{UserID: 2, Likes: []uint64{1, 2, 3, 4}, Dislikes: []uint64{5}},
+		&domain.Profile{UserID: 3, Likes: []uint64{1, 3, 5}},
+		&domain.Profile{UserID: 4, Likes: []uint64{6}},
+	)
+	defer storage.Close()
+	items, err := processTestRecommendItems(storage, 1)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ids := make([]uint64, len(items))
+	for i := range items {
+		ids[i] = items[i].ItemID
+	}
+	expected := []uint64{3, 4}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expected items %v, got %v", expected, ids)
+	}
+}
+
+func TestLikeStorageCompact(t *testing.T) {
+	proto := NewProtocol(NewLikeProtocol())
+	file := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	itemIndexStorage := openTestItemIndex(t)
+	factory := NewStorageFactory()
+	storage, err := factory.Open(file, deltaStorage, indexStorage, itemIndexStorage, nil)
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	defer storage.Close()
+	// Create profiles
+	for _, item := range []uint64{1, 2, 3} {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 1, ItemID: item})
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 2, ItemID: item})
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 3, ItemID: item})
+	}
+	err = storage.Compact()
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	if deltaStorage.GetTotalItemCount() != 0 {
+		t.Errorf("Expected the delta to be empty, got %d items", deltaStorage.GetTotalItemCount())
+	}
+	// Update, grow beyond the capacity and delete
+	processTestWriteAction(storage, domain.ActionDislike, domain.DislikePayload{UserID: 1, ItemID: 1})
+	for item := uint64(100000); item < 10000000; item += 100000 {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 2, ItemID: item})
+	}
+	processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 3})
+	processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 4, ItemID: 1})
+	expected := map[uint64]*domain.Profile{}
+	for _, user := range []uint64{1, 2, 3, 4} {
+		expected[user], _ = processTestGetProfile(storage, user)
+	}
+	err = storage.Compact()
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	if deltaStorage.GetTotalItemCount() != 0 {
+		t.Errorf("Expected the delta to be empty, got %d items", deltaStorage.GetTotalItemCount())
+	}
+	for user, profile := range expected {
+		got, err := processTestGetProfile(storage, user)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(got, profile) {
+			t.Errorf("Expected profile %v, got %v", profile, got)
+		}
+	}
+	// Check the file: the old entries are deleted, 1, 2 and 4 are appended
+	_, err = NewIterator(helpers.NewFileBuffer(file.Bytes()), proto)
+	if err == nil || !errors.Is(err, &domain.CorruptedFileError{}) {
+		t.Error("Expected the file to stay locked")
+	}
+	buffer := helpers.NewFileBuffer(append([]byte{}, file.Bytes()...))
+	proto.WriteLocked(false, buffer)
+	iter, err := NewIterator(buffer, proto)
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	users := make([]uint64, 0)
+	deleted := make([]byte, 0)
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		users = append(users, entry.Data.(*domain.Profile).UserID)
+		deleted = append(deleted, entry.Deleted)
+	}
+	if !reflect.DeepEqual(users, []uint64{1, 2, 3, 1, 2, 4}) ||
+		!reflect.DeepEqual(deleted, []byte{1, 1, 1, 0, 0, 0}) {
+		t.Errorf("Unexpected entries %v with deleted flags %v", users, deleted)
+	}
+	if offset, ok := indexStorage.Get(3); ok {
+		t.Errorf("Expected deleted profile to be removed from index, got %d", offset)
+	}
+	// Item 1 is disliked by user 1 and liked by users 2 and 4
+	offsets := make([]uint64, 0)
+	for _, user := range []uint64{1, 2, 4} {
+		offset, _ := indexStorage.Get(user)
+		offsets = append(offsets, offset)
+	}
+	if got := itemIndexStorage.GetOffsets([]uint64{1}); !reflect.DeepEqual(got, offsets) {
+		t.Errorf("Expected item index offsets %v, got %v", offsets, got)
+	}
+}
+
+// The file failing the sync after the specified number of successful ones.
+type failingSyncFile struct {
+	*helpers.FileBuffer
+	syncsLeft int
+}
+
+func (f *failingSyncFile) Sync() error {
+	if f.syncsLeft == 0 {
+		return errors.New("sync failed")
+	}
+	f.syncsLeft--
+	return nil
+}
+
+func TestLikeStorageCompactCrash(t *testing.T) {
+	factory := NewStorageFactory()
+	file := &failingSyncFile{helpers.NewFileBuffer(nil), -1}
+	deltaFile := helpers.NewFileBuffer(nil)
+	indexFile := helpers.NewFileBuffer(nil)
+	deltaStorage, err := delta.NewStorageFactory().Open(deltaFile)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	indexStorage, err := index.NewStorageFactory().Open(indexFile, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for user := uint64(1); user <= 2; user++ {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: user, ItemID: 1})
+	}
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for user := uint64(1); user <= 2; user++ {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: user, ItemID: 2})
+	}
+	// The process is killed once the old entries are marked deleted
+	file.syncsLeft = 1
+	if err = storage.Compact(); err == nil {
+		t.Fatal("Expected the compaction to fail")
+	}
+	deltaStorage, err = delta.NewStorageFactory().OpenMaybeRecover(helpers.NewFileBuffer(deltaFile.Bytes()))
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	indexStorage, err = index.NewStorageFactory().Open(helpers.NewFileBuffer(indexFile.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	storage, err = factory.OpenMaybeRecover(helpers.NewFileBuffer(file.Bytes()), deltaStorage, indexStorage, nil, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	defer storage.Close()
+	for user := uint64(1); user <= 2; user++ {
+		profile, err := processTestGetProfile(storage, user)
+		if err != nil || profile == nil || !reflect.DeepEqual(profile.Likes, []uint64{1, 2}) {
+			t.Errorf("Unexpected profile %v, error %v", profile, err)
+		}
+	}
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for user := uint64(1); user <= 2; user++ {
+		profile, err := processTestGetProfile(storage, user)
+		if err != nil || profile == nil || !reflect.DeepEqual(profile.Likes, []uint64{1, 2}) {
+			t.Errorf("Unexpected profile %v after compaction, error %v", profile, err)
+		}
+	}
+}
+
+func TestLikeStorageFreeSlots(t *testing.T) {
+	file := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	factory := NewStorageFactory()
+	storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for user := uint64(1); user <= 4; user++ {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: user, ItemID: 1})
+	}
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 2})
+	processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 3})
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	size := file.Len()
+	fragmentation := storage.GetFragmentation()
+	if fragmentation != 0.5 {
+		t.Errorf("Expected fragmentation 0.5, got %f", fragmentation)
+	}
+
+	t.Run("should write a new profile to a deleted entry's slot", func(t *testing.T) {
+		processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 5, ItemID: 2})
+		if err := storage.Compact(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if file.Len() != size {
+			t.Errorf("Expected the file size to stay %d, got %d", size, file.Len())
+		}
+		offset, _ := indexStorage.Get(5)
+		if offset == 0 || int(offset) >= size {
+			t.Errorf("Expected the profile to be written to a free slot, got offset %d", offset)
+		}
+		profile, err := processTestGetProfile(storage, 5)
+		if err != nil || profile == nil || !reflect.DeepEqual(profile.Likes, []uint64{2}) {
+			t.Errorf("Unexpected profile %v, error %v", profile, err)
+		}
+		if storage.GetFragmentation() >= fragmentation {
+			t.Errorf("Expected fragmentation to decrease, got %f", storage.GetFragmentation())
+		}
+	})
+
+	t.Run("should write a changed profile after its old entry", func(t *testing.T) {
+		for _, user := range []uint64{1, 4} {
+			oldOffset, _ := indexStorage.Get(user)
+			processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: user, ItemID: 3})
+			if err := storage.Compact(); err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			offset, _ := indexStorage.Get(user)
+			if offset <= oldOffset {
+				t.Errorf("Expected user %d to be moved beyond offset %d, got %d", user, oldOffset, offset)
+			}
+			profile, err := processTestGetProfile(storage, user)
+			if err != nil || profile == nil || !reflect.DeepEqual(profile.Likes, []uint64{1, 3}) {
+				t.Errorf("Unexpected profile %v, error %v", profile, err)
+			}
+		}
+	})
+
+	t.Run("should rebuild the free list upon opening", func(t *testing.T) {
+		fragmentation := storage.GetFragmentation()
+		if err := storage.Close(); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		reopened := helpers.NewFileBuffer(append([]byte{}, file.Bytes()...))
+		storage, err := factory.Open(reopened, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer storage.Close()
+		if storage.GetFragmentation() != fragmentation {
+			t.Errorf("Expected fragmentation %f, got %f", fragmentation, storage.GetFragmentation())
+		}
+	})
+}
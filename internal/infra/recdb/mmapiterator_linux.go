@@ -0,0 +1,162 @@
+//go:build linux
+
+package recdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"recengine/internal/domain"
+	"syscall"
+)
+
+// Iterates over the entries of the database file mapped into memory. The
+// entries are decoded straight from the mapped pages into the same entry and
+// profile structs, so no data is copied into intermediate buffers and the
+// item lists are allocated only when they outgrow the previous ones.
+type mmapIterator struct {
+	data       []byte
+	proto      Protocol
+	entryIndex int
+	// The index of the entry following the last one to iterate.
+	endIndex   int
+	fileOffset int64
+	entry      Entry
+	// True for the segments, which share the mapping of the split iterator.
+	shared bool
+}
+
+// Compile-time type check
+var _ = (scanIterator)((*mmapIterator)(nil))
+
+// Creates the iterator over the entries of a file whose header has already
+// been read. The regular files are mapped into memory, while the other
+// streams are read through a buffer.
+func newScanIterator(file io.ReadWriteSeeker, proto Protocol, header *Header) (scanIterator, error) {
+	if osFile, ok := file.(*os.File); ok {
+		return newMmapIterator(osFile, proto, header)
+	}
+	return newBufferedScanIterator(file, proto, header)
+}
+
+// Maps the file into memory for reading and creates the iterator over its
+// entries. The header must have been read from the file.
+func newMmapIterator(file *os.File, proto Protocol, header *Header) (*mmapIterator, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	iter := &mmapIterator{
+		proto:      proto,
+		endIndex:   int(header.NumEntries),
+		fileOffset: int64(entriesOffset),
+	}
+	if info.Size() == 0 {
+		return iter, nil
+	}
+	iter.data, err = syscall.Mmap(
+		int(file.Fd()),
+		0,
+		int(info.Size()),
+		syscall.PROT_READ,
+		syscall.MAP_SHARED,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map RECDB file: %v", err)
+	}
+	// The advice is a hint only, so its failure doesn't matter
+	syscall.Madvise(iter.data, syscall.MADV_SEQUENTIAL)
+	return iter, nil
+}
+
+// Returns true if there is at least one entry that can be got by Next().
+func (iter *mmapIterator) HasNext() bool {
+	return iter.entryIndex < iter.endIndex
+}
+
+// Returns the current entry and iterates next. The entry and its data are
+// only valid until the next call. A corrupted entry is skipped returning
+// domain.CorruptedEntryError.
+func (iter *mmapIterator) Next() (*Entry, error) {
+	if !iter.HasNext() {
+		return nil, errors.New("failed to iterate next: the last entry reached")
+	}
+	if iter.fileOffset >= int64(len(iter.data)) {
+		return nil, fmt.Errorf("failed to iterate next: %v", io.ErrUnexpectedEOF)
+	}
+	size, err := iter.proto.DecodeEntry(&iter.entry, iter.data[iter.fileOffset:])
+	if errors.Is(err, &domain.CorruptedEntryError{}) {
+		iter.fileOffset += int64(size)
+		iter.entryIndex++
+		return nil, fmt.Errorf("failed to iterate next: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to iterate next: %v", err)
+	}
+	iter.fileOffset += int64(size)
+	iter.entryIndex++
+	return &iter.entry, nil
+}
+
+// Returns the offset of the previously read entry from the beginning of
+// the file.
+func (iter *mmapIterator) GetPreviousOffset() int64 {
+	return iter.fileOffset - int64(iter.entry.Capacity)
+}
+
+// Splits the remaining entries into at most n consecutive segments of about
+// the same size in bytes. The boundaries are found by walking the capacities
+// of the entries without decoding their data.
+func (iter *mmapIterator) Split(n int) ([]scanIterator, error) {
+	if n > iter.endIndex-iter.entryIndex {
+		n = iter.endIndex - iter.entryIndex
+	}
+	if n <= 1 {
+		return []scanIterator{iter}, nil
+	}
+	segmentSize := (int64(len(iter.data)) - iter.fileOffset) / int64(n)
+	segments := make([]scanIterator, 0, n)
+	segment := &mmapIterator{
+		data:       iter.data,
+		proto:      iter.proto,
+		entryIndex: iter.entryIndex,
+		fileOffset: iter.fileOffset,
+		shared:     true,
+	}
+	offset := iter.fileOffset
+	for i := iter.entryIndex; i < iter.endIndex; i++ {
+		if offset+entryHeaderSize > int64(len(iter.data)) {
+			return nil, fmt.Errorf("failed to split iterator: %v", io.ErrUnexpectedEOF)
+		}
+		capacity := binary.BigEndian.Uint32(iter.data[offset:])
+		if capacity < entryHeaderSize {
+			return nil, fmt.Errorf("failed to split iterator: invalid capacity %d", capacity)
+		}
+		offset += int64(capacity)
+		if len(segments) < n-1 && offset-segment.fileOffset >= segmentSize {
+			segment.endIndex = i + 1
+			segments = append(segments, segment)
+			segment = &mmapIterator{
+				data:       iter.data,
+				proto:      iter.proto,
+				entryIndex: i + 1,
+				fileOffset: offset,
+				shared:     true,
+			}
+		}
+	}
+	segment.endIndex = iter.endIndex
+	return append(segments, segment), nil
+}
+
+// Unmaps the file unless the iterator is a segment of another one.
+func (iter *mmapIterator) Close() error {
+	if iter.data == nil || iter.shared {
+		return nil
+	}
+	err := syscall.Munmap(iter.data)
+	iter.data = nil
+	return err
+}
@@ -0,0 +1,193 @@
+//go:build linux
+
+package recdb
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"recengine/internal/domain"
+	"reflect"
+	"testing"
+)
+
+// Writes the data into a new file and opens it with the header read.
+func openTestRecDbFile(t testing.TB, data []byte) (*os.File, Protocol, *Header) {
+	filePath := filepath.Join(t.TempDir(), "test.recdb")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	proto := NewProtocol(NewLikeProtocol())
+	header := Header{}
+	if _, err = proto.ReadPrefix(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = proto.ReadHeader(&header, file); err != nil {
+		t.Fatal(err)
+	}
+	proto, err = proto.ForVersion(header.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file, proto, &header
+}
+
+func TestMmapIterator(t *testing.T) {
+	t.Run("should read the entries of a file", func(t *testing.T) {
+		data := append(mockLikeRecDbHeaderBytes(false, 2), mockLikeRecDbEntryBytes(true)...)
+		data = append(data, mockLikeRecDbEntryBytes(false)...)
+		file, proto, header := openTestRecDbFile(t, data)
+		iter, err := newScanIterator(file, proto, header)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer iter.Close()
+		if _, ok := iter.(*mmapIterator); !ok {
+			t.Fatalf("Expected the file to be mapped, got %T", iter)
+		}
+		entrySize := int64(len(mockLikeRecDbEntryBytes(false)))
+		for i, deleted := range []bool{true, false} {
+			if !iter.HasNext() {
+				t.Fatal("Expected HasNext() to be true")
+			}
+			entry, err := iter.Next()
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(entry, mockLikeRecDbEntry(deleted)) {
+				t.Errorf("Expected entry %v, got %v", mockLikeRecDbEntry(deleted), entry)
+			}
+			if offset := iter.GetPreviousOffset(); offset != int64(entriesOffset)+int64(i)*entrySize {
+				t.Errorf("Expected previous offset %d, got %d", int64(entriesOffset)+int64(i)*entrySize, offset)
+			}
+		}
+		if iter.HasNext() {
+			t.Error("Expected HasNext() to be false")
+		}
+	})
+
+	t.Run("should split the entries into segments", func(t *testing.T) {
+		data := mockLikeRecDbHeaderBytes(false, 5)
+		for i := 0; i < 5; i++ {
+			data = append(data, mockLikeRecDbEntryBytes(i%2 == 0)...)
+		}
+		file, proto, header := openTestRecDbFile(t, data)
+		iter, err := newScanIterator(file, proto, header)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer iter.Close()
+		segments, err := iter.Split(2)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if len(segments) != 2 {
+			t.Fatalf("Expected 2 segments, got %d", len(segments))
+		}
+		entrySize := int64(len(mockLikeRecDbEntryBytes(false)))
+		i := 0
+		for _, segment := range segments {
+			for segment.HasNext() {
+				entry, err := segment.Next()
+				if err != nil {
+					t.Fatalf("Got error: %v", err)
+				}
+				if !reflect.DeepEqual(entry, mockLikeRecDbEntry(i%2 == 0)) {
+					t.Errorf("Expected entry %v, got %v", mockLikeRecDbEntry(i%2 == 0), entry)
+				}
+				if offset := segment.GetPreviousOffset(); offset != int64(entriesOffset)+int64(i)*entrySize {
+					t.Errorf("Expected previous offset %d, got %d", int64(entriesOffset)+int64(i)*entrySize, offset)
+				}
+				i++
+			}
+			if err = segment.Close(); err != nil {
+				t.Errorf("Got error: %v", err)
+			}
+		}
+		if i != 5 {
+			t.Errorf("Expected 5 entries, got %d", i)
+		}
+	})
+
+	t.Run("should fail reading a truncated file", func(t *testing.T) {
+		data := append(mockLikeRecDbHeaderBytes(false, 2), mockLikeRecDbEntryBytes(false)...)
+		file, proto, header := openTestRecDbFile(t, data[:len(data)-10])
+		iter, err := newScanIterator(file, proto, header)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer iter.Close()
+		if _, err = iter.Next(); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+}
+
+// Scans a generated file of a million like profiles having 20 likes each.
+func BenchmarkScanIterator(b *testing.B) {
+	const numProfiles = 1000000
+	proto := NewProtocol(NewLikeProtocol())
+	filePath := filepath.Join(b.TempDir(), "bench.recdb")
+	file, err := os.Create(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	header := Header{Version, NewLikeProtocol().GetEntryType(), 0, numProfiles}
+	proto.WritePrefix(writer)
+	proto.WriteHeader(&header, writer)
+	profile := domain.NewProfile(0)
+	for user := uint64(0); user < numProfiles; user++ {
+		profile.UserID = user
+		profile.Likes = profile.Likes[:0]
+		for i := uint64(0); i < 20; i++ {
+			profile.Likes = append(profile.Likes, user%1000+i*1000)
+		}
+		entry := Entry{Data: profile}
+		capacity, _ := proto.PredictEntryCapacity(&entry)
+		entry.Capacity = uint32(capacity)
+		if _, err = proto.WriteEntry(&entry, writer); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err = writer.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	// Reads all the entries with the iterator
+	scan := func(b *testing.B, iter scanIterator) {
+		defer iter.Close()
+		for iter.HasNext() {
+			if _, err := iter.Next(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			iter, err := newBufferedScanIterator(file, proto, &header)
+			if err != nil {
+				b.Fatal(err)
+			}
+			scan(b, iter)
+		}
+	})
+
+	b.Run("mmap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			iter, err := newMmapIterator(file, proto, &header)
+			if err != nil {
+				b.Fatal(err)
+			}
+			scan(b, iter)
+		}
+	})
+}
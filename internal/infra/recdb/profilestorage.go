@@ -0,0 +1,865 @@
+package recdb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// The profiles stored in RECDB files.
+type storedProfile interface {
+	comparable
+	GetUserID() uint64
+	GetItems() []uint64
+}
+
+// Implements the part of the profile storages on top of a RECDB file that
+// doesn't depend on the type of the profiles. The database file is
+// complemented by the data of the delta storage.
+type profileStorage[P storedProfile] struct {
+	file         domain.RandomAccessFile
+	proto        Protocol
+	header       Header
+	deltaStorage domain.DeltaStorage
+	indexStorage domain.IndexStorage
+	// Optional inverted index of the items, which limits the similarity
+	// queries to the profiles sharing items.
+	itemIndexStorage domain.ItemIndexStorage
+	// Optional MinHash signatures of the profiles for the approximate
+	// similarity queries.
+	signatureStorage domain.SignatureStorage
+	// Returns the items the signature of the profile is computed of (all
+	// the items of the profile if nil).
+	signatureItems func(profile P) []uint64
+	// Returns an empty profile of the user.
+	newProfile func(user uint64) P
+	// Applies an item operation of the delta storage to the profile, which
+	// is nil if the user has no profile yet, and returns the result.
+	applyOp func(user uint64, profile P, op domain.DeltaItem) P
+	// The maximum number of the segments the database file is split into
+	// to be scanned concurrently by the similarity queries.
+	numSegments int
+	// The slots of the deleted entries the relocated profiles are written to.
+	freeList *freeList
+	// The size of the entries of the database file in bytes.
+	entriesSize int64
+}
+
+// Opens the storage working with an existing RECDB file, which must store
+// entries of the type. The file gets locked until the storage is closed.
+func (s *profileStorage[P]) open(entryType [8]byte) error {
+	_, err := s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = s.proto.ReadPrefix(s.file)
+	if err != nil {
+		return fmt.Errorf("failed to read RECDB prefix: %v", err)
+	}
+	_, err = s.proto.ReadHeader(&s.header, s.file)
+	if err != nil {
+		return err
+	}
+	if s.header.EntryType != entryType {
+		return fmt.Errorf("unexpected RECDB entry type '%s'", s.header.EntryType)
+	}
+	// The entries are read and written in the version of the file
+	s.proto, err = s.proto.ForVersion(s.header.Version)
+	if err != nil {
+		return err
+	}
+	if s.header.Locked != 0 {
+		return domain.NewCorruptedFileError()
+	}
+	err = s.proto.WriteLocked(true, s.file)
+	if err != nil {
+		return fmt.Errorf("failed to lock the file: %v", err)
+	}
+	s.header.Locked = 1
+	err = s.rebuildFreeList()
+	if err != nil {
+		return err
+	}
+	// The indexes are empty if they have just been created or reset
+	rebuildIndex := s.indexStorage.GetNumEntries() == 0
+	rebuildItemIndex := s.itemIndexStorage != nil && s.itemIndexStorage.GetNumItems() == 0
+	rebuildSignatures := s.signatureStorage != nil && s.signatureStorage.GetNumUsers() == 0
+	if (rebuildIndex || rebuildItemIndex || rebuildSignatures) && s.header.NumEntries > 0 {
+		return s.rebuildIndexes(rebuildIndex, rebuildItemIndex, rebuildSignatures)
+	}
+	return nil
+}
+
+// Fills the free list with the slots of the deleted entries of the database
+// file. The quarantined entries are kept intact for inspection.
+func (s *profileStorage[P]) rebuildFreeList() error {
+	const msg = "failed to rebuild free list: %v"
+	s.freeList = newFreeList()
+	size, err := s.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	s.entriesSize = size - int64(entriesOffset)
+	if s.header.NumEntries == 0 {
+		return nil
+	}
+	iter, err := newScanIterator(s.file, s.proto, &s.header)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if errors.Is(err, &domain.CorruptedEntryError{}) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		if entry.Deleted != 0 && entry.Data != nil {
+			s.freeList.Put(iter.GetPreviousOffset(), entry.Capacity)
+		}
+	}
+	return nil
+}
+
+// Returns the share of the database file taken by the deleted entries,
+// which can be reused by the relocated profiles. The quarantined entries
+// aren't counted.
+func (s *profileStorage[P]) GetFragmentation() float64 {
+	if s.entriesSize <= 0 {
+		return 0
+	}
+	return float64(s.freeList.GetFreeBytes()) / float64(s.entriesSize)
+}
+
+// Adds the offset of the profile's entry to the posting lists of its items.
+func addPostings[P storedProfile](postings map[uint64][]uint64, profile P, offset int64) {
+	for _, item := range profile.GetItems() {
+		postings[item] = append(postings[item], uint64(offset))
+	}
+}
+
+// Fills the index, the item index and/or the signature storage with the
+// entries of the database file.
+func (s *profileStorage[P]) rebuildIndexes(index bool, itemIndex bool, signatures bool) error {
+	const msg = "failed to rebuild indexes: %v"
+	iter, err := newScanIterator(s.file, s.proto, &s.header)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	defer iter.Close()
+	postings := make(map[uint64][]uint64)
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if errors.Is(err, &domain.CorruptedEntryError{}) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		profile, ok := entry.Data.(P)
+		if !ok || entry.Deleted != 0 {
+			continue
+		}
+		// The last entry of a user wins like in RebuildIndex()
+		if index {
+			err = s.indexStorage.Put(profile.GetUserID(), uint64(iter.GetPreviousOffset()))
+			if err != nil {
+				return fmt.Errorf(msg, err)
+			}
+		}
+		if itemIndex {
+			addPostings(postings, profile, iter.GetPreviousOffset())
+		}
+		if signatures {
+			err = s.updateSignature(profile.GetUserID(), profile)
+			if err != nil {
+				return fmt.Errorf(msg, err)
+			}
+		}
+	}
+	if index {
+		err = s.indexStorage.Sync()
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+	}
+	if itemIndex {
+		return s.itemIndexStorage.Reset(postings)
+	}
+	return nil
+}
+
+// Updates the signature of the user's profile, which is nil if the profile
+// has been deleted.
+func (s *profileStorage[P]) updateSignature(user uint64, profile P) error {
+	if s.signatureStorage == nil {
+		return nil
+	}
+	var none P
+	if profile == none {
+		return s.signatureStorage.Remove(user)
+	}
+	var items []uint64
+	if s.signatureItems != nil {
+		items = s.signatureItems(profile)
+	} else {
+		items = profile.GetItems()
+	}
+	if len(items) == 0 {
+		return s.signatureStorage.Remove(user)
+	}
+	signature := domain.ComputeMinHashSignature(items)
+	return s.signatureStorage.Put(user, &signature)
+}
+
+// Closes the storage file. The files not closed with this
+// function are considered broken and require recovery.
+func (s *profileStorage[P]) Close() error {
+	err := s.proto.WriteLocked(false, s.file)
+	if err != nil {
+		s.file.Close()
+		return fmt.Errorf("failed to unlock the file: %v", err)
+	}
+	return s.file.Close()
+}
+
+// Executes a set of tasks sequently reading and/or modifiying entries in
+// the corresponding database file.
+// The modifications are stored in the delta storage and acknowledged once the
+// storage commits them according to its durability, while the requests are
+// answered by the processRequests function after a single pass over the
+// database file. The type-specific modifications are converted into the delta
+// operations by the toDeltaOp function, which returns the error to answer the
+// action with instead if it cannot be applied (e.g. it's unknown).
+func (s *profileStorage[P]) processActions(
+	actions []domain.Action,
+	toDeltaOp func(action domain.Action) (domain.DeltaOp, uint64, uint64, error),
+	processRequests func(requests []domain.Action) error,
+) error {
+	requests := make([]domain.Action, 0, len(actions))
+	compactions := make([]domain.Action, 0)
+	// The modifications are acknowledged once they are durable
+	modifications := make([]domain.Action, 0, len(actions))
+	always := s.deltaStorage.GetDurability().IsAlways()
+	var commitErr error
+	for _, action := range actions {
+		switch action.ActionType {
+		case domain.ActionDeleteProfile:
+			payload := action.Payload.(domain.DeleteProfilePayload)
+			s.deltaStorage.Add(domain.DeltaOpDeleteProfile, payload.UserID, 0)
+			modifications = append(modifications, action)
+		case domain.ActionGetProfile,
+			domain.ActionGetSimilarProfiles,
+			domain.ActionRecommendItems:
+			requests = append(requests, action)
+		case domain.ActionCompact:
+			compactions = append(compactions, action)
+		default:
+			op, user, item, err := toDeltaOp(action)
+			if err != nil {
+				action.Error <- err
+				continue
+			}
+			s.deltaStorage.Add(op, user, item)
+			modifications = append(modifications, action)
+		}
+		if always && len(modifications) > 0 {
+			commitErr = s.commitDelta(modifications, commitErr)
+			modifications = modifications[:0]
+		}
+	}
+	if len(modifications) > 0 {
+		commitErr = s.commitDelta(modifications, commitErr)
+	}
+	if len(requests) > 0 {
+		if err := processRequests(requests); err != nil {
+			sendError(compactions, err)
+			return err
+		}
+	}
+	if len(compactions) > 0 {
+		err := s.Compact()
+		sendError(compactions, err)
+		if err != nil {
+			return err
+		}
+	}
+	return commitErr
+}
+
+// Makes the operations added to the delta storage durable and acknowledges
+// the modifications they came from. Returns the previous error if any.
+func (s *profileStorage[P]) commitDelta(modifications []domain.Action, prevErr error) error {
+	err := s.deltaStorage.Commit()
+	if err != nil {
+		err = fmt.Errorf("failed to commit delta: %w", err)
+	}
+	sendError(modifications, err)
+	if prevErr != nil {
+		return prevErr
+	}
+	return err
+}
+
+// Applies all the operations of the delta storage to the database file,
+// updates the index storage accordingly and resets the delta storage.
+// A live entry is never overwritten, since a torn write would destroy the
+// only copy of the profile. The changed profiles are written to new entries
+// instead: to the slots of the entries deleted before the compaction or to
+// the end of the file. A new entry of a profile always follows its old entry,
+// so the last live entry of a user in the file is the newest one. Once the new
+// entries and the index pointing to them are synced, the old entries are
+// marked deleted, which is a single byte write, and their slots are reused by
+// the next compactions. The delta is
+// reset only after that, so a compaction interrupted at any point is simply
+// redone: the delta operations give the same result when applied again.
+func (s *profileStorage[P]) Compact() error {
+	const msg = "failed to compact RECDB: %v"
+	deltaUsers := make(map[uint64]bool)
+	for _, user := range s.deltaStorage.GetUsers() {
+		deltaUsers[user] = false
+	}
+	if len(deltaUsers) == 0 {
+		return nil
+	}
+	// Rewrite the existing entries
+	_, err := s.file.Seek(int64(entriesOffset), io.SeekStart)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	var none P
+	relocated := make([]relocation[P], 0)
+	obsoleteOffsets := make([]int64, 0)
+	// The slots become free once the compaction is persisted
+	freedSlots := make([]freeSlot, 0)
+	postings := make(map[uint64][]uint64)
+	iter := newIterator(s.file, s.proto, &s.header)
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if errors.Is(err, &domain.CorruptedEntryError{}) {
+			// Quarantine the entry: it's marked deleted keeping its content
+			obsoleteOffsets = append(obsoleteOffsets, iter.GetPreviousOffset())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		if entry.Deleted != 0 {
+			continue
+		}
+		profile := entry.Data.(P)
+		user := profile.GetUserID()
+		offset := iter.GetPreviousOffset()
+		if _, hasDelta := deltaUsers[user]; !hasDelta {
+			err = s.indexStorage.Put(user, uint64(offset))
+			if err != nil {
+				return fmt.Errorf(msg, err)
+			}
+			addPostings(postings, profile, offset)
+			continue
+		}
+		deltaUsers[user] = true
+		profile = s.applyDelta(user, profile)
+		err = s.updateSignature(user, profile)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		obsoleteOffsets = append(obsoleteOffsets, offset)
+		freedSlots = append(freedSlots, freeSlot{offset, entry.Capacity})
+		if profile != none {
+			relocated = append(relocated, relocation[P]{profile, iter.GetNextOffset()})
+			continue
+		}
+		err = s.indexStorage.Remove(user)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+	}
+	for user, seen := range deltaUsers {
+		if seen {
+			continue
+		}
+		profile := s.applyDelta(user, none)
+		err = s.updateSignature(user, profile)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		if profile != none {
+			relocated = append(relocated, relocation[P]{profile, 0})
+		}
+	}
+	// Write the new and changed profiles to new entries
+	sort.Slice(relocated, func(i, j int) bool {
+		return relocated[i].profile.GetUserID() < relocated[j].profile.GetUserID()
+	})
+	appended := make([]P, 0, len(relocated))
+	for _, r := range relocated {
+		reused, err := s.writeToFreeSlot(r.profile, r.minOffset, postings)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+		if !reused {
+			appended = append(appended, r.profile)
+		}
+	}
+	err = s.appendProfiles(appended, iter.GetNextOffset(), postings)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	// The index must point to the new entries before the old ones are
+	// deleted, and it may write a checkpoint of the offsets, which must
+	// point to the persisted entries
+	err = s.indexStorage.Sync()
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	for _, offset := range obsoleteOffsets {
+		err = markEntryDeletedAt(s.file, offset)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+	}
+	// The database must be persisted before the delta is thrown away
+	err = helpers.Sync(s.file)
+	if err != nil {
+		return fmt.Errorf(msg, err)
+	}
+	for _, slot := range freedSlots {
+		s.freeList.Put(slot.offset, slot.capacity)
+	}
+	if s.itemIndexStorage != nil {
+		err = s.itemIndexStorage.Reset(postings)
+		if err != nil {
+			return fmt.Errorf(msg, err)
+		}
+	}
+	return s.deltaStorage.Reset()
+}
+
+// A profile to be written to a new entry by the compaction.
+type relocation[P any] struct {
+	profile P
+	// The new entry must be located at this offset or further, i.e. after
+	// the old entry of the profile if any.
+	minOffset int64
+}
+
+// Writes the profile to a slot of a deleted entry large enough to keep it
+// with the usual slack, which is located at the minimal offset or further,
+// and updates the index and the posting lists. Returns false if there is no
+// such slot.
+func (s *profileStorage[P]) writeToFreeSlot(
+	profile P,
+	minOffset int64,
+	postings map[uint64][]uint64,
+) (bool, error) {
+	entry := Entry{Data: profile}
+	capacity, err := s.proto.PredictEntryCapacity(&entry)
+	if err != nil {
+		return false, err
+	}
+	slot, ok := s.freeList.Take(capacity, minOffset)
+	if !ok {
+		return false, nil
+	}
+	_, err = s.file.Seek(slot.offset, io.SeekStart)
+	if err != nil {
+		return false, err
+	}
+	entry.Capacity = slot.capacity
+	writer := bufio.NewWriter(s.file)
+	_, err = s.proto.WriteEntry(&entry, writer)
+	if err != nil {
+		return false, err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return false, err
+	}
+	err = s.indexStorage.Put(profile.GetUserID(), uint64(slot.offset))
+	if err != nil {
+		return false, err
+	}
+	addPostings(postings, profile, slot.offset)
+	return true, nil
+}
+
+// Writes the profiles as new entries starting at the offset, which must be
+// the end of the entries, and updates the header, the index and the posting
+// lists.
+func (s *profileStorage[P]) appendProfiles(
+	profiles []P,
+	offset int64,
+	postings map[uint64][]uint64,
+) error {
+	_, err := s.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(s.file)
+	for _, profile := range profiles {
+		entry := Entry{Data: profile}
+		capacity, err := s.proto.PredictEntryCapacity(&entry)
+		if err != nil {
+			return err
+		}
+		entry.Capacity = uint32(capacity)
+		_, err = s.proto.WriteEntry(&entry, writer)
+		if err != nil {
+			return err
+		}
+		err = s.indexStorage.Put(profile.GetUserID(), uint64(offset))
+		if err != nil {
+			return err
+		}
+		addPostings(postings, profile, offset)
+		offset += int64(capacity)
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	err = s.file.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	s.entriesSize = offset - int64(entriesOffset)
+	s.header.NumEntries += uint32(len(profiles))
+	_, err = s.file.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = s.proto.WriteHeader(&s.header, s.file)
+	return err
+}
+
+// Sends the error to every action of the list.
+func sendError(actions []domain.Action, err error) {
+	for _, action := range actions {
+		action.Error <- err
+	}
+}
+
+// Returns the actual profile of the user or nil if there is no such profile.
+func (s *profileStorage[P]) readProfile(user uint64) (P, error) {
+	var profile P
+	if offset, ok := s.indexStorage.Get(user); ok {
+		entry, err := s.readEntryAt(int64(offset))
+		if err != nil {
+			return profile, fmt.Errorf("failed to read profile %d: %w", user, err)
+		}
+		if entry.Deleted == 0 && entry.Data.(P).GetUserID() == user {
+			profile = entry.Data.(P)
+		}
+	}
+	return s.applyDelta(user, profile), nil
+}
+
+// Reads the database entry located at the offset from the file beginning.
+func (s *profileStorage[P]) readEntryAt(offset int64) (*Entry, error) {
+	if offset < int64(entriesOffset) {
+		return nil, fmt.Errorf("invalid entry offset %d", offset)
+	}
+	_, err := s.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{}
+	_, err = s.proto.ReadEntry(entry, bufio.NewReader(s.file))
+	if err != nil {
+		return nil, err
+	}
+	// The quarantined entries have no data
+	if _, ok := entry.Data.(P); !ok && entry.Deleted == 0 {
+		return nil, fmt.Errorf("unexpected entry data type %s", reflect.TypeOf(entry.Data))
+	}
+	return entry, nil
+}
+
+// Reads the database entry located at the offset from the file beginning
+// without moving the file pointer, so the entries can be read concurrently.
+func (s *profileStorage[P]) readEntryFrom(reader io.ReaderAt, offset int64) (*Entry, error) {
+	if offset < int64(entriesOffset) {
+		return nil, fmt.Errorf("invalid entry offset %d", offset)
+	}
+	entry := &Entry{}
+	section := io.NewSectionReader(reader, offset, math.MaxInt64-offset)
+	_, err := s.proto.ReadEntry(entry, bufio.NewReader(section))
+	if err != nil {
+		return nil, err
+	}
+	// The quarantined entries have no data
+	if _, ok := entry.Data.(P); !ok && entry.Deleted == 0 {
+		return nil, fmt.Errorf("unexpected entry data type %s", reflect.TypeOf(entry.Data))
+	}
+	return entry, nil
+}
+
+// Applies the operations stored in the delta storage to the profile read
+// from the database. The profile may be nil if the user has no entry in the
+// database. Returns nil if the profile doesn't exist after applying the
+// operations.
+func (s *profileStorage[P]) applyDelta(user uint64, profile P) P {
+	var none P
+	for _, op := range s.deltaStorage.GetUserOps(user) {
+		if op.Op == domain.DeltaOpDeleteProfile {
+			profile = none
+			continue
+		}
+		profile = s.applyOp(user, profile, op)
+	}
+	return profile
+}
+
+// Passes every actual profile to the callback function. The profiles are
+// read from the database file sequentially and complemented by the delta
+// data. The profiles existing in the delta storage only are passed last.
+// The profiles read from the file are reused, so the callback must copy
+// the profiles it keeps.
+func (s *profileStorage[P]) scan(callback func(profile P)) error {
+	return s.scanSegments([]func(profile P){callback})
+}
+
+// Does the same as scan, but the database file is split into up to
+// len(callbacks) segments scanned concurrently, each segment passing the
+// profiles to its own callback. The profiles existing in the delta storage
+// only are passed to the first callback after all the segments are scanned.
+func (s *profileStorage[P]) scanSegments(callbacks []func(profile P)) error {
+	var none P
+	deltaUsers := make(map[uint64]bool)
+	for _, user := range s.deltaStorage.GetUsers() {
+		deltaUsers[user] = false
+	}
+	iter, err := newScanIterator(s.file, s.proto, &s.header)
+	if err != nil {
+		return fmt.Errorf("failed to scan RECDB: %v", err)
+	}
+	defer iter.Close()
+	segments, err := iter.Split(len(callbacks))
+	if err != nil {
+		return fmt.Errorf("failed to scan RECDB: %v", err)
+	}
+	// The segments don't write the map, but collect the users they've met
+	seenUsers := make([][]uint64, len(segments))
+	err = runSegments(len(segments), func(i int) error {
+		var err error
+		seenUsers[i], err = s.scanSegment(segments[i], deltaUsers, callbacks[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, users := range seenUsers {
+		for _, user := range users {
+			deltaUsers[user] = true
+		}
+	}
+	for user, seen := range deltaUsers {
+		if seen {
+			continue
+		}
+		if profile := s.applyDelta(user, none); profile != none {
+			callbacks[0](profile)
+		}
+	}
+	return nil
+}
+
+// Passes the actual profiles of the entries of the segment to the callback
+// function and returns the users of the delta storage it has met. The
+// corrupted entries are skipped.
+func (s *profileStorage[P]) scanSegment(
+	iter scanIterator,
+	deltaUsers map[uint64]bool,
+	callback func(profile P),
+) ([]uint64, error) {
+	var none P
+	seenUsers := make([]uint64, 0)
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if errors.Is(err, &domain.CorruptedEntryError{}) {
+			// The entry gets quarantined upon the next compaction
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan RECDB: %v", err)
+		}
+		if entry.Deleted != 0 {
+			continue
+		}
+		profile, ok := entry.Data.(P)
+		if !ok {
+			return nil, errors.New("failed to scan RECDB: unexpected entry data type")
+		}
+		if _, hasDelta := deltaUsers[profile.GetUserID()]; hasDelta {
+			seenUsers = append(seenUsers, profile.GetUserID())
+			profile = s.applyDelta(profile.GetUserID(), profile)
+		}
+		if profile != none {
+			callback(profile)
+		}
+	}
+	return seenUsers, nil
+}
+
+// Passes every actual profile that may share items with the given ones to
+// one of the callback functions. Without the item index all the profiles are
+// passed as by scanSegments. Otherwise, the entries found in the item index
+// are read first, split into up to len(callbacks) segments read concurrently
+// if the file allows reading at any offset, and the profiles changed in the
+// delta storage since the last compaction are passed to the first callback
+// last regardless of their items.
+func (s *profileStorage[P]) scanSharing(items []uint64, callbacks []func(profile P)) error {
+	if s.itemIndexStorage == nil {
+		return s.scanSegments(callbacks)
+	}
+	var none P
+	deltaUsers := make(map[uint64]bool)
+	for _, user := range s.deltaStorage.GetUsers() {
+		deltaUsers[user] = false
+	}
+	offsets := s.itemIndexStorage.GetOffsets(items)
+	readerAt, canReadAt := s.file.(io.ReaderAt)
+	// The reads moving the shared file pointer can't be concurrent
+	numSegments := 1
+	if canReadAt {
+		numSegments = len(callbacks)
+		if numSegments > len(offsets) {
+			numSegments = len(offsets)
+		}
+		if numSegments < 1 {
+			numSegments = 1
+		}
+	}
+	seenUsers := make([][]uint64, numSegments)
+	err := runSegments(numSegments, func(i int) error {
+		readEntry := s.readEntryAt
+		if numSegments > 1 {
+			readEntry = func(offset int64) (*Entry, error) {
+				return s.readEntryFrom(readerAt, offset)
+			}
+		}
+		first := i * len(offsets) / numSegments
+		last := (i + 1) * len(offsets) / numSegments
+		for _, offset := range offsets[first:last] {
+			entry, err := readEntry(int64(offset))
+			if errors.Is(err, &domain.CorruptedEntryError{}) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to scan RECDB: %v", err)
+			}
+			if entry.Deleted != 0 {
+				continue
+			}
+			profile := entry.Data.(P)
+			user := profile.GetUserID()
+			if _, hasDelta := deltaUsers[user]; hasDelta {
+				seenUsers[i] = append(seenUsers[i], user)
+				profile = s.applyDelta(user, profile)
+			}
+			if profile != none {
+				callbacks[i](profile)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, users := range seenUsers {
+		for _, user := range users {
+			deltaUsers[user] = true
+		}
+	}
+	for user, seen := range deltaUsers {
+		if seen {
+			continue
+		}
+		profile, err := s.readProfile(user)
+		if err != nil {
+			return fmt.Errorf("failed to scan RECDB: %v", err)
+		}
+		if profile != none {
+			callbacks[0](profile)
+		}
+	}
+	return nil
+}
+
+// Passes the actual profiles of the users to the callback function along
+// with the profiles changed in the delta storage since the last compaction.
+// Every profile is passed once.
+func (s *profileStorage[P]) scanUsers(users []uint64, callback func(profile P)) error {
+	var none P
+	seen := make(map[uint64]bool)
+	for _, list := range [][]uint64{users, s.deltaStorage.GetUsers()} {
+		for _, user := range list {
+			if seen[user] {
+				continue
+			}
+			seen[user] = true
+			profile, err := s.readProfile(user)
+			if err != nil {
+				return err
+			}
+			if profile != none {
+				callback(profile)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the number of the distinct items of the profiles. The item index
+// doesn't count the items added since the last compaction, but it saves
+// the extra pass over the database file.
+func (s *profileStorage[P]) countItems() (int, error) {
+	if s.itemIndexStorage != nil {
+		return s.itemIndexStorage.GetNumItems(), nil
+	}
+	items := make(map[uint64]struct{})
+	err := s.scan(func(profile P) {
+		for _, item := range profile.GetItems() {
+			items[item] = struct{}{}
+		}
+	})
+	return len(items), err
+}
+
+// Calls the function for each of the n segments concurrently and waits for
+// all the calls to return. Returns the error of the first failed segment.
+func runSegments(n int, process func(segment int) error) error {
+	if n == 1 {
+		return process(0)
+	}
+	errs := make([]error, n)
+	wg := sync.WaitGroup{}
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(segment int) {
+			defer wg.Done()
+			errs[segment] = process(segment)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
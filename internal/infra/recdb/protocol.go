@@ -2,23 +2,45 @@ package recdb
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"recengine/internal/domain"
 	"recengine/internal/helpers"
 	"reflect"
 )
 
-// Current database file format version.
-const Version byte = 1
+// Current database file format version. Version 1 stores the item IDs of
+// the like profiles as fixed 8-byte integers, while version 2 stores the
+// sorted lists as uvarint-encoded deltas. Version 3 adds a CRC32C checksum
+// to every entry.
+const Version byte = 3
+
+// The oldest database file format version that can still be read and written.
+const MinVersion byte = 1
 
 // The size in bytes, that occupies the header of the database file.
 const headerSize = 1 + 8 + 1 + 4
 
-// The size of the data in the entry that is stored before the EntryData.
+// The size of the data in the entry that is stored before the EntryData in
+// the versions having no checksums.
 const entryHeaderSize = 4 + 1
 
+// The size of the entry checksum stored after the entry header.
+const entryChecksumSize = 4
+
+// The first file format version storing the checksums of the entries.
+const checksumVersion byte = 3
+
+// The table of the CRC32C (Castagnoli) polynomial the entry checksums use.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// The offset of the "deleted" field from the beginning of the entry.
+const entryDeletedOffset = 4
+
 // The database file prefix (aka "Magic number").
 var prefix = [...]byte{'R', 'E', 'C', 'D', 'B'}
 
@@ -50,6 +72,23 @@ type Header struct {
 	NumEntries uint32
 }
 
+// Returns the size of the data stored before the EntryData in the file
+// format version.
+func getEntryHeaderSize(version byte) int {
+	if version >= checksumVersion {
+		return entryHeaderSize + entryChecksumSize
+	}
+	return entryHeaderSize
+}
+
+// Computes the checksum of the entry spanning the whole buffer. The checksum
+// covers the capacity and the data but not the "deleted" flag, so marking
+// an entry deleted stays a single byte write.
+func computeEntryChecksum(entry []byte) uint32 {
+	checksum := crc32.Checksum(entry[:entryDeletedOffset], checksumTable)
+	return crc32.Update(checksum, checksumTable, entry[entryHeaderSize+entryChecksumSize:])
+}
+
 // Database entry record.
 type Entry struct {
 	// Serialized entry's size including the size of this field itself.
@@ -64,28 +103,42 @@ type Entry struct {
 
 // Concrete protocol implementations (e.g. LikeProtocol) must implement this interface.
 type ConcreteProtocol interface {
-	// Reads entry data filling the `Entry.Data` struct.
-	// Returns the number of the bytes having read.
+	// Reads entry data of the file format version filling the `Entry.Data`
+	// struct. Returns the number of the bytes having read.
 	// The returned size can vary from 0 to `Entry.Capacity`.
-	ReadEntryData(*Entry, io.Reader) (int, error)
+	ReadEntryData(entry *Entry, version byte, reader io.Reader) (int, error)
 
-	// Writes entry data from the `Entry.Data` field into the stream.
-	// Returns the number of the bytes having read.
+	// Writes entry data from the `Entry.Data` field into the stream in the
+	// file format version. Returns the number of the bytes having read.
 	// The data length cannot be greater than `Entry.Capacity`.
-	WriteEntryData(*Entry, io.Writer) (int, error)
+	WriteEntryData(entry *Entry, version byte, writer io.Writer) (int, error)
+
+	// Decodes entry data of the file format version from the buffer, which
+	// spans the data up to `Entry.Capacity`. The `Entry.Data` struct and its
+	// slices are reused if they are of the type of the implementation.
+	// Returns the number of the bytes having decoded.
+	DecodeEntryData(entry *Entry, version byte, data []byte) (int, error)
 
 	// Returns the type code of the data stored in the `Entry.Data` field of
 	// entries of the database file type that is handled by this implementation.
 	GetEntryType() [8]byte
 
-	// Returns the minimum number of bytes it the entry will span after serialization.
-	PredictDataSize(data any) (int, error)
+	// Returns the minimum number of bytes it the entry will span after
+	// serialization in the file format version.
+	PredictDataSize(data any, version byte) (int, error)
 }
 
 // Provides recommendation DB file functions.
 // The protocol doesn't know about concrete implementation of Entry data.
 type Protocol interface {
-	// Initializes an empty database.
+	// Returns the protocol reading and writing the entries in the file format
+	// version or an error if the version isn't supported.
+	ForVersion(version byte) (Protocol, error)
+
+	// Returns the file format version the entries are read and written in.
+	GetVersion() byte
+
+	// Initializes an empty database of the protocol's version.
 	Create(writer io.Writer) error
 
 	// Writes database prefix, aka "Magic number", which verifies type of the file.
@@ -108,8 +161,16 @@ type Protocol interface {
 	// Reads a database entry. Returns number of bytes read.
 	// The last argument is a callback function that must read the type-specific
 	// Data field from the stream and return the number of bytes read.
+	// If the checksum of a live entry doesn't match, returns the capacity
+	// along with domain.CorruptedEntryError, so the entry can be skipped.
+	// The deleted entries having a wrong checksum are read with no data.
 	ReadEntry(entry *Entry, reader io.Reader) (int, error)
 
+	// Decodes a database entry from the beginning of the buffer reusing the
+	// data of the entry. Returns the capacity of the entry. The checksums
+	// are verified the same way as by ReadEntry.
+	DecodeEntry(entry *Entry, data []byte) (int, error)
+
 	// Writes the "locked" field of the file's header without changing file
 	// pointer position.
 	WriteLocked(locked bool, file io.WriteSeeker) error
@@ -129,32 +190,52 @@ type Protocol interface {
 // The protocol doesn't know about concrete implementation of Entry data.
 type protocol struct {
 	concreteProto ConcreteProtocol
+	version       byte
 }
 
 // Compile-time type check
 var _ = (Protocol)((*protocol)(nil))
 
 // Instantiates a new protocol functions implementation using a concrete
-// implementation of reading and writing entry data.
+// implementation of reading and writing entry data. The protocol works with
+// the current file format version.
 func NewProtocol(concreteProto ConcreteProtocol) Protocol {
 	return &protocol{
 		concreteProto: concreteProto,
+		version:       Version,
+	}
+}
+
+// Returns the protocol reading and writing the entries in the file format
+// version or an error if the version isn't supported.
+func (p *protocol) ForVersion(version byte) (Protocol, error) {
+	if version < MinVersion || version > Version {
+		return nil, fmt.Errorf("unsupported RECDB version %d", version)
 	}
+	return &protocol{
+		concreteProto: p.concreteProto,
+		version:       version,
+	}, nil
+}
+
+// Returns the file format version the entries are read and written in.
+func (p *protocol) GetVersion() byte {
+	return p.version
 }
 
-// Initializes an empty database.
+// Initializes an empty database of the protocol's version.
 func (p *protocol) Create(writer io.Writer) error {
 	bufWriter := bufio.NewWriter(writer)
 	_, err := p.WritePrefix(bufWriter)
 	if err != nil {
 		return err
 	}
-	header := Header{Version, p.concreteProto.GetEntryType(), 0, 0}
+	header := Header{p.version, p.concreteProto.GetEntryType(), 0, 0}
 	_, err = p.WriteHeader(&header, bufWriter)
 	if err != nil {
 		return err
 	}
-	return nil
+	return bufWriter.Flush()
 }
 
 // Tries to open the database file or create it if it doesn't exist yet.
@@ -238,6 +319,9 @@ func (p *protocol) ReadHeader(header *Header, reader io.Reader) (int, error) {
 // Data field into the stream and return the number of bytes written.
 func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) (int, error) {
 	const msg = "failed to write database entry: %w"
+	if p.version >= checksumVersion {
+		return p.writeEntryWithChecksum(entry, writer)
+	}
 	err := binary.Write(writer, binary.BigEndian, entry.Capacity)
 	if err != nil {
 		return 0, fmt.Errorf(msg, err)
@@ -247,7 +331,7 @@ func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) (int, error) {
 		return 0, fmt.Errorf(msg, err)
 	}
 	var dataLen int
-	dataLen, err = p.concreteProto.WriteEntryData(entry, writer)
+	dataLen, err = p.concreteProto.WriteEntryData(entry, p.version, writer)
 	if err != nil {
 		return 0, fmt.Errorf(msg, err)
 	}
@@ -261,11 +345,45 @@ func (p *protocol) WriteEntry(entry *Entry, writer io.Writer) (int, error) {
 	return int(entry.Capacity), nil
 }
 
+// Writes a database entry along with its checksum, which requires the whole
+// entry to be serialized into a buffer first.
+func (p *protocol) writeEntryWithChecksum(entry *Entry, writer io.Writer) (int, error) {
+	const msg = "failed to write database entry: %w"
+	headerSize := entryHeaderSize + entryChecksumSize
+	if int(entry.Capacity) < headerSize {
+		return 0, fmt.Errorf(msg, fmt.Errorf("invalid capacity %d", entry.Capacity))
+	}
+	buffer := bytes.NewBuffer(make([]byte, headerSize, entry.Capacity))
+	_, err := p.concreteProto.WriteEntryData(entry, p.version, buffer)
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	if buffer.Len() > int(entry.Capacity) {
+		return 0, fmt.Errorf(msg, fmt.Errorf("entry's capacity=%d is less than data len=%d",
+			entry.Capacity, buffer.Len()-headerSize))
+	}
+	data := buffer.Bytes()
+	data = append(data, make([]byte, int(entry.Capacity)-len(data))...)
+	binary.BigEndian.PutUint32(data, entry.Capacity)
+	data[entryDeletedOffset] = entry.Deleted
+	binary.BigEndian.PutUint32(data[entryHeaderSize:], computeEntryChecksum(data))
+	_, err = writer.Write(data)
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	return int(entry.Capacity), nil
+}
+
 // Reads a database entry. Returns number of bytes read.
 // The last argument is a callback function that must read the type-specific
 // Data field from the stream and return the number of bytes read.
+// If the checksum of a live entry doesn't match, returns the capacity along
+// with domain.CorruptedEntryError, so the entry can be skipped.
 func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
 	const msg = "failed to read database entry: %v"
+	if p.version >= checksumVersion {
+		return p.readEntryWithChecksum(entry, reader)
+	}
 	// Read Capacity
 	err := binary.Read(reader, binary.BigEndian, &entry.Capacity)
 	if err != nil {
@@ -280,7 +398,7 @@ func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
 	entry.Deleted = bytes[0]
 	// Read EntryDataLen
 	var dataLen int
-	dataLen, err = p.concreteProto.ReadEntryData(entry, reader)
+	dataLen, err = p.concreteProto.ReadEntryData(entry, p.version, reader)
 	if err != nil {
 		return 0, fmt.Errorf(msg, err)
 	}
@@ -293,6 +411,64 @@ func (p *protocol) ReadEntry(entry *Entry, reader io.Reader) (int, error) {
 	return int(entry.Capacity), nil
 }
 
+// Reads the whole entry having a checksum into a buffer and decodes it.
+// The data of the entry read from a stream is never reused.
+func (p *protocol) readEntryWithChecksum(entry *Entry, reader io.Reader) (int, error) {
+	const msg = "failed to read database entry: %w"
+	var header [entryHeaderSize + entryChecksumSize]byte
+	_, err := io.ReadFull(reader, header[:])
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	capacity := binary.BigEndian.Uint32(header[:])
+	if int(capacity) < len(header) {
+		return 0, fmt.Errorf(msg, fmt.Errorf("invalid capacity %d", capacity))
+	}
+	data := make([]byte, capacity)
+	copy(data, header[:])
+	_, err = io.ReadFull(reader, data[len(header):])
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	entry.Data = nil
+	return p.DecodeEntry(entry, data)
+}
+
+// Decodes a database entry from the beginning of the buffer reusing the data
+// of the entry. Returns the capacity of the entry. If the checksum of a live
+// entry doesn't match, returns the capacity along with
+// domain.CorruptedEntryError, so the entry can be skipped.
+func (p *protocol) DecodeEntry(entry *Entry, data []byte) (int, error) {
+	const msg = "failed to decode database entry: %w"
+	headerSize := getEntryHeaderSize(p.version)
+	if len(data) < headerSize {
+		return 0, fmt.Errorf(msg, io.ErrUnexpectedEOF)
+	}
+	entry.Capacity = binary.BigEndian.Uint32(data)
+	entry.Deleted = data[entryDeletedOffset]
+	if int(entry.Capacity) < headerSize || int(entry.Capacity) > len(data) {
+		return 0, fmt.Errorf(msg, fmt.Errorf("invalid capacity %d", entry.Capacity))
+	}
+	if p.version >= checksumVersion {
+		expected := binary.BigEndian.Uint32(data[entryHeaderSize:])
+		actual := computeEntryChecksum(data[:entry.Capacity])
+		if expected != actual && entry.Deleted != 0 {
+			// The data of the deleted entries doesn't matter
+			entry.Data = nil
+			return int(entry.Capacity), nil
+		}
+		if expected != actual {
+			err := domain.NewCorruptedEntryError(expected, actual)
+			return int(entry.Capacity), fmt.Errorf(msg, err)
+		}
+	}
+	_, err := p.concreteProto.DecodeEntryData(entry, p.version, data[headerSize:entry.Capacity])
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	return int(entry.Capacity), nil
+}
+
 // Writes the "locked" field of the file's header without changing file
 // pointer position.
 func (p *protocol) WriteLocked(locked bool, file io.WriteSeeker) error {
@@ -347,11 +523,11 @@ func (p *protocol) IsLocked(file io.ReadSeeker) (bool, error) {
 
 // Returns the minimum number of bytes it the entry will span after serialization.
 func (p *protocol) PredictEntrySize(entry *Entry) (int, error) {
-	size, err := p.concreteProto.PredictDataSize(entry.Data)
+	size, err := p.concreteProto.PredictDataSize(entry.Data, p.version)
 	if err != nil {
 		return 0, fmt.Errorf("cannot predict data size: %w", err)
 	}
-	return size + entryHeaderSize, nil
+	return size + getEntryHeaderSize(p.version), nil
 }
 
 // Returns the optimal capacity for the entry in bytes.
@@ -2,6 +2,7 @@ package recdb
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"recengine/internal/domain"
 	"recengine/internal/helpers"
@@ -96,71 +97,128 @@ func TestProtocolWriteEntry(t *testing.T) {
 	profile := domain.NewProfile(42)
 	profile.Likes = []uint64{7, 13}
 	profile.Dislikes = []uint64{33}
-	expected := []byte{
-		0, 0, 0, 50, // Capacity
-		0,                       // Deleted
-		0, 0, 0, 0, 0, 0, 0, 42, // user id
-		0, 0, 0, 2, // like count
-		0, 0, 0, 0, 0, 0, 0, 7, // like #1
-		0, 0, 0, 0, 0, 0, 0, 13, // like #2
-		0, 0, 0, 1, // dislike count
-		0, 0, 0, 0, 0, 0, 0, 33, // dislike #1
-		0, 0, 0, 0, 0, // reserve
-	}
-	entry := Entry{uint32(len(expected)), 0, profile}
-	buf := bytes.NewBuffer(nil)
-	proto := NewProtocol(NewLikeProtocol())
-	n, err := proto.WriteEntry(&entry, buf)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
-	}
-	if n != len(expected) {
-		t.Errorf("Write length expected %d, got %d", len(expected), n)
-		return
+	fixtures := []struct {
+		version  byte
+		expected []byte
+	}{
+		{1, []byte{
+			0, 0, 0, 50, // Capacity
+			0,                       // Deleted
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			0, 0, 0, 2, // like count
+			0, 0, 0, 0, 0, 0, 0, 7, // like #1
+			0, 0, 0, 0, 0, 0, 0, 13, // like #2
+			0, 0, 0, 1, // dislike count
+			0, 0, 0, 0, 0, 0, 0, 33, // dislike #1
+			0, 0, 0, 0, 0, // reserve
+		}},
+		{2, []byte{
+			0, 0, 0, 19, // Capacity
+			0,                       // Deleted
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			2,    // like count
+			7, 6, // like deltas
+			1,  // dislike count
+			33, // dislike delta
+			0,  // reserve
+		}},
+		{3, []byte{
+			0, 0, 0, 23, // Capacity
+			0,                      // Deleted
+			0x43, 0x40, 0xdc, 0x64, // Checksum
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			2,    // like count
+			7, 6, // like deltas
+			1,  // dislike count
+			33, // dislike delta
+			0,  // reserve
+		}},
 	}
-	if !reflect.DeepEqual(expected, buf.Bytes()) {
-		t.Errorf("Entry expected \n%v, got \n%v", expected, buf.Bytes())
-		return
+	for _, fixture := range fixtures {
+		entry := Entry{uint32(len(fixture.expected)), 0, profile}
+		buf := bytes.NewBuffer(nil)
+		proto, _ := NewProtocol(NewLikeProtocol()).ForVersion(fixture.version)
+		n, err := proto.WriteEntry(&entry, buf)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if n != len(fixture.expected) {
+			t.Errorf("Write length expected %d, got %d", len(fixture.expected), n)
+			return
+		}
+		if !reflect.DeepEqual(fixture.expected, buf.Bytes()) {
+			t.Errorf("Version %d entry expected \n%v, got \n%v",
+				fixture.version, fixture.expected, buf.Bytes())
+			return
+		}
 	}
 }
 
 func TestReadEntry(t *testing.T) {
-	data := []byte{
-		0, 0, 0, 50, // Capacity
-		0,                       // Deleted
-		0, 0, 0, 0, 0, 0, 0, 42, // user id
-		0, 0, 0, 2, // like count
-		0, 0, 0, 0, 0, 0, 0, 7, // like #1
-		0, 0, 0, 0, 0, 0, 0, 13, // like #2
-		0, 0, 0, 1, // dislike count
-		0, 0, 0, 0, 0, 0, 0, 33, // dislike #1
-		0, 0, 0, 0, 0, // reserve
-	}
 	profile := domain.NewProfile(42)
 	profile.Likes = []uint64{7, 13}
 	profile.Dislikes = []uint64{33}
-	expected := Entry{uint32(len(data)), 0, profile}
-	entry := Entry{}
-	reader := bytes.NewReader(append(data, 42))
-	proto := NewProtocol(NewLikeProtocol())
-	n, err := proto.ReadEntry(&entry, reader)
-	if err != nil {
-		t.Errorf("Got error: %v", err)
-		return
-	}
-	if n != len(data) {
-		t.Errorf("Read length expected %d, got %d", len(data), n)
-		return
-	}
-	pos, _ := reader.Seek(0, io.SeekCurrent)
-	if pos != int64(len(data)) {
-		t.Errorf("Position after read expected %d, got %d", len(data), pos)
-		return
+	fixtures := []struct {
+		version byte
+		data    []byte
+	}{
+		{1, []byte{
+			0, 0, 0, 50, // Capacity
+			0,                       // Deleted
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			0, 0, 0, 2, // like count
+			0, 0, 0, 0, 0, 0, 0, 7, // like #1
+			0, 0, 0, 0, 0, 0, 0, 13, // like #2
+			0, 0, 0, 1, // dislike count
+			0, 0, 0, 0, 0, 0, 0, 33, // dislike #1
+			0, 0, 0, 0, 0, // reserve
+		}},
+		{2, []byte{
+			0, 0, 0, 19, // Capacity
+			0,                       // Deleted
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			2,    // like count
+			7, 6, // like deltas
+			1,  // dislike count
+			33, // dislike delta
+			0,  // reserve
+		}},
+		{3, []byte{
+			0, 0, 0, 23, // Capacity
+			0,                      // Deleted
+			0x43, 0x40, 0xdc, 0x64, // Checksum
+			0, 0, 0, 0, 0, 0, 0, 42, // user id
+			2,    // like count
+			7, 6, // like deltas
+			1,  // dislike count
+			33, // dislike delta
+			0,  // reserve
+		}},
 	}
-	if !reflect.DeepEqual(expected, entry) {
-		t.Errorf("Header expected %v, got %v", expected, entry)
-		return
+	for _, fixture := range fixtures {
+		expected := Entry{uint32(len(fixture.data)), 0, profile}
+		entry := Entry{}
+		reader := bytes.NewReader(append(fixture.data, 42))
+		proto, _ := NewProtocol(NewLikeProtocol()).ForVersion(fixture.version)
+		n, err := proto.ReadEntry(&entry, reader)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if n != len(fixture.data) {
+			t.Errorf("Read length expected %d, got %d", len(fixture.data), n)
+			return
+		}
+		pos, _ := reader.Seek(0, io.SeekCurrent)
+		if pos != int64(len(fixture.data)) {
+			t.Errorf("Position after read expected %d, got %d", len(fixture.data), pos)
+			return
+		}
+		if !reflect.DeepEqual(expected, entry) {
+			t.Errorf("Version %d entry expected %v, got %v", fixture.version, expected, entry)
+			return
+		}
 	}
 }
 
@@ -249,3 +307,56 @@ func TestIsLocked(t *testing.T) {
 		}
 	})
 }
+
+func TestReadEntryChecksum(t *testing.T) {
+	proto := NewProtocol(NewLikeProtocol())
+	profile := domain.NewProfile(42)
+	profile.Likes = []uint64{7, 13}
+	// Returns the entry bytes having a broken like delta.
+	makeCorruptedEntry := func(deleted byte) []byte {
+		buf := bytes.NewBuffer(nil)
+		proto.WriteEntry(&Entry{30, deleted, profile}, buf)
+		data := buf.Bytes()
+		data[getEntryHeaderSize(Version)+8+1]++
+		return data
+	}
+
+	t.Run("should fail reading a corrupted entry", func(t *testing.T) {
+		data := makeCorruptedEntry(0)
+		entry := Entry{}
+		n, err := proto.ReadEntry(&entry, bytes.NewReader(data))
+		if !errors.Is(err, &domain.CorruptedEntryError{}) {
+			t.Fatalf("Expected CorruptedEntryError, got %v", err)
+		}
+		if n != len(data) {
+			t.Errorf("Read length expected %d, got %d", len(data), n)
+		}
+	})
+
+	t.Run("should read a corrupted deleted entry without data", func(t *testing.T) {
+		data := makeCorruptedEntry(1)
+		entry := Entry{}
+		n, err := proto.ReadEntry(&entry, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if n != len(data) || entry.Deleted != 1 || entry.Data != nil {
+			t.Errorf("Expected a deleted entry of %d bytes without data, got %v", len(data), entry)
+		}
+	})
+
+	t.Run("should ignore the deleted flag", func(t *testing.T) {
+		buf := bytes.NewBuffer(nil)
+		proto.WriteEntry(&Entry{30, 0, profile}, buf)
+		data := buf.Bytes()
+		data[entryDeletedOffset] = 1
+		entry := Entry{}
+		_, err := proto.ReadEntry(&entry, bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(entry.Data, profile) {
+			t.Errorf("Expected profile %v, got %v", profile, entry.Data)
+		}
+	})
+}
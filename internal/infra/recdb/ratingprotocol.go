@@ -0,0 +1,137 @@
+package recdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"recengine/internal/domain"
+	"reflect"
+)
+
+// The size of a serialized (item, score) pair.
+const ratingSize = 8 + 4
+
+// Numeric ("rating") implementation of IConcreteProtocol.
+type ratingProtocol struct{}
+
+// Compile-time type check
+var _ = (ConcreteProtocol)((*ratingProtocol)(nil))
+
+// Instantiates a RatingProtocol.
+func NewRatingProtocol() ConcreteProtocol {
+	return &ratingProtocol{}
+}
+
+// Reads entry data filling the `Entry.Data` struct. The rating entries are
+// encoded the same way in all the versions.
+// Returns the number of the bytes having read.
+// The returned size can vary from 0 to `Entry.Capacity`.
+func (p *ratingProtocol) ReadEntryData(entry *Entry, version byte, reader io.Reader) (int, error) {
+	// Read user ID
+	var userId uint64
+	err := binary.Read(reader, binary.BigEndian, &userId)
+	if err != nil {
+		return 0, err
+	}
+	// Read ratings
+	var numRatings uint32
+	err = binary.Read(reader, binary.BigEndian, &numRatings)
+	if err != nil {
+		return 0, err
+	}
+	// Check data integrity
+	size := 8 + 4 + int(numRatings)*ratingSize
+	if size > int(entry.Capacity)-getEntryHeaderSize(version) {
+		return 0, fmt.Errorf("entry's capacity=%d is less than data len=%d",
+			entry.Capacity, size)
+	}
+	buffer := make([]byte, int(numRatings)*ratingSize)
+	_, err = io.ReadFull(reader, buffer)
+	if err != nil {
+		return 0, err
+	}
+	ratings := make([]domain.ItemRating, numRatings)
+	for i := range ratings {
+		pair := buffer[i*ratingSize:]
+		ratings[i].ItemID = binary.BigEndian.Uint64(pair)
+		ratings[i].Score = math.Float32frombits(binary.BigEndian.Uint32(pair[8:]))
+	}
+	// Update entry.Data
+	entry.Data = &domain.RatingProfile{
+		UserID:  userId,
+		Ratings: ratings,
+	}
+	return size, nil
+}
+
+// Decodes entry data from the buffer, which spans the data up to
+// `Entry.Capacity`. The profile of the entry and its ratings are reused.
+// Returns the number of the bytes having decoded.
+func (p *ratingProtocol) DecodeEntryData(entry *Entry, version byte, data []byte) (int, error) {
+	profile, ok := entry.Data.(*domain.RatingProfile)
+	if !ok {
+		profile = domain.NewRatingProfile(0)
+		entry.Data = profile
+	}
+	if len(data) < 8+4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	profile.UserID = binary.BigEndian.Uint64(data)
+	numRatings := int(binary.BigEndian.Uint32(data[8:]))
+	if (len(data)-8-4)/ratingSize < numRatings {
+		return 0, fmt.Errorf("entry's capacity=%d is less than data len=%d",
+			entry.Capacity, 8+4+numRatings*ratingSize)
+	}
+	profile.Ratings = profile.Ratings[:0]
+	for i := 0; i < numRatings; i++ {
+		pair := data[8+4+i*ratingSize:]
+		profile.Ratings = append(profile.Ratings, domain.ItemRating{
+			ItemID: binary.BigEndian.Uint64(pair),
+			Score:  math.Float32frombits(binary.BigEndian.Uint32(pair[8:])),
+		})
+	}
+	return 8 + 4 + numRatings*ratingSize, nil
+}
+
+// Writes entry data from the `Entry.Data` field into the stream.
+// Returns the number of the bytes having read.
+// The data length cannot be greater than `Entry.Capacity`.
+func (p *ratingProtocol) WriteEntryData(entry *Entry, version byte, writer io.Writer) (int, error) {
+	// Get profile
+	profile, ok := entry.Data.(*domain.RatingProfile)
+	if !ok {
+		return 0, fmt.Errorf(
+			"entry's data type doesn't represent rating profile, got %s",
+			reflect.TypeOf(entry.Data).Name(),
+		)
+	}
+	size, err := p.PredictDataSize(profile, version)
+	if err != nil {
+		return 0, err
+	}
+	buffer := make([]byte, 0, size)
+	buffer = binary.BigEndian.AppendUint64(buffer, profile.UserID)
+	buffer = binary.BigEndian.AppendUint32(buffer, uint32(len(profile.Ratings)))
+	for _, rating := range profile.Ratings {
+		buffer = binary.BigEndian.AppendUint64(buffer, rating.ItemID)
+		buffer = binary.BigEndian.AppendUint32(buffer, math.Float32bits(rating.Score))
+	}
+	return writer.Write(buffer)
+}
+
+// Returns the type code of the data stored in the `Entry.Data` field of
+// entries of the database file type that is handled by this implementation.
+func (p *ratingProtocol) GetEntryType() [8]byte {
+	return [...]byte{'R', 'A', 'T', 'I', 'N', 'G', ' ', ' '}
+}
+
+// Returns the minimum number of bytes it the entry will span after serialization.
+func (p *ratingProtocol) PredictDataSize(data any, version byte) (int, error) {
+	profile, ok := data.(*domain.RatingProfile)
+	if !ok {
+		return 0, errors.New("unknown data type")
+	}
+	return 8 + 4 + len(profile.Ratings)*ratingSize, nil
+}
@@ -0,0 +1,78 @@
+package recdb
+
+import (
+	"bytes"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"reflect"
+	"testing"
+)
+
+func TestRatingProtocolReadEntryData(t *testing.T) {
+	proto := NewRatingProtocol()
+	profileData := []byte{
+		0, 0, 0, 0, 0, 0, 0, 42, // user id
+		0, 0, 0, 2, // rating count
+		0, 0, 0, 0, 0, 0, 0, 7, // item #1
+		0x40, 0x90, 0, 0, // score #1 (4.5)
+		0, 0, 0, 0, 0, 0, 0, 13, // item #2
+		0x3f, 0x80, 0, 0, // score #2 (1)
+	}
+	profile := domain.RatingProfile{
+		UserID:  42,
+		Ratings: []domain.ItemRating{{ItemID: 7, Score: 4.5}, {ItemID: 13, Score: 1}},
+	}
+
+	t.Run("should read a profile", func(t *testing.T) {
+		entry := &Entry{
+			Capacity: uint32(len(profileData) + getEntryHeaderSize(Version)),
+		}
+		n, err := proto.ReadEntryData(entry, Version, bytes.NewReader(profileData))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if n != len(profileData) {
+			t.Errorf("Read %d bytes, must be %d", n, len(profileData))
+			return
+		}
+		resultProfile, ok := entry.Data.(*domain.RatingProfile)
+		if !ok {
+			t.Errorf("Invalid Data type %s", reflect.TypeOf(entry.Data))
+			return
+		}
+		if !reflect.DeepEqual(*resultProfile, profile) {
+			t.Errorf("Expected profile to be %v, got %v", profile, *resultProfile)
+		}
+	})
+
+	t.Run("should fail reading profile data larger than available capacity", func(t *testing.T) {
+		entry := &Entry{
+			Capacity: uint32(len(profileData)),
+		}
+		_, err := proto.ReadEntryData(entry, Version, bytes.NewReader(profileData))
+		if err == nil {
+			t.Error("Expected an error")
+		}
+	})
+
+	t.Run("should write a profile", func(t *testing.T) {
+		buffer := helpers.NewFileBuffer(nil)
+		entry := Entry{
+			Capacity: uint32(len(profileData) + getEntryHeaderSize(Version)),
+			Data:     &profile,
+		}
+		n, err := proto.WriteEntryData(&entry, Version, buffer)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if n != len(profileData) {
+			t.Errorf("Expected written len to be %d, got %d", len(profileData), n)
+			return
+		}
+		if !reflect.DeepEqual(profileData, buffer.Bytes()) {
+			t.Errorf("Expected buffer to be %v, got %v", profileData, buffer.Bytes())
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package recdb
+
+import (
+	"fmt"
+	"recengine/internal/domain"
+	"recengine/internal/domain/valueobjects"
+)
+
+// Implements the rating profile storage on top of a RECDB file, which is
+// complemented by the data of the delta storage.
+type ratingStorage struct {
+	*profileStorage[*domain.RatingProfile]
+}
+
+// Compile-time type check
+var _ = (domain.ProfileStorage)((*ratingStorage)(nil))
+
+// A pending request for similar rating profiles or predicted ratings.
+type ratingSimilarityQuery struct {
+	action    domain.Action
+	profile   *domain.RatingProfile
+	metric    valueobjects.SimilarityMetric
+	limit     uint
+	collector *domain.SimilarRatingProfileCollector
+}
+
+// Returns new rating storage instance working with an existing RECDB file.
+// The file gets locked until the storage is closed.
+func newRatingStorage(
+	file domain.RandomAccessFile,
+	proto Protocol,
+	deltaStorage domain.DeltaStorage,
+	indexStorage domain.IndexStorage,
+	itemIndexStorage domain.ItemIndexStorage,
+	signatureStorage domain.SignatureStorage,
+	numSegments int,
+) (domain.ProfileStorage, error) {
+	s := &ratingStorage{&profileStorage[*domain.RatingProfile]{
+		file:             file,
+		proto:            proto,
+		deltaStorage:     deltaStorage,
+		indexStorage:     indexStorage,
+		itemIndexStorage: itemIndexStorage,
+		signatureStorage: signatureStorage,
+		newProfile:       domain.NewRatingProfile,
+		numSegments:      numSegments,
+		applyOp:          applyRatingDeltaOp,
+	}}
+	if err := s.open(NewRatingProtocol().GetEntryType()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Executes a set of tasks sequently reading and/or modifiying entries in
+// the corresponding database file.
+// The modifications are stored in the delta storage, while the requests are
+// answered after a single pass over the database file.
+func (s *ratingStorage) ProcessActions(actions []domain.Action) error {
+	return s.processActions(actions, toRatingDeltaOp, s.processRequests)
+}
+
+// Converts the action modifying a rating profile to the delta operation.
+func toRatingDeltaOp(action domain.Action) (domain.DeltaOp, uint64, uint64, error) {
+	switch action.ActionType {
+	case domain.ActionRate:
+		payload := action.Payload.(domain.RatePayload)
+		return domain.MakeRateDeltaOp(payload.Score), payload.UserID, payload.ItemID, nil
+	case domain.ActionDeleteItem:
+		payload := action.Payload.(domain.DeleteItemPayload)
+		return domain.DeltaOpRemove, payload.UserID, payload.ItemID, nil
+	}
+	return 0, 0, 0, fmt.Errorf("unknown action %d", action.ActionType)
+}
+
+// Applies the item operation of the delta storage to the rating profile.
+func applyRatingDeltaOp(
+	user uint64,
+	profile *domain.RatingProfile,
+	op domain.DeltaItem,
+) *domain.RatingProfile {
+	switch {
+	case op.Op.IsRate():
+		if profile == nil {
+			profile = domain.NewRatingProfile(user)
+		}
+		profile.Rate(op.ItemID, op.Op.GetScore())
+	case op.Op == domain.DeltaOpRemove:
+		if profile != nil {
+			profile.RemoveItem(op.ItemID)
+		}
+	}
+	return profile
+}
+
+// Answers the actions that read the profiles. The modifications must have
+// been applied to the delta storage at this point.
+func (s *ratingStorage) processRequests(requests []domain.Action) error {
+	queries := make([]*ratingSimilarityQuery, 0, len(requests))
+	for i, action := range requests {
+		var user uint64
+		switch payload := action.Payload.(type) {
+		case domain.GetRatingProfilePayload:
+			user = payload.UserID
+		case domain.GetSimilarRatingProfilesPayload:
+			user = payload.UserID
+		case domain.PredictRatingsPayload:
+			user = payload.UserID
+		}
+		profile, err := s.readProfile(user)
+		if err != nil {
+			sendError(requests[i:], err)
+			return err
+		}
+		switch payload := action.Payload.(type) {
+		case domain.GetRatingProfilePayload:
+			payload.Profile <- profile
+		case domain.GetSimilarRatingProfilesPayload:
+			if profile == nil {
+				payload.Profiles <- &[]domain.SimilarRatingProfile{}
+				continue
+			}
+			queries = append(queries, &ratingSimilarityQuery{
+				action:    action,
+				profile:   profile,
+				metric:    payload.Metric,
+				limit:     payload.Limit,
+				collector: domain.NewSimilarRatingProfileCollector(payload.Limit),
+			})
+		case domain.PredictRatingsPayload:
+			if profile == nil {
+				payload.Items <- &[]domain.RecItem{}
+				continue
+			}
+			queries = append(queries, &ratingSimilarityQuery{
+				action:    action,
+				profile:   profile,
+				metric:    payload.Metric,
+				limit:     payload.MaxSimilarProfiles,
+				collector: domain.NewSimilarRatingProfileCollector(payload.MaxSimilarProfiles),
+			})
+		default:
+			action.Error <- fmt.Errorf("unexpected payload of action %d", action.ActionType)
+		}
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	items := make([]uint64, 0)
+	for _, query := range queries {
+		items = append(items, query.profile.GetItems()...)
+	}
+	segments := splitRatingSimilarityQueries(queries, s.numSegments)
+	callbacks := make([]func(profile *domain.RatingProfile), len(segments))
+	for i, segmentQueries := range segments {
+		callbacks[i] = evaluateRatingSimilarityQueries(segmentQueries)
+	}
+	err := s.scanSharing(items, callbacks)
+	mergeRatingSimilarityQueries(segments)
+	if err != nil {
+		for _, query := range queries {
+			query.action.Error <- err
+		}
+		return err
+	}
+	for _, query := range queries {
+		similarProfiles := query.collector.GetProfiles()
+		switch payload := query.action.Payload.(type) {
+		case domain.GetSimilarRatingProfilesPayload:
+			payload.Profiles <- &similarProfiles
+		case domain.PredictRatingsPayload:
+			items := domain.PredictRatings(query.profile, similarProfiles)
+			payload.Items <- &items
+		}
+	}
+	return nil
+}
+
+// Returns the queries for every scan segment. The segments other than the
+// first one get copies of the queries having their own collectors.
+func splitRatingSimilarityQueries(
+	queries []*ratingSimilarityQuery,
+	numSegments int,
+) [][]*ratingSimilarityQuery {
+	segments := make([][]*ratingSimilarityQuery, 0, numSegments)
+	segments = append(segments, queries)
+	for i := 1; i < numSegments; i++ {
+		segmentQueries := make([]*ratingSimilarityQuery, len(queries))
+		for j, query := range queries {
+			segmentQuery := *query
+			segmentQuery.collector = domain.NewSimilarRatingProfileCollector(query.limit)
+			segmentQueries[j] = &segmentQuery
+		}
+		segments = append(segments, segmentQueries)
+	}
+	return segments
+}
+
+// Merges the collectors of the segment queries into the ones of the first
+// segment.
+func mergeRatingSimilarityQueries(segments [][]*ratingSimilarityQuery) {
+	for _, segmentQueries := range segments[1:] {
+		for j, query := range segmentQueries {
+			segments[0][j].collector.Merge(query.collector)
+		}
+	}
+}
+
+// Returns the callback comparing a rating profile with the profiles of the
+// queries.
+func evaluateRatingSimilarityQueries(
+	queries []*ratingSimilarityQuery,
+) func(profile *domain.RatingProfile) {
+	return func(profile *domain.RatingProfile) {
+		for _, query := range queries {
+			if profile.UserID == query.profile.UserID {
+				continue
+			}
+			similarity := query.profile.ComputeSimilarity(profile, query.metric)
+			query.collector.Add(profile, similarity)
+		}
+	}
+}
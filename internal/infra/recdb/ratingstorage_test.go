@@ -0,0 +1,159 @@
+package recdb
+
+import (
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"reflect"
+	"testing"
+)
+
+// Processes ActionGetProfile of a rating profile and returns the result.
+func processTestGetRatingProfile(
+	storage domain.ProfileStorage,
+	user uint64,
+) (*domain.RatingProfile, error) {
+	errChan := make(chan error)
+	profileChan := make(chan *domain.RatingProfile)
+	action := domain.Action{
+		ActionType: domain.ActionGetProfile,
+		Error:      errChan,
+		Payload:    domain.GetRatingProfilePayload{UserID: user, Profile: profileChan},
+	}
+	go storage.ProcessActions([]domain.Action{action})
+	select {
+	case err := <-errChan:
+		return nil, err
+	case profile := <-profileChan:
+		return profile, nil
+	}
+}
+
+// Processes ActionRecommendItems of a rating storage and returns the result.
+func processTestPredictRatings(storage domain.ProfileStorage, user uint64) ([]domain.RecItem, error) {
+	errChan := make(chan error)
+	itemsChan := make(chan *[]domain.RecItem)
+	action := domain.Action{
+		ActionType: domain.ActionRecommendItems,
+		Error:      errChan,
+		Payload: domain.PredictRatingsPayload{
+			UserID:             user,
+			MaxSimilarProfiles: 10,
+			Items:              itemsChan,
+		},
+	}
+	go storage.ProcessActions([]domain.Action{action})
+	select {
+	case err := <-errChan:
+		return nil, err
+	case items := <-itemsChan:
+		return *items, nil
+	}
+}
+
+// Rates the items of the user with the scores.
+func rateTestItems(storage domain.ProfileStorage, user uint64, ratings ...domain.ItemRating) {
+	for _, rating := range ratings {
+		processTestWriteAction(storage, domain.ActionRate, domain.RatePayload{
+			UserID: user,
+			ItemID: rating.ItemID,
+			Score:  rating.Score,
+		})
+	}
+}
+
+func TestRatingStorage(t *testing.T) {
+	file := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	factory := NewRatingStorageFactory()
+	storage, err := factory.Open(file, deltaStorage, indexStorage, openTestItemIndex(t), nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	rateTestItems(storage, 1, domain.ItemRating{ItemID: 1, Score: 4}, domain.ItemRating{ItemID: 2, Score: 2})
+	rateTestItems(storage, 2, domain.ItemRating{ItemID: 1, Score: 5}, domain.ItemRating{ItemID: 2, Score: 1},
+		domain.ItemRating{ItemID: 3, Score: 4.5}, domain.ItemRating{ItemID: 4, Score: 1.5})
+	rateTestItems(storage, 3, domain.ItemRating{ItemID: 1, Score: 1}, domain.ItemRating{ItemID: 2, Score: 5},
+		domain.ItemRating{ItemID: 4, Score: 5})
+
+	t.Run("should apply the delta to the profile", func(t *testing.T) {
+		rateTestItems(storage, 4, domain.ItemRating{ItemID: 1, Score: 3}, domain.ItemRating{ItemID: 2, Score: 3})
+		rateTestItems(storage, 4, domain.ItemRating{ItemID: 1, Score: 4.7})
+		processTestWriteAction(storage, domain.ActionDeleteItem, domain.DeleteItemPayload{UserID: 4, ItemID: 2})
+		expected := &domain.RatingProfile{UserID: 4, Ratings: []domain.ItemRating{{ItemID: 1, Score: 4.7}}}
+		profile, err := processTestGetRatingProfile(storage, 4)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(profile, expected) {
+			t.Errorf("Expected profile %v, got %v", expected, profile)
+		}
+		processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 4})
+	})
+
+	t.Run("should predict the scores of the items rated by similar profiles", func(t *testing.T) {
+		items, err := processTestPredictRatings(storage, 1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(items) != 2 || items[0].ItemID != 3 || items[1].ItemID != 4 {
+			t.Errorf("Expected items 3 and 4, got %v", items)
+			return
+		}
+		if items[0].Relevance <= 3 || items[1].Relevance >= 3 {
+			t.Errorf("Expected item 3 to be predicted above the mean and 4 below, got %v", items)
+		}
+	})
+
+	t.Run("should keep the profiles after compaction and reopening", func(t *testing.T) {
+		expected := map[uint64]*domain.RatingProfile{}
+		for _, user := range []uint64{1, 2, 3, 4} {
+			expected[user], _ = processTestGetRatingProfile(storage, user)
+		}
+		if err := storage.Compact(); err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if err := storage.Close(); err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		newDeltaStorage, _ := openTestDeltaAndIndex(t)
+		storage, err = factory.Open(
+			helpers.NewFileBuffer(file.Bytes()),
+			newDeltaStorage,
+			indexStorage,
+			openTestItemIndex(t),
+			nil,
+		)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		for user, profile := range expected {
+			got, err := processTestGetRatingProfile(storage, user)
+			if err != nil {
+				t.Errorf("Got error: %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, profile) {
+				t.Errorf("Expected profile %v, got %v", profile, got)
+			}
+		}
+	})
+
+	storage.Close()
+}
+
+func TestRatingStorageFactoryOpen(t *testing.T) {
+	t.Run("should refuse to open a like database", func(t *testing.T) {
+		file := helpers.NewFileBuffer(mockLikeRecDbHeaderBytes(false, 0))
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		storage, err := NewRatingStorageFactory().Open(file, deltaStorage, indexStorage, nil, nil)
+		if err == nil {
+			storage.Close()
+			t.Error("Opened a like database without an error")
+		}
+	})
+}
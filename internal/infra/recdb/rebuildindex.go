@@ -0,0 +1,56 @@
+package recdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"recengine/internal/domain"
+)
+
+// Fills the empty index storage with the offsets of the live entries of the
+// unlocked database file. A compaction interrupted between relocating a
+// profile and marking its old entry deleted leaves two live entries of the
+// user, the newest (the last one in the file) of which is kept. Either one
+// is consistent with the delta, which isn't reset until the old entries are
+// marked deleted. Returns the number of the duplicate entries skipped.
+func RebuildIndex(
+	file io.ReadWriteSeeker,
+	proto Protocol,
+	indexStorage domain.IndexStorage,
+) (int, error) {
+	const msg = "failed to rebuild index: %v"
+	iter, err := NewIterator(file, proto)
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	offsets := make(map[uint64]int64)
+	duplicates := 0
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if errors.Is(err, &domain.CorruptedEntryError{}) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf(msg, err)
+		}
+		profile, ok := entry.Data.(interface{ GetUserID() uint64 })
+		if !ok || entry.Deleted != 0 {
+			continue
+		}
+		if _, ok := offsets[profile.GetUserID()]; ok {
+			duplicates++
+		}
+		offsets[profile.GetUserID()] = iter.GetPreviousOffset()
+	}
+	for user, offset := range offsets {
+		err = indexStorage.Put(user, uint64(offset))
+		if err != nil {
+			return 0, fmt.Errorf(msg, err)
+		}
+	}
+	err = indexStorage.Sync()
+	if err != nil {
+		return 0, fmt.Errorf(msg, err)
+	}
+	return duplicates, nil
+}
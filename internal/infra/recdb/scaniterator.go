@@ -0,0 +1,60 @@
+package recdb
+
+import "io"
+
+// The read-only iterator the scans of the whole database file go through.
+// Unlike Iterator, it may reuse the data of the entries between the calls.
+type scanIterator interface {
+	// Returns true if there is at least one entry that can be got by Next().
+	HasNext() bool
+
+	// Returns the current entry and iterates next. The entry and its data
+	// are only valid until the next call. A corrupted entry is skipped
+	// returning domain.CorruptedEntryError, so the iteration can go on.
+	Next() (*Entry, error)
+
+	// Returns the offset of the previously read entry from the beginning of
+	// the file.
+	GetPreviousOffset() int64
+
+	// Splits the remaining entries into at most n consecutive segments of
+	// about the same size, which can be iterated concurrently. The iterator
+	// must not be iterated after the split, but it must be closed after the
+	// segments have been iterated; the segments aren't closed themselves.
+	Split(n int) ([]scanIterator, error)
+
+	// Releases the resources held by the iterator.
+	Close() error
+}
+
+// Adapts the buffered iterator to scanIterator.
+type bufferedScanIterator struct {
+	*iterator
+}
+
+// Compile-time type check
+var _ = (scanIterator)((*bufferedScanIterator)(nil))
+
+// Creates the buffered iterator over the entries of a file whose header has
+// already been read.
+func newBufferedScanIterator(
+	file io.ReadWriteSeeker,
+	proto Protocol,
+	header *Header,
+) (scanIterator, error) {
+	_, err := file.Seek(int64(entriesOffset), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	return &bufferedScanIterator{newIterator(file, proto, header)}, nil
+}
+
+// The buffered iterator reads the file sequentially, so it's never split.
+func (iter *bufferedScanIterator) Split(n int) ([]scanIterator, error) {
+	return []scanIterator{iter}, nil
+}
+
+// The buffered iterator holds no resources.
+func (iter *bufferedScanIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package recdb
+
+import "io"
+
+// Creates the iterator over the entries of a file whose header has already
+// been read.
+func newScanIterator(file io.ReadWriteSeeker, proto Protocol, header *Header) (scanIterator, error) {
+	return newBufferedScanIterator(file, proto, header)
+}
@@ -0,0 +1,456 @@
+package recdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"runtime"
+	"strconv"
+)
+
+// Profile storage factory.
+type storageFactory struct {
+	proto Protocol
+	// The maximum number of the segments the database file is split into
+	// to be scanned concurrently.
+	numSegments int
+	// Instantiates the storage of the profile type the factory works with.
+	newStorage func(
+		file domain.RandomAccessFile,
+		proto Protocol,
+		deltaStorage domain.DeltaStorage,
+		indexStorage domain.IndexStorage,
+		itemIndexStorage domain.ItemIndexStorage,
+		signatureStorage domain.SignatureStorage,
+		numSegments int,
+	) (domain.ProfileStorage, error)
+}
+
+// Compile-time type check
+var _ = (domain.ProfileStorageFactory)((*storageFactory)(nil))
+
+// Instantiates a like storage factory.
+func NewStorageFactory() domain.ProfileStorageFactory {
+	return NewStorageFactoryForProtocol(NewProtocol(NewLikeProtocol()))
+}
+
+// Instantiates a like storage factory.
+func NewStorageFactoryForProtocol(proto Protocol) domain.ProfileStorageFactory {
+	return &storageFactory{
+		proto:       proto,
+		numSegments: getNumScanSegments(),
+		newStorage:  newLikeStorage,
+	}
+}
+
+// Instantiates a rating storage factory.
+func NewRatingStorageFactory() domain.ProfileStorageFactory {
+	return &storageFactory{
+		proto:       NewProtocol(NewRatingProtocol()),
+		numSegments: getNumScanSegments(),
+		newStorage:  newRatingStorage,
+	}
+}
+
+// Returns the number of the segments the scans are split into, which is set
+// by REC_SCAN_SEGMENTS and defaults to the number of the usable CPUs.
+func getNumScanSegments() int {
+	numSegments, err := strconv.Atoi(os.Getenv("REC_SCAN_SEGMENTS"))
+	if err != nil || numSegments < 1 {
+		numSegments = runtime.GOMAXPROCS(0)
+	}
+	return numSegments
+}
+
+// If the file is corrupted, recovers it making its data consistent.
+// All inconsistent data is skipped (removed).  The file is considered
+// corrupted if it's locked, which means it hasn't been closed properly.
+// The entries are recovered in place, so the offsets of the valid entries
+// stay unchanged. The entries whose data cannot be read are marked deleted,
+// the entries failing the checksum are quarantined (marked deleted keeping
+// the content) and the entries whose capacity is broken are cut off along
+// with the rest of the file. If a compaction has been interrupted leaving
+// two live entries of a user, the older one is marked deleted.
+func (f *storageFactory) Recover(file domain.RandomAccessFile) error {
+	_, err := f.recover(file)
+	return err
+}
+
+// Recovers the file (see Recover). Returns the offsets of the live entries
+// of the users whose older entries have been marked deleted.
+func (f *storageFactory) recover(file domain.RandomAccessFile) (map[uint64]int64, error) {
+	deduplicated := make(map[uint64]int64)
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return deduplicated, nil
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.proto.ReadPrefix(file)
+	if err != nil {
+		return nil, fmt.Errorf("not a RECDB file: %v", err)
+	}
+	header := Header{}
+	_, err = f.proto.ReadHeader(&header, file)
+	if err != nil {
+		// The file has been cut in the middle of the header
+		err = file.Truncate(0)
+		if err != nil {
+			return nil, err
+		}
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		return deduplicated, f.proto.Create(file)
+	}
+	proto, err := f.proto.ForVersion(header.Version)
+	if err != nil {
+		return nil, err
+	}
+	// Check the entries. A compaction writes the new entry of a profile
+	// after the old one, so the last live entry of a user is the newest.
+	liveOffsets := make(map[uint64]int64)
+	offset := int64(entriesOffset)
+	header.NumEntries = 0
+	for offset < size {
+		capacity, entry, err := recoverEntryAt(file, proto, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		if capacity == 0 {
+			err = file.Truncate(offset)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if profile, ok := entry.Data.(interface{ GetUserID() uint64 }); ok && entry.Deleted == 0 {
+			user := profile.GetUserID()
+			if prevOffset, ok := liveOffsets[user]; ok {
+				err = markEntryDeletedAt(file, prevOffset)
+				if err != nil {
+					return nil, err
+				}
+				deduplicated[user] = offset
+			}
+			liveOffsets[user] = offset
+		}
+		offset += capacity
+		header.NumEntries++
+	}
+	// Update the header
+	header.Locked = 0
+	_, err = file.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.proto.WriteHeader(&header, file)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	return deduplicated, err
+}
+
+// Checks the entry at the offset and marks it deleted if its data is broken.
+// Returns the capacity of the entry or zero if the capacity itself is broken,
+// and the entry as it has been read.
+func recoverEntryAt(
+	file domain.RandomAccessFile,
+	proto Protocol,
+	offset int64,
+	size int64,
+) (int64, *Entry, error) {
+	entry := &Entry{}
+	_, err := file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, entry, err
+	}
+	var capacity uint32
+	err = binary.Read(file, binary.BigEndian, &capacity)
+	headerSize := getEntryHeaderSize(proto.GetVersion())
+	if err != nil || int(capacity) < headerSize || offset+int64(capacity) > size {
+		return 0, entry, nil
+	}
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, entry, err
+	}
+	reader := bufio.NewReader(io.LimitReader(file, int64(capacity)))
+	_, err = proto.ReadEntry(entry, reader)
+	if err == nil && entry.Deleted <= 1 {
+		return int64(capacity), entry, nil
+	}
+	corrupted := errors.Is(err, &domain.CorruptedEntryError{})
+	entry.Deleted = 1
+	err = markEntryDeletedAt(file, offset)
+	if err != nil {
+		return 0, entry, err
+	}
+	// The entries failing the checksum are quarantined: they're marked
+	// deleted keeping the content, which is never decoded again
+	if corrupted {
+		return int64(capacity), entry, nil
+	}
+	// The data of the other broken entries is cleared, as it must be
+	// readable by any concrete protocol when filled with zeros.
+	_, err = helpers.WriteZeros(int(capacity)-headerSize, file)
+	if err != nil {
+		return 0, entry, err
+	}
+	return int64(capacity), entry, nil
+}
+
+// Sets the deleted flag of the entry located at the offset leaving the file
+// positioned right after the flag.
+func markEntryDeletedAt(file io.WriteSeeker, offset int64) error {
+	_, err := file.Seek(offset+entryDeletedOffset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte{1})
+	return err
+}
+
+// Rewrites the entries of the database file in the current file format
+// version into the empty destination file, filling the index storage with
+// their new offsets. The deleted entries are dropped. The file is recovered
+// first if it's corrupted. Returns false without writing anything if the file
+// is up to date.
+func (f *storageFactory) Upgrade(
+	src domain.RandomAccessFile,
+	dst domain.RandomAccessFile,
+	indexStorage domain.IndexStorage,
+) (bool, error) {
+	return f.rewrite(src, dst, indexStorage, false, "failed to upgrade RECDB file: %v")
+}
+
+// Rewrites the entries of the database file into the empty destination file
+// like Upgrade() does, even if the file is up to date. The deleted entries
+// are dropped, so the file isn't fragmented anymore.
+func (f *storageFactory) Rewrite(
+	src domain.RandomAccessFile,
+	dst domain.RandomAccessFile,
+	indexStorage domain.IndexStorage,
+) error {
+	_, err := f.rewrite(src, dst, indexStorage, true, "failed to rewrite RECDB file: %v")
+	return err
+}
+
+// Rewrites the live entries of the database file into the destination file.
+// Unless forced, returns false without writing anything if the file is up
+// to date.
+func (f *storageFactory) rewrite(
+	src domain.RandomAccessFile,
+	dst domain.RandomAccessFile,
+	indexStorage domain.IndexStorage,
+	force bool,
+	msg string,
+) (bool, error) {
+	locked, err := f.proto.IsLocked(src)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	if locked {
+		err = f.Recover(src)
+		if err != nil {
+			return false, fmt.Errorf("failed to recover: %v", err)
+		}
+	}
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	_, err = f.proto.ReadPrefix(src)
+	if err != nil {
+		return false, fmt.Errorf("not a RECDB file: %v", err)
+	}
+	header := Header{}
+	_, err = f.proto.ReadHeader(&header, src)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	if header.Version == Version && !force {
+		return false, nil
+	}
+	srcProto, err := f.proto.ForVersion(header.Version)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	writer := bufio.NewWriter(dst)
+	err = f.proto.Create(writer)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	newHeader := Header{Version, header.EntryType, 0, 0}
+	offset := int64(entriesOffset)
+	iter, err := newScanIterator(src, srcProto, &header)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	defer iter.Close()
+	for iter.HasNext() {
+		entry, err := iter.Next()
+		if err != nil {
+			return false, fmt.Errorf(msg, err)
+		}
+		profile, ok := entry.Data.(interface{ GetUserID() uint64 })
+		if !ok || entry.Deleted != 0 {
+			continue
+		}
+		newEntry := Entry{Data: entry.Data}
+		capacity, err := f.proto.PredictEntryCapacity(&newEntry)
+		if err != nil {
+			return false, fmt.Errorf(msg, err)
+		}
+		newEntry.Capacity = uint32(capacity)
+		_, err = f.proto.WriteEntry(&newEntry, writer)
+		if err != nil {
+			return false, fmt.Errorf(msg, err)
+		}
+		err = indexStorage.Put(profile.GetUserID(), uint64(offset))
+		if err != nil {
+			return false, fmt.Errorf(msg, err)
+		}
+		offset += int64(capacity)
+		newHeader.NumEntries++
+	}
+	err = writer.Flush()
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	_, err = dst.Seek(int64(len(prefix)), io.SeekStart)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	_, err = f.proto.WriteHeader(&newHeader, dst)
+	if err != nil {
+		return false, fmt.Errorf(msg, err)
+	}
+	return true, nil
+}
+
+// Fills the empty index storage with the offsets of the live entries of the
+// database file keeping the newest entry of every user. The file is recovered
+// first if it's corrupted. Returns the number of the duplicate entries left
+// by an interrupted compaction.
+func (f *storageFactory) RebuildIndex(
+	file domain.RandomAccessFile,
+	indexStorage domain.IndexStorage,
+) (int, error) {
+	locked, err := f.proto.IsLocked(file)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild index: %v", err)
+	}
+	if locked {
+		err = f.Recover(file)
+		if err != nil {
+			return 0, fmt.Errorf("failed to recover: %v", err)
+		}
+	}
+	return RebuildIndex(file, f.proto, indexStorage)
+}
+
+// Opens a storage file. If the file is empty, writes all necessary data.
+// Profile storage also depends on a corresponding delta, index, item index
+// and signature storage objects, but it doesn't close them automatically upon
+// closing itself. The item index and the signature storages are optional
+// (nil).
+func (f *storageFactory) Open(
+	file domain.RandomAccessFile,
+	deltaStorage domain.DeltaStorage,
+	indexStorage domain.IndexStorage,
+	itemIndexStorage domain.ItemIndexStorage,
+	signatureStorage domain.SignatureStorage,
+) (domain.ProfileStorage, error) {
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			return nil, fmt.Errorf("failed to lock RECDB file: %w", err)
+		}
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		err = f.proto.Create(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create RECDB file: %v", err)
+		}
+	}
+	return f.newStorage(
+		file,
+		f.proto,
+		deltaStorage,
+		indexStorage,
+		itemIndexStorage,
+		signatureStorage,
+		f.numSegments,
+	)
+}
+
+// Opens a storage file.  If the file is empty, writes all necessary
+// data. If the file is corrupted, tries to recover it first.
+// Profile storage also depends on a corresponding delta, index, item index
+// and signature storage objects, but it doesn't close them automatically upon
+// closing itself. The item index and the signature storages are optional
+// (nil).
+func (f *storageFactory) OpenMaybeRecover(
+	file domain.RandomAccessFile,
+	deltaStorage domain.DeltaStorage,
+	indexStorage domain.IndexStorage,
+	itemIndexStorage domain.ItemIndexStorage,
+	signatureStorage domain.SignatureStorage,
+) (domain.ProfileStorage, error) {
+	// The file must not be recovered while another process is writing it
+	if lockable, ok := file.(helpers.LockableFile); ok {
+		if err := helpers.LockFile(lockable); err != nil {
+			return nil, fmt.Errorf("failed to lock RECDB file: %w", err)
+		}
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		locked, err := f.proto.IsLocked(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if file is locked: %v", err)
+		}
+		if locked {
+			deduplicated, err := f.recover(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to recover: %v", err)
+			}
+			// The index may point to the old entries marked deleted, unless
+			// it's empty and gets rebuilt upon opening anyway
+			if indexStorage.GetNumEntries() > 0 {
+				for user, offset := range deduplicated {
+					err = indexStorage.Put(user, uint64(offset))
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+			// The recovery moves the entries, so the item index gets rebuilt
+			if itemIndexStorage != nil {
+				err = itemIndexStorage.Reset(make(map[uint64][]uint64))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return f.Open(file, deltaStorage, indexStorage, itemIndexStorage, signatureStorage)
+}
@@ -0,0 +1,367 @@
+package recdb
+
+import (
+	"bytes"
+	"errors"
+	"recengine/internal/domain"
+	"recengine/internal/helpers"
+	"recengine/internal/infra/delta"
+	"recengine/internal/infra/index"
+	"recengine/internal/infra/itemindex"
+	"recengine/internal/infra/minhash"
+	"reflect"
+	"testing"
+)
+
+// Opens empty delta and index storages for testing purposes.
+func openTestDeltaAndIndex(t *testing.T) (domain.DeltaStorage, domain.IndexStorage) {
+	deltaStorage, err := delta.NewStorageFactory().Open(helpers.NewFileBuffer(nil))
+	if err != nil {
+		t.Fatalf("Failed to open delta storage: %v", err)
+	}
+	indexStorage, err := index.NewStorageFactory().Open(helpers.NewFileBuffer(nil), nil)
+	if err != nil {
+		t.Fatalf("Failed to open index storage: %v", err)
+	}
+	return deltaStorage, indexStorage
+}
+
+// Opens an empty item index storage for testing purposes.
+func openTestItemIndex(t *testing.T) domain.ItemIndexStorage {
+	itemIndexStorage, err := itemindex.NewStorageFactory().Open(helpers.NewFileBuffer(nil), nil)
+	if err != nil {
+		t.Fatalf("Failed to open item index storage: %v", err)
+	}
+	return itemIndexStorage
+}
+
+// Opens an empty signature storage for testing purposes.
+func openTestSignatures(t *testing.T) domain.SignatureStorage {
+	signatureStorage, err := minhash.NewStorageFactory().Open(helpers.NewFileBuffer(nil), nil)
+	if err != nil {
+		t.Fatalf("Failed to open signature storage: %v", err)
+	}
+	return signatureStorage
+}
+
+func TestStorageFactoryOpen(t *testing.T) {
+	factory := NewStorageFactory()
+	proto := NewProtocol(NewLikeProtocol())
+
+	t.Run("should create a new file that is locked until closed", func(t *testing.T) {
+		file := helpers.NewFileBuffer(nil)
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		// New files are created in the current version
+		expected := mockLikeRecDbHeaderBytes(true, 0)
+		expected[len(prefix)] = Version
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+		storage.Close()
+		if locked, _ := proto.IsLocked(helpers.NewFileBuffer(file.Bytes())); locked {
+			t.Error("The file is locked after closed")
+		}
+	})
+
+	t.Run("should open an existing file", func(t *testing.T) {
+		data := append(mockLikeRecDbHeaderBytes(false, 1), mockLikeRecDbEntryBytes(false)...)
+		file := helpers.NewFileBuffer(data)
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		defer storage.Close()
+		if locked, _ := proto.IsLocked(file); !locked {
+			t.Error("The file is not locked")
+		}
+	})
+
+	t.Run("should rebuild the empty index from the file", func(t *testing.T) {
+		data := append(mockLikeRecDbHeaderBytes(false, 1), mockLikeRecDbEntryBytes(false)...)
+		file := helpers.NewFileBuffer(data)
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer storage.Close()
+		if offset, ok := indexStorage.Get(42); !ok || offset != uint64(entriesOffset) {
+			t.Errorf("Expected offset %d, got %d (%v)", entriesOffset, offset, ok)
+		}
+	})
+
+	t.Run("should fail opening a locked file", func(t *testing.T) {
+		file := helpers.NewFileBuffer(mockLikeRecDbHeaderBytes(true, 0))
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+		if err == nil {
+			storage.Close()
+			t.Error("Opened a locked file without an error")
+			return
+		}
+		if !errors.Is(err, &domain.CorruptedFileError{}) {
+			t.Errorf("Expected CorruptedFileError, got %v", err)
+		}
+	})
+}
+
+func TestStorageFactoryRecover(t *testing.T) {
+	factory := NewStorageFactory()
+
+	t.Run("should mark broken entries deleted and cut off broken tail", func(t *testing.T) {
+		validEntry := mockLikeRecDbEntryBytes(false)
+		otherEntry := mockLikeRecDbEntryBytes(false)
+		otherEntry[entryHeaderSize+7] = 43 // user id
+		brokenEntry := mockLikeRecDbEntryBytes(false)
+		brokenEntry[5+8+3] = 200 // like count exceeding the capacity
+		recoveredEntry := make([]byte, len(brokenEntry))
+		copy(recoveredEntry, brokenEntry[:4])
+		recoveredEntry[4] = 1 // Deleted
+		tornEntry := mockLikeRecDbEntryBytes(false)[:20]
+		data := append(mockLikeRecDbHeaderBytes(true, 1), validEntry...)
+		data = append(data, brokenEntry...)
+		data = append(data, otherEntry...)
+		data = append(data, tornEntry...)
+		expected := append(mockLikeRecDbHeaderBytes(false, 3), validEntry...)
+		expected = append(expected, recoveredEntry...)
+		expected = append(expected, otherEntry...)
+		file := helpers.NewFileBuffer(data)
+		err := factory.Recover(file)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+
+	t.Run("should quarantine entries failing the checksum", func(t *testing.T) {
+		proto := NewProtocol(NewLikeProtocol())
+		buf := bytes.NewBuffer(mockLikeRecDbHeaderBytes(true, 2))
+		buf.Bytes()[len(prefix)] = Version
+		entry := mockLikeRecDbEntry(false)
+		proto.WriteEntry(entry, buf)
+		proto.WriteEntry(entry, buf)
+		data := buf.Bytes()
+		entrySize := len(data) - entriesOffset
+		corruptedOffset := entriesOffset + entrySize/2
+		data[corruptedOffset+getEntryHeaderSize(Version)+8+1]++
+		expected := append([]byte{}, data...)
+		expected[lockedOffset] = 0
+		expected[corruptedOffset+entryDeletedOffset] = 1
+		file := helpers.NewFileBuffer(data)
+		err := factory.Recover(file)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+
+	t.Run("should mark older live entries of the same user deleted", func(t *testing.T) {
+		data := append(mockLikeRecDbHeaderBytes(true, 3), mockLikeRecDbEntryBytes(false)...)
+		data = append(data, mockLikeRecDbEntryBytes(false)...)
+		data = append(data, mockLikeRecDbEntryBytes(false)...)
+		expected := append(mockLikeRecDbHeaderBytes(false, 3), mockLikeRecDbEntryBytes(true)...)
+		expected = append(expected, mockLikeRecDbEntryBytes(true)...)
+		expected = append(expected, mockLikeRecDbEntryBytes(false)...)
+		file := helpers.NewFileBuffer(data)
+		err := factory.Recover(file)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+
+	t.Run("should recreate a file with broken header", func(t *testing.T) {
+		file := helpers.NewFileBuffer(mockLikeRecDbHeaderBytes(true, 1)[:10])
+		err := factory.Recover(file)
+		if err != nil {
+			t.Errorf("Got error: %v", err)
+			return
+		}
+		expected := mockLikeRecDbHeaderBytes(false, 0)
+		expected[len(prefix)] = Version
+		if !reflect.DeepEqual(file.Bytes(), expected) {
+			t.Errorf("Expected data \n%v, got \n%v", expected, file.Bytes())
+		}
+	})
+}
+
+func TestStorageFactoryOpenMaybeRecover(t *testing.T) {
+	factory := NewStorageFactory()
+	data := append(mockLikeRecDbHeaderBytes(true, 0), mockLikeRecDbEntryBytes(false)...)
+	file := helpers.NewFileBuffer(data)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	indexStorage.Put(42, uint64(entriesOffset))
+	itemIndexStorage := openTestItemIndex(t)
+	itemIndexStorage.Reset(map[uint64][]uint64{7: {1000}})
+	storage, err := factory.OpenMaybeRecover(file, deltaStorage, indexStorage, itemIndexStorage, nil)
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	defer storage.Close()
+	profile, err := processTestGetProfile(storage, 42)
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+		return
+	}
+	if !reflect.DeepEqual(profile, mockLikeRecDbEntry(false).Data) {
+		t.Errorf("Expected profile %v, got %v", mockLikeRecDbEntry(false).Data, profile)
+	}
+	offsets := itemIndexStorage.GetOffsets([]uint64{7, 33})
+	if !reflect.DeepEqual(offsets, []uint64{uint64(entriesOffset)}) {
+		t.Errorf("Expected the item index to be rebuilt, got offsets %v", offsets)
+	}
+
+	t.Run("should point the index to the newest of duplicated entries", func(t *testing.T) {
+		entrySize := len(mockLikeRecDbEntryBytes(false))
+		data := append(mockLikeRecDbHeaderBytes(true, 2), mockLikeRecDbEntryBytes(false)...)
+		data = append(data, mockLikeRecDbEntryBytes(false)...)
+		file := helpers.NewFileBuffer(data)
+		deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+		indexStorage.Put(42, uint64(entriesOffset))
+		storage, err := factory.OpenMaybeRecover(file, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer storage.Close()
+		if offset, ok := indexStorage.Get(42); !ok || offset != uint64(entriesOffset+entrySize) {
+			t.Errorf("Expected offset %d, got %d (%v)", entriesOffset+entrySize, offset, ok)
+		}
+		if storage.GetFragmentation() == 0 {
+			t.Errorf("Expected the old entry to be marked deleted")
+		}
+	})
+}
+
+func TestStorageFactoryUpgrade(t *testing.T) {
+	factory := NewStorageFactory()
+	data := append(mockLikeRecDbHeaderBytes(false, 3), mockLikeRecDbEntryBytes(true)...)
+	data = append(data, mockLikeRecDbEntryBytes(false)...)
+	data = append(data, mockLikeRecDbEntryBytes(false)...)
+	// The last entry belongs to another user
+	data[len(data)-len(mockLikeRecDbEntryBytes(false))+entryHeaderSize+7] = 43
+
+	t.Run("should rewrite version 1 file in the current version", func(t *testing.T) {
+		dst := helpers.NewFileBuffer(nil)
+		_, indexStorage := openTestDeltaAndIndex(t)
+		upgraded, err := factory.Upgrade(helpers.NewFileBuffer(data), dst, indexStorage)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if !upgraded {
+			t.Fatal("Expected the file to be upgraded")
+		}
+		if dst.Bytes()[len(prefix)] != Version {
+			t.Errorf("Expected version %d, got %d", Version, dst.Bytes()[len(prefix)])
+		}
+		deltaStorage, _ := openTestDeltaAndIndex(t)
+		storage, err := factory.Open(dst, deltaStorage, indexStorage, nil, nil)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		defer storage.Close()
+		for _, user := range []uint64{42, 43} {
+			expected := mockLikeRecDbEntry(false).Data.(*domain.Profile)
+			expected.UserID = user
+			profile, err := processTestGetProfile(storage, user)
+			if err != nil {
+				t.Fatalf("Got error: %v", err)
+			}
+			if !reflect.DeepEqual(profile, expected) {
+				t.Errorf("Expected profile %v, got %v", expected, profile)
+			}
+		}
+	})
+
+	t.Run("should leave the current version file intact", func(t *testing.T) {
+		src := helpers.NewFileBuffer(nil)
+		NewProtocol(NewLikeProtocol()).Create(src)
+		dst := helpers.NewFileBuffer(nil)
+		_, indexStorage := openTestDeltaAndIndex(t)
+		upgraded, err := factory.Upgrade(src, dst, indexStorage)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if upgraded || dst.Len() != 0 {
+			t.Error("Expected the file not to be upgraded")
+		}
+	})
+}
+
+func TestStorageFactoryRewrite(t *testing.T) {
+	factory := NewStorageFactory()
+	file := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage := openTestDeltaAndIndex(t)
+	storage, err := factory.Open(file, deltaStorage, indexStorage, nil, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 1, ItemID: 1})
+	processTestWriteAction(storage, domain.ActionLike, domain.LikePayload{UserID: 2, ItemID: 2})
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	processTestWriteAction(storage, domain.ActionDeleteProfile, domain.DeleteProfilePayload{UserID: 1})
+	if err = storage.Compact(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if err = storage.Close(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	src := helpers.NewFileBuffer(file.Bytes())
+	dst := helpers.NewFileBuffer(nil)
+	deltaStorage, indexStorage = openTestDeltaAndIndex(t)
+	if err := factory.Rewrite(src, dst, indexStorage); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	storage, err = factory.Open(dst, deltaStorage, indexStorage, nil, nil)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	defer storage.Close()
+	if dst.Len() >= src.Len() || storage.GetFragmentation() != 0 {
+		t.Errorf("Expected the deleted entry to be dropped, got fragmentation %f", storage.GetFragmentation())
+	}
+	profile, err := processTestGetProfile(storage, 2)
+	if err != nil || profile == nil || !reflect.DeepEqual(profile.Likes, []uint64{2}) {
+		t.Errorf("Unexpected profile %v, error %v", profile, err)
+	}
+}
+
+func TestStorageFactoryRebuildIndex(t *testing.T) {
+	entrySize := len(mockLikeRecDbEntryBytes(false))
+	data := append(mockLikeRecDbHeaderBytes(false, 4), mockLikeRecDbEntryBytes(false)...)
+	data = append(data, mockLikeRecDbEntryBytes(true)...)
+	data = append(data, mockLikeRecDbEntryBytes(false)...)
+	data = append(data, mockLikeRecDbEntryBytes(false)...)
+	// The last entry belongs to another user
+	data[len(data)-entrySize+entryHeaderSize+7] = 43
+	_, indexStorage := openTestDeltaAndIndex(t)
+	duplicates, err := NewStorageFactory().RebuildIndex(helpers.NewFileBuffer(data), indexStorage)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if duplicates != 1 || indexStorage.GetNumEntries() != 2 {
+		t.Errorf("Expected 2 indexes and 1 duplicate, got %d and %d", indexStorage.GetNumEntries(), duplicates)
+	}
+	expected := map[uint64]int{42: entriesOffset + 2*entrySize, 43: entriesOffset + 3*entrySize}
+	for user, offset := range expected {
+		if got, ok := indexStorage.Get(user); !ok || got != uint64(offset) {
+			t.Errorf("Expected user %d at offset %d, got %d (%v)", user, offset, got, ok)
+		}
+	}
+}
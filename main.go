@@ -2,25 +2,53 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"os"
+	"recengine/internal/api/router"
 	"recengine/internal/api/shard"
 	"recengine/internal/domain"
 	"recengine/internal/infra/delta"
 	"recengine/internal/infra/index"
+	"recengine/internal/infra/itemindex"
+	"recengine/internal/infra/minhash"
+	"recengine/internal/infra/recdb"
 
 	"github.com/joho/godotenv"
 )
 
+// Creates the namespace service working with the storages of the engine.
+func newNamespaceService(ctx context.Context) *domain.NamespaceService {
+	deltaStorageFactory := delta.NewStorageFactory()
+	likeStorageFactory := recdb.NewStorageFactory()
+	ratingStorageFactory := recdb.NewRatingStorageFactory()
+	indexStorageFactory := index.NewStorageFactory()
+	itemIndexStorageFactory := itemindex.NewStorageFactory()
+	signatureStorageFactory := minhash.NewStorageFactory()
+
+	return domain.NewNamespaceService(
+		ctx,
+		deltaStorageFactory,
+		likeStorageFactory,
+		ratingStorageFactory,
+		indexStorageFactory,
+		itemIndexStorageFactory,
+		signatureStorageFactory,
+	)
+}
+
 func runShard() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	deltaStorageFactory := delta.NewStorageFactory()
-	indexStorageFactory := index.NewStorageFactory()
-
-	nsService := domain.NewNamespaceService(ctx, deltaStorageFactory, indexStorageFactory)
+	nsService := newNamespaceService(ctx)
 	if err := nsService.LoadNamespaces(); err != nil {
-		log.Printf("Warning: couldn't load domains (first load?): %v\n", err)
+		// Running without the namespaces of a manifest that cannot be read
+		// would drop them upon the next save
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("Error loading namespaces: %v\n", err)
+		}
+		log.Printf("Warning: couldn't load namespaces (first load?): %v\n", err)
 	}
 	if err := nsService.Start(ctx); err != nil {
 		log.Fatalf("Error running namespace service: %v\n", err)
@@ -30,14 +58,65 @@ func runShard() {
 		Config:    shard.NewConfigFromEnv(nil),
 		NsService: nsService,
 	})
-	if err := app.Run(); err != nil {
+	err := app.Run()
+	nsService.Stop()
+	if err != nil {
 		log.Fatalf("Error running shard application: %v\n", err)
 	}
 }
 
+// Rewrites the database files of the namespaces in the current format
+// version. The shard must not be running.
+func runUpgrade() {
+	nsService := newNamespaceService(context.Background())
+	if err := nsService.LoadNamespaces(); err != nil {
+		log.Fatalf("Error loading namespaces: %v\n", err)
+	}
+	if err := nsService.UpgradeNamespaces(); err != nil {
+		log.Fatalf("Error upgrading namespaces: %v\n", err)
+	}
+}
+
+// Rebuilds the index files of the namespaces from their database files.
+// The shard must not be running.
+func runRebuildIndex() {
+	nsService := newNamespaceService(context.Background())
+	if err := nsService.LoadNamespaces(); err != nil {
+		log.Fatalf("Error loading namespaces: %v\n", err)
+	}
+	if err := nsService.RebuildIndexes(); err != nil {
+		log.Fatalf("Error rebuilding indexes: %v\n", err)
+	}
+}
+
+func runRouter() {
+	app, err := router.NewApplication(&router.ApplicationDto{
+		Config: router.NewConfigFromEnv(nil),
+	})
+	if err != nil {
+		log.Fatalf("Error creating router application: %v\n", err)
+	}
+	if err := app.Run(); err != nil {
+		log.Fatalf("Error running router application: %v\n", err)
+	}
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Fatalf("Error loading .env file: %v\n", err)
 	}
-	runShard()
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	switch command {
+	case "router":
+		runRouter()
+	case "upgrade":
+		runUpgrade()
+	case "rebuild-index":
+		runRebuildIndex()
+	default:
+		runShard()
+	}
 }